@@ -27,10 +27,34 @@ var (
 	// PruneAction is the annotation that defines if a Kubernetes resource should be garbage collected.
 	PruneAction = fmt.Sprintf("action.%s/prune", GroupVersion.Group)
 
+	// PruneAnnotation is the annotation that, when set to disabled, retains a Kubernetes resource
+	// in the cluster when its instance is pruned or the resource is no longer part of the instance.
+	PruneAnnotation = fmt.Sprintf("%s/prune", GroupVersion.Group)
+
 	// ForceAction is the annotation that defines if a Kubernetes resource should be recreated.
 	ForceAction = fmt.Sprintf("action.%s/force", GroupVersion.Group)
 
 	// IfNotPresentAction is the annotation that defines if a Kubernetes resource
 	// should be applied only if it doesn't exist on the cluster.
 	IfNotPresentAction = fmt.Sprintf("action.%s/one-off", GroupVersion.Group)
+
+	// WaitConditionAnnotation is the annotation that defines a JSONPath expression
+	// which must evaluate to a non-empty value for a Kubernetes resource to be considered ready.
+	WaitConditionAnnotation = fmt.Sprintf("%s/wait-condition", GroupVersion.Group)
+
+	// ApplyOrderAnnotation is the annotation that defines an integer by which the Kubernetes resources
+	// of an instance are ordered when applied, the resources with lower values are applied first.
+	ApplyOrderAnnotation = fmt.Sprintf("%s/apply-order", GroupVersion.Group)
+
+	// HookAnnotation is the annotation that marks a Kubernetes resource as a hook,
+	// applied and awaited before or after the other resources of an instance.
+	HookAnnotation = fmt.Sprintf("%s/hook", GroupVersion.Group)
+)
+
+const (
+	// HookPreApply is the hook annotation value of the resources applied before the instance resources.
+	HookPreApply = "pre-apply"
+
+	// HookPostApply is the hook annotation value of the resources applied after the instance resources.
+	HookPostApply = "post-apply"
 )
@@ -23,6 +23,12 @@ const (
 	// BundleName is the CUE path for the Timoni's bundle name.
 	BundleName Selector = "bundle.name"
 
+	// BundleCUEVersionSelector is the CUE path for the Timoni's bundle CUE version constraint.
+	BundleCUEVersionSelector Selector = "bundle.cueVersion"
+
+	// BundleOrderSelector is the CUE path for the Timoni's bundle namespaces apply order.
+	BundleOrderSelector Selector = "bundle.order"
+
 	// BundleInstancesSelector is the CUE path for the Timoni's bundle instances.
 	BundleInstancesSelector Selector = "bundle.instances"
 
@@ -38,13 +44,125 @@ const (
 	// BundleNamespaceSelector is the CUE path for the Timoni's bundle instance namespace.
 	BundleNamespaceSelector Selector = "namespace"
 
+	// BundleNamespaceOverridableSelector is the CUE path for the Timoni's bundle instance namespace override opt-out.
+	BundleNamespaceOverridableSelector Selector = "namespaceOverridable"
+
 	// BundleValuesSelector is the CUE path for the Timoni's bundle instance values.
 	BundleValuesSelector Selector = "values"
 
+	// BundleValuesFromSelector is the CUE path for the Timoni's bundle instance values inheritance.
+	BundleValuesFromSelector Selector = "valuesFrom"
+
+	// BundleDependsOnSelector is the CUE path for the Timoni's bundle instance dependencies.
+	BundleDependsOnSelector Selector = "dependsOn"
+
+	// BundleSecretRefsSelector is the CUE path for the Timoni's bundle instance secret references.
+	BundleSecretRefsSelector Selector = "secretRefs"
+
+	// BundleLabelsSelector is the CUE path for the Timoni's bundle instance labels.
+	BundleLabelsSelector Selector = "labels"
+
+	// BundleEnabledSelector is the CUE path for the Timoni's bundle instance enabled flag.
+	BundleEnabledSelector Selector = "enabled"
+
+	// BundleTimeoutSelector is the CUE path for the Timoni's bundle instance apply timeout.
+	BundleTimeoutSelector Selector = "timeout"
+
+	// BundleApplyRetriesSelector is the CUE path for the Timoni's bundle instance apply retries.
+	BundleApplyRetriesSelector Selector = "applyRetries"
+
+	// BundleDeletePolicySelector is the CUE path for the Timoni's bundle instance delete policy.
+	BundleDeletePolicySelector Selector = "deletePolicy"
+
+	// BundleWaitForSelector is the CUE path for the Timoni's bundle instance wait conditions.
+	BundleWaitForSelector Selector = "waitFor"
+
+	// BundleNamespaceMetadataSelector is the CUE path for the Timoni's bundle instance namespace metadata.
+	BundleNamespaceMetadataSelector Selector = "namespaceMetadata"
+
+	// BundleSensitiveSelector is the CUE path for the Timoni's bundle instance sensitive values.
+	BundleSensitiveSelector Selector = "sensitive"
+
+	// BundleConditionalValuesSelector is the CUE path for the Timoni's bundle instance conditional values.
+	BundleConditionalValuesSelector Selector = "conditionalValues"
+
+	// BundleForEachSelector is the CUE path for the Timoni's bundle instance templates.
+	BundleForEachSelector Selector = "bundle.forEach"
+
+	// BundleForEachParamsSelector is the CUE path for the parameters list of an instance template.
+	BundleForEachParamsSelector Selector = "params"
+
+	// BundleForEachTemplateSelector is the CUE path for the instance definition of an instance template.
+	BundleForEachTemplateSelector Selector = "#template"
+
+	// BundleForEachParamSelector is the CUE path for the parameters referenced by an instance template.
+	BundleForEachParamSelector Selector = "#param"
+
+	// BundleForEachNameSelector is the CUE path for the name of the instances generated by a template.
+	BundleForEachNameSelector Selector = "name"
+
 	// BundleNameLabelKey is the Kubernetes label key for tracking Timoni's bundle by name.
 	BundleNameLabelKey = "bundle.timoni.sh/name"
+
+	// BundleRevisionLabelKey is the Kubernetes label key for tracking Timoni's bundle revisions.
+	BundleRevisionLabelKey = "bundle.timoni.sh/revision"
+)
+
+const (
+	// DeletePolicyDelete removes all the instance objects from the cluster.
+	DeletePolicyDelete = "delete"
+
+	// DeletePolicyOrphan leaves all the instance objects in the cluster
+	// and only removes the instance storage.
+	DeletePolicyOrphan = "orphan"
+
+	// DeletePolicyKeepNamespace removes the instance objects from the cluster,
+	// except for the Namespace objects.
+	DeletePolicyKeepNamespace = "keep-namespace"
 )
 
+// WaitCondition defines a JSONPath expression evaluated against the instance
+// objects of a kind, after they are applied on the cluster.
+type WaitCondition struct {
+	// Kind of the objects the condition applies to.
+	Kind string `json:"kind"`
+
+	// Name restricts the condition to the object with this name,
+	// when empty the condition applies to all the objects of the kind.
+	Name string `json:"name,omitempty"`
+
+	// JSONPath is the expression evaluated against the live object,
+	// in the format 'status.field' or '{.status.field}'.
+	JSONPath string `json:"jsonPath"`
+
+	// Value is the expected result of the expression,
+	// when empty the condition is met if the result is not empty.
+	Value string `json:"value,omitempty"`
+}
+
+// String returns the condition in the format 'Kind[/name]:jsonPath[=value]'.
+func (c WaitCondition) String() string {
+	s := c.Kind
+	if c.Name != "" {
+		s += "/" + c.Name
+	}
+	s += ":" + c.JSONPath
+	if c.Value != "" {
+		s += "=" + c.Value
+	}
+	return s
+}
+
+// NamespaceMetadata defines the labels and annotations
+// set on the instance namespace when it's created by Timoni.
+type NamespaceMetadata struct {
+	// Labels set on the namespace, e.g. the pod security admission labels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations set on the namespace.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
 // BundleSchema defines the v1alpha1 CUE schema for Timoni's bundle API.
 // TODO: switch to go:embed when this is available https://github.com/cue-lang/cue/issues/607
 const BundleSchema = `
@@ -53,14 +171,48 @@ import "strings"
 #Bundle: {
 	apiVersion: string & =~"^v1alpha1$"
 	name:       string & =~"^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$" & strings.MaxRunes(63) & strings.MinRunes(1)
+	cueVersion?: string
+	order?: [...string & =~"^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$" & strings.MaxRunes(63) & strings.MinRunes(1)]
 	instances: [string & =~"^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$" & strings.MaxRunes(63) & strings.MinRunes(1)]: {
 		module: close({
-			url:     string & =~"^oci://.*$"
+			url:     string & =~"^(oci|file)://.*$"
 			version: *"latest" | string
 			digest?: string
 		})
 		namespace: string & =~"^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$" & strings.MaxRunes(63) & strings.MinRunes(1)
+		namespaceOverridable?: bool
 		values: {...}
+		valuesFrom?: string & =~"^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$" & strings.MaxRunes(63) & strings.MinRunes(1)
+		dependsOn?: [...string]
+		secretRefs?: [...string & =~"^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$" & strings.MaxRunes(253)]
+		labels?: [string]: string
+		enabled?: bool
+		timeout?: string
+		applyRetries?: int & >=0
+		deletePolicy?: "delete" | "orphan" | "keep-namespace"
+		waitFor?: [...close({
+			kind:     string & strings.MinRunes(1)
+			name?:    string
+			jsonPath: string & strings.MinRunes(1)
+			value?:   string
+		})]
+		namespaceMetadata?: close({
+			labels?: [string]: string
+			annotations?: [string]: string
+		})
+		sensitive?: [...string & strings.MinRunes(1)]
+		conditionalValues?: [...close({
+			when:   string & strings.MinRunes(1)
+			values: {...}
+		})]
+	}
+	forEach?: [string]: {
+		params: [...{...}]
+		#template: {
+			#param: {...}
+			name: string
+			...
+		}
 	}
 }
 
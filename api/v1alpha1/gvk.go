@@ -31,6 +31,10 @@ var (
 	// Secret type used to store the instance metadata and inventory.
 	InstanceStorageType = "timoni.sh/instance"
 
+	// RevisionStorageType is the name of the Kubernetes
+	// Secret type used to store the bundle instance revisions.
+	RevisionStorageType = "timoni.sh/revision"
+
 	// FieldManager is the name of the manager performing Kubernetes patch operations.
 	FieldManager = "timoni"
 )
@@ -28,9 +28,15 @@ const (
 	// ConfigValuesSelector is the CUE path for the Timoni's instance config.
 	ConfigValuesSelector Selector = "timoni.instance.config"
 
+	// InstanceObjectsSelector is the CUE path for the Kubernetes objects generated by the Timoni's instance.
+	InstanceObjectsSelector Selector = "timoni.instance.objects"
+
 	// ApplySelector is the CUE path for the Timoni's apply resource sets.
 	ApplySelector Selector = "timoni.apply"
 
+	// MinVersionSelector is the CUE path for the minimum Timoni version required by the module.
+	MinVersionSelector Selector = "timoni.minVersion"
+
 	// ValuesSelector is the CUE path for the Timoni's module values.
 	ValuesSelector Selector = "values"
 )
@@ -42,6 +48,7 @@ const InstanceSchema = `
 	instance: {...}
 	apply: [string]: [...]
 	kubeMinorVersion?: int
+	minVersion?: string
 }
 
 timoni: #Timoni
@@ -70,4 +77,23 @@ type Instance struct {
 	// Images contains the list of container image references.
 	// +optional
 	Images []string `json:"images,omitempty"`
+
+	// Digest is the SHA-256 digest of the last applied Kubernetes objects
+	// in the format 'sha256:<hex>'.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// Bundle is the name of the bundle that applied this instance.
+	// +optional
+	Bundle string `json:"bundle,omitempty"`
+
+	// DependsOn contains the names of the bundle instances
+	// that must be applied before this instance.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// DeletePolicy is the policy applied when the bundle instance is deleted,
+	// an empty value means all the instance objects are deleted.
+	// +optional
+	DeletePolicy string `json:"deletePolicy,omitempty"`
 }
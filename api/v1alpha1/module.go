@@ -20,6 +20,10 @@ package v1alpha1
 // denotes the latest stable version of a module.
 const LatestVersion = "latest"
 
+// LocalModulePrefix is the URL scheme of the modules
+// loaded from a local directory instead of a registry.
+const LocalModulePrefix = "file://"
+
 // ModuleReference contains the information necessary to locate
 // a module's OCI artifact in the registry.
 type ModuleReference struct {
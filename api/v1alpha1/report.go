@@ -0,0 +1,61 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// BuildReportKind is the kind of the report generated by the bundle build.
+const BuildReportKind = "BuildReport"
+
+// BuildReport holds the inventory of the Kubernetes objects
+// generated by the instances of a Bundle at build time.
+type BuildReport struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Bundle is the name of the Bundle.
+	Bundle string `json:"bundle"`
+
+	// Objects is the list of the Kubernetes objects generated
+	// by the Bundle's instances, in the order they are applied.
+	Objects []BuildReportObject `json:"objects"`
+}
+
+// BuildReportObject contains the information necessary to locate
+// a Kubernetes object and the instance that owns it.
+type BuildReportObject struct {
+	// ID is the object ID used in the instance inventory,
+	// in the format '<namespace>_<name>_<group>_<kind>'.
+	ID string `json:"id"`
+
+	// APIVersion is the API group and version of the object.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind is the kind of the object.
+	Kind string `json:"kind"`
+
+	// Name is the name of the object.
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the object, empty for cluster-scoped objects.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Instance is the name of the instance that generated the object.
+	Instance string `json:"instance"`
+
+	// InstanceNamespace is the namespace of the instance that generated the object.
+	InstanceNamespace string `json:"instanceNamespace"`
+}
@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -27,12 +28,40 @@ const (
 	// RuntimeKind is the name of the Timoni runtime CUE attributes.
 	RuntimeKind string = "runtime"
 
+	// ReadKind is the name of the Timoni read CUE attributes.
+	ReadKind string = "read"
+
+	// ReadFileType is the read attribute type for loading the content of local files.
+	ReadFileType string = "file"
+
+	// ExprKind is the name of the Timoni expression CUE attributes.
+	ExprKind string = "expr"
+
+	// MetaKind is the name of the Timoni build metadata CUE attributes.
+	MetaKind string = "meta"
+
+	// MetaTimestamp is the build metadata name of the bundle build timestamp.
+	MetaTimestamp string = "timestamp"
+
+	// MetaRevision is the build metadata name of the bundle Git revision.
+	MetaRevision string = "revision"
+
+	// MetaTimestampEnv is the environment variable that sets the build timestamp.
+	MetaTimestampEnv string = "TIMONI_TIMESTAMP"
+
+	// MetaRevisionEnv is the environment variable that sets the build revision.
+	MetaRevisionEnv string = "TIMONI_REVISION"
+
 	// RuntimeDefaultName is the name of the default Timoni runtime.
 	RuntimeDefaultName string = "_default"
 
 	// RuntimeDelimiter is the delimiter used in Timoni runtime CUE attributes.
 	RuntimeDelimiter string = ":"
 
+	// TransformDelimiter is the delimiter of the value transforms
+	// chained in Timoni runtime and read CUE attributes.
+	TransformDelimiter string = ","
+
 	// RuntimePIVersionSelector is the CUE path for the Timoni's runtime API version.
 	RuntimePIVersionSelector Selector = "runtime.apiVersion"
 
@@ -73,20 +102,26 @@ import "strings"
 type RuntimeAttribute struct {
 	Name string
 	Type string
+
+	// Transforms are the value transforms chained after the name,
+	// e.g. ['trim', 'lower'] for '@timoni(runtime:string:NAME,trim,lower)'.
+	Transforms []string
 }
 
 // NewRuntimeAttribute returns a RuntimeAttribute from the given CUE attribute.
 // If the CUE attribute doesn't match the expected format
-// '@timoni(runtime:[TYPE]:[NAME])', an error is returned.
+// '@timoni(runtime:[TYPE]:[NAME][,TRANSFORM...])', an error is returned.
 func NewRuntimeAttribute(key, body string) (*RuntimeAttribute, error) {
 	if !IsRuntimeAttribute(key, body) {
 		return nil, fmt.Errorf("invalid format, must be @timoni(%s%s[TYPE]%s[NAME])",
 			RuntimeKind, RuntimeDelimiter, RuntimeDelimiter)
 	}
-	parts := strings.Split(body, RuntimeDelimiter)
+	ref, transforms := SplitTransforms(body)
+	parts := strings.Split(ref, RuntimeDelimiter)
 	return &RuntimeAttribute{
-		Type: parts[1],
-		Name: parts[2],
+		Type:       parts[1],
+		Name:       parts[2],
+		Transforms: transforms,
 	}, nil
 }
 
@@ -97,7 +132,8 @@ func IsRuntimeAttribute(key, body string) bool {
 		return false
 	}
 
-	parts := strings.Split(body, RuntimeDelimiter)
+	ref, _ := SplitTransforms(body)
+	parts := strings.Split(ref, RuntimeDelimiter)
 	if len(parts) == 3 && parts[0] == RuntimeKind {
 		return true
 	}
@@ -105,6 +141,152 @@ func IsRuntimeAttribute(key, body string) bool {
 	return false
 }
 
+// ReadAttribute holds the type and path of the content read from disk.
+type ReadAttribute struct {
+	Type string
+	Path string
+
+	// Transforms are the value transforms chained after the path,
+	// e.g. ['trim', 'lower'] for '@timoni(read:file:name.txt,trim,lower)'.
+	Transforms []string
+}
+
+// NewReadAttribute returns a ReadAttribute from the given CUE attribute.
+// If the CUE attribute doesn't match the expected format
+// '@timoni(read:[TYPE]:[PATH][,TRANSFORM...])', an error is returned.
+// Paths that aren't valid CUE tokens, like '../tls.crt', or that contain commas, must be quoted.
+func NewReadAttribute(key, body string) (*ReadAttribute, error) {
+	if !IsReadAttribute(key, body) {
+		return nil, fmt.Errorf("invalid format, must be @timoni(%s%s[TYPE]%s[PATH])",
+			ReadKind, RuntimeDelimiter, RuntimeDelimiter)
+	}
+	ref, transforms := SplitTransforms(body)
+	parts := strings.SplitN(ref, RuntimeDelimiter, 3)
+	path := parts[2]
+	if p, err := strconv.Unquote(path); err == nil {
+		path = p
+	}
+	return &ReadAttribute{
+		Type:       parts[1],
+		Path:       path,
+		Transforms: transforms,
+	}, nil
+}
+
+// IsReadAttribute returns true if the given
+// CUE attribute matches the expected format.
+func IsReadAttribute(key, body string) bool {
+	if key != FieldManager {
+		return false
+	}
+
+	ref, _ := SplitTransforms(body)
+	parts := strings.SplitN(ref, RuntimeDelimiter, 3)
+	return len(parts) == 3 && parts[0] == ReadKind && parts[2] != ""
+}
+
+// SplitTransforms splits the body of a runtime or read attribute into the value
+// reference and the chained transforms, e.g. 'read:file:name.txt,trim,lower' is split
+// into 'read:file:name.txt' and ['trim', 'lower']. Delimiters in quoted strings are ignored.
+func SplitTransforms(body string) (string, []string) {
+	var parts []string
+	quoted, escaped, last := false, false, 0
+	for i, c := range body {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && string(c) == TransformDelimiter:
+			parts = append(parts, body[last:i])
+			last = i + 1
+		}
+	}
+	parts = append(parts, body[last:])
+
+	ref := parts[0]
+	var transforms []string
+	for _, t := range parts[1:] {
+		transforms = append(transforms, strings.TrimSpace(t))
+	}
+	return ref, transforms
+}
+
+// MetaAttribute holds the name of the build metadata.
+type MetaAttribute struct {
+	Name string
+
+	// Transforms are the value transforms chained after the name,
+	// e.g. ['upper'] for '@timoni(meta:revision,upper)'.
+	Transforms []string
+}
+
+// NewMetaAttribute returns a MetaAttribute from the given CUE attribute.
+// If the CUE attribute doesn't match the expected format
+// '@timoni(meta:[NAME][,TRANSFORM...])', an error is returned.
+func NewMetaAttribute(key, body string) (*MetaAttribute, error) {
+	if !IsMetaAttribute(key, body) {
+		return nil, fmt.Errorf("invalid format, must be @timoni(%s%s[%s|%s])",
+			MetaKind, RuntimeDelimiter, MetaTimestamp, MetaRevision)
+	}
+	ref, transforms := SplitTransforms(body)
+	parts := strings.Split(ref, RuntimeDelimiter)
+	return &MetaAttribute{
+		Name:       parts[1],
+		Transforms: transforms,
+	}, nil
+}
+
+// IsMetaAttribute returns true if the given
+// CUE attribute matches the expected format.
+func IsMetaAttribute(key, body string) bool {
+	if key != FieldManager {
+		return false
+	}
+
+	ref, _ := SplitTransforms(body)
+	parts := strings.Split(ref, RuntimeDelimiter)
+	return len(parts) == 2 && parts[0] == MetaKind &&
+		(parts[1] == MetaTimestamp || parts[1] == MetaRevision)
+}
+
+// ExprAttribute holds the CUE expression used to compute a field value.
+type ExprAttribute struct {
+	Expr string
+}
+
+// NewExprAttribute returns an ExprAttribute from the given CUE attribute.
+// If the CUE attribute doesn't match the expected format
+// '@timoni(expr:[EXPRESSION])', an error is returned.
+// Quoted expressions are unquoted before being returned.
+func NewExprAttribute(key, body string) (*ExprAttribute, error) {
+	if !IsExprAttribute(key, body) {
+		return nil, fmt.Errorf("invalid format, must be @timoni(%s%s[EXPRESSION])",
+			ExprKind, RuntimeDelimiter)
+	}
+	parts := strings.SplitN(body, RuntimeDelimiter, 2)
+	expr := strings.TrimSpace(parts[1])
+	if e, err := strconv.Unquote(expr); err == nil {
+		expr = e
+	}
+	return &ExprAttribute{
+		Expr: expr,
+	}, nil
+}
+
+// IsExprAttribute returns true if the given
+// CUE attribute matches the expected format.
+func IsExprAttribute(key, body string) bool {
+	if key != FieldManager {
+		return false
+	}
+
+	parts := strings.SplitN(body, RuntimeDelimiter, 2)
+	return len(parts) == 2 && parts[0] == ExprKind && strings.TrimSpace(parts[1]) != ""
+}
+
 // Runtime holds the list of in-cluster resources and the
 // CUE expressions for extracting specific fields values.
 type Runtime struct {
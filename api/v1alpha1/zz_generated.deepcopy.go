@@ -37,6 +37,42 @@ func (in *ArtifactReference) DeepCopy() *ArtifactReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildReport) DeepCopyInto(out *BuildReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	if in.Objects != nil {
+		in, out := &in.Objects, &out.Objects
+		*out = make([]BuildReportObject, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildReport.
+func (in *BuildReport) DeepCopy() *BuildReport {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildReportObject) DeepCopyInto(out *BuildReportObject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildReportObject.
+func (in *BuildReportObject) DeepCopy() *BuildReportObject {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildReportObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageReference) DeepCopyInto(out *ImageReference) {
 	*out = *in
@@ -68,6 +104,11 @@ func (in *Instance) DeepCopyInto(out *Instance) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Instance.
@@ -102,6 +143,35 @@ func (in *ModuleReference) DeepCopy() *ModuleReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceMetadata) DeepCopyInto(out *NamespaceMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceMetadata.
+func (in *NamespaceMetadata) DeepCopy() *NamespaceMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceInventory) DeepCopyInto(out *ResourceInventory) {
 	*out = *in
@@ -239,3 +309,18 @@ func (in *RuntimeValue) DeepCopy() *RuntimeValue {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WaitCondition) DeepCopyInto(out *WaitCondition) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WaitCondition.
+func (in *WaitCondition) DeepCopy() *WaitCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(WaitCondition)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -52,9 +52,11 @@ The apply command performs the following steps:
 - Builds the module by passing the instance name, namespace and values.
 - Labels the resulting Kubernetes resources with the instance name and namespace.
 - Applies the Kubernetes resources on the cluster.
+- Applies the resources annotated with 'timoni.sh/apply-order: "<int>"' in ascending order of the annotation value.
 - Creates or updates the instance inventory with the last applied resources IDs (stored in a secret named timoni.<instance_name>).
 - Recreates the resources annotated with 'action.timoni.sh/force: "enabled"' if they contain changes to immutable fields.
 - Waits for the applied resources to become ready.
+- Waits for the resources annotated with 'timoni.sh/wait-condition: "<jsonpath>"' until the expression evaluates to a non-empty value.
 - Deletes the resources which were previously applied but are missing from the current instance.
 - Skips the resources annotated with 'action.timoni.sh/prune: "disabled"' from deletion.
 - Waits for the deleted resources to be finalised.
@@ -84,6 +86,11 @@ The apply command performs the following steps:
   timoni apply -n apps app oci://docker.io/org/module \
   --values ./values-1.yaml \
   --values ./values-2.json
+
+  # Validate the objects against Kyverno policies and abort the apply on violations
+  timoni apply -n apps app oci://docker.io/org/module \
+  --kyverno-policies ./policies \
+  --enforce
 `,
 	RunE: runApplyCmd,
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -109,6 +116,11 @@ type applyFlags struct {
 	wait               bool
 	force              bool
 	overwriteOwnership bool
+	fieldManager       string
+	forceConflicts     bool
+	policiesDir        string
+	enforce            bool
+	trimValues         bool
 	creds              flags.Credentials
 }
 
@@ -119,16 +131,26 @@ func init() {
 	applyCmd.Flags().VarP(&applyArgs.pkg, applyArgs.pkg.Type(), applyArgs.pkg.Shorthand(), applyArgs.pkg.Description())
 	applyCmd.Flags().StringSliceVarP(&applyArgs.valuesFiles, "values", "f", nil,
 		"The local path to values files (cue, yaml or json format).")
+	applyCmd.Flags().BoolVar(&applyArgs.trimValues, "trim-values-to-schema", false,
+		"Remove the values fields that are not defined in the module's schema instead of failing the apply.")
 	applyCmd.Flags().BoolVar(&applyArgs.force, "force", false,
 		"Recreate immutable Kubernetes resources.")
 	applyCmd.Flags().BoolVar(&applyArgs.overwriteOwnership, "overwrite-ownership", false,
 		"Overwrite instance ownership, if the instance is owned by a Bundle.")
+	applyCmd.Flags().StringVar(&applyArgs.fieldManager, "field-manager", apiv1.FieldManager,
+		"The name of the server-side apply field manager recorded in the Kubernetes objects.")
+	applyCmd.Flags().BoolVar(&applyArgs.forceConflicts, "force-conflicts", true,
+		"Take the ownership of the fields managed by other field managers, when disabled the apply fails on conflicts.")
 	applyCmd.Flags().BoolVar(&applyArgs.dryrun, "dry-run", false,
 		"Perform a server-side apply dry run.")
 	applyCmd.Flags().BoolVar(&applyArgs.diff, "diff", false,
 		"Perform a server-side apply dry run and prints the diff.")
 	applyCmd.Flags().BoolVar(&applyArgs.wait, "wait", true,
 		"Wait for the applied Kubernetes objects to become ready.")
+	applyCmd.Flags().StringVar(&applyArgs.policiesDir, "kyverno-policies", "",
+		"The local path to a directory with Kyverno policies to validate the Kubernetes objects against before apply.")
+	applyCmd.Flags().BoolVar(&applyArgs.enforce, "enforce", false,
+		"Abort the apply if the Kubernetes objects violate any of the Kyverno policies.")
 	applyCmd.Flags().Var(&applyArgs.creds, applyArgs.creds.Type(), applyArgs.creds.Description())
 	rootCmd.AddCommand(applyCmd)
 }
@@ -172,6 +194,8 @@ func runApplyCmd(cmd *cobra.Command, args []string) error {
 		applyArgs.creds.String(),
 		rootArgs.registryInsecure,
 	)
+	fetcher.SetRetry(rootArgs.registryRetries, rootArgs.registryRetryDelay)
+	fetcher.SetMirrors(rootArgs.registryMirrors)
 	mod, err := fetcher.Fetch()
 	if err != nil {
 		return err
@@ -185,6 +209,8 @@ func runApplyCmd(cmd *cobra.Command, args []string) error {
 		fetcher.GetModuleRoot(),
 		applyArgs.pkg.String(),
 	)
+	builder.SetTimoniVersion(VERSION)
+	builder.SetLogger(engineLogger(log))
 
 	if err := builder.WriteSchemaFile(); err != nil {
 		return err
@@ -202,6 +228,12 @@ func runApplyCmd(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
+		if applyArgs.trimValues {
+			valuesCue, err = trimValuesToSchema(log, builder, valuesCue)
+			if err != nil {
+				return err
+			}
+		}
 		err = builder.MergeValuesFile(valuesCue)
 		if err != nil {
 			return err
@@ -235,7 +267,16 @@ func runApplyCmd(cmd *cobra.Command, args []string) error {
 		objects = append(objects, set.Objects...)
 	}
 
-	rm, err := runtime.NewResourceManager(kubeconfigArgs)
+	if applyArgs.policiesDir != "" {
+		if err := validateKyvernoPolicies(log, applyArgs.policiesDir, applyArgs.enforce, objects); err != nil {
+			return err
+		}
+	}
+
+	rm, err := runtime.NewResourceManagerWithOptions(kubeconfigArgs, runtime.ManagerOptions{
+		FieldManager:   applyArgs.fieldManager,
+		ForceConflicts: applyArgs.forceConflicts,
+	})
 	if err != nil {
 		return err
 	}
@@ -264,6 +305,20 @@ func runApplyCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// The hooks are applied separately from the apply sets they are defined in.
+	var hooks runtime.Hooks
+	mainSets := make([]engine.ResourceSet, 0, len(applySets))
+	for _, set := range applySets {
+		setObjects, setHooks, err := runtime.SplitHooks(set.Objects)
+		if err != nil {
+			return err
+		}
+		hooks.Add(setHooks)
+		if len(setObjects) > 0 {
+			mainSets = append(mainSets, engine.ResourceSet{Name: set.Name, Objects: setObjects})
+		}
+	}
+
 	im := runtime.NewInstanceManager(applyArgs.name, *kubeconfigArgs.Namespace, finalValues, *mod)
 
 	if err := im.AddObjects(objects); err != nil {
@@ -279,7 +334,7 @@ func runApplyCmd(cmd *cobra.Command, args []string) error {
 		if !nsExists {
 			log.Info(colorizeJoin(colorizeNamespaceFromArgs(), ssa.CreatedAction, dryRunServer))
 		}
-		return instanceDryRunDiff(logr.NewContext(ctx, log), rm, objects, staleObjects, nsExists, tmpDir, applyArgs.diff)
+		return instanceDryRunDiff(logr.NewContext(ctx, log), rm, applySets, staleObjects, nsExists, tmpDir, applyArgs.diff)
 	}
 
 	if !exists {
@@ -305,28 +360,47 @@ func runApplyCmd(cmd *cobra.Command, args []string) error {
 		FailFast: true,
 	}
 
-	for _, set := range applySets {
-		if len(applySets) > 1 {
-			log.Info(fmt.Sprintf("applying %s", set.Name))
-		}
-
-		cs, err := rm.ApplyAllStaged(ctx, set.Objects, applyOpts)
+	applyHooks := func(ctx context.Context, hook string, hookObjects []*unstructured.Unstructured) error {
+		log.Info(fmt.Sprintf("applying %s hooks", hook))
+		cs, err := runtime.ApplyAllOrdered(ctx, rm, hookObjects, applyOpts)
 		if err != nil {
 			return err
 		}
 		for _, change := range cs.Entries {
 			log.Info(colorizeJoin(change))
 		}
+		return nil
+	}
 
-		if applyArgs.wait {
-			spin := StartSpinner(fmt.Sprintf("waiting for %v resource(s) to become ready...", len(set.Objects)))
-			err = rm.Wait(set.Objects, waitOptions)
-			spin.Stop()
+	applyObjects := func(ctx context.Context) error {
+		for _, set := range mainSets {
+			if len(mainSets) > 1 {
+				log.Info(fmt.Sprintf("applying %s", set.Name))
+			}
+
+			cs, err := runtime.ApplyAllOrdered(ctx, rm, set.Objects, applyOpts)
 			if err != nil {
 				return err
 			}
-			log.Info("resources are ready")
+			for _, change := range cs.Entries {
+				log.Info(colorizeJoin(change))
+			}
+
+			if applyArgs.wait {
+				spin := StartSpinner(fmt.Sprintf("waiting for %v resource(s) to become ready...", len(set.Objects)))
+				err = rm.Wait(set.Objects, waitOptions)
+				spin.Stop()
+				if err != nil {
+					return err
+				}
+				log.Info("resources are ready")
+			}
 		}
+		return nil
+	}
+
+	if err := runtime.ApplyWithHooks(ctx, rm.Client(), hooks, applyHooks, applyObjects, waitOptions); err != nil {
+		return err
 	}
 
 	if images, err := builder.GetContainerImages(buildResult); err == nil {
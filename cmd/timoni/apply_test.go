@@ -23,14 +23,18 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fluxcd/pkg/ssa"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/runtime"
 )
 
 func TestApply(t *testing.T) {
@@ -354,3 +358,140 @@ func TestApply_GlobalResources(t *testing.T) {
 		t.Log("\n", output)
 	})
 }
+
+func TestApply_KyvernoPolicies(t *testing.T) {
+	g := NewWithT(t)
+	modPath := "testdata/module"
+	name := rnd("my-instance", 5)
+	namespace := rnd("my-namespace", 5)
+
+	policiesDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(policiesDir, "policy.yaml"), []byte(`
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: disallow-internal
+spec:
+  validationFailureAction: Enforce
+  rules:
+    - name: check-server
+      match:
+        any:
+          - resources:
+              kinds:
+                - ConfigMap
+      validate:
+        message: "internal servers are not allowed"
+        pattern:
+          =(data):
+            =(server): "!*.internal*"
+`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = executeCommand(fmt.Sprintf(
+		"apply -n %s %s %s -p main --wait --kyverno-policies %s --enforce",
+		namespace,
+		name,
+		modPath,
+		policiesDir,
+	))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("policy violation(s) found"))
+
+	clientCM := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-client", name),
+			Namespace: namespace,
+		},
+	}
+	err = envTestClient.Get(context.Background(), client.ObjectKeyFromObject(clientCM), clientCM)
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestApply_WaitCondition(t *testing.T) {
+	g := NewWithT(t)
+	namespace := rnd("my-namespace", 5)
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	g.Expect(envTestClient.Create(context.Background(), ns)).To(Succeed())
+
+	svc := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lb",
+			Namespace: namespace,
+			Annotations: map[string]string{
+				apiv1.WaitConditionAnnotation: "status.loadBalancer.ingress",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	g.Expect(envTestClient.Create(context.Background(), svc)).To(Succeed())
+
+	obj, err := runtime.ToUnstructured(svc)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	rm, err := runtime.NewResourceManager(kubeconfigArgs)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	t.Run("times out without ingress", func(t *testing.T) {
+		g := NewWithT(t)
+		err := rm.Wait([]*unstructured.Unstructured{obj}, ssa.WaitOptions{
+			Interval: 100 * time.Millisecond,
+			Timeout:  time.Second,
+		})
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("completes when ingress appears", func(t *testing.T) {
+		g := NewWithT(t)
+
+		go func() {
+			time.Sleep(time.Second)
+			svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+			_ = envTestClient.Status().Update(context.Background(), svc)
+		}()
+
+		err := rm.Wait([]*unstructured.Unstructured{obj}, ssa.WaitOptions{
+			Interval: 100 * time.Millisecond,
+			Timeout:  10 * time.Second,
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+}
+
+func TestApply_FieldManager(t *testing.T) {
+	g := NewWithT(t)
+	modPath := "testdata/module"
+	name := rnd("my-instance", 5)
+	namespace := rnd("my-namespace", 5)
+
+	output, err := executeCommand(fmt.Sprintf(
+		"apply -n %s %s %s -p main --field-manager platform-ci --wait --timeout=10s",
+		namespace,
+		name,
+		modPath,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+	t.Log("\n", output)
+
+	clientCM := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-client", name),
+			Namespace: namespace,
+		},
+	}
+
+	err = envTestClient.Get(context.Background(), client.ObjectKeyFromObject(clientCM), clientCM)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	var managers []string
+	for _, entry := range clientCM.GetManagedFields() {
+		managers = append(managers, entry.Manager)
+	}
+	g.Expect(managers).To(ContainElement("platform-ci"))
+	g.Expect(managers).ToNot(ContainElement(apiv1.FieldManager))
+}
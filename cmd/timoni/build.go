@@ -25,6 +25,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"cuelang.org/go/cue/ast"
@@ -32,9 +33,9 @@ import (
 	"cuelang.org/go/cue/format"
 	cuejson "cuelang.org/go/encoding/json"
 	cueyaml "cuelang.org/go/encoding/yaml"
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"sigs.k8s.io/yaml"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 	"github.com/stefanprodan/timoni/internal/engine"
@@ -48,10 +49,34 @@ var buildCmd = &cobra.Command{
 	Example: `  # Build an instance from a local module
   timoni build app ./path/to/module --output yaml
 
+  # Build an instance and print one JSON object per line
+  timoni build app ./path/to/module --output jsonl
+
   # Build an instance with custom values by merging them in the specified order
   timoni build app ./path/to/module \
   --values ./values-1.cue \
   --values ./values-2.cue
+
+  # Build an instance starting from an example shipped with the module
+  timoni build app ./path/to/module --example minimal -f ./values.cue
+
+  # Build an instance and override the values from the command line
+  timoni build app ./path/to/module --set replicas=2 --set-string image.tag=1.0
+
+  # Build an instance by unifying multiple packages of the module
+  timoni build app ./path/to/module -p main -p extras
+
+  # Build an instance by setting the value of the CUE fields annotated with @tag(env)
+  timoni build app ./path/to/module -t env=prod
+
+  # Build an instance and drop the values that are not defined in the module's schema
+  timoni build app ./path/to/module -f ./helm-values.yaml --trim-values-to-schema
+
+  # Build an instance and fail if the objects violate the Kyverno policies
+  timoni build app ./path/to/module --kyverno-policies ./policies --enforce
+
+  # Build an instance and preview the fields owned by Timoni after apply
+  timoni build app ./path/to/module --show-managed-fields
 `,
 	RunE: runBuildCmd,
 	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -70,9 +95,17 @@ type buildFlags struct {
 	name        string
 	module      string
 	version     flags.Version
-	pkg         flags.Package
+	pkg         flags.Packages
 	valuesFiles []string
+	example     string
+	setValues   []string
+	setStrings  []string
+	tags        []string
 	output      string
+	policiesDir string
+	enforce     bool
+	trimValues  bool
+	showFields  bool
 	creds       flags.Credentials
 }
 
@@ -83,8 +116,24 @@ func init() {
 	buildCmd.Flags().VarP(&buildArgs.pkg, buildArgs.pkg.Type(), buildArgs.pkg.Shorthand(), buildArgs.pkg.Description())
 	buildCmd.Flags().StringSliceVarP(&buildArgs.valuesFiles, "values", "f", nil,
 		"The local path to values files (cue, yaml or json format).")
+	buildCmd.Flags().StringVar(&buildArgs.example, "example", "",
+		"The name of an example values file from the module's examples directory, the values files are merged on top of it.")
+	buildCmd.Flags().StringArrayVar(&buildArgs.setValues, "set", nil,
+		"Override a value in the format path.to.field=value, with numbers and booleans converted from strings, can be specified multiple times.")
+	buildCmd.Flags().StringArrayVar(&buildArgs.setStrings, "set-string", nil,
+		"Override a string value in the format path.to.field=value, can be specified multiple times.")
+	buildCmd.Flags().BoolVar(&buildArgs.trimValues, "trim-values-to-schema", false,
+		"Remove the values fields that are not defined in the module's schema instead of failing the build.")
+	buildCmd.Flags().StringArrayVarP(&buildArgs.tags, "tag", "t", nil,
+		"Set the value of a CUE field annotated with @tag(key) in the format key=value, can be specified multiple times.")
 	buildCmd.Flags().StringVarP(&buildArgs.output, "output", "o", "yaml",
-		"The format in which the Kubernetes objects should be printed, can be 'yaml' or 'json'.")
+		"The format in which the Kubernetes objects should be printed, can be 'yaml', 'json' or 'jsonl'.")
+	buildCmd.Flags().StringVar(&buildArgs.policiesDir, "kyverno-policies", "",
+		"The local path to a directory with Kyverno policies to validate the Kubernetes objects against.")
+	buildCmd.Flags().BoolVar(&buildArgs.enforce, "enforce", false,
+		"Fail the build if the Kubernetes objects violate any of the Kyverno policies.")
+	buildCmd.Flags().BoolVar(&buildArgs.showFields, "show-managed-fields", false,
+		"Include in the Kubernetes objects a preview of the managed fields claimed by Timoni's field manager on apply, for diagnostic purposes.")
 	buildCmd.Flags().Var(&buildArgs.creds, buildArgs.creds.Type(), buildArgs.creds.Description())
 
 	rootCmd.AddCommand(buildCmd)
@@ -98,6 +147,10 @@ func runBuildCmd(cmd *cobra.Command, args []string) error {
 	buildArgs.name = args[0]
 	buildArgs.module = args[1]
 
+	if err := validateTags(buildArgs.tags); err != nil {
+		return err
+	}
+
 	version := buildArgs.version.String()
 	if version == "" {
 		version = apiv1.LatestVersion
@@ -123,18 +176,34 @@ func runBuildCmd(cmd *cobra.Command, args []string) error {
 		buildArgs.creds.String(),
 		rootArgs.registryInsecure,
 	)
+	fetcher.SetRetry(rootArgs.registryRetries, rootArgs.registryRetryDelay)
+	fetcher.SetMirrors(rootArgs.registryMirrors)
 	mod, err := fetcher.Fetch()
 	if err != nil {
 		return err
 	}
 
+	pkgs := buildArgs.pkg.Values()
+	if slices.Contains(pkgs, flags.AllPackages) {
+		if len(pkgs) > 1 {
+			return fmt.Errorf("the package %s can't be combined with other packages", flags.AllPackages)
+		}
+		pkgs, err = engine.ListModulePackages(fetcher.GetModuleRoot())
+		if err != nil {
+			return err
+		}
+	}
+
 	builder := engine.NewModuleBuilder(
 		ctx,
 		buildArgs.name,
 		*kubeconfigArgs.Namespace,
 		fetcher.GetModuleRoot(),
-		buildArgs.pkg.String(),
+		pkgs[0],
 	)
+	builder.SetTimoniVersion(VERSION)
+	builder.SetExtraPackages(pkgs[1:])
+	builder.SetLogger(engineLogger(LoggerInstance(cmd.Context(), buildArgs.name)))
 
 	if err := builder.WriteSchemaFile(); err != nil {
 		return err
@@ -145,18 +214,45 @@ func runBuildCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if len(buildArgs.valuesFiles) > 0 {
-		valuesCue, err := convertToCue(cmd, buildArgs.valuesFiles)
+	valuesFiles := buildArgs.valuesFiles
+	if buildArgs.example != "" {
+		examplePath, err := engine.GetModuleExample(fetcher.GetModuleRoot(), buildArgs.example)
 		if err != nil {
 			return err
 		}
+		valuesFiles = append([]string{examplePath}, valuesFiles...)
+	}
+
+	var valuesCue [][]byte
+	if len(valuesFiles) > 0 {
+		valuesCue, err = convertToCue(cmd, valuesFiles)
+		if err != nil {
+			return err
+		}
+		if buildArgs.trimValues {
+			valuesCue, err = trimValuesToSchema(LoggerInstance(cmd.Context(), buildArgs.name), builder, valuesCue)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(buildArgs.setValues) > 0 || len(buildArgs.setStrings) > 0 {
+		setCue, err := setValuesToCue(apiv1.ValuesSelector.String(), buildArgs.setValues, buildArgs.setStrings)
+		if err != nil {
+			return err
+		}
+		valuesCue = append(valuesCue, setCue)
+	}
+
+	if len(valuesCue) > 0 {
 		err = builder.MergeValuesFile(valuesCue)
 		if err != nil {
 			return err
 		}
 	}
 
-	buildResult, err := builder.Build()
+	buildResult, err := builder.Build(buildArgs.tags...)
 	if err != nil {
 		return describeErr(fetcher.GetModuleRoot(), "build failed", err)
 	}
@@ -180,11 +276,24 @@ func runBuildCmd(cmd *cobra.Command, args []string) error {
 		objects = append(objects, set.Objects...)
 	}
 
+	if buildArgs.policiesDir != "" {
+		log := LoggerInstance(cmd.Context(), buildArgs.name)
+		if err := validateKyvernoPolicies(log, buildArgs.policiesDir, buildArgs.enforce, objects); err != nil {
+			return err
+		}
+	}
+
+	if buildArgs.showFields {
+		if err := engine.SetManagedFieldsPreview(objects, apiv1.FieldManager); err != nil {
+			return err
+		}
+	}
+
 	switch buildArgs.output {
 	case "yaml":
 		var sb strings.Builder
 		for _, obj := range objects {
-			data, err := yaml.Marshal(obj)
+			data, err := engine.MarshalObjectYAML(obj)
 			if err != nil {
 				return fmt.Errorf("converting objects failed: %w", err)
 			}
@@ -210,9 +319,62 @@ func runBuildCmd(cmd *cobra.Command, args []string) error {
 		}
 		_, err = cmd.OutOrStdout().Write(b)
 		return err
+	case "jsonl":
+		var sb strings.Builder
+		for _, obj := range objects {
+			data, err := json.Marshal(obj)
+			if err != nil {
+				return fmt.Errorf("converting objects failed: %w", err)
+			}
+			sb.Write(data)
+			sb.WriteString("\n")
+		}
+		_, err = cmd.OutOrStdout().Write([]byte(sb.String()))
+		return err
 	default:
-		return fmt.Errorf("unknown --output=%s, can be yaml or json", buildArgs.output)
+		return fmt.Errorf("unknown --output=%s, can be yaml, json or jsonl", buildArgs.output)
+	}
+}
+
+// validateTags checks that the CUE tags are in the key=value format
+// and that they don't override the tags injected by Timoni.
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		key, _, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid tag '%s', must be in the format key=value", tag)
+		}
+		if slices.Contains(engine.ReservedTags, key) {
+			return fmt.Errorf("invalid tag '%s', the key is reserved for %s", tag, strings.Join(engine.ReservedTags, ", "))
+		}
+	}
+	return nil
+}
+
+// trimValuesToSchema removes the values fields not allowed by the module's schema and logs each removed field.
+func trimValuesToSchema(log logr.Logger, builder *engine.ModuleBuilder, valuesCue [][]byte) ([][]byte, error) {
+	valuesCue, trimmed, err := builder.TrimValuesToSchema(valuesCue)
+	if err != nil {
+		return nil, fmt.Errorf("trimming values failed: %w", err)
+	}
+	for _, field := range trimmed {
+		log.Info(colorizeJoin(colorizeSubject(field), colorizeWarning("trimmed"), "not defined in the module's schema"))
+	}
+	return valuesCue, nil
+}
+
+// setValuesToCue returns the CUE source of the --set and --set-string overrides
+// nested under the given field. As JSON is valid CUE, the overrides are encoded as JSON.
+func setValuesToCue(field string, overrides, stringOverrides []string) ([]byte, error) {
+	values, err := engine.ParseSetValues(overrides, stringOverrides)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(map[string]any{field: values})
+	if err != nil {
+		return nil, fmt.Errorf("converting overrides failed: %w", err)
 	}
+	return data, nil
 }
 
 func convertToCue(cmd *cobra.Command, paths []string) ([][]byte, error) {
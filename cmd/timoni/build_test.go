@@ -17,12 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/fluxcd/pkg/ssa"
 	. "github.com/onsi/gomega"
+	cp "github.com/otiai10/copy"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -72,6 +76,28 @@ func TestBuild(t *testing.T) {
 		g.Expect(len(objects)).To(BeEquivalentTo(2))
 	})
 
+	t.Run("builds module and outputs JSON Lines", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+		namespace := rnd("my-namespace", 5)
+		output, err := executeCommand(fmt.Sprintf(
+			"build -n %s %s %s -p main -o jsonl",
+			namespace,
+			name,
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+		g.Expect(lines).To(HaveLen(2))
+		for _, line := range lines {
+			var obj unstructured.Unstructured
+			g.Expect(json.Unmarshal([]byte(line), &obj.Object)).To(Succeed())
+			g.Expect(obj.GetKind()).To(BeEquivalentTo("ConfigMap"))
+			g.Expect(obj.GetNamespace()).To(BeEquivalentTo(namespace))
+		}
+	})
+
 	t.Run("builds module with custom values", func(t *testing.T) {
 		g := NewWithT(t)
 		name := rnd("my-instance", 5)
@@ -122,6 +148,45 @@ func TestBuild(t *testing.T) {
 		}
 	})
 
+	t.Run("builds module with mixed CUE and YAML values", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+		namespace := rnd("my-namespace", 5)
+		output, err := executeCommand(fmt.Sprintf(
+			"build -n %s %s %s -f %s -f %s -p main -o yaml",
+			namespace,
+			name,
+			modPath,
+			modPath+"-values/example.com.cue",
+			modPath+"-values/example.com.yaml",
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		// the domain from the YAML file overrides the one from the CUE file
+		g.Expect(output).To(ContainSubstring("tcp://yaml.example.com"))
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(len(objects)).To(BeEquivalentTo(2))
+		for _, o := range objects {
+			// this annotation is specified only in the CUE file
+			g.Expect(o.GetAnnotations()).To(HaveKeyWithValue("scope", "external"))
+		}
+
+		output, err = executeCommand(fmt.Sprintf(
+			"build -n %s %s %s -f %s -f %s -p main -o yaml",
+			namespace,
+			name,
+			modPath,
+			modPath+"-values/example.com.yaml",
+			modPath+"-values/example.com.cue",
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("tcp://example.com"))
+		g.Expect(output).ToNot(ContainSubstring("yaml.example.com"))
+	})
+
 	t.Run("builds module with merged values", func(t *testing.T) {
 		g := NewWithT(t)
 		name := rnd("my-instance", 5)
@@ -150,6 +215,65 @@ func TestBuild(t *testing.T) {
 		g.Expect(val).To(BeEquivalentTo("tcp://example.io:9090"))
 	})
 
+	t.Run("builds module with stable output", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+		namespace := rnd("my-namespace", 5)
+		cmd := fmt.Sprintf(
+			"build -n %s %s %s -f %s -p main -o yaml",
+			namespace,
+			name,
+			modPath,
+			modPath+"-values/example.com.cue",
+		)
+
+		first, err := executeCommand(cmd)
+		g.Expect(err).ToNot(HaveOccurred())
+		second, err := executeCommand(cmd)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(second).To(Equal(first))
+
+		g.Expect(first).To(HavePrefix("apiVersion: v1\nkind: ConfigMap\nmetadata:\n"))
+	})
+
+	t.Run("builds module with set values", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+		namespace := rnd("my-namespace", 5)
+		output, err := executeCommand(fmt.Sprintf(
+			"build -n %s %s %s -f %s --set domain=example.org --set client.enabled=false --set-string team=42 -p main -o yaml",
+			namespace,
+			name,
+			modPath,
+			modPath+"-values/example.com.cue",
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(len(objects)).To(BeEquivalentTo(1))
+		g.Expect(objects[0].GetName()).To(BeEquivalentTo(name + "-server"))
+		g.Expect(objects[0].GetAnnotations()).To(HaveKeyWithValue("scope", "external"))
+		g.Expect(objects[0].GetLabels()).To(HaveKeyWithValue("app.kubernetes.io/team", "42"))
+		g.Expect(output).To(ContainSubstring("hostname: example.org"))
+	})
+
+	t.Run("fails to build with conflicting set values", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+		namespace := rnd("my-namespace", 5)
+		output, err := executeCommand(fmt.Sprintf(
+			"build -n %s %s %s --set domain=example.org --set-string domain=example.io -p main -o yaml",
+			namespace,
+			name,
+			modPath,
+		))
+		g.Expect(output).To(BeEmpty())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("the path domain is already set"))
+	})
+
 	t.Run("fails to build with syntactically invalid file", func(t *testing.T) {
 		g := NewWithT(t)
 		name := rnd("my-instance", 5)
@@ -229,3 +353,312 @@ func TestBuild(t *testing.T) {
 		g.Expect(err.Error()).To(ContainSubstring("timoni.kubeMinorVersion: invalid value"))
 	})
 }
+
+func TestBuild_RegistryMirror(t *testing.T) {
+	g := NewWithT(t)
+	modPath := "testdata/module"
+	modName := rnd("my-mod", 5)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s/mirror/%s -v %s",
+		modPath,
+		dockerRegistry,
+		modName,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	name := rnd("my-instance", 5)
+	output, err := executeCommand(fmt.Sprintf(
+		"build -n default %s oci://registry.example.com/%s -v %s -p main -o yaml --registry-mirror registry.example.com=%s/mirror",
+		name,
+		modName,
+		modVer,
+		dockerRegistry,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	objects, err := ssa.ReadObjects(strings.NewReader(output))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(objects).ToNot(BeEmpty())
+	g.Expect(objects[0].GetName()).To(ContainSubstring(name))
+}
+
+func TestBuild_KyvernoPolicies(t *testing.T) {
+	modPath := "testdata/module"
+	policiesDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(policiesDir, "policy.yaml"), []byte(`
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: disallow-internal
+spec:
+  validationFailureAction: Enforce
+  rules:
+    - name: check-server
+      match:
+        any:
+          - resources:
+              kinds:
+                - ConfigMap
+      validate:
+        message: "internal servers are not allowed"
+        pattern:
+          =(data):
+            =(server): "!*.internal*"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("builds module with violations", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+		output, err := executeCommand(fmt.Sprintf(
+			"build %s %s -p main -o yaml --kyverno-policies %s",
+			name,
+			modPath,
+			policiesDir,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("tcp://example.internal"))
+	})
+
+	t.Run("fails to build on violations with --enforce", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+		output, err := executeCommand(fmt.Sprintf(
+			"build %s %s -p main -o yaml --kyverno-policies %s --enforce",
+			name,
+			modPath,
+			policiesDir,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("1 policy violation(s) found"))
+		g.Expect(output).ToNot(ContainSubstring("apiVersion"))
+	})
+
+	t.Run("builds module without violations", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+		_, err := executeCommand(fmt.Sprintf(
+			"build %s %s -f %s -p main -o yaml --kyverno-policies %s --enforce",
+			name,
+			modPath,
+			modPath+"-values/example.com.cue",
+			policiesDir,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+}
+
+func TestBuild_TrimValuesToSchema(t *testing.T) {
+	modPath := "testdata/module"
+	valuesPath := filepath.Join(t.TempDir(), "values.yaml")
+	err := os.WriteFile(valuesPath, []byte(`
+values:
+  domain: example.com
+  replicaCount: 3
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("fails to build with undefined values", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main -f %s",
+			modPath,
+			valuesPath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("replicaCount"))
+	})
+
+	t.Run("builds module with undefined values trimmed", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main -o yaml -f %s --trim-values-to-schema",
+			modPath,
+			valuesPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("tcp://example.com"))
+	})
+}
+
+func TestBuild_MinVersion(t *testing.T) {
+	modPath := "testdata/module"
+
+	newModule := func(g *WithT, minVersion string) string {
+		moduleRoot := filepath.Join(t.TempDir(), "module")
+		g.Expect(cp.Copy(modPath, moduleRoot)).To(Succeed())
+		versionFile := filepath.Join(moduleRoot, "version.cue")
+		g.Expect(os.WriteFile(versionFile, []byte(fmt.Sprintf("package main\ntimoni: minVersion: %q\n", minVersion)), 0644)).To(Succeed())
+		return moduleRoot
+	}
+
+	t.Run("fails to build with an older timoni version", func(t *testing.T) {
+		g := NewWithT(t)
+		moduleRoot := newModule(g, "99.0.0")
+		output, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main -o yaml",
+			moduleRoot,
+		))
+		g.Expect(output).To(BeEmpty())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(
+			fmt.Sprintf("the module requires timoni version 99.0.0 or newer, but the current version is %s, please upgrade timoni", VERSION)))
+	})
+
+	t.Run("builds with the required timoni version", func(t *testing.T) {
+		g := NewWithT(t)
+		moduleRoot := newModule(g, "0.0.0-dev.0")
+		output, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main -o yaml",
+			moduleRoot,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("tcp://example.internal"))
+	})
+}
+
+func TestBuild_MultiplePackages(t *testing.T) {
+	modPath := "testdata/module"
+
+	newModule := func(g *WithT, extras string) string {
+		moduleRoot := filepath.Join(t.TempDir(), "module")
+		g.Expect(cp.Copy(modPath, moduleRoot)).To(Succeed())
+		g.Expect(os.MkdirAll(filepath.Join(moduleRoot, "extras"), os.ModePerm)).To(Succeed())
+		extrasFile := filepath.Join(moduleRoot, "extras", "extras.cue")
+		g.Expect(os.WriteFile(extrasFile, []byte(extras), 0644)).To(Succeed())
+		return moduleRoot
+	}
+
+	extras := `package extras
+
+values: domain: string
+
+timoni: apply: extras: [{
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: {
+		name:      "\(timoni.instance.config.metadata.name)-extras"
+		namespace: timoni.instance.config.metadata.namespace
+	}
+	data: domain: values.domain
+}]
+`
+
+	t.Run("builds module by unifying multiple packages", func(t *testing.T) {
+		g := NewWithT(t)
+		moduleRoot := newModule(g, extras)
+		output, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main -p extras -o yaml",
+			moduleRoot,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("name: app-client"))
+		g.Expect(output).To(ContainSubstring("name: app-server"))
+		g.Expect(output).To(ContainSubstring("name: app-extras"))
+		g.Expect(output).To(ContainSubstring("domain: example.internal"))
+	})
+
+	t.Run("builds module by unifying all packages", func(t *testing.T) {
+		g := NewWithT(t)
+		moduleRoot := newModule(g, extras)
+		output, err := executeCommand(fmt.Sprintf(
+			"build app %s -p * -o yaml",
+			moduleRoot,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("name: app-client"))
+		g.Expect(output).To(ContainSubstring("name: app-extras"))
+	})
+
+	t.Run("fails to build with conflicting packages", func(t *testing.T) {
+		g := NewWithT(t)
+		moduleRoot := newModule(g, "package extras\n\nvalues: team: 1\n")
+		_, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main -p extras -o yaml",
+			moduleRoot,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("conflicting values"))
+	})
+}
+
+func TestBuild_ShowManagedFields(t *testing.T) {
+	modPath := "testdata/module"
+
+	t.Run("omits managed fields by default", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main -o yaml",
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).ToNot(ContainSubstring("managedFields"))
+	})
+
+	t.Run("includes managed fields preview", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main -o yaml --show-managed-fields",
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(objects).ToNot(BeEmpty())
+
+		for _, o := range objects {
+			fields := o.GetManagedFields()
+			g.Expect(fields).To(HaveLen(1))
+			g.Expect(fields[0].Manager).To(Equal("timoni"))
+			g.Expect(string(fields[0].Operation)).To(Equal("Apply"))
+			g.Expect(string(fields[0].FieldsV1.Raw)).To(ContainSubstring(`"f:data"`))
+		}
+	})
+}
+
+func TestBuild_Example(t *testing.T) {
+	modPath := "testdata/module"
+
+	t.Run("builds module with an example and values on top", func(t *testing.T) {
+		g := NewWithT(t)
+		name := rnd("my-instance", 5)
+
+		valuesPath := filepath.Join(t.TempDir(), "values.cue")
+		g.Expect(os.WriteFile(valuesPath, []byte(`values: domain: "override.internal"`), 0644)).To(Succeed())
+
+		output, err := executeCommand(fmt.Sprintf(
+			"build %s %s -p main --example minimal -f %s -o yaml",
+			name,
+			modPath,
+			valuesPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+		g.Expect(objects[0].GetName()).To(Equal(name + "-server"))
+
+		hostname, _, err := unstructured.NestedString(objects[0].Object, "data", "hostname")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(hostname).To(Equal("override.internal"))
+	})
+
+	t.Run("fails for unknown example", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand(fmt.Sprintf(
+			"build app %s -p main --example full",
+			modPath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("example 'full' not found, available examples: minimal, ns"))
+	})
+}
@@ -17,7 +17,20 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/oci"
 )
 
 type bundleFlags struct {
@@ -25,10 +38,26 @@ type bundleFlags struct {
 	runtimeFiles        []string
 	runtimeCluster      string
 	runtimeClusterGroup string
+	noCache             bool
+	instancesNamespace  string
+	moduleRoot          string
+	overlays            []string
+	strictWarnings      bool
+	strict              bool
+	envFile             string
+	legacyTemplates     bool
+	policy              string
+	verifyKey           string
+	verifyIdentity      string
+	verifyOIDCIssuer    string
 }
 
 var bundleArgs bundleFlags
 
+// noBundleInstancesMsg is logged by the commands that have nothing
+// to do when the bundle compiles without declaring any instances.
+const noBundleInstancesMsg = "no instances defined in bundle"
+
 var bundleCmd = &cobra.Command{
 	Use:   "bundle",
 	Short: "Commands for managing bundles",
@@ -43,5 +72,129 @@ func init() {
 		"Filter runtime cluster by name.")
 	bundleCmd.PersistentFlags().StringVar(&bundleArgs.runtimeClusterGroup, "runtime-group", "*",
 		"Filter runtime clusters by group.")
+	bundleCmd.PersistentFlags().BoolVar(&bundleArgs.noCache, "no-cache", false,
+		"Bypass the cache of the built bundle values, the bundles with runtime values, read attributes or encrypted files are never cached.")
+	bundleCmd.PersistentFlags().StringVar(&bundleArgs.instancesNamespace, "instances-namespace", "",
+		"Override the namespace of all the bundle instances, except the ones with 'namespaceOverridable: false'.")
+	bundleCmd.RegisterFlagCompletionFunc("instances-namespace", completeNamespaceList)
+	bundleCmd.PersistentFlags().StringVar(&bundleArgs.moduleRoot, "module-root", "",
+		"The local path to a directory containing a cue.mod, from which the bundle CUE imports are resolved.")
+	bundleCmd.PersistentFlags().StringSliceVar(&bundleArgs.overlays, "overlay", nil,
+		"The local path to bundle files merged on top of the bundle, with the overlay instance values taking precedence.")
+	bundleCmd.PersistentFlags().BoolVar(&bundleArgs.strictWarnings, "strict-warnings", false,
+		"Fail the build if the bundle files produce warnings.")
+	bundleCmd.PersistentFlags().BoolVar(&bundleArgs.strict, "strict", false,
+		"Fail the build if the bundle files contain top-level fields other than 'bundle', e.g. a misspelled 'bundel' field.")
+	bundleCmd.PersistentFlags().StringVar(&bundleArgs.envFile, "env-file", "",
+		"The local path to a .env file with runtime values, overridden by the environment when used with --runtime-from-env.")
+	bundleCmd.PersistentFlags().BoolVar(&bundleArgs.legacyTemplates, "legacy-templates", false,
+		"Render the bundle files marked with '.tmpl', e.g. 'bundle.tmpl.cue', using Go text/template after the runtime injection.")
+	bundleCmd.PersistentFlags().StringVar(&bundleArgs.policy, "policy", "",
+		"The OCI URL of a CUE schema artifact that the values of all the bundle instances are validated against, e.g. 'oci://ghcr.io/org/policies/values:v1'.")
+	bundleCmd.PersistentFlags().StringVar(&bundleArgs.verifyKey, "verify-key", "",
+		"The Cosign public key, the remote modules without a valid signature made with this key are rejected (the cosign binary must be present in PATH).")
+	bundleCmd.PersistentFlags().StringVar(&bundleArgs.verifyIdentity, "verify-identity", "",
+		"The identity expected in the Fulcio certificate of the Cosign keyless signature of the remote modules (the cosign binary must be present in PATH).")
+	bundleCmd.PersistentFlags().StringVar(&bundleArgs.verifyOIDCIssuer, "verify-oidc-issuer", "",
+		"The OIDC issuer of the identity set with --verify-identity, e.g. https://token.actions.githubusercontent.com.")
 	rootCmd.AddCommand(bundleCmd)
 }
+
+// bundleVerifyOptions returns the trusted signers of the bundle modules.
+func bundleVerifyOptions() oci.VerifyOptions {
+	return oci.VerifyOptions{
+		Key:        bundleArgs.verifyKey,
+		Identity:   bundleArgs.verifyIdentity,
+		OIDCIssuer: bundleArgs.verifyOIDCIssuer,
+	}
+}
+
+// overrideBundleNamespace sets the namespace of the bundle instances to the value of
+// the --instances-namespace flag, and warns about the instances that opted out of the override.
+func overrideBundleNamespace(log logr.Logger, bundle *engine.Bundle) {
+	if bundleArgs.instancesNamespace == "" {
+		return
+	}
+
+	for _, name := range bundle.OverrideNamespace(bundleArgs.instancesNamespace) {
+		log.Info(colorizeJoin(colorizeSubject(name), colorizeWarning("namespace not overridden"),
+			fmt.Sprintf("the instance is not namespace overridable, skipping %s", bundleArgs.instancesNamespace)))
+	}
+}
+
+// bundleFileHasInstances returns false if the bundle file declares no instances.
+// If the file can't be compiled on its own, it's assumed to have instances
+// and the errors are left to be reported by the bundle builder.
+func bundleFileHasInstances(ctx *cue.Context, filename string) bool {
+	instances, err := engine.ExtractValueFromFile(ctx, filename, apiv1.BundleInstancesSelector.String())
+	if err != nil {
+		return true
+	}
+	iter, err := instances.Fields(cue.Concrete(true))
+	if err != nil {
+		return true
+	}
+	return iter.Next()
+}
+
+// reportBundleWarnings logs the warnings found when building the bundle,
+// or returns them as an error if the --strict-warnings flag is set.
+func reportBundleWarnings(log logr.Logger, warnings []string) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	if bundleArgs.strictWarnings {
+		return fmt.Errorf("failed to build bundle, found %d warning(s): %s",
+			len(warnings), strings.Join(warnings, "; "))
+	}
+
+	for _, w := range warnings {
+		log.Info(colorizeJoin(colorizeWarning("warning"), w))
+	}
+	return nil
+}
+
+// parseInstanceSelector parses a label selector in the Kubernetes syntax,
+// e.g. 'team=payments,tier!=db'. An empty selector matches all the instances.
+func parseInstanceSelector(selector string) (labels.Selector, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector '%s': %w", selector, err)
+	}
+	return sel, nil
+}
+
+// selectInstancesByLabels returns the stored instances with labels matching the selector.
+func selectInstancesByLabels(instances []*apiv1.Instance, selector labels.Selector) []*apiv1.Instance {
+	var selected []*apiv1.Instance
+	for _, instance := range instances {
+		if selector.Matches(labels.Set(instance.Labels)) {
+			selected = append(selected, instance)
+		}
+	}
+	return selected
+}
+
+// pullBundleArtifact pulls the bundle artifact from the OCI URL, extracts it to the
+// destination directory and returns the paths of the bundle files. The returned module
+// root is the artifact directory if it contains a cue.mod, and empty otherwise.
+func pullBundleArtifact(ctx context.Context, ociURL, dstDir, creds string) ([]string, string, error) {
+	if !strings.HasPrefix(ociURL, apiv1.ArtifactPrefix) {
+		return nil, "", fmt.Errorf("invalid bundle URL '%s', must start with %s", ociURL, apiv1.ArtifactPrefix)
+	}
+
+	spin := StartSpinner(fmt.Sprintf("pulling %s", ociURL))
+	opts := oci.Options(ctx, creds, rootArgs.registryInsecure)
+	files, err := oci.PullBundle(oci.RewriteURL(ociURL, rootArgs.registryMirrors), dstDir, opts)
+	spin.Stop()
+	if err != nil {
+		return nil, "", fmt.Errorf("pulling bundle failed: %w", err)
+	}
+
+	moduleRoot := ""
+	if fs, err := os.Stat(filepath.Join(dstDir, "cue.mod")); err == nil && fs.IsDir() {
+		moduleRoot = dstDir
+	}
+	return files, moduleRoot, nil
+}
@@ -18,13 +18,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"maps"
 	"os"
+	"os/signal"
 	"path"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"cuelang.org/go/cue"
@@ -32,26 +37,37 @@ import (
 	"github.com/fluxcd/pkg/ssa"
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 	"github.com/stefanprodan/timoni/internal/engine"
 	"github.com/stefanprodan/timoni/internal/flags"
+	"github.com/stefanprodan/timoni/internal/oci"
 	"github.com/stefanprodan/timoni/internal/runtime"
 )
 
 var bundleApplyCmd = &cobra.Command{
-	Use:   "apply",
+	Use:   "apply [BUNDLE URL]",
 	Short: "Install or upgrade instances from a bundle",
 	Long: `The bundle apply command installs or upgrades the instances defined in a bundle.
 `,
 	Example: `  # Install all instances from a bundle
   timoni bundle apply -f bundle.cue
 
+  # Install all instances from a bundle artifact stored in a container registry
+  timoni bundle apply oci://ghcr.io/org/bundles/podinfo:v1.0.0
+
   # Do a dry-run upgrade and print the diff
   timoni bundle apply -f bundle.cue \
   --dry-run --diff
 
+  # Validate all instances with a server-side dry run, without applying them
+  timoni bundle apply -f bundle.cue --validate-only
+
   # Force apply instances from multiple bundles
   timoni bundle apply --force \
   -f ./bundle.cue \
@@ -59,8 +75,44 @@ var bundleApplyCmd = &cobra.Command{
 
   # Pass secret values from stdin
   cat ./bundle_secrets.cue | timoni bundle apply -f ./bundle.cue -f -
+
+  # Apply a bundle and print the summary of the changed instances in JSON format
+  timoni bundle apply -f bundle.cue -o json
+
+  # Apply only the frontend instance and the instances it depends on
+  timoni bundle apply -f bundle.cue --instance frontend
+
+  # Revert the changes made to all instances if any instance fails to apply
+  timoni bundle apply -f bundle.cue --atomic
+
+  # Keep the last five revisions of the bundle for 'timoni bundle rollback'
+  timoni bundle apply -f bundle.cue --history-limit 5
+
+  # Delete the instances removed or disabled in the bundle since the last apply
+  timoni bundle apply -f bundle.cue --prune
+
+  # Prune the removed instances and wait until their objects are removed from the cluster
+  timoni bundle apply -f bundle.cue --prune --prune-wait
+
+  # Promote an image to a new tag across all instances
+  timoni bundle apply -f bundle.cue --image-override ghcr.io/org/app=v2.0
+
+  # Apply the bundle on the clusters of two kubeconfig contexts
+  timoni bundle apply -f bundle.cue --context staging --context production
+
+  # Abort the apply if it doesn't finish, including the wait for readiness, in ten minutes
+  timoni bundle apply -f bundle.cue --total-timeout 10m
+
+  # Fail before applying an instance whose pods would exceed the namespace ResourceQuota
+  timoni bundle apply -f bundle.cue --enforce-quota
+
+  # Reapply the bundle every five minutes until interrupted
+  timoni bundle apply -f bundle.cue --reconcile-interval 5m
+
+  # Reapply the bundle every minute, backing off up to ten minutes on consecutive failures
+  timoni bundle apply -f bundle.cue --reconcile-interval 1m --reconcile-max-backoff 10m
 `,
-	Args: cobra.NoArgs,
+	Args: cobra.MaximumNArgs(1),
 	RunE: runBundleApplyCmd,
 }
 
@@ -69,64 +121,271 @@ type bundleApplyFlags struct {
 	files              []string
 	dryrun             bool
 	diff               bool
+	validateOnly       bool
 	wait               bool
 	force              bool
 	overwriteOwnership bool
+	fieldManager       string
+	forceConflicts     bool
+	reconcileInterval  time.Duration
+	reconcileBackoff   time.Duration
+	output             string
+	instances          []string
+	noDeps             bool
+	atomic             bool
+	prune              bool
+	pruneWait          bool
+	historyLimit       int
+	createNamespace    bool
+	updateNamespace    bool
+	applyRetries       int
+	applyRetryDelay    time.Duration
+	contexts           []string
+	failFast           bool
+	totalTimeout       time.Duration
+	checkQuota         bool
+	enforceQuota       bool
+	imageOverrides     flags.ImageOverrides
 	creds              flags.Credentials
 }
 
 var bundleApplyArgs bundleApplyFlags
 
+// defaultApplyRetryDelay is the wait time before the first retry of a failed instance apply.
+const defaultApplyRetryDelay = 5 * time.Second
+
 func init() {
 	bundleApplyCmd.Flags().VarP(&bundleApplyArgs.pkg, bundleApplyArgs.pkg.Type(), bundleApplyArgs.pkg.Shorthand(), bundleApplyArgs.pkg.Description())
 	bundleApplyCmd.Flags().StringSliceVarP(&bundleApplyArgs.files, "file", "f", nil,
 		"The local path to bundle.cue files.")
 	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.force, "force", false,
-		"Recreate immutable Kubernetes resources.")
+		"Recreate immutable Kubernetes resources and apply the instances with no detected changes.")
 	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.overwriteOwnership, "overwrite-ownership", false,
 		"Overwrite instance ownership, if any instances are owned by other Bundles.")
+	bundleApplyCmd.Flags().StringVar(&bundleApplyArgs.fieldManager, "field-manager", apiv1.FieldManager,
+		"The name of the server-side apply field manager recorded in the Kubernetes objects.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.forceConflicts, "force-conflicts", true,
+		"Take the ownership of the fields managed by other field managers, when disabled the apply fails on conflicts.")
 	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.dryrun, "dry-run", false,
 		"Perform a server-side apply dry run.")
 	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.diff, "diff", false,
 		"Perform a server-side apply dry run and prints the diff.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.validateOnly, "validate-only", false,
+		"Build all instances and validate their objects with a server-side apply dry run, exiting with an error if any instance is invalid.")
 	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.wait, "wait", true,
 		"Wait for the applied Kubernetes objects to become ready.")
+	bundleApplyCmd.Flags().DurationVar(&bundleApplyArgs.reconcileInterval, "reconcile-interval", 0,
+		"Keep running and reapply the bundle at the given interval, e.g. '5m'. Disabled when set to zero.")
+	bundleApplyCmd.Flags().DurationVar(&bundleApplyArgs.reconcileBackoff, "reconcile-max-backoff", time.Hour,
+		"The maximum interval between reconciliations, when the interval is doubled after each consecutive failure.")
+	bundleApplyCmd.Flags().StringVarP(&bundleApplyArgs.output, "output", "o", "",
+		"The format in which the apply summary should be printed, can be 'json'.")
+	bundleApplyCmd.Flags().StringSliceVar(&bundleApplyArgs.instances, "instance", nil,
+		"Apply only the instances with the given names and their dependencies. Can be specified multiple times.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.noDeps, "no-deps", false,
+		"Don't apply the dependencies of the instances selected with --instance.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.atomic, "atomic", false,
+		"Roll back all the applied instances to their previous state if any instance fails to apply.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.prune, "prune", false,
+		"Delete the instances of the bundle found in the cluster which are no longer part of the bundle, e.g. disabled instances.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.pruneWait, "prune-wait", false,
+		"Wait for the objects of the pruned instances to be removed from the cluster, reporting the objects stuck with finalizers when the timeout expires.")
+	bundleApplyCmd.Flags().IntVar(&bundleApplyArgs.historyLimit, "history-limit", 0,
+		"The number of bundle revisions kept in the cluster for rollback, older revisions are deleted. Disabled when set to zero.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.createNamespace, "create-namespace", true,
+		"Create the instance namespace if not present, with the labels and annotations set in the instance 'namespaceMetadata'.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.updateNamespace, "update-namespace", false,
+		"Set the labels and annotations from the instance 'namespaceMetadata' on the namespaces that already exist.")
+	bundleApplyCmd.Flags().IntVar(&bundleApplyArgs.applyRetries, "apply-retries", 0,
+		"The number of times an instance apply is retried when the cluster returns a transient error, such as an admission webhook not being ready. Can be overridden per instance with 'applyRetries'.")
+	bundleApplyCmd.Flags().DurationVar(&bundleApplyArgs.applyRetryDelay, "apply-retry-delay", defaultApplyRetryDelay,
+		"The wait time before retrying a failed instance apply, doubled after each attempt.")
+	bundleApplyCmd.Flags().StringSliceVar(&bundleApplyArgs.contexts, "context", nil,
+		"Apply the bundle on the clusters of the given kubeconfig contexts. Can be specified multiple times.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.failFast, "fail-fast", false,
+		"Stop applying the bundle on the remaining kubeconfig contexts when the apply fails on one of them. Runtime clusters always stop on the first failure.")
+	bundleApplyCmd.Flags().DurationVar(&bundleApplyArgs.totalTimeout, "total-timeout", 0,
+		"The deadline for the entire apply, including the bundle build, the module pulls, the apply and the wait of all instances. Disabled when set to zero.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.checkQuota, "check-quota", false,
+		"Warn when the resource requests and limits of an instance exceed the ResourceQuotas of its namespace.")
+	bundleApplyCmd.Flags().BoolVar(&bundleApplyArgs.enforceQuota, "enforce-quota", false,
+		"Fail the apply when the resource requests and limits of an instance exceed the ResourceQuotas of its namespace. Implies --check-quota.")
+	bundleApplyCmd.Flags().Var(&bundleApplyArgs.imageOverrides, bundleApplyArgs.imageOverrides.Type(), bundleApplyArgs.imageOverrides.Description())
 	bundleApplyCmd.Flags().Var(&bundleApplyArgs.creds, bundleApplyArgs.creds.Type(), bundleApplyArgs.creds.Description())
 	bundleCmd.AddCommand(bundleApplyCmd)
 }
 
-func runBundleApplyCmd(cmd *cobra.Command, _ []string) error {
-	start := time.Now()
+func runBundleApplyCmd(cmd *cobra.Command, args []string) error {
 	files := bundleApplyArgs.files
-	if len(files) == 0 {
+	if len(files) == 0 && len(args) == 0 {
 		return errors.New("no bundle provided with -f")
 	}
-	var stdinFile string
-	for i, file := range files {
-		if file == "-" {
-			stdinFile, err := saveReaderToFile(cmd.InOrStdin())
-			if err != nil {
-				return err
-			}
-			files[i] = stdinFile
+	if o := bundleApplyArgs.output; o != "" && o != "json" {
+		return fmt.Errorf("unknown --output=%s, can be json", o)
+	}
+	if bundleApplyArgs.applyRetries < 0 {
+		return errors.New("--apply-retries can't be negative")
+	}
+	if bundleApplyArgs.prune && len(bundleApplyArgs.instances) > 0 {
+		return errors.New("--prune can't be used with --instance")
+	}
+	if bundleApplyArgs.pruneWait && !bundleApplyArgs.prune {
+		return errors.New("--prune-wait can't be used without --prune")
+	}
+	if bundleApplyArgs.validateOnly && (bundleApplyArgs.dryrun || bundleApplyArgs.diff ||
+		bundleApplyArgs.atomic || bundleApplyArgs.prune || bundleApplyArgs.reconcileInterval > 0) {
+		return errors.New("--validate-only can't be used with --dry-run, --diff, --atomic, --prune or --reconcile-interval")
+	}
+	if len(bundleApplyArgs.contexts) > 0 && (len(bundleArgs.runtimeFiles) > 0 ||
+		strings.Trim(bundleArgs.runtimeCluster, "*") != "" || strings.Trim(bundleArgs.runtimeClusterGroup, "*") != "") {
+		return errors.New("--context can't be used with --runtime, --runtime-cluster or --runtime-group")
+	}
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
+	}
+	defer removeStdinFile()
+
+	bundleURL := ""
+	if len(args) == 1 {
+		bundleURL = args[0]
+	}
+
+	if bundleApplyArgs.reconcileInterval > 0 {
+		if bundleApplyArgs.dryrun || bundleApplyArgs.diff {
+			return errors.New("--reconcile-interval can't be used with --dry-run or --diff")
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return reconcileBundle(ctx, bundleApplyArgs.reconcileInterval, bundleApplyArgs.reconcileBackoff, func(ctx context.Context) error {
+			return applyBundle(ctx, cmd.OutOrStdout(), bundleURL, files)
+		})
+	}
+
+	return applyBundle(cmd.Context(), cmd.OutOrStdout(), bundleURL, files)
+}
+
+// reconcileBundle calls the apply function at the given interval until the context is canceled.
+// Apply errors are logged and retried with an exponential backoff capped at maxBackoff.
+func reconcileBundle(ctx context.Context, interval, maxBackoff time.Duration, apply func(ctx context.Context) error) error {
+	log := LoggerFrom(ctx)
+	failures := 0
+	for cycle := 1; ; cycle++ {
+		if ctx.Err() != nil {
 			break
 		}
+
+		start := time.Now()
+		if err := apply(ctx); err != nil {
+			failures++
+			log.Error(err, fmt.Sprintf("reconciliation #%d failed", cycle))
+		} else {
+			failures = 0
+			log.Info(fmt.Sprintf("reconciliation #%d finished in %s", cycle, time.Since(start).Round(time.Second)))
+		}
+
+		next := reconcileBackoff(interval, maxBackoff, failures)
+		if failures > 0 {
+			log.Info(fmt.Sprintf("next reconciliation in %s (backoff after %d consecutive failures)", next, failures))
+		} else {
+			log.Info(fmt.Sprintf("next reconciliation in %s", next))
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(next):
+		}
 	}
-	if stdinFile != "" {
-		defer os.Remove(stdinFile)
+
+	log.Info("reconciliation stopped")
+	return nil
+}
+
+// reconcileBackoff returns the interval doubled for each consecutive failure,
+// capped at maxBackoff. The interval is never reduced below its initial value.
+func reconcileBackoff(interval, maxBackoff time.Duration, failures int) time.Duration {
+	next := interval
+	for i := 0; i < failures && next < maxBackoff; i++ {
+		next *= 2
+	}
+	if next > maxBackoff && maxBackoff > interval {
+		next = maxBackoff
 	}
+	return next
+}
 
+// applyBundle builds the bundle from the given files and applies its instances on the selected clusters.
+// If a bundle URL is given, the bundle artifact is pulled and its files are merged with the given files.
+// The summary of the instance changes is logged per cluster, or printed to out in JSON format.
+func applyBundle(ctx context.Context, out io.Writer, bundleURL string, files []string) error {
+	start := time.Now()
 	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(tmpDir)
 
-	ctx, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+	// The phase is reported when the total timeout is exceeded.
+	var deadline time.Time
+	phase := "building the bundle"
+	if bundleApplyArgs.totalTimeout > 0 {
+		var cancelTotal context.CancelFunc
+		ctx, cancelTotal = context.WithTimeout(ctx, bundleApplyArgs.totalTimeout)
+		defer cancelTotal()
+		deadline, _ = ctx.Deadline()
+	}
+	withPhase := func(err error) error {
+		if err != nil && !deadline.IsZero() && !time.Now().Before(deadline) {
+			return fmt.Errorf("exceeded the total timeout of %s while %s: %w", bundleApplyArgs.totalTimeout, phase, err)
+		}
+		return err
+	}
+
+	parentCtx := ctx
+	ctx, cancel := context.WithTimeout(ctx, rootArgs.timeout)
 	defer cancel()
 
+	moduleRoot := bundleArgs.moduleRoot
+	if bundleURL != "" {
+		phase = "pulling the bundle artifact"
+		bundleDir, err := os.MkdirTemp("", apiv1.FieldManager)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(bundleDir)
+
+		pulled, pulledRoot, err := pullBundleArtifact(ctx, bundleURL, bundleDir, bundleApplyArgs.creds.String())
+		if err != nil {
+			return withPhase(err)
+		}
+		files = append(pulled, files...)
+		if moduleRoot == "" {
+			moduleRoot = pulledRoot
+		}
+	}
+
 	cuectx := cuecontext.New()
 	bm := engine.NewBundleBuilder(cuectx, files)
+	bm.SetLogger(engineLogger(LoggerFrom(ctx)))
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(moduleRoot)
+	bm.SetOverlays(bundleArgs.overlays)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	var policy *engine.ValuesPolicy
+	if bundleArgs.policy != "" {
+		phase = "pulling the values policy"
+		policy, err = pullValuesPolicy(ctx, cuectx, bundleArgs.policy, bundleApplyArgs.creds.String())
+		if err != nil {
+			return withPhase(err)
+		}
+	}
 
 	runtimeValues := make(map[string]string)
 
@@ -140,6 +399,9 @@ func runBundleApplyCmd(cmd *cobra.Command, _ []string) error {
 	}
 
 	clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+	if len(bundleApplyArgs.contexts) > 0 {
+		clusters = contextClusters(bundleApplyArgs.contexts)
+	}
 	if len(clusters) == 0 {
 		return errors.New("no cluster found")
 	}
@@ -147,8 +409,16 @@ func runBundleApplyCmd(cmd *cobra.Command, _ []string) error {
 	ctxPull, cancel := context.WithTimeout(ctx, rootArgs.timeout)
 	defer cancel()
 
-	for _, cluster := range clusters {
+	var summary bundleApplySummary
+
+	var rb *bundleRollback
+	if bundleApplyArgs.atomic && !bundleApplyArgs.dryrun && !bundleApplyArgs.diff {
+		rb = &bundleRollback{}
+	}
+
+	applyCluster := func(cluster apiv1.RuntimeCluster) error {
 		kubeconfigArgs.Context = &cluster.KubeContext
+		phase = "building the bundle"
 
 		clusterValues := make(map[string]string)
 
@@ -180,17 +450,45 @@ func runBundleApplyCmd(cmd *cobra.Command, _ []string) error {
 			return describeErr(workspace, "failed to parse bundle", err)
 		}
 
-		v, err := bm.Build()
+		v, warnings, err := bm.Build()
 		if err != nil {
 			return describeErr(tmpDir, "failed to build bundle", err)
 		}
 
+		if err := reportBundleWarnings(LoggerFrom(ctx), warnings); err != nil {
+			return err
+		}
+
 		bundle, err := bm.GetBundle(v)
 		if err != nil {
 			return err
 		}
 
-		log := LoggerBundle(cmd.Context(), bundle.Name, cluster.Name)
+		log := LoggerBundle(ctx, bundle.Name, cluster.Name)
+		overrideBundleNamespace(log, bundle)
+
+		if len(bundle.Instances) == 0 {
+			log.Info(noBundleInstancesMsg)
+			if bundleApplyArgs.prune {
+				dryrun := bundleApplyArgs.dryrun || bundleApplyArgs.diff
+				if err := pruneBundleInstances(logr.NewContext(ctx, log), rm, bundle, cluster.Name, dryrun); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if len(bundleApplyArgs.instances) > 0 {
+			if err := bundle.SelectInstances(bundleApplyArgs.instances, !bundleApplyArgs.noDeps); err != nil {
+				return err
+			}
+		}
+
+		if policy != nil {
+			if err := validateValuesPolicy(policy, bundle, workspace); err != nil {
+				return err
+			}
+		}
 
 		if !bundleApplyArgs.overwriteOwnership {
 			err = bundleInstancesOwnershipConflicts(bundle.Instances)
@@ -199,13 +497,25 @@ func runBundleApplyCmd(cmd *cobra.Command, _ []string) error {
 			}
 		}
 
-		for _, instance := range bundle.Instances {
-			spin := StartSpinner(fmt.Sprintf("pulling %s", instance.Module.Repository))
-			pullErr := fetchBundleInstanceModule(ctxPull, instance, tmpDir)
-			spin.Stop()
-			if pullErr != nil {
-				return pullErr
-			}
+		if err := bundleInstancesInvalidWaitFor(bundle.Instances); err != nil {
+			return err
+		}
+
+		if err := bundleInstancesMissingSecrets(ctx, rm, bundle.Instances); err != nil {
+			return err
+		}
+
+		phase = "resolving the instance modules"
+		if err := bundleInstancesMissingModules(ctxPull, bundle.Instances); err != nil {
+			return err
+		}
+
+		phase = "pulling the instance modules"
+		spin := StartSpinner(fmt.Sprintf("pulling %d module(s)", len(bundle.Instances)))
+		pullErr := fetchBundleInstanceModules(ctxPull, bundle.Instances, tmpDir)
+		spin.Stop()
+		if pullErr != nil {
+			return pullErr
 		}
 
 		kubeVersion, err := runtime.ServerVersion(kubeconfigArgs)
@@ -218,36 +528,273 @@ func runBundleApplyCmd(cmd *cobra.Command, _ []string) error {
 			startMsg = fmt.Sprintf("%s on %s", startMsg, colorizeSubject(cluster.Group))
 		}
 
-		if bundleApplyArgs.dryrun || bundleApplyArgs.diff {
+		switch {
+		case bundleApplyArgs.validateOnly:
+			startMsg = strings.Replace(startMsg, "applying", "validating", 1)
 			log.Info(fmt.Sprintf("%s %s", startMsg, colorizeDryRun("(server dry run)")))
-		} else {
+		case bundleApplyArgs.dryrun || bundleApplyArgs.diff:
+			log.Info(fmt.Sprintf("%s %s", startMsg, colorizeDryRun("(server dry run)")))
+		default:
 			log.Info(startMsg)
 		}
 
+		var rev *bundleRevision
+		if bundleApplyArgs.historyLimit > 0 && !bundleApplyArgs.validateOnly &&
+			!bundleApplyArgs.dryrun && !bundleApplyArgs.diff {
+			rev = &bundleRevision{}
+		}
+
+		summary.Bundle = bundle.Name
+		var results []bundleInstanceResult
+		var invalid []string
 		for _, instance := range bundle.Instances {
 			instance.Cluster = cluster.Name
-			if err := applyBundleInstance(logr.NewContext(ctx, log), cuectx, instance, kubeVersion, tmpDir); err != nil {
+			phase = fmt.Sprintf("applying instance %s", instance.Name)
+
+			// Instances with a custom timeout are not bound by the global timeout.
+			instanceCtx, instanceCancel := ctx, context.CancelFunc(func() {})
+			if instance.Timeout > 0 {
+				instanceCtx, instanceCancel = context.WithTimeout(parentCtx, instance.Timeout)
+			}
+			status, err := applyBundleInstance(logr.NewContext(instanceCtx, log), cuectx, instance, kubeVersion, tmpDir, rb, rev)
+			instanceCancel()
+			if err != nil && bundleApplyArgs.validateOnly {
+				log.Error(err, fmt.Sprintf("instance %s validation failed", instance.Name))
+				invalid = append(invalid, instance.Name)
+				continue
+			}
+			if err != nil {
+				if rb != nil {
+					return rb.rollback(logr.NewContext(ctx, log), err)
+				}
+				return err
+			}
+			results = append(results, bundleInstanceResult{
+				Name:      instance.Name,
+				Namespace: instance.Namespace,
+				Cluster:   cluster.Name,
+				Status:    status,
+			})
+		}
+		summary.add(results...)
+
+		if len(invalid) > 0 {
+			return fmt.Errorf("validation failed for %d instance(s): %s", len(invalid), strings.Join(invalid, ", "))
+		}
+
+		if bundleApplyArgs.prune {
+			phase = "pruning the bundle instances"
+			dryrun := bundleApplyArgs.dryrun || bundleApplyArgs.diff
+			if err := pruneBundleInstances(logr.NewContext(ctx, log), rm, bundle, cluster.Name, dryrun); err != nil {
+				return err
+			}
+		}
+
+		if rev != nil {
+			phase = "storing the bundle revision"
+			revision, err := rev.store(ctx, rm, bundle.Name, bundleApplyArgs.historyLimit)
+			if err != nil {
 				return err
 			}
+			log.V(1).Info("stored bundle revision", "revision", revision)
 		}
 
 		elapsed := time.Since(start)
-		if bundleApplyArgs.dryrun || bundleApplyArgs.diff {
+		if bundleApplyArgs.validateOnly {
+			log.Info(fmt.Sprintf("validated successfully %s",
+				colorizeDryRun("(server dry run)")))
+		} else if bundleApplyArgs.dryrun || bundleApplyArgs.diff {
 			log.Info(fmt.Sprintf("applied successfully %s",
 				colorizeDryRun("(server dry run)")))
 		} else {
 			log.Info(fmt.Sprintf("applied successfully in %s", elapsed.Round(time.Second)))
+			log.Info(newBundleApplySummary(bundle.Name, results).String())
+		}
+		return nil
+	}
+
+	// The runtime clusters are applied in order, e.g. staging before production,
+	// while the kubeconfig contexts are independent targets unless fail-fast is set.
+	failFast := bundleApplyArgs.failFast || len(bundleApplyArgs.contexts) == 0
+
+	var failed []string
+	for _, cluster := range clusters {
+		err := withPhase(applyCluster(cluster))
+		if len(clusters) > 1 {
+			summary.addCluster(cluster.Name, err)
+		}
+		if err == nil {
+			continue
 		}
+		if failFast || rb != nil {
+			return err
+		}
+		LoggerFrom(ctx).Error(err, fmt.Sprintf("apply failed on cluster %s", cluster.Name))
+		failed = append(failed, cluster.Name)
+	}
+
+	if bundleApplyArgs.output == "json" && !bundleApplyArgs.dryrun && !bundleApplyArgs.diff && !bundleApplyArgs.validateOnly {
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return fmt.Errorf("summary JSON conversion failed: %w", err)
+		}
+		data = append(data, "\n"...)
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("apply failed on %d cluster(s): %s", len(failed), strings.Join(failed, ", "))
 	}
 	return nil
 }
 
-func fetchBundleInstanceModule(ctx context.Context, instance *engine.BundleInstance, rootDir string) error {
+// contextClusters returns a cluster for each of the given kubeconfig contexts,
+// named and grouped after the context.
+func contextClusters(contexts []string) []apiv1.RuntimeCluster {
+	var clusters []apiv1.RuntimeCluster
+	for _, kubeContext := range slices.Compact(slices.Clone(contexts)) {
+		clusters = append(clusters, apiv1.RuntimeCluster{
+			Name:        kubeContext,
+			Group:       kubeContext,
+			KubeContext: kubeContext,
+		})
+	}
+	return clusters
+}
+
+const (
+	instanceCreated   = "created"
+	instanceUpdated   = "updated"
+	instanceUnchanged = "unchanged"
+	instanceSkipped   = "skipped"
+)
+
+// bundleInstanceResult holds the outcome of applying a bundle instance on a cluster.
+type bundleInstanceResult struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Cluster   string `json:"cluster"`
+	Status    string `json:"status"`
+}
+
+// bundleApplySummary aggregates the instance results of a bundle apply.
+type bundleApplySummary struct {
+	Bundle    string                 `json:"bundle"`
+	Created   int                    `json:"created"`
+	Updated   int                    `json:"updated"`
+	Unchanged int                    `json:"unchanged"`
+	Skipped   int                    `json:"skipped"`
+	Instances []bundleInstanceResult `json:"instances"`
+	Clusters  []bundleClusterResult  `json:"clusters,omitempty"`
+}
+
+// bundleClusterResult holds the outcome of applying a bundle on a cluster,
+// reported when the bundle is applied on multiple clusters.
+type bundleClusterResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func newBundleApplySummary(bundle string, results []bundleInstanceResult) *bundleApplySummary {
+	s := &bundleApplySummary{Bundle: bundle}
+	s.add(results...)
+	return s
+}
+
+func (s *bundleApplySummary) add(results ...bundleInstanceResult) {
+	for _, r := range results {
+		switch r.Status {
+		case instanceCreated:
+			s.Created++
+		case instanceUpdated:
+			s.Updated++
+		case instanceUnchanged:
+			s.Unchanged++
+		case instanceSkipped:
+			s.Skipped++
+		}
+		s.Instances = append(s.Instances, r)
+	}
+}
+
+func (s *bundleApplySummary) addCluster(name string, err error) {
+	result := bundleClusterResult{Name: name, Status: "succeeded"}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	s.Clusters = append(s.Clusters, result)
+}
+
+func (s *bundleApplySummary) String() string {
+	msg := fmt.Sprintf("%d instance(s) unchanged, %d updated, %d created", s.Unchanged, s.Updated, s.Created)
+	if s.Skipped > 0 {
+		msg = fmt.Sprintf("%s, %d skipped", msg, s.Skipped)
+	}
+	return msg
+}
+
+// maxConcurrentPulls is the number of modules pulled in parallel by fetchBundleInstanceModules.
+const maxConcurrentPulls = 4
+
+// fetchBundleInstanceModules pulls the modules of the bundle instances in parallel.
+// The module layers are shared between the pulls, so that a module referenced
+// by multiple instances at the same digest is downloaded once.
+func fetchBundleInstanceModules(ctx context.Context, instances []*engine.BundleInstance, rootDir string) error {
+	layers, err := oci.NewLayerCache(rootArgs.cacheDir)
+	if err != nil {
+		return err
+	}
+	defer layers.Close()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentPulls)
+	errs := make([]error, len(instances))
+	for i, instance := range instances {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, instance *engine.BundleInstance) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fetchBundleInstanceModule(ctx, instance, rootDir, layers)
+		}(i, instance)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// fetchBundleInstanceModule pulls the module of the bundle instance to '<rootDir>/<instance>/module'
+// and sets the instance module reference to the pulled version and digest.
+// If a layer cache is given, the module layers are read from and stored in it.
+func fetchBundleInstanceModule(ctx context.Context, instance *engine.BundleInstance, rootDir string, layers *oci.LayerCache) error {
 	modDir := path.Join(rootDir, instance.Name)
 	if err := os.MkdirAll(modDir, os.ModePerm); err != nil {
 		return err
 	}
 
+	fetcher := newBundleInstanceFetcher(ctx, instance, modDir)
+	fetcher.SetLayerCache(layers)
+	mod, err := fetcher.Fetch()
+	if err != nil {
+		return err
+	}
+
+	if instance.Module.Digest != "" && mod.Digest != instance.Module.Digest {
+		return fmt.Errorf("the upstream digest %s of version %s doesn't match the specified digest %s",
+			mod.Digest, instance.Module.Version, instance.Module.Digest)
+	}
+
+	instance.Module = *mod
+	return nil
+}
+
+// newBundleInstanceFetcher returns a module fetcher for the bundle instance.
+// If the instance module is pinned to a digest with the latest version, the module is fetched by digest.
+func newBundleInstanceFetcher(ctx context.Context, instance *engine.BundleInstance, modDir string) *engine.Fetcher {
 	moduleVersion := instance.Module.Version
 	if moduleVersion == apiv1.LatestVersion && instance.Module.Digest != "" {
 		moduleVersion = "@" + instance.Module.Digest
@@ -262,21 +809,52 @@ func fetchBundleInstanceModule(ctx context.Context, instance *engine.BundleInsta
 		bundleApplyArgs.creds.String(),
 		rootArgs.registryInsecure,
 	)
-	mod, err := fetcher.Fetch()
-	if err != nil {
-		return err
+	fetcher.SetRetry(rootArgs.registryRetries, rootArgs.registryRetryDelay)
+	fetcher.SetMirrors(rootArgs.registryMirrors)
+	fetcher.SetVerify(bundleVerifyOptions())
+	return fetcher
+}
+
+// bundleInstancesMissingModules checks in parallel that the modules of all
+// the bundle instances exist, without pulling them, and returns an error
+// listing the instances with missing or unreachable modules.
+func bundleInstancesMissingModules(ctx context.Context, instances []*engine.BundleInstance) error {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentPulls)
+	errs := make([]error, len(instances))
+	for i, instance := range instances {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, instance *engine.BundleInstance) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = newBundleInstanceFetcher(ctx, instance, "").Resolve()
+		}(i, instance)
 	}
+	wg.Wait()
 
-	if instance.Module.Digest != "" && mod.Digest != instance.Module.Digest {
-		return fmt.Errorf("the upstream digest %s of version %s doesn't match the specified digest %s",
-			mod.Digest, instance.Module.Version, instance.Module.Digest)
+	var missing []string
+	for i, err := range errs {
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("instance \"%s\" references module \"%s\" version \"%s\": %s",
+				instances[i].Name, instances[i].Module.Repository, instances[i].Module.Version, err.Error()))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing module references: %s", strings.Join(missing, "; "))
 	}
 
-	instance.Module = *mod
 	return nil
 }
 
-func applyBundleInstance(ctx context.Context, cuectx *cue.Context, instance *engine.BundleInstance, kubeVersion string, rootDir string) error {
+// applyBundleInstance applies the instance objects on the cluster and returns
+// whether the instance was created, updated or left unchanged.
+// If the digest of the objects matches the one stored by the last apply,
+// the instance is skipped, unless force is set.
+// If a rollback is given, the instance state is recorded before any changes are made.
+// If a revision is given, the applied objects are added to it once the instance is stored.
+func applyBundleInstance(ctx context.Context, cuectx *cue.Context, instance *engine.BundleInstance, kubeVersion string, rootDir string,
+	rb *bundleRollback, rev *bundleRevision) (string, error) {
 	log := LoggerBundleInstance(ctx, instance.Bundle, instance.Cluster, instance.Name)
 
 	modDir := path.Join(rootDir, instance.Name, "module")
@@ -287,14 +865,16 @@ func applyBundleInstance(ctx context.Context, cuectx *cue.Context, instance *eng
 		modDir,
 		bundleApplyArgs.pkg.String(),
 	)
+	builder.SetTimoniVersion(VERSION)
+	builder.SetLogger(engineLogger(log))
 
 	if err := builder.WriteSchemaFile(); err != nil {
-		return err
+		return "", err
 	}
 
 	modName, err := builder.GetModuleName()
 	if err != nil {
-		return err
+		return "", err
 	}
 	instance.Module.Name = modName
 
@@ -302,47 +882,74 @@ func applyBundleInstance(ctx context.Context, cuectx *cue.Context, instance *eng
 		colorizeSubject(instance.Module.Name), colorizeSubject(instance.Module.Version)))
 	err = builder.WriteValuesFileWithDefaults(instance.Values)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	builder.SetVersionInfo(instance.Module.Version, kubeVersion)
 
 	buildResult, err := builder.Build()
 	if err != nil {
-		return describeErr(modDir, "build failed for "+instance.Name, err)
+		return "", describeErr(modDir, "build failed for "+instance.Name, err)
 	}
 
 	finalValues, err := builder.GetDefaultValues()
 	if err != nil {
-		return fmt.Errorf("failed to extract values: %w", err)
+		return "", fmt.Errorf("failed to extract values: %w", err)
 	}
 
 	bundleApplySets, err := builder.GetApplySets(buildResult)
 	if err != nil {
-		return fmt.Errorf("failed to extract objects: %w", err)
+		return "", fmt.Errorf("failed to extract objects: %w", err)
 	}
 
 	var objects []*unstructured.Unstructured
 	for _, set := range bundleApplySets {
 		objects = append(objects, set.Objects...)
 	}
+	engine.OverrideImages(objects, bundleApplyArgs.imageOverrides)
 
-	rm, err := runtime.NewResourceManager(kubeconfigArgs)
+	if _, err := runtime.MatchWaitConditions(objects, instance.WaitFor); err != nil {
+		return "", fmt.Errorf("invalid %s of instance %s: %w", apiv1.BundleWaitForSelector, instance.Name, err)
+	}
+
+	// The hooks are applied separately from the apply sets they are defined in.
+	var hooks runtime.Hooks
+	mainSets := make([]engine.ResourceSet, 0, len(bundleApplySets))
+	for _, set := range bundleApplySets {
+		setObjects, setHooks, err := runtime.SplitHooks(set.Objects)
+		if err != nil {
+			return "", err
+		}
+		hooks.Add(setHooks)
+		if len(setObjects) > 0 {
+			mainSets = append(mainSets, engine.ResourceSet{Name: set.Name, Objects: setObjects})
+		}
+	}
+
+	rm, err := runtime.NewResourceManagerWithOptions(kubeconfigArgs, runtime.ManagerOptions{
+		FieldManager:   bundleApplyArgs.fieldManager,
+		ForceConflicts: bundleApplyArgs.forceConflicts,
+	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	rm.SetOwnerLabels(objects, instance.Name, instance.Namespace)
 
 	exists := false
 	sm := runtime.NewStorageManager(rm)
-	if _, err = sm.Get(ctx, instance.Name, instance.Namespace); err == nil {
+	stored, err := sm.Get(ctx, instance.Name, instance.Namespace)
+	if err == nil {
 		exists = true
 	}
 
 	nsExists, err := sm.NamespaceExists(ctx, instance.Namespace)
 	if err != nil {
-		return fmt.Errorf("instance init failed: %w", err)
+		return "", fmt.Errorf("instance init failed: %w", err)
+	}
+	if !nsExists && !bundleApplyArgs.createNamespace {
+		return "", fmt.Errorf("instance init failed: namespace %s not found, "+
+			"create it or enable --create-namespace", instance.Namespace)
 	}
 
 	im := runtime.NewInstanceManager(instance.Name, instance.Namespace, finalValues, instance.Module)
@@ -350,15 +957,41 @@ func applyBundleInstance(ctx context.Context, cuectx *cue.Context, instance *eng
 	if im.Instance.Labels == nil {
 		im.Instance.Labels = make(map[string]string)
 	}
+	maps.Copy(im.Instance.Labels, instance.Labels)
 	im.Instance.Labels[apiv1.BundleNameLabelKey] = instance.Bundle
+	im.Instance.Bundle = instance.Bundle
+	im.Instance.DependsOn = instance.DependsOn
+	if instance.DeletePolicy != apiv1.DeletePolicyDelete {
+		im.Instance.DeletePolicy = instance.DeletePolicy
+	}
 
 	if err := im.AddObjects(objects); err != nil {
-		return fmt.Errorf("adding objects to instance failed: %w", err)
+		return "", fmt.Errorf("adding objects to instance failed: %w", err)
 	}
 
+	digest, err := runtime.ObjectsDigest(objects)
+	if err != nil {
+		return "", fmt.Errorf("computing objects digest failed: %w", err)
+	}
+	im.Instance.Digest = digest
+
 	staleObjects, err := sm.GetStaleObjects(ctx, &im.Instance)
 	if err != nil {
-		return fmt.Errorf("getting stale objects failed: %w", err)
+		return "", fmt.Errorf("getting stale objects failed: %w", err)
+	}
+
+	if nsExists && (bundleApplyArgs.checkQuota || bundleApplyArgs.enforceQuota) {
+		if err := checkInstanceQuotas(ctx, log, rm.Client(), instance, objects, exists); err != nil {
+			return "", err
+		}
+	}
+
+	if bundleApplyArgs.validateOnly {
+		if err := validateBundleInstance(logr.NewContext(ctx, log), rm, instance, objects, nsExists); err != nil {
+			return "", err
+		}
+		log.Info(colorizeJoin("validated successfully", colorizeDryRun("(server dry run)")))
+		return "", nil
 	}
 
 	if bundleApplyArgs.dryrun || bundleApplyArgs.diff {
@@ -369,25 +1002,57 @@ func applyBundleInstance(ctx context.Context, cuectx *cue.Context, instance *eng
 		if err := instanceDryRunDiff(
 			logr.NewContext(ctx, log),
 			rm,
-			objects,
+			bundleApplySets,
 			staleObjects,
 			nsExists,
 			rootDir,
 			bundleApplyArgs.diff,
 		); err != nil {
-			return err
+			return "", err
 		}
 
 		log.Info(colorizeJoin("applied successfully", colorizeDryRun("(server dry run)")))
-		return nil
+		return "", nil
+	}
+
+	// The instances are always applied when reconciling, to correct the drift of their objects.
+	skip := exists && !bundleApplyArgs.force && bundleApplyArgs.reconcileInterval == 0 &&
+		instanceUpToDate(stored, &im.Instance)
+	if skip {
+		if skip, err = instanceObjectsExist(ctx, rm.Client(), objects); err != nil {
+			return "", fmt.Errorf("checking the instance objects failed: %w", err)
+		}
+	}
+	if skip {
+		log.Info(fmt.Sprintf("skipping %s in namespace %s, no changes detected",
+			colorizeSubject(instance.Name), colorizeSubject(instance.Namespace)))
+		if rev != nil {
+			rev.add(stored, objects)
+		}
+		return instanceSkipped, nil
+	}
+
+	if rb != nil {
+		if err := rb.record(ctx, rm, sm, instance, objects, !nsExists); err != nil {
+			return "", err
+		}
+	}
+
+	if !nsExists || bundleApplyArgs.updateNamespace {
+		if err := sm.ApplyNamespace(ctx, instance.Namespace, instance.NamespaceMetadata, bundleApplyArgs.updateNamespace); err != nil {
+			return "", fmt.Errorf("instance init failed: %w", err)
+		}
+		if nsExists {
+			log.Info(colorizeJoin(colorizeSubject("Namespace/"+instance.Namespace), ssa.ConfiguredAction))
+		}
 	}
 
 	if !exists {
 		log.Info(fmt.Sprintf("installing %s in namespace %s",
 			colorizeSubject(instance.Name), colorizeSubject(instance.Namespace)))
 
-		if err := sm.Apply(ctx, &im.Instance, true); err != nil {
-			return fmt.Errorf("instance init failed: %w", err)
+		if err := sm.Apply(ctx, &im.Instance, false); err != nil {
+			return "", fmt.Errorf("instance init failed: %w", err)
 		}
 
 		if !nsExists {
@@ -398,57 +1063,141 @@ func applyBundleInstance(ctx context.Context, cuectx *cue.Context, instance *eng
 			colorizeSubject(instance.Name), colorizeSubject(instance.Namespace)))
 	}
 
-	applyOpts := runtime.ApplyOptions(bundleApplyArgs.force, rootArgs.timeout)
+	timeout := rootArgs.timeout
+	if instance.Timeout > 0 {
+		timeout = instance.Timeout
+	}
+
+	// The waits are bound by the deadline of the entire bundle apply.
+	if deadline, ok := ctx.Deadline(); ok && bundleApplyArgs.totalTimeout > 0 && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	applyOpts := runtime.ApplyOptions(bundleApplyArgs.force, timeout)
 	applyOpts.WaitInterval = 5 * time.Second
 
 	waitOptions := ssa.WaitOptions{
 		Interval: applyOpts.WaitInterval,
-		Timeout:  rootArgs.timeout,
+		Timeout:  timeout,
 		FailFast: true,
 	}
 
-	for _, set := range bundleApplySets {
-		if len(bundleApplySets) > 1 {
-			log.Info(fmt.Sprintf("applying %s", set.Name))
-		}
+	status := instanceUnchanged
+	if !exists {
+		status = instanceCreated
+	}
 
-		cs, err := rm.ApplyAllStaged(ctx, set.Objects, applyOpts)
+	retryOpts := runtime.ApplyRetryOptions{
+		Retries: bundleApplyArgs.applyRetries,
+		Delay:   bundleApplyArgs.applyRetryDelay,
+		OnRetry: func(attempt int, delay time.Duration, err error) {
+			log.Info(colorizeJoin(colorizeWarning(fmt.Sprintf("apply attempt %d failed", attempt)),
+				fmt.Sprintf("retrying in %s: %s", delay, err)))
+		},
+	}
+	if instance.ApplyRetries != nil {
+		retryOpts.Retries = *instance.ApplyRetries
+	}
+
+	applyHooks := func(ctx context.Context, hook string, hookObjects []*unstructured.Unstructured) error {
+		log.Info(fmt.Sprintf("applying %s hooks", hook))
+		var cs *ssa.ChangeSet
+		err := runtime.RetryApply(ctx, retryOpts, func() (err error) {
+			cs, err = runtime.ApplyAllOrdered(ctx, rm, hookObjects, applyOpts)
+			return err
+		})
 		if err != nil {
 			return err
 		}
 		for _, change := range cs.Entries {
 			log.Info(colorizeJoin(change))
+			if status == instanceUnchanged && change.Action != ssa.UnchangedAction {
+				status = instanceUpdated
+			}
+		}
+		return nil
+	}
+
+	applyObjects := func(ctx context.Context) error {
+		for _, set := range mainSets {
+			if len(mainSets) > 1 {
+				log.Info(fmt.Sprintf("applying %s", set.Name))
+			}
+
+			log.V(1).Info("applying objects", "set", set.Name, "objects", len(set.Objects))
+			var cs *ssa.ChangeSet
+			err := runtime.RetryApply(ctx, retryOpts, func() (err error) {
+				cs, err = runtime.ApplyAllOrdered(ctx, rm, set.Objects, applyOpts)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for _, change := range cs.Entries {
+				log.Info(colorizeJoin(change))
+				if status == instanceUnchanged && change.Action != ssa.UnchangedAction {
+					status = instanceUpdated
+				}
+			}
+
+			if bundleApplyArgs.wait {
+				spin := StartSpinner(fmt.Sprintf("waiting for %v resource(s) to become ready...", len(set.Objects)))
+				err = rm.Wait(set.Objects, waitOptions)
+				spin.Stop()
+				if err != nil {
+					return err
+				}
+				log.Info(fmt.Sprintf("%s resources %s", set.Name, colorizeReady("ready")))
+			}
 		}
 
-		if bundleApplyArgs.wait {
-			spin := StartSpinner(fmt.Sprintf("waiting for %v resource(s) to become ready...", len(set.Objects)))
-			err = rm.Wait(set.Objects, waitOptions)
+		if bundleApplyArgs.wait && len(instance.WaitFor) > 0 {
+			waitCtx, cancel := context.WithTimeout(ctx, timeout)
+			spin := StartSpinner(fmt.Sprintf("waiting for %v condition(s) to be met...", len(instance.WaitFor)))
+			err = runtime.WaitForConditions(waitCtx, rm.Client(), objects, instance.WaitFor, applyOpts.WaitInterval)
 			spin.Stop()
+			cancel()
 			if err != nil {
 				return err
 			}
-			log.Info(fmt.Sprintf("%s resources %s", set.Name, colorizeReady("ready")))
+			log.Info(fmt.Sprintf("wait conditions %s", colorizeReady("met")))
 		}
+		return nil
+	}
+
+	if err := runtime.ApplyWithHooks(ctx, rm.Client(), hooks, applyHooks, applyObjects, waitOptions); err != nil {
+		return "", err
 	}
 
 	if images, err := builder.GetContainerImages(buildResult); err == nil {
+		for i, image := range images {
+			images[i] = engine.OverrideImage(image, bundleApplyArgs.imageOverrides)
+		}
 		im.Instance.Images = images
 	}
 
+	log.V(1).Info("storing instance", "digest", im.Instance.Digest)
 	if err := sm.Apply(ctx, &im.Instance, true); err != nil {
-		return fmt.Errorf("storing instance failed: %w", err)
+		return "", fmt.Errorf("storing instance failed: %w", err)
+	}
+	if rev != nil {
+		rev.add(&im.Instance, objects)
 	}
 
 	var deletedObjects []*unstructured.Unstructured
 	if len(staleObjects) > 0 {
+		log.V(1).Info("pruning stale objects", "objects", len(staleObjects))
 		deleteOpts := runtime.DeleteOptions(instance.Name, instance.Namespace)
 		changeSet, err := rm.DeleteAll(ctx, staleObjects, deleteOpts)
 		if err != nil {
-			return fmt.Errorf("pruning objects failed: %w", err)
+			return "", fmt.Errorf("pruning objects failed: %w", err)
 		}
 		deletedObjects = runtime.SelectObjectsFromSet(changeSet, ssa.DeletedAction)
 		for _, change := range changeSet.Entries {
-			log.Info(colorizeJoin(change))
+			log.Info(colorizePruneChange(change))
+		}
+		if len(deletedObjects) > 0 && status == instanceUnchanged {
+			status = instanceUpdated
 		}
 	}
 
@@ -458,14 +1207,101 @@ func applyBundleInstance(ctx context.Context, cuectx *cue.Context, instance *eng
 			err = rm.WaitForTermination(deletedObjects, waitOptions)
 			spin.Stop()
 			if err != nil {
-				return fmt.Errorf("waiting for termination failed: %w", err)
+				return "", fmt.Errorf("waiting for termination failed: %w", err)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// validateBundleInstance performs a server-side apply dry run for the instance objects
+// and returns an error if any of them is rejected by the API server or by the admission
+// controllers. When the instance namespace doesn't exist, the objects in that namespace
+// can't be validated and are skipped.
+func validateBundleInstance(ctx context.Context, rm *ssa.ResourceManager, instance *engine.BundleInstance,
+	objects []*unstructured.Unstructured, nsExists bool) error {
+	log := LoggerFrom(ctx)
+	diffOpts := ssa.DefaultDiffOptions()
+
+	var failed []string
+	for _, object := range objects {
+		if !nsExists && object.GetNamespace() == instance.Namespace {
+			log.Info(colorizeJoin(object, "validation skipped, namespace not found"))
+			continue
+		}
+
+		if _, _, _, err := rm.Diff(ctx, object, diffOpts); err != nil {
+			if ssa.IsImmutableError(err) && (bundleApplyArgs.force ||
+				ssa.AnyInMetadata(object, map[string]string{apiv1.ForceAction: apiv1.EnabledValue})) {
+				continue
 			}
+			log.Error(err, colorizeJoin(object, "invalid", dryRunServer))
+			failed = append(failed, ssa.FmtUnstructured(object))
 		}
 	}
 
+	if len(failed) > 0 {
+		return fmt.Errorf("invalid objects: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checkInstanceQuotas logs the ResourceQuota limits of the instance namespace exceeded
+// by the instance objects, and returns an error listing them if --enforce-quota is set.
+func checkInstanceQuotas(ctx context.Context, log logr.Logger, c client.Client, instance *engine.BundleInstance,
+	objects []*unstructured.Unstructured, upgrade bool) error {
+	violations, err := runtime.CheckResourceQuotas(ctx, c, instance.Namespace, objects, upgrade)
+	if err != nil {
+		return fmt.Errorf("quota check failed: %w", err)
+	}
+
+	var exceeded []string
+	for _, v := range violations {
+		log.Info(colorizeJoin(colorizeWarning("quota exceeded"), v.String()))
+		exceeded = append(exceeded, v.String())
+	}
+
+	if len(exceeded) > 0 && bundleApplyArgs.enforceQuota {
+		return fmt.Errorf("instance %s exceeds the resource quotas of namespace %s: %s",
+			instance.Name, instance.Namespace, strings.Join(exceeded, ", "))
+	}
 	return nil
 }
 
+// instanceUpToDate returns true if the stored instance has the same objects digest,
+// module, values and metadata as the desired instance.
+func instanceUpToDate(stored, desired *apiv1.Instance) bool {
+	return stored.Digest != "" &&
+		stored.Digest == desired.Digest &&
+		stored.Module.Version == desired.Module.Version &&
+		stored.Module.Digest == desired.Module.Digest &&
+		stored.Values == desired.Values &&
+		maps.Equal(runtime.InstanceLabels(stored.Labels), runtime.InstanceLabels(desired.Labels)) &&
+		slices.Equal(stored.DependsOn, desired.DependsOn) &&
+		stored.DeletePolicy == desired.DeletePolicy
+}
+
+// instanceObjectsExist returns true if all the objects are found in the cluster
+// and none of them is being deleted.
+func instanceObjectsExist(ctx context.Context, reader client.Reader, objects []*unstructured.Unstructured) (bool, error) {
+	for _, object := range objects {
+		live := &metav1.PartialObjectMetadata{}
+		live.SetGroupVersionKind(object.GroupVersionKind())
+		err := reader.Get(ctx, client.ObjectKeyFromObject(object), live)
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if live.GetDeletionTimestamp() != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func bundleInstancesOwnershipConflicts(bundleInstances []*engine.BundleInstance) error {
 	var conflicts []string
 	rm, err := runtime.NewResourceManager(kubeconfigArgs)
@@ -494,6 +1330,104 @@ func bundleInstancesOwnershipConflicts(bundleInstances []*engine.BundleInstance)
 	return nil
 }
 
+// pruneBundleInstances deletes the instances of the bundle found in the cluster which are
+// no longer part of the bundle, e.g. removed or disabled, in reverse dependency order.
+func pruneBundleInstances(ctx context.Context, rm *ssa.ResourceManager, bundle *engine.Bundle, cluster string, dryrun bool) error {
+	log := LoggerFrom(ctx)
+
+	sm := runtime.NewStorageManager(rm)
+	stored, err := sm.List(ctx, "", bundle.Name)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool, len(bundle.Instances))
+	for _, instance := range bundle.Instances {
+		current[instance.Namespace+"/"+instance.Name] = true
+	}
+
+	var stale []*apiv1.Instance
+	for _, instance := range stored {
+		if !current[instance.Namespace+"/"+instance.Name] {
+			stale = append(stale, instance)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	instances, err := bundleInstancesFromStorage(bundle.Name, cluster, stale)
+	if err != nil {
+		return err
+	}
+
+	// with --prune-wait the deleted objects of all instances are awaited at the end
+	wait := bundleApplyArgs.wait && !bundleApplyArgs.pruneWait
+	var deletedObjects []*unstructured.Unstructured
+	for index := len(instances) - 1; index >= 0; index-- {
+		instance := instances[index]
+		log.Info(fmt.Sprintf("pruning instance %s in namespace %s",
+			colorizeSubject(instance.Name), colorizeSubject(instance.Namespace)))
+		objects, err := deleteBundleInstance(ctx, instance, wait, dryrun)
+		if err != nil {
+			return err
+		}
+		deletedObjects = append(deletedObjects, objects...)
+	}
+
+	if bundleApplyArgs.pruneWait && len(deletedObjects) > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, rootArgs.timeout)
+		defer cancel()
+		spin := StartSpinner(fmt.Sprintf("waiting for %v pruned resource(s) to be deleted...", len(deletedObjects)))
+		err = runtime.WaitForDeletion(waitCtx, rm.Client(), deletedObjects, ssa.DefaultWaitOptions().Interval)
+		spin.Stop()
+		if err != nil {
+			return fmt.Errorf("pruning instances failed: %w", err)
+		}
+		log.Info("all pruned resources have been deleted")
+	}
+	return nil
+}
+
+// bundleInstancesInvalidWaitFor checks that the wait conditions
+// of the instances can be parsed, before any instance is applied.
+func bundleInstancesInvalidWaitFor(bundleInstances []*engine.BundleInstance) error {
+	for _, instance := range bundleInstances {
+		for _, condition := range instance.WaitFor {
+			if err := runtime.ValidateWaitCondition(condition); err != nil {
+				return fmt.Errorf("invalid %s of instance %s: %w", apiv1.BundleWaitForSelector, instance.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// bundleInstancesMissingSecrets checks that the Secrets referenced by the instances
+// exist in the instance namespace. Only the Secrets metadata is read from the cluster.
+func bundleInstancesMissingSecrets(ctx context.Context, rm *ssa.ResourceManager, bundleInstances []*engine.BundleInstance) error {
+	var missing []string
+	for _, instance := range bundleInstances {
+		for _, name := range instance.SecretRefs {
+			secret := &metav1.PartialObjectMetadata{}
+			secret.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Secret"})
+			err := rm.Client().Get(ctx, client.ObjectKey{Name: name, Namespace: instance.Namespace}, secret)
+			switch {
+			case apierrors.IsNotFound(err):
+				missing = append(missing, fmt.Sprintf("instance \"%s\" references secret \"%s\" not found in namespace \"%s\"",
+					instance.Name, name, instance.Namespace))
+			case err != nil:
+				return fmt.Errorf("failed to get secret %s/%s referenced by instance %s: %w",
+					instance.Namespace, name, instance.Name, err)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing secret references: %s", strings.Join(missing, "; "))
+	}
+
+	return nil
+}
+
 func saveReaderToFile(reader io.Reader) (string, error) {
 	f, err := os.CreateTemp("", "*.cue")
 	if err != nil {
@@ -508,3 +1442,21 @@ func saveReaderToFile(reader io.Reader) (string, error) {
 
 	return f.Name(), nil
 }
+
+// saveStdinToFile writes the reader to a temporary file if the files contain '-',
+// and returns a copy of the files with '-' replaced by the temporary file path,
+// along with a function that removes the temporary file.
+func saveStdinToFile(reader io.Reader, files []string) ([]string, func(), error) {
+	result := slices.Clone(files)
+	for i, file := range result {
+		if file == "-" {
+			stdinFile, err := saveReaderToFile(reader)
+			if err != nil {
+				return nil, nil, err
+			}
+			result[i] = stdinFile
+			return result, func() { os.Remove(stdinFile) }, nil
+		}
+	}
+	return result, func() {}, nil
+}
@@ -18,18 +18,30 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fluxcd/pkg/ssa"
 	"github.com/google/go-containerregistry/pkg/crane"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/runtime"
 )
 
 func Test_BundleApply(t *testing.T) {
@@ -592,3 +604,1260 @@ runtime: {
 		g.Expect(err.Error()).To(ContainSubstring("no cluster found"))
 	})
 }
+
+func Test_BundleApply_Reconcile(t *testing.T) {
+	t.Run("runs multiple cycles until canceled", func(t *testing.T) {
+		g := NewWithT(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cycles := 0
+		err := reconcileBundle(ctx, 10*time.Millisecond, 20*time.Millisecond, func(ctx context.Context) error {
+			cycles++
+			if cycles == 1 {
+				return errors.New("transient failure")
+			}
+			if cycles == 3 {
+				cancel()
+			}
+			return nil
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cycles).To(Equal(3))
+	})
+
+	t.Run("corrects drift on the next cycle", func(t *testing.T) {
+		g := NewWithT(t)
+
+		modPath := "testdata/module"
+		namespace := rnd("my-namespace", 5)
+		modName := rnd("my-mod", 5)
+		modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+		modVer := "1.0.0"
+
+		_, err := executeCommand(fmt.Sprintf(
+			"mod push %s oci://%s -v %s",
+			modPath,
+			modURL,
+			modVer,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+		}
+	}
+}
+`, rnd("my-bundle", 5), modURL, modVer, namespace)
+
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		err = os.WriteFile(bundlePath, []byte(bundleData), 0644)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		clientCM := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "frontend-client",
+				Namespace: namespace,
+			},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cycles := 0
+		err = reconcileBundle(ctx, 100*time.Millisecond, time.Second, func(ctx context.Context) error {
+			cycles++
+			output, err := executeCommand(fmt.Sprintf(
+				"bundle apply -f %s -p main --wait",
+				bundlePath,
+			))
+			g.Expect(err).ToNot(HaveOccurred())
+			t.Log("\n", output)
+
+			err = envTestClient.Get(context.Background(), client.ObjectKeyFromObject(clientCM), clientCM)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			switch cycles {
+			case 1:
+				// introduce drift by deleting an object managed by the instance
+				g.Expect(envTestClient.Delete(context.Background(), clientCM)).To(Succeed())
+			case 2:
+				cancel()
+			}
+			return nil
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cycles).To(Equal(2))
+	})
+}
+
+func Test_InstanceObjectsExist(t *testing.T) {
+	newConfigMap := func(name string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+		}
+	}
+
+	kubeClient := fake.NewClientBuilder().WithObjects(newConfigMap("client"), newConfigMap("server")).Build()
+
+	toObjects := func(g *WithT, names ...string) []*unstructured.Unstructured {
+		var objects []*unstructured.Unstructured
+		for _, name := range names {
+			object, err := runtime.ToUnstructured(newConfigMap(name))
+			g.Expect(err).ToNot(HaveOccurred())
+			objects = append(objects, object)
+		}
+		return objects
+	}
+
+	t.Run("returns true when all objects exist", func(t *testing.T) {
+		g := NewWithT(t)
+		found, err := instanceObjectsExist(context.Background(), kubeClient, toObjects(g, "client", "server"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(found).To(BeTrue())
+	})
+
+	t.Run("returns false when an object was deleted", func(t *testing.T) {
+		g := NewWithT(t)
+		found, err := instanceObjectsExist(context.Background(), kubeClient, toObjects(g, "client", "deleted"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(found).To(BeFalse())
+	})
+}
+
+func Test_BundleApply_ReconcileBackoff(t *testing.T) {
+	g := NewWithT(t)
+
+	interval := time.Minute
+	maxBackoff := 10 * time.Minute
+
+	// simulate three consecutive failures followed by a success
+	failures := 0
+	var delays []time.Duration
+	for _, failed := range []bool{true, true, true, false} {
+		if failed {
+			failures++
+		} else {
+			failures = 0
+		}
+		delays = append(delays, reconcileBackoff(interval, maxBackoff, failures))
+	}
+	g.Expect(delays).To(Equal([]time.Duration{
+		2 * time.Minute,
+		4 * time.Minute,
+		8 * time.Minute,
+		time.Minute,
+	}))
+
+	g.Expect(reconcileBackoff(interval, maxBackoff, 10)).To(Equal(maxBackoff))
+	g.Expect(reconcileBackoff(interval, maxBackoff, 1000)).To(Equal(maxBackoff))
+	g.Expect(reconcileBackoff(interval, time.Second, 3)).To(Equal(interval))
+}
+
+func Test_BundleApply_Summary(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleTmpl := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: server: enabled: false
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: %[5]s
+		}
+	}
+}
+`
+	bundleName := rnd("my-bundle", 5)
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+
+	applySummary := func(clientEnabled string, args string) bundleApplySummary {
+		g := NewWithT(t)
+		err := os.WriteFile(bundlePath, []byte(fmt.Sprintf(bundleTmpl,
+			bundleName, modURL, modVer, namespace, clientEnabled)), 0644)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle apply -f %s -p main --wait -o json %s",
+			bundlePath,
+			args,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var summary bundleApplySummary
+		g.Expect(json.Unmarshal([]byte(jsonFromOutput(output)), &summary)).To(Succeed())
+		g.Expect(summary.Bundle).To(Equal(bundleName))
+		g.Expect(summary.Instances).To(HaveLen(2))
+		return summary
+	}
+
+	summary := applySummary("false", "")
+	g.Expect(summary.Created).To(Equal(2))
+
+	summary = applySummary("false", "")
+	g.Expect(summary.Skipped).To(Equal(2))
+	g.Expect(summary.Instances).To(ContainElement(bundleInstanceResult{
+		Name:      "frontend",
+		Namespace: namespace,
+		Cluster:   apiv1.RuntimeDefaultName,
+		Status:    instanceSkipped,
+	}))
+
+	summary = applySummary("false", "--force")
+	g.Expect(summary.Unchanged).To(Equal(2))
+
+	summary = applySummary("true", "")
+	g.Expect(summary.Skipped).To(Equal(1))
+	g.Expect(summary.Updated).To(Equal(1))
+	g.Expect(summary.Instances).To(ContainElement(bundleInstanceResult{
+		Name:      "backend",
+		Namespace: namespace,
+		Cluster:   apiv1.RuntimeDefaultName,
+		Status:    instanceUpdated,
+	}))
+}
+
+func Test_BundleApply_Instances(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath := "testdata/module"
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleTmpl := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			dependsOn: ["backend"]
+			values: server: enabled: false
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: false
+		}
+		worker: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: false
+		}
+	}
+}
+`
+	applyInstances := func(g *WithT, args string) ([]string, error) {
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		err := os.WriteFile(bundlePath, []byte(fmt.Sprintf(bundleTmpl,
+			rnd("my-bundle", 5), modURL, modVer, rnd("my-namespace", 5))), 0644)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle apply -f %s -p main --wait -o json %s",
+			bundlePath, args,
+		))
+		if err != nil {
+			return nil, err
+		}
+
+		var summary bundleApplySummary
+		g.Expect(json.Unmarshal([]byte(jsonFromOutput(output)), &summary)).To(Succeed())
+
+		var names []string
+		for _, instance := range summary.Instances {
+			names = append(names, instance.Name)
+		}
+		return names, nil
+	}
+
+	t.Run("applies the selected instances and their dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		names, err := applyInstances(g, "--instance frontend")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(names).To(Equal([]string{"backend", "frontend"}))
+	})
+
+	t.Run("applies only the selected instances without dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		names, err := applyInstances(g, "--instance frontend --instance worker --no-deps")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(names).To(Equal([]string{"frontend", "worker"}))
+	})
+
+	t.Run("fails for unknown instances", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := applyInstances(g, "--instance web")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("available instances: backend, frontend, worker"))
+	})
+}
+
+func Test_BundleApply_Atomic(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The frontend instance is applied after the backend, and it fails
+	// when its namespace is not a valid Kubernetes namespace name.
+	bundleTmpl := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: false
+			values: domain: "%[5]s"
+		}
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[6]s"
+			dependsOn: ["backend"]
+			values: server: enabled: false
+		}
+	}
+}
+`
+	applyBundle := func(g *WithT, domain, frontendNamespace string) error {
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		err := os.WriteFile(bundlePath, []byte(fmt.Sprintf(bundleTmpl,
+			bundleName, modURL, modVer, namespace, domain, frontendNamespace)), 0644)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = executeCommand(fmt.Sprintf(
+			"bundle apply -f %s -p main --wait --atomic",
+			bundlePath,
+		))
+		return err
+	}
+
+	serverCM := func() (*corev1.ConfigMap, error) {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "backend-server",
+				Namespace: namespace,
+			},
+		}
+		err := envTestClient.Get(context.Background(), client.ObjectKeyFromObject(cm), cm)
+		return cm, err
+	}
+
+	t.Run("deletes the created instances on failure", func(t *testing.T) {
+		g := NewWithT(t)
+		err := applyBundle(g, "v1.internal", "Invalid")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("rolled back"))
+
+		_, err = serverCM()
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		_, err = executeCommand(fmt.Sprintf("inspect values -n %s backend", namespace))
+		g.Expect(err).To(HaveOccurred())
+
+		// envtest has no namespace controller, the deleted namespace remains terminating
+		ns := &corev1.Namespace{}
+		err = envTestClient.Get(context.Background(), client.ObjectKey{Name: namespace}, ns)
+		if err == nil {
+			g.Expect(ns.DeletionTimestamp).ToNot(BeNil())
+		} else {
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}
+	})
+
+	t.Run("reverts the updated instances on failure", func(t *testing.T) {
+		g := NewWithT(t)
+		namespace = rnd("my-namespace", 5)
+		g.Expect(applyBundle(g, "v1.internal", namespace)).To(Succeed())
+
+		err := applyBundle(g, "v2.internal", "Invalid")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("rolled back"))
+
+		cm, err := serverCM()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cm.Data["hostname"]).To(Equal("v1.internal"))
+
+		output, err := executeCommand(fmt.Sprintf("inspect values -n %s backend", namespace))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("v1.internal"))
+	})
+}
+
+func Test_BundleApply_SecretRefs(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+	secretName := rnd("my-secret", 5)
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			secretRefs: ["%[5]s"]
+			values: client: enabled: false
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace, secretName)
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	g.Expect(envTestClient.Create(context.Background(), ns)).To(Succeed())
+
+	t.Run("fails for missing secret references", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --wait", bundlePath))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(
+			fmt.Sprintf("instance \"backend\" references secret \"%s\" not found in namespace \"%s\"", secretName, namespace)))
+
+		_, err = executeCommand(fmt.Sprintf("inspect values -n %s backend", namespace))
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("applies when the secrets exist", func(t *testing.T) {
+		g := NewWithT(t)
+		sc := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: namespace,
+			},
+			StringData: map[string]string{"password": "test"},
+		}
+		g.Expect(envTestClient.Create(context.Background(), sc)).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --wait", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+}
+
+func Test_BundleApply_ValidateOnly(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	g.Expect(envTestClient.Create(context.Background(), ns)).To(Succeed())
+
+	bundleData := func(team string) string {
+		return fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: false
+		}
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: server: enabled: false
+			values: team: "%[5]s"
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace, team)
+	}
+
+	t.Run("fails for objects rejected by the API server", func(t *testing.T) {
+		g := NewWithT(t)
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(bundlePath, []byte(bundleData("invalid team!")), 0644)).To(Succeed())
+
+		output, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --validate-only", bundlePath))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("validation failed for 1 instance(s): frontend"))
+		g.Expect(output).To(ContainSubstring("instance frontend validation failed"))
+
+		for _, name := range []string{"backend", "frontend"} {
+			_, err = executeCommand(fmt.Sprintf("inspect values -n %s %s", namespace, name))
+			g.Expect(err).To(HaveOccurred())
+		}
+	})
+
+	t.Run("validates without applying", func(t *testing.T) {
+		g := NewWithT(t)
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(bundlePath, []byte(bundleData("web")), 0644)).To(Succeed())
+
+		output, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --validate-only", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("validated successfully"))
+
+		_, err = executeCommand(fmt.Sprintf("inspect values -n %s frontend", namespace))
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("fails when combined with dry run", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand("bundle apply -f bundle.cue --validate-only --dry-run")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("--validate-only can't be used with --dry-run"))
+	})
+}
+
+func Test_BundleApply_Prune(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleTmpl := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			enabled: %[5]t
+			values: server: enabled: true
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: false
+		}
+	}
+}
+`
+	applyBundle := func(frontend bool, args string) error {
+		bundleData := fmt.Sprintf(bundleTmpl, bundleName, modURL, modVer, namespace, frontend)
+		_, err := executeCommandWithIn(fmt.Sprintf("bundle apply -f - -p main --wait %s", args),
+			strings.NewReader(bundleData))
+		return err
+	}
+
+	t.Run("keeps disabled instances without prune", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(applyBundle(true, "")).To(Succeed())
+		g.Expect(applyBundle(false, "")).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf("inspect values -n %s frontend", namespace))
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("annotates frontend client to be retained", func(t *testing.T) {
+		g := NewWithT(t)
+
+		clientCM := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "frontend-client",
+				Namespace: namespace,
+			},
+		}
+		err := envTestClient.Get(context.Background(), client.ObjectKeyFromObject(clientCM), clientCM)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		patch := client.MergeFrom(clientCM.DeepCopy())
+		clientCM.SetAnnotations(map[string]string{apiv1.PruneAnnotation: apiv1.DisabledValue})
+		g.Expect(envTestClient.Patch(context.Background(), clientCM, patch)).To(Succeed())
+	})
+
+	t.Run("deletes disabled instances with prune", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(applyBundle(false, "--prune")).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf("inspect values -n %s frontend", namespace))
+		g.Expect(err).To(HaveOccurred())
+
+		_, err = executeCommand(fmt.Sprintf("inspect values -n %s backend", namespace))
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("retains annotated objects of pruned instances", func(t *testing.T) {
+		g := NewWithT(t)
+
+		clientCM := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "frontend-client",
+				Namespace: namespace,
+			},
+		}
+		err := envTestClient.Get(context.Background(), client.ObjectKeyFromObject(clientCM), clientCM)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(clientCM.GetDeletionTimestamp()).To(BeNil())
+
+		serverCM := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "frontend-server",
+				Namespace: namespace,
+			},
+		}
+		err = envTestClient.Get(context.Background(), client.ObjectKeyFromObject(serverCM), serverCM)
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+}
+
+func Test_BundleApplySummary(t *testing.T) {
+	g := NewWithT(t)
+
+	summary := newBundleApplySummary("my-bundle", []bundleInstanceResult{
+		{Name: "a", Status: instanceUnchanged},
+		{Name: "b", Status: instanceUnchanged},
+		{Name: "c", Status: instanceUnchanged},
+		{Name: "d", Status: instanceUpdated},
+		{Name: "e", Status: instanceUpdated},
+		{Name: "f", Status: instanceCreated},
+	})
+	g.Expect(summary.String()).To(Equal("3 instance(s) unchanged, 2 updated, 1 created"))
+	g.Expect(summary.Instances).To(HaveLen(6))
+
+	summary.add(bundleInstanceResult{Name: "g", Status: instanceSkipped})
+	g.Expect(summary.String()).To(Equal("3 instance(s) unchanged, 2 updated, 1 created, 1 skipped"))
+}
+
+func Test_InstanceUpToDate(t *testing.T) {
+	g := NewWithT(t)
+
+	stored := &apiv1.Instance{
+		Module: apiv1.ModuleReference{Version: "1.0.0", Digest: "sha256:a"},
+		Values: "values: {}",
+		Digest: "sha256:b",
+	}
+	stored.Labels = map[string]string{apiv1.BundleNameLabelKey: "my-bundle"}
+
+	desired := stored.DeepCopy()
+	g.Expect(instanceUpToDate(stored, desired)).To(BeTrue())
+
+	desired.Digest = "sha256:c"
+	g.Expect(instanceUpToDate(stored, desired)).To(BeFalse())
+
+	desired = stored.DeepCopy()
+	desired.Labels[apiv1.BundleNameLabelKey] = "other-bundle"
+	g.Expect(instanceUpToDate(stored, desired)).To(BeFalse())
+
+	desired = stored.DeepCopy()
+	desired.DependsOn = []string{"backend"}
+	g.Expect(instanceUpToDate(stored, desired)).To(BeFalse())
+
+	stored.Digest = ""
+	g.Expect(instanceUpToDate(stored, stored.DeepCopy())).To(BeFalse())
+}
+
+func Test_InstanceUpToDate_Storage(t *testing.T) {
+	g := NewWithT(t)
+
+	rm := ssa.NewResourceManager(newFakeApplyClient(), nil, ssa.Owner{Field: apiv1.FieldManager, Group: "instance.timoni.sh"})
+	sm := runtime.NewStorageManager(rm)
+
+	desired := &apiv1.Instance{
+		Module: apiv1.ModuleReference{Version: "1.0.0", Digest: "sha256:a"},
+		Values: "values: {}",
+		Digest: "sha256:b",
+	}
+	desired.Name = "frontend"
+	desired.Namespace = "apps"
+	desired.Labels = map[string]string{
+		apiv1.BundleNameLabelKey: "my-bundle",
+		"team":                   "frontend",
+	}
+	g.Expect(sm.Apply(context.Background(), desired.DeepCopy(), false)).To(Succeed())
+
+	stored, err := sm.Get(context.Background(), desired.Name, desired.Namespace)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(stored.Labels).To(HaveKey("app.kubernetes.io/created-by"))
+	g.Expect(instanceUpToDate(stored, desired)).To(BeTrue())
+
+	desired.Labels["team"] = "backend"
+	g.Expect(instanceUpToDate(stored, desired)).To(BeFalse())
+}
+
+// newFakeApplyClient returns a fake client which handles the server-side apply
+// patches by creating or updating the objects, as the fake client doesn't support them.
+func newFakeApplyClient(objects ...client.Object) client.WithWatch {
+	return fake.NewClientBuilder().WithObjects(objects...).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return c.Patch(ctx, obj, patch, opts...)
+			}
+			existing := obj.DeepCopyObject().(client.Object)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return err
+				}
+				return c.Create(ctx, obj)
+			}
+			obj.SetResourceVersion(existing.GetResourceVersion())
+			return c.Update(ctx, obj)
+		},
+	}).Build()
+}
+
+func Test_BundleApply_NamespaceMetadata(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := func(ns, level string) string {
+		return fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			namespaceMetadata: {
+				labels: "pod-security.kubernetes.io/enforce": "%[5]s"
+				annotations: "team": "frontend"
+			}
+			values: server: enabled: false
+		}
+	}
+}
+`, bundleName, modURL, modVer, ns, level)
+	}
+
+	t.Run("creates the namespace with labels", func(t *testing.T) {
+		g := NewWithT(t)
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(bundlePath, []byte(bundleData(namespace, "restricted")), 0644)).To(Succeed())
+
+		output, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --wait", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		t.Log("\n", output)
+
+		ns := &corev1.Namespace{}
+		err = envTestClient.Get(context.Background(), client.ObjectKey{Name: namespace}, ns)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ns.GetLabels()).To(HaveKeyWithValue("pod-security.kubernetes.io/enforce", "restricted"))
+		g.Expect(ns.GetLabels()).To(HaveKeyWithValue("app.kubernetes.io/created-by", apiv1.FieldManager))
+		g.Expect(ns.GetAnnotations()).To(HaveKeyWithValue("team", "frontend"))
+	})
+
+	t.Run("does not modify existing namespace", func(t *testing.T) {
+		g := NewWithT(t)
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(bundlePath, []byte(bundleData(namespace, "baseline")), 0644)).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --wait", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		ns := &corev1.Namespace{}
+		err = envTestClient.Get(context.Background(), client.ObjectKey{Name: namespace}, ns)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ns.GetLabels()).To(HaveKeyWithValue("pod-security.kubernetes.io/enforce", "restricted"))
+	})
+
+	t.Run("updates existing namespace", func(t *testing.T) {
+		g := NewWithT(t)
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(bundlePath, []byte(bundleData(namespace, "baseline")), 0644)).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --wait --update-namespace", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		ns := &corev1.Namespace{}
+		err = envTestClient.Get(context.Background(), client.ObjectKey{Name: namespace}, ns)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(ns.GetLabels()).To(HaveKeyWithValue("pod-security.kubernetes.io/enforce", "baseline"))
+		g.Expect(ns.GetLabels()).To(HaveKeyWithValue("app.kubernetes.io/created-by", apiv1.FieldManager))
+	})
+
+	t.Run("fails for missing namespace", func(t *testing.T) {
+		g := NewWithT(t)
+		missing := rnd("my-namespace", 5)
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(bundlePath, []byte(bundleData(missing, "restricted")), 0644)).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --create-namespace=false", bundlePath))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("namespace %s not found", missing)))
+	})
+}
+
+func Test_BundleApply_MissingModules(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: false
+		}
+		cache: {
+			module: {
+				url:     "oci://%[2]s-typo"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+		}
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: server: enabled: false
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace)
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	output, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --wait", bundlePath))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("missing module references"))
+	g.Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("instance \"cache\" references module \"oci://%s-typo\"", modURL)))
+	g.Expect(err.Error()).ToNot(ContainSubstring("instance \"backend\""))
+	g.Expect(err.Error()).ToNot(ContainSubstring("instance \"frontend\""))
+	g.Expect(output).ToNot(ContainSubstring("installing"))
+
+	for _, name := range []string{"backend", "frontend"} {
+		_, err = executeCommand(fmt.Sprintf("inspect values -n %s %s", namespace, name))
+		g.Expect(err).To(HaveOccurred())
+	}
+}
+
+func Test_BundleApply_NamespaceOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	nsInfra := rnd("infra", 5)
+	nsData := rnd("data", 5)
+	nsApps := rnd("apps", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	order: ["%[4]s", "%[5]s"]
+	instances: {
+		a: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[6]s"
+		}
+		b: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[5]s"
+		}
+		c: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+		}
+	}
+}
+`, bundleName, modURL, modVer, nsInfra, nsData, nsApps)
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	output, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --wait", bundlePath))
+	g.Expect(err).ToNot(HaveOccurred())
+	t.Log("\n", output)
+
+	infra := strings.Index(output, fmt.Sprintf("installing c in namespace %s", nsInfra))
+	data := strings.Index(output, fmt.Sprintf("installing b in namespace %s", nsData))
+	apps := strings.Index(output, fmt.Sprintf("installing a in namespace %s", nsApps))
+	g.Expect(infra).To(BeNumerically(">=", 0))
+	g.Expect(data).To(BeNumerically(">", infra))
+	g.Expect(apps).To(BeNumerically(">", data))
+}
+
+func Test_BundleApply_EmptyBundle(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleData := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "empty-bundle"
+	instances: {}
+}
+`
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	t.Run("builds nothing", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle build -f %s", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("no instances defined in bundle"))
+		g.Expect(output).ToNot(ContainSubstring("apiVersion"))
+	})
+
+	t.Run("applies nothing", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle apply -f %s -p main --wait", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("no instances defined in bundle"))
+
+		_, err = executeCommand("bundle status empty-bundle")
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("reports the status of nothing", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle status -f %s", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("no instances defined in bundle"))
+	})
+}
+
+func Test_BundleApply_Contexts(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Write a kubeconfig with two contexts targeting the test cluster.
+	kubeConfig, err := clientcmd.LoadFromFile(*kubeconfigArgs.KubeConfig)
+	g.Expect(err).ToNot(HaveOccurred())
+	current := kubeConfig.Contexts[kubeConfig.CurrentContext]
+	g.Expect(current).ToNot(BeNil())
+	kubeConfig.Contexts["cluster-a"] = current.DeepCopy()
+	kubeConfig.Contexts["cluster-b"] = current.DeepCopy()
+	kubeConfigPath := filepath.Join(t.TempDir(), "kubeconfig")
+	g.Expect(clientcmd.WriteToFile(*kubeConfig, kubeConfigPath)).To(Succeed())
+
+	defaultKubeConfig := *kubeconfigArgs.KubeConfig
+	defaultKubeContext := kubeconfigArgs.Context
+	t.Cleanup(func() {
+		*kubeconfigArgs.KubeConfig = defaultKubeConfig
+		kubeconfigArgs.Context = defaultKubeContext
+	})
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: server: enabled: false
+		}
+	}
+}
+`, rnd("my-bundle", 5), modURL, modVer, namespace)
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	t.Run("applies the bundle on all contexts", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle apply -f %s -p main --wait -o json --kubeconfig %s --context cluster-a --context cluster-b",
+			bundlePath,
+			kubeConfigPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var summary bundleApplySummary
+		g.Expect(json.Unmarshal([]byte(jsonFromOutput(output)), &summary)).To(Succeed())
+		g.Expect(summary.Clusters).To(Equal([]bundleClusterResult{
+			{Name: "cluster-a", Status: "succeeded"},
+			{Name: "cluster-b", Status: "succeeded"},
+		}))
+		g.Expect(summary.Instances).To(HaveLen(2))
+		g.Expect(summary.Instances[0].Cluster).To(Equal("cluster-a"))
+		g.Expect(summary.Instances[1].Cluster).To(Equal("cluster-b"))
+	})
+
+	t.Run("continues on the remaining contexts after a failure", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle apply -f %s -p main --wait -o json --kubeconfig %s --context missing --context cluster-a",
+			bundlePath,
+			kubeConfigPath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("apply failed on 1 cluster(s): missing"))
+
+		var summary bundleApplySummary
+		g.Expect(json.Unmarshal([]byte(jsonFromOutput(output)), &summary)).To(Succeed())
+		g.Expect(summary.Clusters).To(HaveLen(2))
+		g.Expect(summary.Clusters[0].Status).To(Equal("failed"))
+		g.Expect(summary.Clusters[1]).To(Equal(bundleClusterResult{Name: "cluster-a", Status: "succeeded"}))
+	})
+
+	t.Run("stops on the first failure with fail-fast", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle apply -f %s -p main --wait --kubeconfig %s --context missing --context cluster-a --fail-fast",
+			bundlePath,
+			kubeConfigPath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(output).ToNot(ContainSubstring("cluster-a"))
+	})
+}
+
+func Test_BundleApply_TotalTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+		}
+	}
+}
+`, rnd("my-bundle", 5), modURL, modVer, namespace)
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	_, err = executeCommand(fmt.Sprintf(
+		"bundle apply -f %s -p main --wait --total-timeout 1ms",
+		bundlePath,
+	))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("exceeded the total timeout of 1ms while resolving the instance modules"))
+
+	err = envTestClient.Get(context.Background(), client.ObjectKey{Name: namespace}, &corev1.Namespace{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func Test_SaveStdinToFile(t *testing.T) {
+	g := NewWithT(t)
+
+	files := []string{"bundle.cue", "-"}
+	result, removeStdinFile, err := saveStdinToFile(strings.NewReader("bundle: {}"), files)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(files).To(Equal([]string{"bundle.cue", "-"}))
+	g.Expect(result).To(HaveLen(2))
+	g.Expect(result[0]).To(Equal("bundle.cue"))
+
+	data, err := os.ReadFile(result[1])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal("bundle: {}"))
+
+	removeStdinFile()
+	g.Expect(result[1]).ToNot(BeAnExistingFile())
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+// instanceSnapshot holds the state of a bundle instance
+// before it was applied on a cluster.
+type instanceSnapshot struct {
+	instance *engine.BundleInstance
+	rm       *ssa.ResourceManager
+	sm       *runtime.StorageManager
+
+	// stored is the instance storage record, nil if the instance didn't exist.
+	stored *apiv1.Instance
+
+	// existing are the objects found in-cluster before the apply.
+	existing []*unstructured.Unstructured
+
+	// created are the objects that didn't exist before the apply.
+	created []*unstructured.Unstructured
+
+	// createdNamespace is set when the instance namespace didn't exist before the apply.
+	createdNamespace bool
+}
+
+// bundleRollback records the state of the bundle instances before they are applied,
+// and reverts them to that state when the bundle apply fails.
+type bundleRollback struct {
+	snapshots []*instanceSnapshot
+}
+
+// record takes a snapshot of the in-cluster objects of the instance, including
+// the objects of the previous revision that would be pruned, and of its storage record.
+// When createdNamespace is set, the instance namespace is deleted on rollback.
+func (r *bundleRollback) record(ctx context.Context, rm *ssa.ResourceManager, sm *runtime.StorageManager,
+	instance *engine.BundleInstance, objects []*unstructured.Unstructured, createdNamespace bool) error {
+	snapshot := &instanceSnapshot{
+		instance:         instance,
+		rm:               rm,
+		sm:               sm,
+		createdNamespace: createdNamespace,
+	}
+
+	targets := append([]*unstructured.Unstructured{}, objects...)
+	stored, err := sm.Get(ctx, instance.Name, instance.Namespace)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("snapshot of instance %s failed: %w", instance.Name, err)
+	}
+	if err == nil {
+		snapshot.stored = stored
+
+		im := runtime.InstanceManager{Instance: *stored}
+		previous, err := im.ListObjects()
+		if err != nil {
+			return fmt.Errorf("snapshot of instance %s failed: %w", instance.Name, err)
+		}
+		targets = append(targets, previous...)
+	}
+
+	seen := make(map[string]bool)
+	for _, object := range targets {
+		id := ssa.FmtUnstructured(object)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(object.GroupVersionKind())
+		err := rm.Client().Get(ctx, client.ObjectKeyFromObject(object), live)
+		switch {
+		case err == nil:
+			snapshot.existing = append(snapshot.existing, cleanSnapshotObject(live))
+		case apierrors.IsNotFound(err):
+			snapshot.created = append(snapshot.created, object)
+		default:
+			return fmt.Errorf("snapshot of %s failed: %w", id, err)
+		}
+	}
+
+	r.snapshots = append(r.snapshots, snapshot)
+	return nil
+}
+
+// rollback reverts the recorded instances in the reverse order in which they were applied.
+// For each instance, the objects created by the apply are deleted, the objects that existed
+// before are reapplied from the snapshot, the storage record is restored or removed, and
+// the namespace created by the apply is deleted.
+// Since the apply may have failed due to a timeout, the rollback runs with a new timeout.
+func (r *bundleRollback) rollback(ctx context.Context, cause error) error {
+	log := LoggerFrom(ctx)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rootArgs.timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(r.snapshots) - 1; i >= 0; i-- {
+		snapshot := r.snapshots[i]
+		log.Info(fmt.Sprintf("rolling back instance %s in namespace %s",
+			colorizeSubject(snapshot.instance.Name), colorizeSubject(snapshot.instance.Namespace)))
+		if err := snapshot.restore(ctx, log); err != nil {
+			errs = append(errs, fmt.Errorf("rollback of instance %s failed: %w", snapshot.instance.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(append([]error{cause}, errs...)...)
+	}
+
+	return fmt.Errorf("%w (rolled back %d instance(s))", cause, len(r.snapshots))
+}
+
+// restore reverts the instance objects and storage record to the snapshot state.
+func (s *instanceSnapshot) restore(ctx context.Context, log logr.Logger) error {
+	deleteOpts := runtime.DeleteOptions(s.instance.Name, s.instance.Namespace)
+	created := append([]*unstructured.Unstructured{}, s.created...)
+	sort.Sort(sort.Reverse(ssa.SortableUnstructureds(created)))
+	for _, object := range created {
+		change, err := s.rm.Delete(ctx, object, deleteOpts)
+		if err != nil {
+			return err
+		}
+		log.Info(colorizeJoin(change))
+	}
+
+	if len(s.existing) > 0 {
+		applyOpts := runtime.ApplyOptions(true, rootArgs.timeout)
+		cs, err := s.rm.ApplyAllStaged(ctx, s.existing, applyOpts)
+		if err != nil {
+			return err
+		}
+		for _, change := range cs.Entries {
+			log.Info(colorizeJoin(change))
+		}
+	}
+
+	if s.stored != nil {
+		return s.sm.Apply(ctx, s.stored, false)
+	}
+	if err := s.sm.Delete(ctx, s.instance.Name, s.instance.Namespace); err != nil {
+		return err
+	}
+
+	if s.createdNamespace {
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: s.instance.Namespace,
+			},
+		}
+		if err := s.rm.Client().Delete(ctx, ns); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		log.Info(colorizeJoin(colorizeSubject("Namespace/"+s.instance.Namespace), ssa.DeletedAction))
+	}
+	return nil
+}
+
+// cleanSnapshotObject removes the server-side metadata and the status
+// from the object, so that it can be reapplied as the desired state.
+func cleanSnapshotObject(object *unstructured.Unstructured) *unstructured.Unstructured {
+	o := object.DeepCopy()
+	for _, field := range []string{"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields"} {
+		unstructured.RemoveNestedField(o.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(o.Object, "status")
+	return o
+}
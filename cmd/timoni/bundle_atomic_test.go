@@ -0,0 +1,101 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+func Test_BundleAtomicRollback(t *testing.T) {
+	g := NewWithT(t)
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "apps"},
+	}
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "apps",
+			Labels: map[string]string{
+				"instance.timoni.sh/name":      "app",
+				"instance.timoni.sh/namespace": "apps",
+			},
+		},
+	}
+
+	// The fake client ignores the context, the interceptor fails the
+	// requests made after the context is canceled like the API server.
+	kubeClient := fake.NewClientBuilder().WithObjects(ns, cm).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+	rm := ssa.NewResourceManager(kubeClient, nil, ssa.Owner{Field: apiv1.FieldManager, Group: "instance.timoni.sh"})
+
+	object, err := runtime.ToUnstructured(cm)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	rb := &bundleRollback{
+		snapshots: []*instanceSnapshot{{
+			instance:         &engine.BundleInstance{Name: "app", Namespace: "apps"},
+			rm:               rm,
+			sm:               runtime.NewStorageManager(rm),
+			created:          []*unstructured.Unstructured{object},
+			createdNamespace: true,
+		}},
+	}
+
+	// The apply failed due to the timeout, the rollback must not reuse the expired context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = rb.rollback(ctx, errors.New("timeout waiting for instance"))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("rolled back 1 instance(s)"))
+
+	err = kubeClient.Get(context.Background(), client.ObjectKeyFromObject(cm), &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	err = kubeClient.Get(context.Background(), client.ObjectKeyFromObject(ns), &corev1.Namespace{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
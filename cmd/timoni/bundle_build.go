@@ -17,18 +17,24 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"maps"
 	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
 	"github.com/fluxcd/pkg/ssa"
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/yaml"
@@ -36,11 +42,12 @@ import (
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 	"github.com/stefanprodan/timoni/internal/engine"
 	"github.com/stefanprodan/timoni/internal/flags"
+	"github.com/stefanprodan/timoni/internal/oci"
 	"github.com/stefanprodan/timoni/internal/runtime"
 )
 
 var bundleBuildCmd = &cobra.Command{
-	Use:     "build",
+	Use:     "build [BUNDLE URL]",
 	Aliases: []string{"template"},
 	Short:   "Build and print the resulting Kubernetes resources for all instances from a Bundle",
 	Long: `The bundle build command builds and prints the resulting Kubernetes resources for all instances defined in a Bundle.
@@ -48,17 +55,64 @@ var bundleBuildCmd = &cobra.Command{
 	Example: `  # Build all instances from a bundle
   timoni bundle build -f bundle.cue
 
+  # Build all instances from a bundle artifact stored in a container registry
+  timoni bundle build oci://ghcr.io/org/bundles/podinfo:v1.0.0
+
+  # Build all instances from a bundle and print the objects as a JSON list
+  timoni bundle build -f bundle.cue -o json
+
+  # Build all instances from a bundle and write the objects to one file per instance
+  timoni bundle build -f bundle.cue --output-dir ./deploy
+
+  # Build all instances and write the inventory of the objects to a JSON report
+  timoni bundle build -f bundle.cue --report build-report.json
+
+  # Write the objects of each instance to a file and generate a kustomization.yaml listing them
+  timoni bundle build -f bundle.cue --output-dir ./deploy -o kustomize
+
+  # Build all instances from a bundle and annotate the objects for Helm tooling
+  timoni bundle build -f bundle.cue --compat helm
+
+  # Build all instances from a bundle and override the values of an instance
+  timoni bundle build -f bundle.cue --set instances.podinfo.values.replicas=2
+
+  # List the namespaces the bundle instances and their objects are written to
+  timoni bundle build -f bundle.cue --list-namespaces
+
+  # Build only the instances whose source files changed since a git ref
+  timoni bundle build -f bundle.cue --since origin/main
+
+  # Build all instances from a bundle and set the tag of an image across all instances
+  timoni bundle build -f bundle.cue --image-override ghcr.io/org/app=v2.0
+
+  # Build all instances from a bundle and print the values marked as sensitive
+  timoni bundle build -f bundle.cue --show-secrets
+
+  # Print the bundle files with the runtime values injected, without building the bundle
+  timoni bundle build -f bundle.cue --runtime-from-env --show-injected
+
   # Pass secret values from stdin
   cat ./bundle_secrets.cue | timoni bundle build -f ./bundle.cue -f -
 `,
-	Args: cobra.NoArgs,
+	Args: cobra.MaximumNArgs(1),
 	RunE: runBundleBuildCmd,
 }
 
 type bundleBuildFlags struct {
-	pkg   flags.Package
-	files []string
-	creds flags.Credentials
+	pkg            flags.Package
+	files          []string
+	output         string
+	outputDir      string
+	report         string
+	compat         string
+	setValues      []string
+	setStrings     []string
+	showInjected   bool
+	namespaces     bool
+	since          string
+	showSecrets    bool
+	imageOverrides flags.ImageOverrides
+	creds          flags.Credentials
 }
 
 var bundleBuildArgs bundleBuildFlags
@@ -67,29 +121,65 @@ func init() {
 	bundleBuildCmd.Flags().VarP(&bundleBuildArgs.pkg, bundleBuildArgs.pkg.Type(), bundleBuildArgs.pkg.Shorthand(), bundleBuildArgs.pkg.Description())
 	bundleBuildCmd.Flags().StringSliceVarP(&bundleBuildArgs.files, "file", "f", nil,
 		"The local path to bundle.cue files.")
+	bundleBuildCmd.Flags().StringVarP(&bundleBuildArgs.output, "output", "o", "yaml",
+		"The format in which the Kubernetes objects should be printed, can be 'yaml', 'json' or 'kustomize' (requires --output-dir).")
+	bundleBuildCmd.Flags().StringVar(&bundleBuildArgs.outputDir, "output-dir", "",
+		"The local path to a directory where the Kubernetes objects of each instance are written to '<instance>.yaml'.")
+	bundleBuildCmd.Flags().StringVar(&bundleBuildArgs.report, "report", "",
+		"The local path to a file where the inventory of the Kubernetes objects and their instances is written in JSON format.")
+	bundleBuildCmd.Flags().StringVar(&bundleBuildArgs.compat, "compat", "",
+		"Annotate the Kubernetes objects with the bundle, instance and chart information, can be 'helm'.")
+	bundleBuildCmd.Flags().StringArrayVar(&bundleBuildArgs.setValues, "set", nil,
+		"Override a bundle field in the format path.to.field=value, with numbers and booleans converted from strings, can be specified multiple times.")
+	bundleBuildCmd.Flags().StringArrayVar(&bundleBuildArgs.setStrings, "set-string", nil,
+		"Override a bundle field with a string in the format path.to.field=value, can be specified multiple times.")
+	bundleBuildCmd.Flags().BoolVar(&bundleBuildArgs.showInjected, "show-injected", false,
+		"Print the bundle files with the @timoni() attributes replaced by the runtime values, and exit without building the bundle.")
+	bundleBuildCmd.Flags().BoolVar(&bundleBuildArgs.namespaces, "list-namespaces", false,
+		"Print the sorted list of namespaces the bundle instances and their Kubernetes objects are written to, instead of the objects.")
+	bundleBuildCmd.Flags().StringVar(&bundleBuildArgs.since, "since", "",
+		"Build only the instances whose bundle files, read files or local module changed since the given git ref, e.g. 'origin/main'.")
+	bundleBuildCmd.Flags().BoolVar(&bundleBuildArgs.showSecrets, "show-secrets", false,
+		"Print the values listed in the instances 'sensitive' field, instead of replacing them with '***'.")
+	bundleBuildCmd.Flags().Var(&bundleBuildArgs.imageOverrides, bundleBuildArgs.imageOverrides.Type(), bundleBuildArgs.imageOverrides.Description())
 	bundleBuildCmd.Flags().Var(&bundleBuildArgs.creds, bundleBuildArgs.creds.Type(), bundleBuildArgs.creds.Description())
 	bundleCmd.AddCommand(bundleBuildCmd)
 }
 
-func runBundleBuildCmd(cmd *cobra.Command, _ []string) error {
+func runBundleBuildCmd(cmd *cobra.Command, args []string) error {
 	files := bundleBuildArgs.files
-	if len(files) == 0 {
+	if len(files) == 0 && len(args) == 0 {
 		return errors.New("no bundle provided with -f")
 	}
-	var stdinFile string
-	for i, file := range files {
-		if file == "-" {
-			stdinFile, err := saveReaderToFile(cmd.InOrStdin())
-			if err != nil {
-				return err
-			}
-			files[i] = stdinFile
+	if o := bundleBuildArgs.output; o != "yaml" && o != "json" && o != outputKustomize {
+		return fmt.Errorf("unknown --output=%s, can be yaml, json or %s", o, outputKustomize)
+	}
+	if bundleBuildArgs.outputDir != "" && bundleBuildArgs.output == "json" {
+		return errors.New("--output-dir can only be used with --output=yaml or --output=kustomize")
+	}
+	if bundleBuildArgs.output == outputKustomize && bundleBuildArgs.outputDir == "" {
+		return errors.New("--output=kustomize requires --output-dir")
+	}
+	if bundleBuildArgs.namespaces && bundleBuildArgs.outputDir != "" {
+		return errors.New("--list-namespaces can't be used with --output-dir")
+	}
+	if c := bundleBuildArgs.compat; c != "" && c != compatHelm {
+		return fmt.Errorf("unknown --compat=%s, can be %s", c, compatHelm)
+	}
+	// The changed files are listed from the git repository of the first local bundle file.
+	gitDir := "."
+	for _, file := range files {
+		if file != "-" {
+			gitDir = filepath.Dir(file)
 			break
 		}
 	}
-	if stdinFile != "" {
-		defer os.Remove(stdinFile)
+
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
 	}
+	defer removeStdinFile()
 
 	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
 	if err != nil {
@@ -97,8 +187,58 @@ func runBundleBuildCmd(cmd *cobra.Command, _ []string) error {
 	}
 	defer os.RemoveAll(tmpDir)
 
+	moduleRoot := bundleArgs.moduleRoot
+	if len(args) == 1 {
+		// The files of the bundle artifact are merged with the files given with -f.
+		bundleDir, err := os.MkdirTemp("", apiv1.FieldManager)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(bundleDir)
+
+		pulled, pulledRoot, err := pullBundleArtifact(cmd.Context(), args[0], bundleDir, bundleBuildArgs.creds.String())
+		if err != nil {
+			return err
+		}
+		files = append(pulled, files...)
+		if moduleRoot == "" {
+			moduleRoot = pulledRoot
+		}
+	}
+
 	ctx := cuecontext.New()
 	bm := engine.NewBundleBuilder(ctx, files)
+	bm.SetLogger(engineLogger(LoggerFrom(cmd.Context())))
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(moduleRoot)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+
+	if bundleArgs.legacyTemplates {
+		// The overrides are exposed to the templates as '.Values'.
+		templateValues, err := engine.ParseSetValues(bundleBuildArgs.setValues, bundleBuildArgs.setStrings)
+		if err != nil {
+			return err
+		}
+		bm.SetLegacyTemplates(true, templateValues)
+	}
+
+	overlays := bundleArgs.overlays
+	if len(bundleBuildArgs.setValues) > 0 || len(bundleBuildArgs.setStrings) > 0 {
+		// The overrides are merged as the last overlay, taking precedence over the bundle files.
+		setCue, err := setValuesToCue("bundle", bundleBuildArgs.setValues, bundleBuildArgs.setStrings)
+		if err != nil {
+			return err
+		}
+		setFile := filepath.Join(tmpDir, "set-values.json")
+		if err := os.WriteFile(setFile, setCue, os.ModePerm); err != nil {
+			return err
+		}
+		overlays = append(append([]string{}, overlays...), setFile)
+	}
+	bm.SetOverlays(overlays)
 
 	runtimeValues := make(map[string]string)
 
@@ -145,49 +285,544 @@ func runBundleBuildCmd(cmd *cobra.Command, _ []string) error {
 		return describeErr(tmpDir, "failed to parse bundle", err)
 	}
 
-	v, err := bm.Build()
+	if bundleBuildArgs.showInjected {
+		injected, err := bm.InjectedFiles()
+		if err != nil {
+			return err
+		}
+		return writeInjectedFiles(cmd.OutOrStdout(), injected)
+	}
+
+	v, warnings, err := bm.Build()
 	if err != nil {
 		return describeErr(tmpDir, "failed to build bundle", err)
 	}
 
+	if err := reportBundleWarnings(LoggerFrom(cmd.Context()), warnings); err != nil {
+		return err
+	}
+
 	bundle, err := bm.GetBundle(v)
 	if err != nil {
 		return err
 	}
 
-	var sb strings.Builder
+	log := LoggerBundle(cmd.Context(), bundle.Name, apiv1.RuntimeDefaultName)
+	overrideBundleNamespace(log, bundle)
+
+	if len(bundle.Instances) == 0 {
+		log.Info(noBundleInstancesMsg)
+		return nil
+	}
+
+	if bundleArgs.policy != "" {
+		policy, err := pullValuesPolicy(cmd.Context(), ctx, bundleArgs.policy, bundleBuildArgs.creds.String())
+		if err != nil {
+			return err
+		}
+		if err := validateValuesPolicy(policy, bundle, tmpDir); err != nil {
+			return err
+		}
+	}
+
+	// The common labels are computed before selecting the changed instances,
+	// as the kustomization references the files of all the instances.
+	var kustomization *bundleKustomization
+	if bundleBuildArgs.output == outputKustomize {
+		if kustomization, err = newBundleKustomization(bundle); err != nil {
+			return err
+		}
+	}
+
+	var skipped []string
+	if ref := bundleBuildArgs.since; ref != "" {
+		changed, err := gitChangedFiles(cmd.Context(), gitDir, ref)
+		if err != nil {
+			return err
+		}
+		skipped, err = selectChangedInstances(bm, bundle, changed)
+		if err != nil {
+			return err
+		}
+		log := LoggerBundle(cmd.Context(), bundle.Name, apiv1.RuntimeDefaultName)
+		for _, name := range skipped {
+			log.Info(fmt.Sprintf("skipping instance %s, no changes since %s", colorizeSubject(name), ref))
+		}
+	}
 
 	ctxPull, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
 	defer cancel()
 
-	for _, instance := range bundle.Instances {
-		if err := fetchBundleInstanceModule(ctxPull, instance, tmpDir); err != nil {
+	layers, err := oci.NewLayerCache(rootArgs.cacheDir)
+	if err != nil {
+		return err
+	}
+	defer layers.Close()
+
+	bm.SetRenderer(func(instance *engine.BundleInstance) ([]*unstructured.Unstructured, error) {
+		if err := fetchBundleInstanceModule(ctxPull, instance, tmpDir, layers); err != nil {
+			return nil, err
+		}
+		objects, err := buildBundleInstance(ctx, instance, tmpDir)
+		if err != nil {
+			return nil, err
+		}
+		engine.OverrideImages(objects, bundleBuildArgs.imageOverrides)
+		return objects, nil
+	})
+
+	if bundleBuildArgs.namespaces {
+		namespaces := make(map[string]bool)
+		err := bm.ForEachInstance(func(instance engine.BundleInstance, objects []*unstructured.Unstructured) error {
+			addBundleNamespaces(namespaces, instance, objects)
+			return nil
+		})
+		if err != nil {
 			return err
 		}
+
+		list := make([]string, 0, len(namespaces))
+		for ns := range namespaces {
+			list = append(list, ns)
+		}
+		sort.Strings(list)
+		for _, ns := range list {
+			if _, err := fmt.Fprintln(cmd.OutOrStdout(), ns); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	for i, instance := range bundle.Instances {
+	// The objects are written as soon as each instance is rendered,
+	// so that they are not held in memory for the whole bundle.
+	out := cmd.OutOrStdout()
+	var jw *jsonListWriter
+	switch {
+	case bundleBuildArgs.outputDir != "":
+		if err := os.MkdirAll(bundleBuildArgs.outputDir, os.ModePerm); err != nil {
+			return fmt.Errorf("creating output dir failed: %w", err)
+		}
+	case bundleBuildArgs.output == "json":
+		jw = &jsonListWriter{w: out}
+	}
+
+	written := make(map[string]bool)
+	report := runtime.NewBuildReport(bundle.Name)
+	err = bm.ForEachInstance(func(instance engine.BundleInstance, objects []*unstructured.Unstructured) error {
+		if err := runtime.AddBuildReportObjects(report, instance.Name, instance.Namespace, objects); err != nil {
+			return err
+		}
+
+		if bundleBuildArgs.compat == compatHelm {
+			setHelmCompatAnnotations(objects, &instance)
+		}
+
+		if !bundleBuildArgs.showSecrets && len(instance.Sensitive) > 0 {
+			sensitive, err := engine.SensitiveValues(instance.Values, instance.Sensitive)
+			if err != nil {
+				return fmt.Errorf("instance %s: %w", instance.Name, err)
+			}
+			warned := make(map[string]bool)
+			for _, v := range sensitive {
+				if v.IsShort() && !warned[v.Path] {
+					warned[v.Path] = true
+					log.Info(colorizeJoin(colorizeSubject(instance.Name), colorizeWarning("warning"),
+						fmt.Sprintf("sensitive value '%s' is shorter than %d characters, it is redacted only from the fields equal to it",
+							v.Path, engine.SensitiveMinLength)))
+				}
+			}
+			engine.RedactObjects(objects, sensitive)
+		}
+
+		if jw != nil {
+			return jw.write(objects)
+		}
+
+		data, err := marshalObjectsYAML(objects)
+		if err != nil {
+			return err
+		}
+
+		if bundleBuildArgs.outputDir != "" {
+			written[instance.Name] = true
+			return writeBundleInstanceFile(log, bundleBuildArgs.outputDir, bundle.Name, instance.Name, data)
+		}
+
+		var sb strings.Builder
+		if len(written) > 0 {
+			sb.WriteString("\n")
+		}
+		written[instance.Name] = true
 		sb.WriteString("---\n")
 		sb.WriteString(fmt.Sprintf("# Instance: %s\n", instance.Name))
 		sb.WriteString("---\n")
+		sb.Write(data)
+		_, err = out.Write([]byte(sb.String()))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if bundleBuildArgs.report != "" {
+		if err := writeBuildReport(bundleBuildArgs.report, report); err != nil {
+			return err
+		}
+	}
+
+	if jw != nil {
+		return jw.close()
+	}
 
-		instance, err := buildBundleInstance(ctx, instance, tmpDir)
+	if bundleBuildArgs.outputDir != "" {
+		// The files of the unchanged instances are kept as they are.
+		for _, name := range skipped {
+			written[name] = true
+		}
+		if kustomization != nil {
+			written[kustomizationName] = true
+		}
+		if err := removeStaleBundleFiles(log, bundleBuildArgs.outputDir, bundle.Name, written); err != nil {
+			return err
+		}
+		if kustomization != nil {
+			delete(written, kustomizationName)
+			return kustomization.write(log, bundleBuildArgs.outputDir, written)
+		}
+	}
+
+	return nil
+}
+
+// gitChangedFiles returns the absolute paths of the files that differ between
+// the working tree of the git repository containing dir and the given ref,
+// including the untracked files that are not ignored.
+// It's a variable so that the git diff can be stubbed in tests.
+var gitChangedFiles = func(ctx context.Context, dir, ref string) ([]string, error) {
+	git := func(dir string, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"--no-pager"}, args...)...)
+		cmd.Dir = dir
+		return cmd.Output()
+	}
+
+	top, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("finding the git repository root failed: %w", err)
+	}
+	root := strings.TrimSpace(string(top))
+
+	// Both commands run in the repository root and print the paths relative to it.
+	changed, err := git(root, "diff", "--name-only", "-z", "--end-of-options", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("listing the files changed since %s failed: %w", ref, err)
+	}
+	untracked, err := git(root, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("listing the untracked files failed: %w", err)
+	}
+
+	var files []string
+	for _, name := range strings.Split(string(changed)+string(untracked), "\x00") {
+		if name != "" {
+			files = append(files, filepath.Join(root, name))
+		}
+	}
+	return files, nil
+}
+
+// selectChangedInstances removes from the bundle the instances without any
+// source file in the changed list, and returns the names of the removed instances.
+// A changed file matches a source if it's the same file or if it's inside the source directory.
+func selectChangedInstances(bm *engine.BundleBuilder, bundle *engine.Bundle, changed []string) ([]string, error) {
+	resolve := func(fp string) string {
+		if p, err := filepath.EvalSymlinks(fp); err == nil {
+			return p
+		}
+		return fp
+	}
+	files := make([]string, 0, len(changed))
+	for _, fp := range changed {
+		files = append(files, resolve(fp))
+	}
+
+	var names, skipped []string
+	for _, instance := range bundle.Instances {
+		sources, err := bm.SourceFiles(instance.Name)
 		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, src := range sources {
+			src = resolve(src)
+			for _, fp := range files {
+				if fp == src || strings.HasPrefix(fp, src+string(filepath.Separator)) {
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if found {
+			names = append(names, instance.Name)
+		} else {
+			skipped = append(skipped, instance.Name)
+		}
+	}
+
+	if err := bundle.SelectInstances(names, false); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// writeBuildReport writes the build report to the given file in JSON format.
+func writeBuildReport(file string, report *apiv1.BuildReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("converting report failed: %w", err)
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing report failed: %w", err)
+	}
+	return nil
+}
+
+// jsonListWriter writes the objects as the items of a Kubernetes JSON list,
+// without holding the whole list in memory.
+type jsonListWriter struct {
+	w     io.Writer
+	count int
+}
+
+// write appends the objects to the list items.
+func (jw *jsonListWriter) write(objects []*unstructured.Unstructured) error {
+	for _, object := range objects {
+		data, err := json.MarshalIndent(object, "        ", "    ")
+		if err != nil {
+			return fmt.Errorf("converting objects failed: %w", err)
+		}
+
+		var sb strings.Builder
+		if jw.count == 0 {
+			sb.WriteString("{\n    \"apiVersion\": \"v1\",\n    \"kind\": \"List\",\n    \"items\": [\n")
+		} else {
+			sb.WriteString(",\n")
+		}
+		sb.WriteString("        ")
+		sb.Write(data)
+		if _, err := jw.w.Write([]byte(sb.String())); err != nil {
 			return err
 		}
+		jw.count++
+	}
+	return nil
+}
 
-		sb.WriteString(instance)
-		if i < len(bundle.Instances)-1 {
-			sb.WriteString("\n")
+// close terminates the list, or writes an empty list if no objects were written.
+func (jw *jsonListWriter) close() error {
+	end := "\n    ]\n}"
+	if jw.count == 0 {
+		end = "{\n    \"apiVersion\": \"v1\",\n    \"kind\": \"List\"\n}"
+	}
+	_, err := jw.w.Write([]byte(end))
+	return err
+}
+
+const (
+	compatHelm = "helm"
+
+	compatBundleAnnotation   = "timoni.sh/bundle"
+	compatInstanceAnnotation = "timoni.sh/instance"
+	compatChartAnnotation    = "helm.sh/chart"
+)
+
+// setHelmCompatAnnotations annotates the objects with the bundle and instance names,
+// and with a chart reference in the Helm '<name>-<version>' format, made of the last element
+// of the module name and the module version, so that the tools keyed on Helm metadata can find the objects.
+func setHelmCompatAnnotations(objects []*unstructured.Unstructured, instance *engine.BundleInstance) {
+	chart := fmt.Sprintf("%s-%s", path.Base(instance.Module.Name), instance.Module.Version)
+	for _, object := range objects {
+		annotations := object.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[compatBundleAnnotation] = instance.Bundle
+		annotations[compatInstanceAnnotation] = instance.Name
+		annotations[compatChartAnnotation] = chart
+		object.SetAnnotations(annotations)
+	}
+}
+
+// marshalObjectsYAML returns the objects as a multi-document YAML.
+func marshalObjectsYAML(objects []*unstructured.Unstructured) ([]byte, error) {
+	var sb strings.Builder
+	for i, r := range objects {
+		data, err := engine.MarshalObjectYAML(r)
+		if err != nil {
+			return nil, fmt.Errorf("converting objects failed: %w", err)
+		}
+
+		if i != 0 {
+			sb.WriteString("---\n")
+		}
+		sb.Write(data)
+	}
+	return []byte(sb.String()), nil
+}
+
+// writeBundleInstanceFile writes the objects of an instance to '<dir>/<instance>.yaml'.
+// The file is prefixed with a header containing the bundle name, which is used
+// by removeStaleBundleFiles to find the files generated for the bundle.
+func writeBundleInstanceFile(log logr.Logger, dir, bundleName, instanceName string, data []byte) error {
+	var sb strings.Builder
+	sb.WriteString(bundleFileHeader(bundleName))
+	sb.WriteString(fmt.Sprintf("# Instance: %s\n", instanceName))
+	sb.WriteString("---\n")
+	sb.Write(data)
+
+	file := filepath.Join(dir, instanceName+".yaml")
+	if err := os.WriteFile(file, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("writing %s failed: %w", file, err)
+	}
+	log.Info(fmt.Sprintf("written %s", colorizeSubject(file)))
+	return nil
+}
+
+const (
+	// outputKustomize is the output format that writes a kustomization.yaml
+	// listing the instance files next to them.
+	outputKustomize = "kustomize"
+
+	// kustomizationName is the name of the kustomization file without the extension.
+	kustomizationName = "kustomization"
+)
+
+// bundleKustomization is a Kustomize config that references the files
+// written with --output-dir, and sets the labels common to all instances.
+type bundleKustomization struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Resources  []string            `json:"resources"`
+	Labels     []kustomizeLabelSet `json:"labels,omitempty"`
+
+	bundle string
+}
+
+type kustomizeLabelSet struct {
+	Pairs            map[string]string `json:"pairs"`
+	IncludeSelectors bool              `json:"includeSelectors"`
+}
+
+// newBundleKustomization returns a kustomization with the bundle name label
+// and the labels set with the same value on all the bundle instances.
+func newBundleKustomization(bundle *engine.Bundle) (*bundleKustomization, error) {
+	labels := map[string]string{apiv1.BundleNameLabelKey: bundle.Name}
+	for i, instance := range bundle.Instances {
+		if instance.Name == kustomizationName {
+			return nil, fmt.Errorf("instance %s conflicts with the %s.yaml file, it can't be used with --output=%s",
+				instance.Name, kustomizationName, outputKustomize)
+		}
+		if i == 0 {
+			maps.Copy(labels, instance.Labels)
+			continue
+		}
+		for k, v := range labels {
+			if k != apiv1.BundleNameLabelKey && instance.Labels[k] != v {
+				delete(labels, k)
+			}
 		}
 	}
 
-	cmd.OutOrStdout().Write([]byte(sb.String()))
+	return &bundleKustomization{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Labels:     []kustomizeLabelSet{{Pairs: labels}},
+		bundle:     bundle.Name,
+	}, nil
+}
+
+// write writes the kustomization to '<dir>/kustomization.yaml',
+// with the files of the given instances as resources.
+func (k *bundleKustomization) write(log logr.Logger, dir string, instances map[string]bool) error {
+	k.Resources = make([]string, 0, len(instances))
+	for name := range instances {
+		k.Resources = append(k.Resources, name+".yaml")
+	}
+	sort.Strings(k.Resources)
+
+	data, err := yaml.Marshal(k)
+	if err != nil {
+		return fmt.Errorf("marshaling %s failed: %w", kustomizationName, err)
+	}
 
+	file := filepath.Join(dir, kustomizationName+".yaml")
+	if err := os.WriteFile(file, append([]byte(bundleFileHeader(k.bundle)), data...), 0644); err != nil {
+		return fmt.Errorf("writing %s failed: %w", file, err)
+	}
+	log.Info(fmt.Sprintf("written %s", colorizeSubject(file)))
 	return nil
 }
 
-func buildBundleInstance(cuectx *cue.Context, instance *engine.BundleInstance, rootDir string) (string, error) {
+// removeStaleBundleFiles removes the files of the instances that are no longer part of the bundle.
+// Files that were not generated for this bundle are left untouched.
+func removeStaleBundleFiles(log logr.Logger, dir, bundleName string, instances map[string]bool) error {
+	header := bundleFileHeader(bundleName)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading output dir failed: %w", err)
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if !ok || !entry.Type().IsRegular() || instances[name] {
+			continue
+		}
+
+		file := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("reading %s failed: %w", file, err)
+		}
+		if !strings.HasPrefix(string(data), header) {
+			continue
+		}
+
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("removing stale file failed: %w", err)
+		}
+		log.Info(fmt.Sprintf("removed %s", colorizeSubject(file)))
+	}
+
+	return nil
+}
+
+// bundleFileHeader returns the header of the files written with --output-dir.
+func bundleFileHeader(bundleName string) string {
+	return fmt.Sprintf("# Bundle: %s\n", bundleName)
+}
+
+// addBundleNamespaces adds to the set the namespace of the instance and the namespaces
+// of its objects, including the ones created by the Namespace objects.
+func addBundleNamespaces(namespaces map[string]bool, instance engine.BundleInstance, objects []*unstructured.Unstructured) {
+	if instance.Namespace != "" {
+		namespaces[instance.Namespace] = true
+	}
+	for _, object := range objects {
+		if ns := object.GetNamespace(); ns != "" {
+			namespaces[ns] = true
+		}
+		if object.GetKind() == "Namespace" && object.GroupVersionKind().Group == "" {
+			namespaces[object.GetName()] = true
+		}
+	}
+}
+
+// buildBundleInstance builds the instance module and returns the sorted objects,
+// labeled with the instance name and namespace.
+func buildBundleInstance(cuectx *cue.Context, instance *engine.BundleInstance, rootDir string) ([]*unstructured.Unstructured, error) {
 	modDir := path.Join(rootDir, instance.Name, "module")
 
 	builder := engine.NewModuleBuilder(
@@ -197,32 +832,33 @@ func buildBundleInstance(cuectx *cue.Context, instance *engine.BundleInstance, r
 		modDir,
 		bundleBuildArgs.pkg.String(),
 	)
+	builder.SetTimoniVersion(VERSION)
 
 	if err := builder.WriteSchemaFile(); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	modName, err := builder.GetModuleName()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	instance.Module.Name = modName
 
 	err = builder.WriteValuesFileWithDefaults(instance.Values)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	builder.SetVersionInfo(instance.Module.Version, "")
 
 	buildResult, err := builder.Build()
 	if err != nil {
-		return "", describeErr(modDir, "build failed for "+instance.Name, err)
+		return nil, describeErr(modDir, "build failed for "+instance.Name, err)
 	}
 
 	bundleBuildSets, err := builder.GetApplySets(buildResult)
 	if err != nil {
-		return "", fmt.Errorf("failed to extract objects: %w", err)
+		return nil, fmt.Errorf("failed to extract objects: %w", err)
 	}
 
 	var objects []*unstructured.Unstructured
@@ -230,20 +866,30 @@ func buildBundleInstance(cuectx *cue.Context, instance *engine.BundleInstance, r
 		objects = append(objects, set.Objects...)
 	}
 	sort.Sort(ssa.SortableUnstructureds(objects))
+	runtime.SetOwnerLabels(objects, instance.Name, instance.Namespace)
 
-	var sb strings.Builder
+	return objects, nil
+}
 
-	for i, r := range objects {
-		data, err := yaml.Marshal(r)
-		if err != nil {
-			return "", fmt.Errorf("converting objects failed: %w", err)
+// writeInjectedFiles writes the content of the injected bundle files,
+// each preceded by a comment with the path of the source file.
+func writeInjectedFiles(w io.Writer, files []engine.InjectedFile) error {
+	for i, file := range files {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
 		}
-
-		if i != 0 {
-			sb.WriteString("---\n")
+		if _, err := fmt.Fprintf(w, "// source: %s\n", file.Source); err != nil {
+			return err
+		}
+		content := file.Content
+		if !bytes.HasSuffix(content, []byte("\n")) {
+			content = append(content, '\n')
+		}
+		if _, err := w.Write(content); err != nil {
+			return err
 		}
-		sb.Write(data)
 	}
-
-	return sb.String(), nil
+	return nil
 }
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/fluxcd/pkg/ssa"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 )
 
 func Test_BundleBuild(t *testing.T) {
@@ -135,9 +142,265 @@ bundle:
 				g.Expect(err).ToNot(HaveOccurred())
 				g.Expect(found).To(BeTrue())
 				g.Expect(host).To(ContainSubstring("example.internal"))
+
+				g.Expect(frontendClientCm.GetLabels()).To(HaveKeyWithValue("instance.timoni.sh/name", "frontend"))
+				g.Expect(backendClientCm.GetLabels()).To(HaveKeyWithValue("instance.timoni.sh/name", "backend"))
+				g.Expect(output).To(ContainSubstring("# Instance: frontend"))
+				g.Expect(output).To(ContainSubstring("# Instance: backend"))
 			})
 		}
 	})
+
+	t.Run("builds instances as JSON list", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle build -f %s -f %s -f %s -p main --runtime-from-env -o json",
+			cuePath, yamlPath, jsonPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		list := &unstructured.UnstructuredList{}
+		g.Expect(list.UnmarshalJSON([]byte(output))).To(Succeed())
+		g.Expect(list.Items).To(HaveLen(2))
+
+		instances := []string{}
+		for _, item := range list.Items {
+			instances = append(instances, item.GetLabels()["instance.timoni.sh/name"])
+		}
+		g.Expect(instances).To(ConsistOf("frontend", "backend"))
+	})
+
+	t.Run("writes instances to output dir", func(t *testing.T) {
+		g := NewWithT(t)
+		outputDir := filepath.Join(t.TempDir(), "deploy")
+		g.Expect(os.MkdirAll(outputDir, os.ModePerm)).To(Succeed())
+
+		stalePath := filepath.Join(outputDir, "removed.yaml")
+		g.Expect(os.WriteFile(stalePath, []byte(fmt.Sprintf("# Bundle: %s\n", bundleName)), 0644)).To(Succeed())
+		otherPath := filepath.Join(outputDir, "other.yaml")
+		g.Expect(os.WriteFile(otherPath, []byte("# Bundle: other\n"), 0644)).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf(
+			"bundle build -f %s -f %s -f %s -p main --runtime-from-env --output-dir %s",
+			cuePath, yamlPath, jsonPath, outputDir,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(stalePath).ToNot(BeAnExistingFile())
+		g.Expect(otherPath).To(BeAnExistingFile())
+
+		for _, instance := range []string{"frontend", "backend"} {
+			data, err := os.ReadFile(filepath.Join(outputDir, instance+".yaml"))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(data)).To(HavePrefix(fmt.Sprintf("# Bundle: %s\n# Instance: %s\n", bundleName, instance)))
+
+			objects, err := ssa.ReadObjects(strings.NewReader(string(data)))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(objects).To(HaveLen(1))
+			g.Expect(objects[0].GetLabels()).To(HaveKeyWithValue("instance.timoni.sh/name", instance))
+		}
+	})
+
+	t.Run("writes the build report", func(t *testing.T) {
+		g := NewWithT(t)
+		reportPath := filepath.Join(t.TempDir(), "report.json")
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(bundlePath, []byte(fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: frontend: {
+		module: {
+			url:     "oci://%[2]s"
+			version: "%[3]s"
+		}
+		namespace: "%[4]s"
+	}
+}
+`, bundleName, modURL, modVer, namespace)), 0644)).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf(
+			"bundle build -f %s -p main --report %s",
+			bundlePath, reportPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		data, err := os.ReadFile(reportPath)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		report := &apiv1.BuildReport{}
+		g.Expect(json.Unmarshal(data, report)).To(Succeed())
+		g.Expect(report.Kind).To(Equal(apiv1.BuildReportKind))
+		g.Expect(report.Bundle).To(Equal(bundleName))
+		g.Expect(report.Objects).To(ConsistOf(
+			apiv1.BuildReportObject{
+				ID:                fmt.Sprintf("%s_frontend-client__ConfigMap", namespace),
+				APIVersion:        "v1",
+				Kind:              "ConfigMap",
+				Name:              "frontend-client",
+				Namespace:         namespace,
+				Instance:          "frontend",
+				InstanceNamespace: namespace,
+			},
+			apiv1.BuildReportObject{
+				ID:                fmt.Sprintf("%s_frontend-server__ConfigMap", namespace),
+				APIVersion:        "v1",
+				Kind:              "ConfigMap",
+				Name:              "frontend-server",
+				Namespace:         namespace,
+				Instance:          "frontend",
+				InstanceNamespace: namespace,
+			},
+		))
+	})
+
+	t.Run("writes a kustomization to output dir", func(t *testing.T) {
+		g := NewWithT(t)
+		outputDir := filepath.Join(t.TempDir(), "deploy")
+
+		_, err := executeCommand(fmt.Sprintf(
+			"bundle build -f %s -f %s -f %s -p main --runtime-from-env --output-dir %s -o kustomize",
+			cuePath, yamlPath, jsonPath, outputDir,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		data, err := os.ReadFile(filepath.Join(outputDir, "kustomization.yaml"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(data)).To(HavePrefix(fmt.Sprintf("# Bundle: %s\n", bundleName)))
+
+		var kustomization bundleKustomization
+		g.Expect(yaml.Unmarshal(data, &kustomization)).To(Succeed())
+		g.Expect(kustomization.Kind).To(Equal("Kustomization"))
+		g.Expect(kustomization.Resources).To(Equal([]string{"backend.yaml", "frontend.yaml"}))
+		for _, resource := range kustomization.Resources {
+			g.Expect(filepath.Join(outputDir, resource)).To(BeAnExistingFile())
+		}
+		g.Expect(kustomization.Labels).To(HaveLen(1))
+		g.Expect(kustomization.Labels[0].Pairs).To(HaveKeyWithValue("bundle.timoni.sh/name", bundleName))
+
+		_, err = executeCommand(fmt.Sprintf(
+			"bundle build -f %s -p main -o kustomize",
+			cuePath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("--output=kustomize requires --output-dir"))
+	})
+
+	t.Run("annotates objects in helm compat mode", func(t *testing.T) {
+		g := NewWithT(t)
+		build := func(args string) []*unstructured.Unstructured {
+			output, err := executeCommand(fmt.Sprintf(
+				"bundle build -f %s -f %s -f %s -p main --runtime-from-env %s",
+				cuePath, yamlPath, jsonPath, args,
+			))
+			g.Expect(err).ToNot(HaveOccurred())
+
+			objects, err := ssa.ReadObjects(strings.NewReader(output))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(objects).To(HaveLen(2))
+			return objects
+		}
+
+		for _, object := range build("--compat helm") {
+			instance := object.GetLabels()["instance.timoni.sh/name"]
+			g.Expect(object.GetAnnotations()).To(HaveKeyWithValue("timoni.sh/bundle", bundleName))
+			g.Expect(object.GetAnnotations()).To(HaveKeyWithValue("timoni.sh/instance", instance))
+			g.Expect(object.GetAnnotations()).To(HaveKeyWithValue("helm.sh/chart", "test-"+modVer))
+		}
+
+		for _, object := range build("") {
+			g.Expect(object.GetAnnotations()).ToNot(HaveKey("timoni.sh/bundle"))
+			g.Expect(object.GetAnnotations()).ToNot(HaveKey("timoni.sh/instance"))
+			g.Expect(object.GetAnnotations()).ToNot(HaveKey("helm.sh/chart"))
+		}
+
+		_, err := executeCommand(fmt.Sprintf("bundle build -f %s --compat kustomize", cuePath))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unknown --compat=kustomize"))
+	})
+
+	t.Run("builds instances with imports from module root", func(t *testing.T) {
+		g := NewWithT(t)
+		moduleRoot := t.TempDir()
+		g.Expect(os.MkdirAll(filepath.Join(moduleRoot, "cue.mod"), os.ModePerm)).To(Succeed())
+		g.Expect(os.MkdirAll(filepath.Join(moduleRoot, "common"), os.ModePerm)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(moduleRoot, "cue.mod", "module.cue"),
+			[]byte(`module: "example.com/bundles"`), 0644)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(moduleRoot, "common", "common.cue"),
+			[]byte(fmt.Sprintf("package common\n\n#Namespace: %q\n", namespace)), 0644)).To(Succeed())
+
+		importPath := filepath.Join(moduleRoot, "bundle.cue")
+		g.Expect(os.WriteFile(importPath, []byte(fmt.Sprintf(`
+import "example.com/bundles/common"
+
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: backend: {
+		module: {
+			url:     "oci://%[2]s"
+			version: "%[3]s"
+		}
+		namespace: common.#Namespace
+		values: client: enabled: false
+	}
+}
+`, bundleName, modURL, modVer)), 0644)).To(Succeed())
+
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle build -f %s -p main --module-root %s",
+			importPath, moduleRoot,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+		g.Expect(objects[0].GetNamespace()).To(Equal(namespace))
+	})
+
+	t.Run("fails on warnings in strict mode", func(t *testing.T) {
+		g := NewWithT(t)
+		warnPath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(warnPath, []byte(fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: backend: {
+		module: {
+			url:     "oci://%[2]s"
+			version: "%[3]s"
+		}
+		namespace: "%[4]s" @timoni(runtime:NAMESPACE)
+		values: client: enabled: false
+	}
+}
+`, bundleName, modURL, modVer, namespace)), 0644)).To(Succeed())
+
+		_, err := executeCommand(fmt.Sprintf("bundle build -f %s -p main", warnPath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = executeCommand(fmt.Sprintf("bundle build -f %s -p main --strict-warnings", warnPath))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unknown attribute '@timoni(runtime:NAMESPACE)' is ignored"))
+	})
+
+	t.Run("overrides the instances namespace", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle build -f %s -f %s -f %s -p main --runtime-from-env --instances-namespace preview",
+			cuePath, yamlPath, jsonPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(objects).To(HaveLen(2))
+		for _, object := range objects {
+			g.Expect(object.GetNamespace()).To(Equal("preview"))
+			g.Expect(object.GetLabels()).To(HaveKeyWithValue("instance.timoni.sh/namespace", "preview"))
+		}
+	})
 }
 
 func Test_BundleBuild_Runtime(t *testing.T) {
@@ -226,3 +489,477 @@ func getObjectByName(objs []*unstructured.Unstructured, name string) (*unstructu
 	}
 	return nil, fmt.Errorf("object with name '%s' does not exist", name)
 }
+
+func Test_BundleBuild_ShowInjected(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleData := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			namespace: "apps"
+			values: ingress: host: "example.com" @timoni(runtime:string:TEST_BINJECT_HOST)
+		}
+	}
+}
+`
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	t.Setenv("TEST_BINJECT_HOST", "my.host")
+
+	output, err := executeCommand(fmt.Sprintf(
+		"bundle build -f %s --runtime-from-env --show-injected",
+		bundlePath,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(output).To(HavePrefix(fmt.Sprintf("// source: %s\n", bundlePath)))
+	g.Expect(output).To(ContainSubstring(`host: "my.host"`))
+	g.Expect(output).ToNot(ContainSubstring("example.com"))
+	g.Expect(output).ToNot(ContainSubstring("#Bundle"))
+}
+
+func Test_BundleBuild_Sensitive(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath, err := filepath.Abs("testdata/module")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: url: "file://%s"
+			namespace: "apps"
+			values: domain: "internal.s3cr3t.host"
+			sensitive: ["domain"]
+		}
+	}
+}
+`, modPath)
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	t.Run("redacts the sensitive values", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle build -f %s", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).ToNot(ContainSubstring("internal.s3cr3t.host"))
+		g.Expect(output).To(ContainSubstring("server: '***'"))
+		g.Expect(output).To(ContainSubstring("hostname: '***'"))
+		g.Expect(output).To(ContainSubstring("name: frontend-server"))
+	})
+
+	t.Run("prints the sensitive values", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle build -f %s --show-secrets", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("server: tcp://internal.s3cr3t.host:9090"))
+	})
+}
+
+func Test_BundleBuild_SetValues(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath := "testdata/module"
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, rnd("my-mod", 5))
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[1]s"
+				version: "%[2]s"
+			}
+			namespace: "apps"
+			values: domain: "example.com"
+		}
+	}
+}
+`, modURL, modVer)
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	t.Run("overrides the instance values", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle build -f %s -p main --set instances.frontend.values.domain=example.org --set instances.frontend.values.server.enabled=false",
+			bundlePath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+
+		clientCm, err := getObjectByName(objects, "frontend-client")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(clientCm.GetNamespace()).To(BeEquivalentTo("apps"))
+
+		server, _, err := unstructured.NestedString(clientCm.Object, "data", "server")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(server).To(BeEquivalentTo("tcp://example.org:9090"))
+	})
+
+	t.Run("fails for conflicting overrides", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand(fmt.Sprintf(
+			"bundle build -f %s -p main --set instances.frontend.values.domain=example.org --set instances.frontend.values=none",
+			bundlePath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("already set"))
+	})
+}
+
+func Test_BundleBuild_LocalModule(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath := "testdata/module"
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, rnd("my-mod", 5))
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: url: "file://./%[1]s"
+			namespace: "apps"
+			values: domain: "local.example.com"
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "apps"
+			values: domain: "remote.example.com"
+		}
+	}
+}
+`, modPath, modURL, modVer)
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	output, err := executeCommand(fmt.Sprintf(
+		"bundle build -f %s -p main",
+		bundlePath,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	objects, err := ssa.ReadObjects(strings.NewReader(output))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(objects).To(HaveLen(4))
+
+	frontendCm, err := getObjectByName(objects, "frontend-client")
+	g.Expect(err).ToNot(HaveOccurred())
+	server, _, err := unstructured.NestedString(frontendCm.Object, "data", "server")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(server).To(BeEquivalentTo("tcp://local.example.com:9090"))
+
+	backendCm, err := getObjectByName(objects, "backend-client")
+	g.Expect(err).ToNot(HaveOccurred())
+	server, _, err = unstructured.NestedString(backendCm.Object, "data", "server")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(server).To(BeEquivalentTo("tcp://remote.example.com:9090"))
+}
+
+func Test_BundleBuild_ListNamespaces(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath := "testdata/module"
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, rnd("my-mod", 5))
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[1]s"
+				version: "%[2]s"
+			}
+			namespace: "apps"
+		}
+		backend: {
+			module: {
+				url:     "oci://%[1]s"
+				version: "%[2]s"
+			}
+			namespace: "data"
+		}
+		worker: {
+			module: {
+				url:     "oci://%[1]s"
+				version: "%[2]s"
+			}
+			namespace: "apps"
+			values: ns: enabled: true
+		}
+	}
+}
+`, modURL, modVer)
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).To(Succeed())
+
+	output, err := executeCommand(fmt.Sprintf(
+		"bundle build -f %s -p main --list-namespaces",
+		bundlePath,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(output).To(Equal("apps\ndata\nworker-ns\n"))
+}
+
+func Test_BundleBuild_Since(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath, err := filepath.Abs("testdata/module")
+	g.Expect(err).ToNot(HaveOccurred())
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, rnd("my-mod", 5))
+	modVer := "1.0.0"
+
+	_, err = executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	tmpDir := t.TempDir()
+	frontendPath := filepath.Join(tmpDir, "frontend.cue")
+	g.Expect(os.WriteFile(frontendPath, []byte(fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: frontend: {
+		module: url: "file://%s"
+		namespace: "apps"
+	}
+}
+`, modPath)), 0644)).To(Succeed())
+
+	backendPath := filepath.Join(tmpDir, "backend.cue")
+	g.Expect(os.WriteFile(backendPath, []byte(fmt.Sprintf(`
+bundle: instances: backend: {
+	module: {
+		url:     "oci://%s"
+		version: "%s"
+	}
+	namespace: "apps"
+}
+`, modURL, modVer)), 0644)).To(Succeed())
+
+	gitDiff := gitChangedFiles
+	defer func() { gitChangedFiles = gitDiff }()
+
+	tests := []struct {
+		name      string
+		changed   []string
+		instances []string
+	}{
+		{
+			name:      "builds the instances declared in the changed files",
+			changed:   []string{backendPath},
+			instances: []string{"backend"},
+		},
+		{
+			name:      "builds the instances of the changed local module",
+			changed:   []string{filepath.Join(modPath, "templates", "config.cue")},
+			instances: []string{"frontend"},
+		},
+		{
+			name:    "skips the instances without changes",
+			changed: []string{filepath.Join(tmpDir, "README.md")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			var dir, ref string
+			gitChangedFiles = func(_ context.Context, d, r string) ([]string, error) {
+				dir, ref = d, r
+				return tt.changed, nil
+			}
+
+			output, err := executeCommand(fmt.Sprintf(
+				"bundle build -f %s -f %s -p main --since origin/main",
+				frontendPath, backendPath,
+			))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(dir).To(Equal(filepath.Dir(frontendPath)))
+			g.Expect(ref).To(Equal("origin/main"))
+
+			for _, name := range []string{"frontend", "backend"} {
+				header := fmt.Sprintf("# Instance: %s\n", name)
+				if slices.Contains(tt.instances, name) {
+					g.Expect(output).To(ContainSubstring(header))
+				} else {
+					g.Expect(output).ToNot(ContainSubstring(header))
+				}
+			}
+		})
+	}
+}
+
+func Test_GitChangedFiles(t *testing.T) {
+	g := NewWithT(t)
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	tmpDir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = tmpDir
+		out, err := cmd.CombinedOutput()
+		g.Expect(err).ToNot(HaveOccurred(), string(out))
+	}
+
+	bundleDir := filepath.Join(tmpDir, "bundles")
+	g.Expect(os.MkdirAll(bundleDir, os.ModePerm)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(tmpDir, ".gitignore"), []byte("*.tmp\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(tmpDir, "unchanged.cue"), []byte("a: 1\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(bundleDir, "bundle.cue"), []byte("a: 1\n"), 0644)).To(Succeed())
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+
+	g.Expect(os.WriteFile(filepath.Join(bundleDir, "bundle.cue"), []byte("a: 2\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(tmpDir, "values.cue"), []byte("b: 1\n"), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(tmpDir, "ignored.tmp"), []byte("c: 1\n"), 0644)).To(Succeed())
+
+	// The bundle directory is not the working directory of the test.
+	files, err := gitChangedFiles(context.Background(), bundleDir, "HEAD")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	root, err := filepath.EvalSymlinks(tmpDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(files).To(ConsistOf(
+		filepath.Join(root, "bundles", "bundle.cue"),
+		filepath.Join(root, "values.cue"),
+	))
+}
+
+func Test_BundleBuild_OCI(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath := "testdata/module"
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, rnd("my-mod", 5))
+	modVer := "1.0.0"
+	bundleRepo := fmt.Sprintf("oci://%s/%s", dockerRegistry, rnd("my-bundle", 5))
+	bundleURL := bundleRepo + ":v1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: frontend: {
+		module: {
+			url:     "oci://%[1]s"
+			version: "%[2]s"
+		}
+		namespace: "apps"
+		values: server: enabled: false
+	}
+}
+`, modURL, modVer)
+	valuesData := `
+bundle:
+  instances:
+    frontend:
+      values:
+        domain: oci.internal
+`
+	bundleDir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(bundleDir, "bundle.cue"), []byte(bundleData), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(bundleDir, "values.yaml"), []byte(valuesData), 0644)).To(Succeed())
+
+	_, err = executeCommand(fmt.Sprintf("artifact push %s -f %s -t v1.0.0 --content-type bundle", bundleRepo, bundleDir))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	t.Run("builds instances from bundle artifact", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle build %s -p main", bundleURL))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+
+		cm, err := getObjectByName(objects, "frontend-client")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cm.GetNamespace()).To(Equal("apps"))
+
+		server, _, err := unstructured.NestedString(cm.Object, "data", "server")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(server).To(ContainSubstring("oci.internal"))
+	})
+
+	t.Run("merges local files with bundle artifact", func(t *testing.T) {
+		g := NewWithT(t)
+		overridePath := filepath.Join(t.TempDir(), "team.cue")
+		g.Expect(os.WriteFile(overridePath, []byte(`bundle: instances: frontend: values: team: "web"`), 0644)).To(Succeed())
+
+		output, err := executeCommand(fmt.Sprintf("bundle build %s -f %s -p main", bundleURL, overridePath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		objects, err := ssa.ReadObjects(strings.NewReader(output))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(objects).To(HaveLen(1))
+		g.Expect(objects[0].GetLabels()).To(HaveKeyWithValue("app.kubernetes.io/team", "web"))
+	})
+
+	t.Run("fails for invalid bundle URL", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand("bundle build bundle.cue -p main")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("invalid bundle URL 'bundle.cue'"))
+	})
+}
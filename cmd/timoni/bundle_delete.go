@@ -26,6 +26,7 @@ import (
 	"cuelang.org/go/cue/cuecontext"
 	"github.com/fluxcd/pkg/ssa"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 	"github.com/stefanprodan/timoni/internal/engine"
@@ -50,6 +51,9 @@ deletes all their Kubernetes resources from the cluster.'.
 
   # Do a dry-run uninstall and print the changes
   timoni bundle delete my-app --dry-run
+
+  # Uninstall the instances matching a label selector
+  timoni bundle delete my-app --selector team=payments
 `,
 	RunE: runBundleDelCmd,
 }
@@ -59,6 +63,7 @@ type bundleDelFlags struct {
 	wait     bool
 	dryrun   bool
 	name     string
+	selector string
 }
 
 var bundleDelArgs bundleDelFlags
@@ -73,6 +78,8 @@ func init() {
 	bundleDelCmd.Flags().StringVar(&bundleDelArgs.name, "name", "",
 		"Name of the bundle to delete.")
 	bundleDelCmd.Flags().MarkDeprecated("name", "use 'timoni bundle delete <name>'")
+	bundleDelCmd.Flags().StringVarP(&bundleDelArgs.selector, "selector", "l", "",
+		"Select the instances by label selector, e.g. 'team=payments,tier!=db'.")
 	bundleCmd.AddCommand(bundleDelCmd)
 }
 
@@ -93,6 +100,11 @@ func runBundleDelCmd(cmd *cobra.Command, args []string) error {
 		bundleDelArgs.name = args[0]
 	}
 
+	selector, err := parseInstanceSelector(bundleDelArgs.selector)
+	if err != nil {
+		return err
+	}
+
 	rt, err := buildRuntime(bundleArgs.runtimeFiles)
 	if err != nil {
 		return err
@@ -119,6 +131,7 @@ func runBundleDelCmd(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
+		instances = selectInstancesByLabels(instances, selector)
 
 		log := LoggerBundle(ctx, bundleDelArgs.name, cluster.Name)
 
@@ -127,17 +140,24 @@ func runBundleDelCmd(cmd *cobra.Command, args []string) error {
 			continue
 		}
 
-		// delete in revers order (last installed, first to uninstall)
-		for index := len(instances) - 1; index >= 0; index-- {
-			instance := instances[index]
+		bundleInstances, err := bundleInstancesFromStorage(bundleDelArgs.name, cluster.Name, instances)
+		if err != nil {
+			return err
+		}
+
+		// delete in reverse dependency order (last installed, first to uninstall)
+		for index := len(bundleInstances) - 1; index >= 0; index-- {
+			instance := bundleInstances[index]
 			log.Info(fmt.Sprintf("deleting instance %s in namespace %s",
 				colorizeSubject(instance.Name), colorizeSubject(instance.Namespace)))
-			if err := deleteBundleInstance(ctx, &engine.BundleInstance{
-				Bundle:    bundleDelArgs.name,
-				Cluster:   cluster.Name,
-				Name:      instance.Name,
-				Namespace: instance.Namespace,
-			}, bundleDelArgs.wait, bundleDelArgs.dryrun); err != nil {
+			if _, err := deleteBundleInstance(ctx, instance, bundleDelArgs.wait, bundleDelArgs.dryrun); err != nil {
+				return err
+			}
+		}
+
+		// the revisions are kept when only some of the instances are deleted
+		if selector.Empty() && !bundleDelArgs.dryrun {
+			if err := runtime.NewRevisionManager(rm).Delete(ctx, bundleDelArgs.name); err != nil {
 				return err
 			}
 		}
@@ -145,12 +165,58 @@ func runBundleDelCmd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func deleteBundleInstance(ctx context.Context, instance *engine.BundleInstance, wait bool, dryrun bool) error {
+// bundleInstancesFromStorage converts the stored instances to bundle instances
+// ordered by their dependencies. It returns an error if any of the instances
+// was recorded as applied by another bundle.
+func bundleInstancesFromStorage(bundle, cluster string, instances []*apiv1.Instance) ([]*engine.BundleInstance, error) {
+	names := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		owner := instance.Bundle
+		// the instances applied before the bundle name was recorded are owned by the storage label
+		if owner == "" {
+			owner = instance.Labels[apiv1.BundleNameLabelKey]
+		}
+		if owner != bundle {
+			return nil, fmt.Errorf("instance %s/%s is managed by bundle %q, not by bundle %q",
+				instance.Namespace, instance.Name, owner, bundle)
+		}
+		names[instance.Name] = true
+	}
+
+	var list []*engine.BundleInstance
+	for _, instance := range instances {
+		// dependencies that are no longer installed don't affect the order
+		var dependsOn []string
+		for _, dep := range instance.DependsOn {
+			if names[dep] {
+				dependsOn = append(dependsOn, dep)
+			}
+		}
+		deletePolicy := instance.DeletePolicy
+		if deletePolicy == "" {
+			deletePolicy = apiv1.DeletePolicyDelete
+		}
+		list = append(list, &engine.BundleInstance{
+			Bundle:       bundle,
+			Cluster:      cluster,
+			Name:         instance.Name,
+			Namespace:    instance.Namespace,
+			DependsOn:    dependsOn,
+			DeletePolicy: deletePolicy,
+		})
+	}
+
+	return engine.SortByDependencies(list)
+}
+
+// deleteBundleInstance deletes the objects and the storage of the instance,
+// and returns the objects deleted from the cluster.
+func deleteBundleInstance(ctx context.Context, instance *engine.BundleInstance, wait bool, dryrun bool) ([]*unstructured.Unstructured, error) {
 	log := LoggerBundle(ctx, instance.Bundle, instance.Cluster)
 
 	sm, err := runtime.NewResourceManager(kubeconfigArgs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
@@ -159,22 +225,28 @@ func deleteBundleInstance(ctx context.Context, instance *engine.BundleInstance,
 	iStorage := runtime.NewStorageManager(sm)
 	inst, err := iStorage.Get(ctx, instance.Name, instance.Namespace)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	iManager := runtime.InstanceManager{Instance: *inst}
 	objects, err := iManager.ListObjects()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	sort.Sort(sort.Reverse(ssa.SortableUnstructureds(objects)))
 
+	objects, retained := selectObjectsByDeletePolicy(objects, instance.DeletePolicy)
+	for _, object := range retained {
+		log.Info(fmt.Sprintf("%s retained, delete policy is %s",
+			colorizeUnstructured(object), instance.DeletePolicy))
+	}
+
 	if dryrun {
 		for _, object := range objects {
 			log.Info(colorizeJoin(object, ssa.DeletedAction, dryRunClient))
 		}
-		return nil
+		return nil, nil
 	}
 
 	hasErrors := false
@@ -188,7 +260,7 @@ func deleteBundleInstance(ctx context.Context, instance *engine.BundleInstance,
 			continue
 		}
 		cs.Add(*change)
-		log.Info(colorizeJoin(change))
+		log.Info(colorizePruneChange(*change))
 	}
 
 	if hasErrors {
@@ -196,7 +268,7 @@ func deleteBundleInstance(ctx context.Context, instance *engine.BundleInstance,
 	}
 
 	if err := iStorage.Delete(ctx, inst.Name, inst.Namespace); err != nil {
-		return err
+		return nil, err
 	}
 
 	deletedObjects := runtime.SelectObjectsFromSet(cs, ssa.DeletedAction)
@@ -207,10 +279,36 @@ func deleteBundleInstance(ctx context.Context, instance *engine.BundleInstance,
 		err = sm.WaitForTermination(deletedObjects, waitOpts)
 		spin.Stop()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		log.Info("all resources have been deleted")
 	}
 
-	return nil
+	return deletedObjects, nil
+}
+
+// selectObjectsByDeletePolicy splits the instance objects into the ones
+// that should be deleted and the ones retained by the delete policy.
+func selectObjectsByDeletePolicy(objects []*unstructured.Unstructured, policy string) (deleted, retained []*unstructured.Unstructured) {
+	for _, object := range objects {
+		switch {
+		case policy == apiv1.DeletePolicyOrphan:
+			retained = append(retained, object)
+		case policy == apiv1.DeletePolicyKeepNamespace &&
+			object.GetAPIVersion() == "v1" && object.GetKind() == "Namespace":
+			retained = append(retained, object)
+		default:
+			deleted = append(deleted, object)
+		}
+	}
+	return deleted, retained
+}
+
+// colorizePruneChange formats a deletion change, reporting the objects
+// skipped due to the prune exclusion annotations as retained.
+func colorizePruneChange(change ssa.ChangeSetEntry) string {
+	if change.Action == ssa.SkippedAction {
+		return fmt.Sprintf("%s retained, prune is disabled by annotation", colorizeSubject(change.Subject))
+	}
+	return colorizeChangeSetEntry(change)
 }
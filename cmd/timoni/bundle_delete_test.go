@@ -28,7 +28,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 )
 
 func Test_BundleDelete(t *testing.T) {
@@ -279,3 +282,271 @@ runtime: {
 		g.Expect(errors.IsNotFound(err)).To(BeTrue())
 	})
 }
+
+func Test_BundleDelete_Selector(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			labels: team: "web"
+			values: server: enabled: false
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			labels: team: "payments"
+			values: client: enabled: false
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace)
+
+	t.Run("deletes only the matching instances", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := executeCommandWithIn("bundle apply -f - -p main --wait", strings.NewReader(bundleData))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		output, err := executeCommand(fmt.Sprintf("bundle status %s -l team=payments", bundleName))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("backend-server"))
+		g.Expect(output).ToNot(ContainSubstring("frontend-client"))
+
+		_, err = executeCommand(fmt.Sprintf("bundle delete %s --selector team=payments --wait", bundleName))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = executeCommand(fmt.Sprintf("inspect values -n %s backend", namespace))
+		g.Expect(err).To(HaveOccurred())
+
+		_, err = executeCommand(fmt.Sprintf("inspect values -n %s frontend", namespace))
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+}
+
+func Test_BundleDelete_ReverseOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			dependsOn: ["backend"]
+			values: server: enabled: false
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			dependsOn: ["database"]
+			values: client: enabled: false
+		}
+		database: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: false
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace)
+
+	t.Run("deletes instances in reverse apply order", func(t *testing.T) {
+		g := NewWithT(t)
+
+		output, err := executeCommandWithIn("bundle apply -f - -p main --wait", strings.NewReader(bundleData))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(strings.Index(output, "installing database")).To(
+			BeNumerically("<", strings.Index(output, "installing backend")))
+		g.Expect(strings.Index(output, "installing backend")).To(
+			BeNumerically("<", strings.Index(output, "installing frontend")))
+
+		output, err = executeCommand(fmt.Sprintf("bundle delete %s --wait", bundleName))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		frontend := strings.Index(output, "deleting instance frontend")
+		backend := strings.Index(output, "deleting instance backend")
+		database := strings.Index(output, "deleting instance database")
+		g.Expect(frontend).To(BeNumerically(">=", 0))
+		g.Expect(frontend).To(BeNumerically("<", backend))
+		g.Expect(backend).To(BeNumerically("<", database))
+
+		for _, name := range []string{"frontend", "backend", "database"} {
+			_, err = executeCommand(fmt.Sprintf("inspect values -n %s %s", namespace, name))
+			g.Expect(err).To(HaveOccurred())
+		}
+	})
+}
+
+func Test_BundleInstancesFromStorage(t *testing.T) {
+	g := NewWithT(t)
+
+	stored := func(name, bundle, label string, dependsOn ...string) *apiv1.Instance {
+		return &apiv1.Instance{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "apps",
+				Labels:    map[string]string{apiv1.BundleNameLabelKey: label},
+			},
+			Bundle:    bundle,
+			DependsOn: dependsOn,
+		}
+	}
+
+	instances, err := bundleInstancesFromStorage("apps", "default", []*apiv1.Instance{
+		stored("frontend", "apps", "apps", "backend"),
+		stored("backend", "", "apps"),
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(instances).To(HaveLen(2))
+	g.Expect(instances[0].Name).To(Equal("backend"))
+	g.Expect(instances[1].Name).To(Equal("frontend"))
+	g.Expect(instances[1].DependsOn).To(Equal([]string{"backend"}))
+
+	_, err = bundleInstancesFromStorage("apps", "default", []*apiv1.Instance{
+		stored("frontend", "web", "apps"),
+	})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring(`instance apps/frontend is managed by bundle "web", not by bundle "apps"`))
+}
+
+func Test_SelectInstancesByLabels(t *testing.T) {
+	g := NewWithT(t)
+
+	newInstance := func(name string, labels map[string]string) *apiv1.Instance {
+		return &apiv1.Instance{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	instances := []*apiv1.Instance{
+		newInstance("frontend", map[string]string{"team": "web", "tier": "app"}),
+		newInstance("backend", map[string]string{"team": "payments", "tier": "app"}),
+		newInstance("db", map[string]string{"team": "payments", "tier": "db"}),
+		newInstance("cache", nil),
+	}
+
+	names := func(instances []*apiv1.Instance) []string {
+		var list []string
+		for _, instance := range instances {
+			list = append(list, instance.Name)
+		}
+		return list
+	}
+
+	for selector, expected := range map[string][]string{
+		"":                       {"frontend", "backend", "db", "cache"},
+		"team=payments":          {"backend", "db"},
+		"team=payments,tier=app": {"backend"},
+		"tier!=app":              {"db", "cache"},
+		"team=ops":               nil,
+	} {
+		sel, err := parseInstanceSelector(selector)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(names(selectInstancesByLabels(instances, sel))).To(Equal(expected), selector)
+	}
+
+	_, err := parseInstanceSelector("team in (web")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("invalid label selector"))
+}
+
+func Test_SelectObjectsByDeletePolicy(t *testing.T) {
+	g := NewWithT(t)
+
+	newObject := func(apiVersion, kind, name string) *unstructured.Unstructured {
+		object := &unstructured.Unstructured{}
+		object.SetAPIVersion(apiVersion)
+		object.SetKind(kind)
+		object.SetName(name)
+		return object
+	}
+	objects := []*unstructured.Unstructured{
+		newObject("v1", "Namespace", "apps"),
+		newObject("v1", "ConfigMap", "config"),
+		newObject("apps/v1", "Deployment", "app"),
+	}
+
+	names := func(objects []*unstructured.Unstructured) []string {
+		var list []string
+		for _, object := range objects {
+			list = append(list, object.GetName())
+		}
+		return list
+	}
+
+	for policy, expected := range map[string][2][]string{
+		apiv1.DeletePolicyDelete:        {{"apps", "config", "app"}, nil},
+		apiv1.DeletePolicyOrphan:        {nil, {"apps", "config", "app"}},
+		apiv1.DeletePolicyKeepNamespace: {{"config", "app"}, {"apps"}},
+	} {
+		deleted, retained := selectObjectsByDeletePolicy(objects, policy)
+		g.Expect(names(deleted)).To(Equal(expected[0]), policy)
+		g.Expect(names(retained)).To(Equal(expected[1]), policy)
+	}
+
+	stored := []*apiv1.Instance{
+		{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Labels: map[string]string{apiv1.BundleNameLabelKey: "apps"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "backend", Labels: map[string]string{apiv1.BundleNameLabelKey: "apps"}},
+			DeletePolicy: apiv1.DeletePolicyKeepNamespace},
+	}
+	instances, err := bundleInstancesFromStorage("apps", "default", stored)
+	g.Expect(err).ToNot(HaveOccurred())
+	policies := make(map[string]string, len(instances))
+	for _, instance := range instances {
+		policies[instance.Name] = instance.DeletePolicy
+	}
+	g.Expect(policies).To(Equal(map[string]string{
+		"frontend": apiv1.DeletePolicyDelete,
+		"backend":  apiv1.DeletePolicyKeepNamespace,
+	}))
+}
@@ -0,0 +1,371 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/spf13/cobra"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+)
+
+var bundleDiffCmd = &cobra.Command{
+	Use:   "diff [OLD BUNDLE] [NEW BUNDLE]",
+	Short: "Compare the instances of two bundle files",
+	Long: `The bundle diff command builds two bundle files and prints the instances that were added,
+removed or changed in the new bundle, including the module and values changes.
+The comparison is done locally, without connecting to the cluster.
+The changes of the sensitive values are redacted, unless --show-secrets is set.
+`,
+	Example: `  # Compare two versions of a bundle
+  timoni bundle diff bundle.old.cue bundle.cue
+
+  # Print the differences in JSON format
+  timoni bundle diff bundle.old.cue bundle.cue -o json
+`,
+	Args: cobra.ExactArgs(2),
+	RunE: runBundleDiffCmd,
+}
+
+type bundleDiffFlags struct {
+	output      string
+	showSecrets bool
+}
+
+var bundleDiffArgs bundleDiffFlags
+
+func init() {
+	bundleDiffCmd.Flags().StringVarP(&bundleDiffArgs.output, "output", "o", "",
+		"The format in which the differences should be printed, can be 'json'.")
+	bundleDiffCmd.Flags().BoolVar(&bundleDiffArgs.showSecrets, "show-secrets", false,
+		"Print the changes of the values marked as sensitive in the bundle, instead of redacting them.")
+	bundleCmd.AddCommand(bundleDiffCmd)
+}
+
+const (
+	instanceAdded   = "added"
+	instanceRemoved = "removed"
+	instanceChanged = "changed"
+)
+
+// bundleFieldChange holds the old and new value of an instance field.
+type bundleFieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// bundleInstanceDiff holds the differences of an instance between two bundles.
+type bundleInstanceDiff struct {
+	Status  string              `json:"status"`
+	Module  string              `json:"module"`
+	Changes []bundleFieldChange `json:"changes,omitempty"`
+}
+
+// bundleDiff holds the differences between two bundles, keyed by instance name.
+type bundleDiff struct {
+	Bundle    string                        `json:"bundle"`
+	Instances map[string]bundleInstanceDiff `json:"instances"`
+}
+
+func runBundleDiffCmd(cmd *cobra.Command, args []string) error {
+	ctx := cuecontext.New()
+
+	oldBundle, err := buildBundleForDiff(cmd.Context(), ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	newBundle, err := buildBundleForDiff(cmd.Context(), ctx, args[1])
+	if err != nil {
+		return err
+	}
+
+	diff, err := diffBundles(oldBundle, newBundle)
+	if err != nil {
+		return err
+	}
+
+	if bundleDiffArgs.output == "json" {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return fmt.Errorf("converting differences failed: %w", err)
+		}
+		_, err = cmd.OutOrStdout().Write(append(data, '\n'))
+		return err
+	}
+
+	if len(diff.Instances) == 0 {
+		LoggerBundle(cmd.Context(), diff.Bundle, apiv1.RuntimeDefaultName).Info("no changes found")
+		return nil
+	}
+
+	names := make([]string, 0, len(diff.Instances))
+	for name := range diff.Instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rows [][]string
+	for _, name := range names {
+		instance := diff.Instances[name]
+		if len(instance.Changes) == 0 {
+			rows = append(rows, []string{name, instance.Status, "module", "", instance.Module})
+			continue
+		}
+		for _, change := range instance.Changes {
+			rows = append(rows, []string{name, instance.Status, change.Field,
+				formatDiffValue(change.From), formatDiffValue(change.To)})
+		}
+	}
+	printTable(cmd.OutOrStdout(), []string{"instance", "status", "field", "from", "to"}, rows)
+
+	return nil
+}
+
+// buildBundleForDiff builds the bundle file in a temporary workspace, using the
+// runtime values from the environment and the env file, if set.
+func buildBundleForDiff(ctx context.Context, cuectx *cue.Context, file string) (*engine.Bundle, error) {
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	bm := engine.NewBundleBuilder(cuectx, []string{file})
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(bundleArgs.moduleRoot)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	runtimeValues := make(map[string]string)
+	if bundleArgs.runtimeFromEnv {
+		maps.Copy(runtimeValues, engine.GetEnv())
+	}
+
+	if err := bm.InitWorkspace(tmpDir, runtimeValues); err != nil {
+		return nil, describeErr(tmpDir, fmt.Sprintf("failed to parse bundle %s", file), err)
+	}
+
+	v, warnings, err := bm.Build()
+	if err != nil {
+		return nil, describeErr(tmpDir, fmt.Sprintf("failed to build bundle %s", file), err)
+	}
+
+	if err := reportBundleWarnings(LoggerFrom(ctx), warnings); err != nil {
+		return nil, err
+	}
+
+	return bm.GetBundle(v)
+}
+
+// diffBundles compares the instances of the old and new bundles by name.
+// The unchanged instances are not included in the result.
+func diffBundles(oldBundle, newBundle *engine.Bundle) (*bundleDiff, error) {
+	diff := &bundleDiff{
+		Bundle:    newBundle.Name,
+		Instances: make(map[string]bundleInstanceDiff),
+	}
+
+	oldInstances := make(map[string]*engine.BundleInstance, len(oldBundle.Instances))
+	for _, instance := range oldBundle.Instances {
+		oldInstances[instance.Name] = instance
+	}
+
+	for _, instance := range newBundle.Instances {
+		old, ok := oldInstances[instance.Name]
+		if !ok {
+			diff.Instances[instance.Name] = bundleInstanceDiff{
+				Status: instanceAdded,
+				Module: bundleInstanceModuleRef(instance),
+			}
+			continue
+		}
+		delete(oldInstances, instance.Name)
+
+		changes, err := diffBundleInstances(old, instance)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			diff.Instances[instance.Name] = bundleInstanceDiff{
+				Status:  instanceChanged,
+				Module:  bundleInstanceModuleRef(instance),
+				Changes: changes,
+			}
+		}
+	}
+
+	for name, instance := range oldInstances {
+		diff.Instances[name] = bundleInstanceDiff{
+			Status: instanceRemoved,
+			Module: bundleInstanceModuleRef(instance),
+		}
+	}
+
+	return diff, nil
+}
+
+// diffBundleInstances returns the changes of the module, namespace, dependencies
+// and values between the old and new versions of an instance.
+func diffBundleInstances(old, instance *engine.BundleInstance) ([]bundleFieldChange, error) {
+	var changes []bundleFieldChange
+	add := func(field string, from, to any) {
+		if !reflect.DeepEqual(from, to) {
+			changes = append(changes, bundleFieldChange{Field: field, From: from, To: to})
+		}
+	}
+
+	add(apiv1.BundleModuleURLSelector.String(), old.Module.Repository, instance.Module.Repository)
+	add(apiv1.BundleModuleVersionSelector.String(), old.Module.Version, instance.Module.Version)
+	add(apiv1.BundleModuleDigestSelector.String(), old.Module.Digest, instance.Module.Digest)
+	add(apiv1.BundleNamespaceSelector.String(), old.Namespace, instance.Namespace)
+	if !slices.Equal(old.DependsOn, instance.DependsOn) {
+		add(apiv1.BundleDependsOnSelector.String(), old.DependsOn, instance.DependsOn)
+	}
+
+	oldValues, err := flattenDiffValues(old.Values)
+	if err != nil {
+		return nil, fmt.Errorf("decoding values of instance %s failed: %w", old.Name, err)
+	}
+	newValues, err := flattenDiffValues(instance.Values)
+	if err != nil {
+		return nil, fmt.Errorf("decoding values of instance %s failed: %w", instance.Name, err)
+	}
+
+	paths := make([]string, 0, len(oldValues)+len(newValues))
+	for p := range oldValues {
+		paths = append(paths, p)
+	}
+	for p := range newValues {
+		if _, ok := oldValues[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	sensitive := append(slices.Clone(old.Sensitive), instance.Sensitive...)
+	for _, p := range paths {
+		field := apiv1.BundleValuesSelector.String() + "." + p
+		from, to := oldValues[p], newValues[p]
+		if !bundleDiffArgs.showSecrets && isSensitiveDiffPath(p, sensitive) {
+			// The change is reported even if the redacted values are equal.
+			if !reflect.DeepEqual(from, to) {
+				changes = append(changes, bundleFieldChange{Field: field, From: redactDiffValue(from), To: redactDiffValue(to)})
+			}
+			continue
+		}
+		add(field, from, to)
+	}
+
+	return changes, nil
+}
+
+// isSensitiveDiffPath returns true if the flattened values path is at, under or above
+// one of the sensitive paths, e.g. a list which contains a sensitive item.
+// The sensitive paths of both the old and new instance are taken into account.
+func isSensitiveDiffPath(p string, sensitive []string) bool {
+	for _, s := range sensitive {
+		var labels []string
+		for _, sel := range cue.ParsePath(s).Selectors() {
+			// The lists are not flattened, the index selectors match the whole list.
+			if sel.Type() != cue.StringLabel {
+				break
+			}
+			labels = append(labels, sel.Unquoted())
+		}
+		sp := strings.Join(labels, ".")
+		if sp == "" {
+			continue
+		}
+		if p == sp || strings.HasPrefix(p, sp+".") || strings.HasPrefix(sp, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// redactDiffValue returns RedactedValue for the set values.
+func redactDiffValue(v any) any {
+	if v == nil {
+		return nil
+	}
+	return engine.RedactedValue
+}
+
+// flattenDiffValues decodes the instance values and returns the leaf values keyed by their path.
+// The lists are compared as a whole, and are not flattened.
+func flattenDiffValues(v cue.Value) (map[string]any, error) {
+	values := make(map[string]any)
+	if !v.Exists() {
+		return values, nil
+	}
+
+	var data map[string]any
+	if err := v.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	var walk func(prefix string, m map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for k, val := range m {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			if nested, ok := val.(map[string]any); ok && len(nested) > 0 {
+				walk(p, nested)
+				continue
+			}
+			values[p] = val
+		}
+	}
+	walk("", data)
+
+	return values, nil
+}
+
+// formatDiffValue returns the JSON representation of the value,
+// or an empty string if the value isn't set.
+func formatDiffValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSpace(string(data))
+}
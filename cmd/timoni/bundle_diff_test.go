@@ -0,0 +1,192 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_BundleDiff(t *testing.T) {
+	oldBundle := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			module: version: "6.5.0"
+			namespace: "apps"
+			values: replicas: 1
+		}
+		backend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			module: version: "6.5.0"
+			namespace: "apps"
+			values: {}
+		}
+	}
+}
+`
+	newBundle := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			module: version: "6.6.0"
+			namespace: "apps"
+			values: replicas: 2
+		}
+		backend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			module: version: "6.5.0"
+			namespace: "apps"
+			values: {}
+		}
+		cache: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/redis"
+			module: version: "7.2.0"
+			namespace: "apps"
+			values: {}
+		}
+	}
+}
+`
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.cue")
+	newPath := filepath.Join(dir, "new.cue")
+	if err := os.WriteFile(oldPath, []byte(oldBundle), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte(newBundle), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("prints the changes as JSON", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle diff %s %s -o json", oldPath, newPath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var diff bundleDiff
+		g.Expect(json.Unmarshal([]byte(output), &diff)).To(Succeed())
+		g.Expect(diff.Bundle).To(Equal("my-bundle"))
+		g.Expect(diff.Instances).To(HaveLen(2))
+		g.Expect(diff.Instances).ToNot(HaveKey("backend"))
+
+		g.Expect(diff.Instances["cache"].Status).To(Equal(instanceAdded))
+		g.Expect(diff.Instances["cache"].Module).To(Equal("oci://ghcr.io/stefanprodan/modules/redis:7.2.0"))
+
+		frontend := diff.Instances["frontend"]
+		g.Expect(frontend.Status).To(Equal(instanceChanged))
+		g.Expect(frontend.Changes).To(Equal([]bundleFieldChange{
+			{Field: "module.version", From: "6.5.0", To: "6.6.0"},
+			{Field: "values.replicas", From: float64(1), To: float64(2)},
+		}))
+	})
+
+	t.Run("prints the changes as table", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle diff %s %s", oldPath, newPath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(MatchRegexp(`cache\s+added\s+module\s+oci://ghcr.io/stefanprodan/modules/redis:7.2.0`))
+		g.Expect(output).To(MatchRegexp(`frontend\s+changed\s+module.version\s+6.5.0\s+6.6.0`))
+		g.Expect(output).To(MatchRegexp(`frontend\s+changed\s+values.replicas\s+1\s+2`))
+	})
+
+	t.Run("reports removed instances", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle diff %s %s -o json", newPath, oldPath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var diff bundleDiff
+		g.Expect(json.Unmarshal([]byte(output), &diff)).To(Succeed())
+		g.Expect(diff.Instances["cache"].Status).To(Equal(instanceRemoved))
+	})
+
+	t.Run("prints nothing for identical bundles", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle diff %s %s -o json", oldPath, oldPath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var diff bundleDiff
+		g.Expect(json.Unmarshal([]byte(output), &diff)).To(Succeed())
+		g.Expect(diff.Instances).To(BeEmpty())
+	})
+}
+
+func Test_BundleDiff_Sensitive(t *testing.T) {
+	bundleData := func(password string, tokens string, sensitive string) string {
+		return fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			module: version: "6.5.0"
+			namespace: "apps"
+			values: {
+				auth: password: "%s"
+				tokens: [%s]
+				replicas: 1
+			}
+			%s
+		}
+	}
+}
+`, password, tokens, sensitive)
+	}
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.cue")
+	newPath := filepath.Join(dir, "new.cue")
+	// The old bundle didn't mark the values as sensitive.
+	if err := os.WriteFile(oldPath, []byte(bundleData("old-s3cr3t", `"abc123"`, "")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte(bundleData("new-s3cr3t", `"def456"`, `sensitive: ["auth.password", "tokens[0]"]`)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("redacts the sensitive changes", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle diff %s %s -o json", oldPath, newPath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).ToNot(ContainSubstring("s3cr3t"))
+
+		var diff bundleDiff
+		g.Expect(json.Unmarshal([]byte(output), &diff)).To(Succeed())
+		g.Expect(diff.Instances["frontend"].Changes).To(Equal([]bundleFieldChange{
+			{Field: "values.auth.password", From: "***", To: "***"},
+			{Field: "values.tokens", From: "***", To: "***"},
+		}))
+	})
+
+	t.Run("prints the sensitive changes", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle diff %s %s --show-secrets", oldPath, newPath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(MatchRegexp(`frontend\s+changed\s+values.auth.password\s+old-s3cr3t\s+new-s3cr3t`))
+	})
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/flags"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the instances from a bundle as custom resources",
+	Long: `The bundle export command prints a custom resource for each instance defined in a bundle,
+containing the resolved module reference and the instance values.
+The custom resources can be committed to a Git repository and reconciled by a
+Flux controller, instead of applying the bundle with Timoni.
+`,
+	Example: `  # Export the instances of a bundle as Flux custom resources
+  timoni bundle export -f bundle.cue --format flux
+
+  # Export the instances and set the reconciliation interval of the controller
+  timoni bundle export -f bundle.cue --format flux --interval 5m > instances.yaml
+`,
+	Args: cobra.NoArgs,
+	RunE: runBundleExportCmd,
+}
+
+type bundleExportFlags struct {
+	files    []string
+	format   string
+	interval time.Duration
+	creds    flags.Credentials
+}
+
+var bundleExportArgs bundleExportFlags
+
+const exportFormatFlux = "flux"
+
+func init() {
+	bundleExportCmd.Flags().StringSliceVarP(&bundleExportArgs.files, "file", "f", nil,
+		"The local path to bundle.cue files.")
+	bundleExportCmd.Flags().StringVar(&bundleExportArgs.format, "format", exportFormatFlux,
+		"The format of the exported custom resources, can be 'flux'.")
+	bundleExportCmd.Flags().DurationVar(&bundleExportArgs.interval, "interval", 10*time.Minute,
+		"The interval at which the controller reconciles the exported instances.")
+	bundleExportCmd.Flags().Var(&bundleExportArgs.creds, bundleExportArgs.creds.Type(), bundleExportArgs.creds.Description())
+	bundleCmd.AddCommand(bundleExportCmd)
+}
+
+func runBundleExportCmd(cmd *cobra.Command, _ []string) error {
+	if f := bundleExportArgs.format; f != exportFormatFlux {
+		return fmt.Errorf("unknown --format=%s, can be %s", f, exportFormatFlux)
+	}
+
+	files := bundleExportArgs.files
+	if len(files) == 0 {
+		return errors.New("no bundle provided with -f")
+	}
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
+	}
+	defer removeStdinFile()
+
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := cuecontext.New()
+	bm := engine.NewBundleBuilder(ctx, files)
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(bundleArgs.moduleRoot)
+	bm.SetOverlays(bundleArgs.overlays)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	runtimeValues := make(map[string]string)
+
+	if bundleArgs.runtimeFromEnv {
+		maps.Copy(runtimeValues, engine.GetEnv())
+	}
+
+	if len(bundleArgs.runtimeFiles) > 0 {
+		kctx, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+		defer cancel()
+
+		rt, err := buildRuntime(bundleArgs.runtimeFiles)
+		if err != nil {
+			return err
+		}
+
+		clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+		if len(clusters) > 1 {
+			return errors.New("you must select a cluster with --runtime-cluster")
+		}
+		if len(clusters) == 0 {
+			return errors.New("no cluster found")
+		}
+
+		cluster := clusters[0]
+		kubeconfigArgs.Context = &cluster.KubeContext
+
+		rm, err := runtime.NewResourceManager(kubeconfigArgs)
+		if err != nil {
+			return err
+		}
+
+		reader := runtime.NewResourceReader(rm)
+		rv, err := reader.Read(kctx, rt.Refs)
+		if err != nil {
+			return err
+		}
+
+		maps.Copy(runtimeValues, rv)
+		maps.Copy(runtimeValues, cluster.NameGroupValues())
+	}
+
+	if err := bm.InitWorkspace(tmpDir, runtimeValues); err != nil {
+		return describeErr(tmpDir, "failed to parse bundle", err)
+	}
+
+	v, warnings, err := bm.Build()
+	if err != nil {
+		return describeErr(tmpDir, "failed to build bundle", err)
+	}
+
+	if err := reportBundleWarnings(LoggerFrom(cmd.Context()), warnings); err != nil {
+		return err
+	}
+
+	bundle, err := bm.GetBundle(v)
+	if err != nil {
+		return err
+	}
+
+	overrideBundleNamespace(LoggerBundle(cmd.Context(), bundle.Name, apiv1.RuntimeDefaultName), bundle)
+
+	ctxPull, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	namespaces := make(map[string]string, len(bundle.Instances))
+	for _, instance := range bundle.Instances {
+		namespaces[instance.Name] = instance.Namespace
+	}
+
+	for _, instance := range bundle.Instances {
+		if strings.HasPrefix(instance.Module.Repository, apiv1.LocalModulePrefix) {
+			return fmt.Errorf("instance %s can't be exported, the module %s is not stored in a container registry",
+				instance.Name, instance.Module.Repository)
+		}
+	}
+
+	// The modules are fetched to resolve the version and digest of the 'latest' tag.
+	if err := fetchBundleInstanceModules(ctxPull, bundle.Instances, tmpDir); err != nil {
+		return err
+	}
+
+	var objects []*unstructured.Unstructured
+	for _, instance := range bundle.Instances {
+		object, err := newFluxInstance(instance, namespaces, bundleExportArgs.interval)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, object)
+	}
+
+	data, err := marshalObjectsYAML(objects)
+	if err != nil {
+		return err
+	}
+	_, err = cmd.OutOrStdout().Write(data)
+	return err
+}
+
+// newFluxInstance returns the custom resource reconciled by Flux for the bundle instance,
+// with the spec modeled after the HelmRelease API. The namespaces map the names of
+// the bundle instances to their namespace, and are used to reference the dependencies.
+func newFluxInstance(instance *engine.BundleInstance, namespaces map[string]string, interval time.Duration) (*unstructured.Unstructured, error) {
+	data, err := instance.Values.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("converting values of instance %s failed: %w", instance.Name, err)
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("converting values of instance %s failed: %w", instance.Name, err)
+	}
+
+	module := map[string]any{
+		"url":     instance.Module.Repository,
+		"version": instance.Module.Version,
+	}
+	if instance.Module.Digest != "" {
+		module["digest"] = instance.Module.Digest
+	}
+
+	spec := map[string]any{
+		"interval": interval.String(),
+		"module":   module,
+	}
+	if len(values) > 0 {
+		spec["values"] = values
+	}
+	if len(instance.DependsOn) > 0 {
+		var dependsOn []any
+		for _, dep := range instance.DependsOn {
+			dependsOn = append(dependsOn, map[string]any{
+				"name":      dep,
+				"namespace": namespaces[dep],
+			})
+		}
+		spec["dependsOn"] = dependsOn
+	}
+
+	object := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+	object.SetAPIVersion(apiv1.GroupVersion.String())
+	object.SetKind(apiv1.InstanceKind)
+	object.SetName(instance.Name)
+	object.SetNamespace(instance.Namespace)
+
+	labels := make(map[string]string)
+	maps.Copy(labels, instance.Labels)
+	labels[apiv1.BundleNameLabelKey] = instance.Bundle
+	object.SetLabels(labels)
+
+	return object, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+func Test_BundleExport(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := "my-bundle"
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			dependsOn: ["backend"]
+			values: server: enabled: false
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: enabled: false
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace)
+
+	wd := t.TempDir()
+	bundlePath := filepath.Join(wd, "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).ToNot(HaveOccurred())
+
+	output, err := executeCommand(fmt.Sprintf("bundle export -f %s --format flux --interval 5m", bundlePath))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	objects, err := ssa.ReadObjects(strings.NewReader(output))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(objects).To(HaveLen(2))
+
+	for _, object := range objects {
+		g.Expect(object.GetAPIVersion()).To(Equal(apiv1.GroupVersion.String()))
+		g.Expect(object.GetKind()).To(Equal(apiv1.InstanceKind))
+		g.Expect(object.GetNamespace()).To(Equal(namespace))
+		g.Expect(object.GetLabels()).To(HaveKeyWithValue(apiv1.BundleNameLabelKey, bundleName))
+
+		url, _, _ := unstructured.NestedString(object.Object, "spec", "module", "url")
+		g.Expect(url).To(Equal("oci://" + modURL))
+		version, _, _ := unstructured.NestedString(object.Object, "spec", "module", "version")
+		g.Expect(version).To(Equal(modVer))
+		digest, _, _ := unstructured.NestedString(object.Object, "spec", "module", "digest")
+		g.Expect(digest).To(HavePrefix("sha256:"))
+		interval, _, _ := unstructured.NestedString(object.Object, "spec", "interval")
+		g.Expect(interval).To(Equal("5m0s"))
+	}
+
+	var frontend *unstructured.Unstructured
+	for _, object := range objects {
+		if object.GetName() == "frontend" {
+			frontend = object
+		}
+	}
+	g.Expect(frontend).ToNot(BeNil())
+	enabled, _, _ := unstructured.NestedBool(frontend.Object, "spec", "values", "server", "enabled")
+	g.Expect(enabled).To(BeFalse())
+	deps, _, _ := unstructured.NestedSlice(frontend.Object, "spec", "dependsOn")
+	g.Expect(deps).To(ConsistOf(map[string]any{"name": "backend", "namespace": namespace}))
+}
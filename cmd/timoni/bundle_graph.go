@@ -0,0 +1,245 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/spf13/cobra"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+var bundleGraphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Render the dependency graph of the instances from a bundle in DOT format",
+	Long: `The bundle graph command renders the instances defined in a bundle as a Graphviz DOT graph,
+with the instances as nodes annotated with their module reference, and the dependsOn relations as edges.
+The edges that are part of a circular dependency are highlighted in red, and the undefined
+dependencies are rendered as dashed nodes.
+`,
+	Example: `  # Print the dependency graph of a bundle
+  timoni bundle graph -f bundle.cue
+
+  # Write the dependency graph to a file and render it as SVG
+  timoni bundle graph -f bundle.cue -o bundle.dot
+  dot -Tsvg bundle.dot > bundle.svg
+`,
+	Args: cobra.NoArgs,
+	RunE: runBundleGraphCmd,
+}
+
+type bundleGraphFlags struct {
+	files  []string
+	output string
+}
+
+var bundleGraphArgs bundleGraphFlags
+
+func init() {
+	bundleGraphCmd.Flags().StringSliceVarP(&bundleGraphArgs.files, "file", "f", nil,
+		"The local path to bundle.cue files.")
+	bundleGraphCmd.Flags().StringVarP(&bundleGraphArgs.output, "output", "o", "",
+		"The local path to the file where the DOT graph should be written, defaults to stdout.")
+	bundleCmd.AddCommand(bundleGraphCmd)
+}
+
+func runBundleGraphCmd(cmd *cobra.Command, _ []string) error {
+	files := bundleGraphArgs.files
+	if len(files) == 0 {
+		return errors.New("no bundle provided with -f")
+	}
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
+	}
+	defer removeStdinFile()
+
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := cuecontext.New()
+	bm := engine.NewBundleBuilder(ctx, files)
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(bundleArgs.moduleRoot)
+	bm.SetOverlays(bundleArgs.overlays)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	runtimeValues := make(map[string]string)
+
+	if bundleArgs.runtimeFromEnv {
+		maps.Copy(runtimeValues, engine.GetEnv())
+	}
+
+	if len(bundleArgs.runtimeFiles) > 0 {
+		kctx, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+		defer cancel()
+
+		rt, err := buildRuntime(bundleArgs.runtimeFiles)
+		if err != nil {
+			return err
+		}
+
+		clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+		if len(clusters) > 1 {
+			return errors.New("you must select a cluster with --runtime-cluster")
+		}
+		if len(clusters) == 0 {
+			return errors.New("no cluster found")
+		}
+
+		cluster := clusters[0]
+		kubeconfigArgs.Context = &cluster.KubeContext
+
+		rm, err := runtime.NewResourceManager(kubeconfigArgs)
+		if err != nil {
+			return err
+		}
+
+		reader := runtime.NewResourceReader(rm)
+		rv, err := reader.Read(kctx, rt.Refs)
+		if err != nil {
+			return err
+		}
+
+		maps.Copy(runtimeValues, rv)
+		maps.Copy(runtimeValues, cluster.NameGroupValues())
+	}
+
+	if err := bm.InitWorkspace(tmpDir, runtimeValues); err != nil {
+		return describeErr(tmpDir, "failed to parse bundle", err)
+	}
+
+	v, warnings, err := bm.Build()
+	if err != nil {
+		return describeErr(tmpDir, "failed to build bundle", err)
+	}
+
+	if err := reportBundleWarnings(LoggerFrom(cmd.Context()), warnings); err != nil {
+		return err
+	}
+
+	// The bundle is looked up without ordering the instances,
+	// as the graph is rendered even if it contains cycles.
+	bundle, err := bm.LookupBundle(v)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writeBundleGraph(&buf, bundle)
+
+	if bundleGraphArgs.output != "" {
+		if err := os.WriteFile(bundleGraphArgs.output, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("writing graph failed: %w", err)
+		}
+		return nil
+	}
+
+	_, err = cmd.OutOrStdout().Write(buf.Bytes())
+	return err
+}
+
+// writeBundleGraph writes the DOT graph of the bundle instances and their dependencies.
+// The edges are directed from an instance to the instances it depends on.
+func writeBundleGraph(w io.Writer, bundle *engine.Bundle) {
+	index := make(map[string]*engine.BundleInstance, len(bundle.Instances))
+	for _, instance := range bundle.Instances {
+		index[instance.Name] = instance
+	}
+
+	fmt.Fprintf(w, "digraph %s {\n", strconv.Quote(bundle.Name))
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+
+	for _, instance := range bundle.Instances {
+		label := fmt.Sprintf("%s\n%s", instance.Name, bundleInstanceModuleRef(instance))
+		fmt.Fprintf(w, "  %s [label=%s];\n", strconv.Quote(instance.Name), strconv.Quote(label))
+	}
+
+	undefined := make(map[string]bool)
+	for _, instance := range bundle.Instances {
+		for _, dep := range instance.DependsOn {
+			if _, ok := index[dep]; !ok && !undefined[dep] {
+				undefined[dep] = true
+				fmt.Fprintf(w, "  %s [style=dashed, color=red];\n", strconv.Quote(dep))
+			}
+		}
+	}
+
+	for _, instance := range bundle.Instances {
+		for _, dep := range instance.DependsOn {
+			attrs := ""
+			if dependsOnPath(index, dep, instance.Name, make(map[string]bool)) {
+				attrs = " [color=red, penwidth=2]"
+			}
+			fmt.Fprintf(w, "  %s -> %s%s;\n", strconv.Quote(instance.Name), strconv.Quote(dep), attrs)
+		}
+	}
+
+	fmt.Fprintln(w, "}")
+}
+
+// dependsOnPath reports whether the target instance can be reached
+// from the given instance by following the dependsOn edges.
+func dependsOnPath(index map[string]*engine.BundleInstance, from, target string, seen map[string]bool) bool {
+	if from == target {
+		return true
+	}
+	if seen[from] {
+		return false
+	}
+	seen[from] = true
+
+	instance, ok := index[from]
+	if !ok {
+		return false
+	}
+	for _, dep := range instance.DependsOn {
+		if dependsOnPath(index, dep, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleInstanceModuleRef returns the module reference of the instance
+// in the format '<repository>:<version>[@<digest>]'.
+func bundleInstanceModuleRef(instance *engine.BundleInstance) string {
+	ref := fmt.Sprintf("%s:%s", instance.Module.Repository, instance.Module.Version)
+	if instance.Module.Digest != "" {
+		ref = fmt.Sprintf("%s@%s", ref, instance.Module.Digest)
+	}
+	return ref
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// dotEdges parses the edges of a DOT graph into a map of 'from -> to' to the edge attributes.
+func dotEdges(dot string) map[string]string {
+	re := regexp.MustCompile(`(?m)^\s*"([^"]+)" -> "([^"]+)"(?: \[(.*)\])?;$`)
+	edges := make(map[string]string)
+	for _, m := range re.FindAllStringSubmatch(dot, -1) {
+		edges[fmt.Sprintf("%s -> %s", m[1], m[2])] = m[3]
+	}
+	return edges
+}
+
+func Test_BundleGraph(t *testing.T) {
+	bundleTmpl := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			module: version: "6.5.0"
+			namespace: "apps"
+			dependsOn: ["backend"]
+			values: {}
+		}
+		backend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			module: version: "6.5.0"
+			namespace: "apps"
+			dependsOn: [%s]
+			values: {}
+		}
+		database: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/redis"
+			namespace: "apps"
+			dependsOn: [%s]
+			values: {}
+		}
+	}
+}
+`
+	writeBundle := func(g *WithT, backendDeps, databaseDeps string) string {
+		bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(bundlePath, []byte(fmt.Sprintf(bundleTmpl, backendDeps, databaseDeps)), 0644)).To(Succeed())
+		return bundlePath
+	}
+
+	t.Run("renders instances and dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		bundlePath := writeBundle(g, `"database"`, "")
+
+		output, err := executeCommand(fmt.Sprintf("bundle graph -f %s", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(HavePrefix(`digraph "my-bundle" {`))
+		g.Expect(output).To(ContainSubstring(`"frontend" [label="frontend\noci://ghcr.io/stefanprodan/modules/podinfo:6.5.0"];`))
+		g.Expect(output).To(ContainSubstring(`"database" [label="database\noci://ghcr.io/stefanprodan/modules/redis:latest"];`))
+
+		g.Expect(dotEdges(output)).To(Equal(map[string]string{
+			"frontend -> backend": "",
+			"backend -> database": "",
+		}))
+	})
+
+	t.Run("highlights circular dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		bundlePath := writeBundle(g, `"database"`, `"backend", "cache"`)
+
+		output, err := executeCommand(fmt.Sprintf("bundle graph -f %s", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring(`"cache" [style=dashed, color=red];`))
+
+		g.Expect(dotEdges(output)).To(Equal(map[string]string{
+			"frontend -> backend": "",
+			"backend -> database": "color=red, penwidth=2",
+			"database -> backend": "color=red, penwidth=2",
+			"database -> cache":   "",
+		}))
+	})
+
+	t.Run("writes graph to file", func(t *testing.T) {
+		g := NewWithT(t)
+		bundlePath := writeBundle(g, "", "")
+		dotPath := filepath.Join(t.TempDir(), "bundle.dot")
+
+		_, err := executeCommand(fmt.Sprintf("bundle graph -f %s -o %s", bundlePath, dotPath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		data, err := os.ReadFile(dotPath)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(dotEdges(string(data))).To(HaveKey("frontend -> backend"))
+	})
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/flags"
+	"github.com/stefanprodan/timoni/internal/oci"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+var bundleImagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "List the container images of all instances from a bundle",
+	Long: `The bundle images command lists the container images referenced by the instances defined in a bundle.
+With --resolve, the digest of each image is fetched from the remote registry
+and the image to digest mapping is written to a lock file.
+`,
+	Example: `  # List the container images of a bundle
+  timoni bundle images -f bundle.cue
+
+  # Resolve the image digests and write them to images.lock
+  timoni bundle images -f bundle.cue --resolve
+
+  # Resolve the image digests and print them in JSON format
+  timoni bundle images -f bundle.cue --resolve --lock-file bundle-images.lock -o json
+`,
+	Args: cobra.NoArgs,
+	RunE: runBundleImagesCmd,
+}
+
+type bundleImagesFlags struct {
+	pkg      flags.Package
+	files    []string
+	resolve  bool
+	lockFile string
+	output   string
+	creds    flags.Credentials
+}
+
+var bundleImagesArgs bundleImagesFlags
+
+func init() {
+	bundleImagesCmd.Flags().VarP(&bundleImagesArgs.pkg, bundleImagesArgs.pkg.Type(), bundleImagesArgs.pkg.Shorthand(), bundleImagesArgs.pkg.Description())
+	bundleImagesCmd.Flags().StringSliceVarP(&bundleImagesArgs.files, "file", "f", nil,
+		"The local path to bundle.cue files.")
+	bundleImagesCmd.Flags().BoolVar(&bundleImagesArgs.resolve, "resolve", false,
+		"Resolve the image digests from the remote registries and write them to the lock file.")
+	bundleImagesCmd.Flags().StringVar(&bundleImagesArgs.lockFile, "lock-file", "images.lock",
+		"The local path to the lock file written when --resolve is set.")
+	bundleImagesCmd.Flags().StringVarP(&bundleImagesArgs.output, "output", "o", "",
+		"The format in which the images should be printed, can be 'json'.")
+	bundleImagesCmd.Flags().Var(&bundleImagesArgs.creds, bundleImagesArgs.creds.Type(), bundleImagesArgs.creds.Description())
+	bundleCmd.AddCommand(bundleImagesCmd)
+}
+
+// bundleImage is a container image referenced by a bundle instance,
+// with the digest set when resolved from the remote registry.
+type bundleImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest,omitempty"`
+}
+
+func runBundleImagesCmd(cmd *cobra.Command, _ []string) error {
+	if o := bundleImagesArgs.output; o != "" && o != "json" {
+		return fmt.Errorf("unknown --output=%s, can be json", o)
+	}
+
+	files := bundleImagesArgs.files
+	if len(files) == 0 {
+		return errors.New("no bundle provided with -f")
+	}
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
+	}
+	defer removeStdinFile()
+
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := cuecontext.New()
+	bm := engine.NewBundleBuilder(ctx, files)
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(bundleArgs.moduleRoot)
+	bm.SetOverlays(bundleArgs.overlays)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	runtimeValues := make(map[string]string)
+
+	if bundleArgs.runtimeFromEnv {
+		maps.Copy(runtimeValues, engine.GetEnv())
+	}
+
+	if len(bundleArgs.runtimeFiles) > 0 {
+		kctx, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+		defer cancel()
+
+		rt, err := buildRuntime(bundleArgs.runtimeFiles)
+		if err != nil {
+			return err
+		}
+
+		clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+		if len(clusters) > 1 {
+			return errors.New("you must select a cluster with --runtime-cluster")
+		}
+		if len(clusters) == 0 {
+			return errors.New("no cluster found")
+		}
+
+		cluster := clusters[0]
+		kubeconfigArgs.Context = &cluster.KubeContext
+
+		rm, err := runtime.NewResourceManager(kubeconfigArgs)
+		if err != nil {
+			return err
+		}
+
+		reader := runtime.NewResourceReader(rm)
+		rv, err := reader.Read(kctx, rt.Refs)
+		if err != nil {
+			return err
+		}
+
+		maps.Copy(runtimeValues, rv)
+		maps.Copy(runtimeValues, cluster.NameGroupValues())
+	}
+
+	if err := bm.InitWorkspace(tmpDir, runtimeValues); err != nil {
+		return describeErr(tmpDir, "failed to parse bundle", err)
+	}
+
+	v, warnings, err := bm.Build()
+	if err != nil {
+		return describeErr(tmpDir, "failed to build bundle", err)
+	}
+
+	if err := reportBundleWarnings(LoggerFrom(cmd.Context()), warnings); err != nil {
+		return err
+	}
+
+	bundle, err := bm.GetBundle(v)
+	if err != nil {
+		return err
+	}
+
+	overrideBundleNamespace(LoggerBundle(cmd.Context(), bundle.Name, apiv1.RuntimeDefaultName), bundle)
+
+	ctxPull, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	if err := fetchBundleInstanceModules(ctxPull, bundle.Instances, tmpDir); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	var images []bundleImage
+	for _, instance := range bundle.Instances {
+		refs, err := bundleInstanceImages(ctx, instance, tmpDir, bundleImagesArgs.pkg.String())
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range refs {
+			if !seen[ref] {
+				seen[ref] = true
+				images = append(images, bundleImage{Image: ref})
+			}
+		}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Image < images[j].Image
+	})
+
+	if bundleImagesArgs.resolve {
+		opts := oci.Options(ctxPull, bundleImagesArgs.creds.String(), rootArgs.registryInsecure)
+		for i := range images {
+			digest, err := oci.ResolveImageDigest(images[i].Image, opts)
+			if err != nil {
+				return err
+			}
+			images[i].Digest = digest
+		}
+
+		data, err := newImagesLock(images)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(bundleImagesArgs.lockFile, data, 0644); err != nil {
+			return fmt.Errorf("writing lock file failed: %w", err)
+		}
+
+		log := LoggerBundle(cmd.Context(), bundle.Name, apiv1.RuntimeDefaultName)
+		log.Info(fmt.Sprintf("images lock written to %s", bundleImagesArgs.lockFile))
+	}
+
+	if bundleImagesArgs.output == "json" {
+		data, err := json.MarshalIndent(images, "", "  ")
+		if err != nil {
+			return fmt.Errorf("converting images failed: %w", err)
+		}
+		_, err = cmd.OutOrStdout().Write(append(data, '\n'))
+		return err
+	}
+
+	var rows [][]string
+	for _, image := range images {
+		if bundleImagesArgs.resolve {
+			rows = append(rows, []string{image.Image, image.Digest})
+		} else {
+			rows = append(rows, []string{image.Image})
+		}
+	}
+	if bundleImagesArgs.resolve {
+		printTable(cmd.OutOrStdout(), []string{"image", "digest"}, rows)
+	} else {
+		printTable(cmd.OutOrStdout(), []string{"image"}, rows)
+	}
+
+	return nil
+}
+
+// newImagesLock returns the YAML lock file content mapping each image
+// reference, without its digest, to the resolved digest. The keys are
+// sorted so that changes to the lock file are easy to review.
+func newImagesLock(images []bundleImage) ([]byte, error) {
+	lock := make(map[string]string, len(images))
+	for _, image := range images {
+		lock[strings.Split(image.Image, "@")[0]] = image.Digest
+	}
+
+	data, err := yaml.Marshal(lock)
+	if err != nil {
+		return nil, fmt.Errorf("converting images lock failed: %w", err)
+	}
+
+	return append([]byte("# Code generated by timoni. DO NOT EDIT.\n"), data...), nil
+}
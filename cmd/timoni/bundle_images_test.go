@@ -0,0 +1,129 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_BundleImages(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := "my-bundle"
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+	imgRef := "cgr.dev/chainguard/timoni:latest-dev@sha256:b49fbaac0eedc22c1cfcd26684707179cccbed0df205171bae3e1bae61326a10"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// use the module artifact as the backend image to resolve its digest from the test registry
+	backendDigest, err := crane.Digest(fmt.Sprintf("%s:%s", modURL, modVer))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: {}
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: client: image: {
+				repository: "%[2]s"
+				tag:        "%[3]s"
+				digest:     ""
+			}
+		}
+		worker: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: {}
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace)
+
+	wd := t.TempDir()
+	bundlePath := filepath.Join(wd, "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).ToNot(HaveOccurred())
+
+	t.Run("lists images", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle images -f %s -p main", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring(imgRef))
+		g.Expect(output).To(ContainSubstring(fmt.Sprintf("%s:%s", modURL, modVer)))
+	})
+
+	t.Run("writes lock file with resolved digests", func(t *testing.T) {
+		g := NewWithT(t)
+		lockPath := filepath.Join(wd, "images.lock")
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle images -f %s -p main --resolve --lock-file %s -o json",
+			bundlePath, lockPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var images []bundleImage
+		g.Expect(json.Unmarshal([]byte(jsonFromOutput(output)), &images)).To(Succeed())
+		g.Expect(images).To(ConsistOf(
+			bundleImage{Image: imgRef, Digest: "sha256:b49fbaac0eedc22c1cfcd26684707179cccbed0df205171bae3e1bae61326a10"},
+			bundleImage{Image: fmt.Sprintf("%s:%s", modURL, modVer), Digest: backendDigest},
+		))
+
+		data, err := os.ReadFile(lockPath)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		lock := make(map[string]string)
+		g.Expect(yaml.Unmarshal(data, &lock)).To(Succeed())
+		g.Expect(lock).To(HaveLen(2))
+		g.Expect(lock).To(HaveKeyWithValue("cgr.dev/chainguard/timoni:latest-dev",
+			"sha256:b49fbaac0eedc22c1cfcd26684707179cccbed0df205171bae3e1bae61326a10"))
+		g.Expect(lock).To(HaveKeyWithValue(fmt.Sprintf("%s:%s", modURL, modVer), backendDigest))
+	})
+}
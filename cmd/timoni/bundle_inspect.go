@@ -0,0 +1,237 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/spf13/cobra"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/flags"
+	"github.com/stefanprodan/timoni/internal/oci"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+var bundleInspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Print the resolved module references of all instances from a bundle",
+	Long: `The bundle inspect command prints the module reference of each instance defined in a bundle,
+including the digest resolved from the remote registry for the module version.
+The command doesn't pull the modules and doesn't make any changes to the cluster.
+`,
+	Example: `  # Print the module references of a bundle
+  timoni bundle inspect -f bundle.cue
+
+  # Print the module references in JSON format
+  timoni bundle inspect -f bundle.cue -o json
+`,
+	Args: cobra.NoArgs,
+	RunE: runBundleInspectCmd,
+}
+
+type bundleInspectFlags struct {
+	files  []string
+	output string
+	creds  flags.Credentials
+}
+
+var bundleInspectArgs bundleInspectFlags
+
+func init() {
+	bundleInspectCmd.Flags().StringSliceVarP(&bundleInspectArgs.files, "file", "f", nil,
+		"The local path to bundle.cue files.")
+	bundleInspectCmd.Flags().StringVarP(&bundleInspectArgs.output, "output", "o", "",
+		"The format in which the module references should be printed, can be 'json'.")
+	bundleInspectCmd.Flags().Var(&bundleInspectArgs.creds, bundleInspectArgs.creds.Type(), bundleInspectArgs.creds.Description())
+	bundleCmd.AddCommand(bundleInspectCmd)
+}
+
+// bundleInstanceModule is the resolved module reference of a bundle instance.
+type bundleInstanceModule struct {
+	Instance   string `json:"instance"`
+	Namespace  string `json:"namespace"`
+	Repository string `json:"repository"`
+	Version    string `json:"version"`
+	Digest     string `json:"digest"`
+}
+
+func runBundleInspectCmd(cmd *cobra.Command, _ []string) error {
+	if o := bundleInspectArgs.output; o != "" && o != "json" {
+		return fmt.Errorf("unknown --output=%s, can be json", o)
+	}
+
+	files := bundleInspectArgs.files
+	if len(files) == 0 {
+		return errors.New("no bundle provided with -f")
+	}
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
+	}
+	defer removeStdinFile()
+
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := cuecontext.New()
+	bm := engine.NewBundleBuilder(ctx, files)
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(bundleArgs.moduleRoot)
+	bm.SetOverlays(bundleArgs.overlays)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	runtimeValues := make(map[string]string)
+
+	if bundleArgs.runtimeFromEnv {
+		maps.Copy(runtimeValues, engine.GetEnv())
+	}
+
+	if len(bundleArgs.runtimeFiles) > 0 {
+		kctx, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+		defer cancel()
+
+		rt, err := buildRuntime(bundleArgs.runtimeFiles)
+		if err != nil {
+			return err
+		}
+
+		clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+		if len(clusters) > 1 {
+			return errors.New("you must select a cluster with --runtime-cluster")
+		}
+		if len(clusters) == 0 {
+			return errors.New("no cluster found")
+		}
+
+		cluster := clusters[0]
+		kubeconfigArgs.Context = &cluster.KubeContext
+
+		rm, err := runtime.NewResourceManager(kubeconfigArgs)
+		if err != nil {
+			return err
+		}
+
+		reader := runtime.NewResourceReader(rm)
+		rv, err := reader.Read(kctx, rt.Refs)
+		if err != nil {
+			return err
+		}
+
+		maps.Copy(runtimeValues, rv)
+		maps.Copy(runtimeValues, cluster.NameGroupValues())
+	}
+
+	if err := bm.InitWorkspace(tmpDir, runtimeValues); err != nil {
+		return describeErr(tmpDir, "failed to parse bundle", err)
+	}
+
+	v, warnings, err := bm.Build()
+	if err != nil {
+		return describeErr(tmpDir, "failed to build bundle", err)
+	}
+
+	if err := reportBundleWarnings(LoggerFrom(cmd.Context()), warnings); err != nil {
+		return err
+	}
+
+	bundle, err := bm.GetBundle(v)
+	if err != nil {
+		return err
+	}
+
+	overrideBundleNamespace(LoggerBundle(cmd.Context(), bundle.Name, apiv1.RuntimeDefaultName), bundle)
+
+	ctxPull, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+	defer cancel()
+
+	opts := oci.Options(ctxPull, bundleInspectArgs.creds.String(), rootArgs.registryInsecure)
+	modules := make([]bundleInstanceModule, 0, len(bundle.Instances))
+	for _, instance := range bundle.Instances {
+		digest, err := resolveBundleInstanceDigest(instance, opts)
+		if err != nil {
+			return err
+		}
+		modules = append(modules, bundleInstanceModule{
+			Instance:   instance.Name,
+			Namespace:  instance.Namespace,
+			Repository: instance.Module.Repository,
+			Version:    instance.Module.Version,
+			Digest:     digest,
+		})
+	}
+
+	if bundleInspectArgs.output == "json" {
+		data, err := json.MarshalIndent(modules, "", "  ")
+		if err != nil {
+			return fmt.Errorf("converting module references failed: %w", err)
+		}
+		_, err = cmd.OutOrStdout().Write(append(data, '\n'))
+		return err
+	}
+
+	var rows [][]string
+	for _, m := range modules {
+		rows = append(rows, []string{m.Instance, m.Namespace, m.Repository, m.Version, m.Digest})
+	}
+	printTable(cmd.OutOrStdout(), []string{"instance", "namespace", "repository", "version", "digest"}, rows)
+
+	return nil
+}
+
+// resolveBundleInstanceDigest returns the digest of the instance module
+// resolved from the remote registry, using the same version selection as the module fetcher.
+func resolveBundleInstanceDigest(instance *engine.BundleInstance, opts []crane.Option) (string, error) {
+	module := instance.Module
+	if strings.HasPrefix(module.Repository, apiv1.LocalModulePrefix) {
+		return "unknown", nil
+	}
+
+	repository := oci.RewriteURL(module.Repository, rootArgs.registryMirrors)
+	ociURL := fmt.Sprintf("%s:%s", repository, module.Version)
+	if module.Version == apiv1.LatestVersion && module.Digest != "" {
+		ociURL = fmt.Sprintf("%s@%s", repository, module.Digest)
+	}
+
+	digest, err := oci.ResolveArtifactDigest(ociURL, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if module.Digest != "" && digest != module.Digest {
+		return "", fmt.Errorf("the upstream digest %s of version %s doesn't match the specified digest %s",
+			digest, module.Version, module.Digest)
+	}
+
+	return digest, nil
+}
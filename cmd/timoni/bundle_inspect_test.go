@@ -0,0 +1,111 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	. "github.com/onsi/gomega"
+)
+
+func Test_BundleInspect(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := "my-bundle"
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	modDigest, err := crane.Digest(fmt.Sprintf("%s:%s", modURL, modVer))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: {}
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				digest:  "%[5]s"
+			}
+			namespace: "%[4]s"
+			values: {}
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace, modDigest)
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).ToNot(HaveOccurred())
+
+	t.Run("prints resolved modules", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle inspect -f %s", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("oci://" + modURL))
+		g.Expect(output).To(ContainSubstring(modDigest))
+	})
+
+	t.Run("prints resolved modules as JSON", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle inspect -f %s -o json", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var modules []bundleInstanceModule
+		g.Expect(json.Unmarshal([]byte(jsonFromOutput(output)), &modules)).To(Succeed())
+		g.Expect(modules).To(ConsistOf(
+			bundleInstanceModule{
+				Instance:   "backend",
+				Namespace:  namespace,
+				Repository: "oci://" + modURL,
+				Version:    "latest",
+				Digest:     modDigest,
+			},
+			bundleInstanceModule{
+				Instance:   "frontend",
+				Namespace:  namespace,
+				Repository: "oci://" + modURL,
+				Version:    modVer,
+				Digest:     modDigest,
+			},
+		))
+	})
+}
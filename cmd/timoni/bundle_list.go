@@ -0,0 +1,154 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+var bundleListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "Prints a table of the bundles applied on the cluster",
+	Long: `The list command scans the instances storage from all namespaces and prints
+the bundles applied by Timoni, with their number of instances,
+the time of the last applied change and the latest stored revision.`,
+	Example: `  # List all bundles on a cluster
+  timoni bundle ls
+
+  # List all bundles in JSON format
+  timoni bundle list -o json
+`,
+	Args: cobra.NoArgs,
+	RunE: runBundleListCmd,
+}
+
+type bundleListFlags struct {
+	output string
+}
+
+var bundleListArgs bundleListFlags
+
+func init() {
+	bundleListCmd.Flags().StringVarP(&bundleListArgs.output, "output", "o", "",
+		"The format in which the bundles should be printed, can be 'json'.")
+	bundleCmd.AddCommand(bundleListCmd)
+}
+
+// bundleListItem holds the summary of a bundle applied on a cluster.
+type bundleListItem struct {
+	runtime.BundleInfo
+
+	// Revision is the latest stored revision, zero if the history is disabled.
+	Revision int `json:"revision"`
+
+	// Cluster is the name of the cluster, empty for the default cluster.
+	Cluster string `json:"cluster,omitempty"`
+}
+
+func runBundleListCmd(cmd *cobra.Command, args []string) error {
+	if o := bundleListArgs.output; o != "" && o != "json" {
+		return fmt.Errorf("unknown --output=%s, can be json", o)
+	}
+
+	rt, err := buildRuntime(bundleArgs.runtimeFiles)
+	if err != nil {
+		return err
+	}
+
+	clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+	if len(clusters) == 0 {
+		return errors.New("no cluster found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	multiCluster := false
+	items := []bundleListItem{}
+	for _, cluster := range clusters {
+		kubeconfigArgs.Context = &cluster.KubeContext
+
+		rm, err := runtime.NewResourceManager(kubeconfigArgs)
+		if err != nil {
+			return err
+		}
+
+		bundles, err := runtime.NewStorageManager(rm).ListBundles(ctx)
+		if err != nil {
+			return err
+		}
+
+		revisions := runtime.NewRevisionManager(rm)
+		for _, bundle := range bundles {
+			revision, err := revisions.Latest(ctx, bundle.Name)
+			if err != nil {
+				return err
+			}
+
+			item := bundleListItem{BundleInfo: bundle, Revision: revision}
+			if !cluster.IsDefault() {
+				item.Cluster = cluster.Name
+				multiCluster = true
+			}
+			items = append(items, item)
+		}
+	}
+
+	if bundleListArgs.output == "json" {
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, "\n"...)
+		_, err = cmd.OutOrStdout().Write(data)
+		return err
+	}
+
+	var rows [][]string
+	for _, item := range items {
+		revision := "-"
+		if item.Revision > 0 {
+			revision = strconv.Itoa(item.Revision)
+		}
+		row := []string{
+			item.Name,
+			strconv.Itoa(item.Instances),
+			item.LastApplied,
+			revision,
+		}
+		if multiCluster {
+			row = append(row, printOrPass(item.Cluster))
+		}
+		rows = append(rows, row)
+	}
+
+	header := []string{"name", "instances", "last applied", "revision"}
+	if multiCluster {
+		header = append(header, "cluster")
+	}
+	printTable(cmd.OutOrStdout(), header, rows)
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func Test_BundleList(t *testing.T) {
+	g := NewWithT(t)
+
+	modPath, err := filepath.Abs("testdata/module")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	appsBundle := rnd("apps", 5)
+	dbBundle := rnd("db", 5)
+	namespace := rnd("my-namespace", 5)
+
+	appsData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: url: "file://%[2]s"
+			namespace: "%[3]s"
+			values: server: enabled: false
+		}
+		backend: {
+			module: url: "file://%[2]s"
+			namespace: "%[3]s"
+			values: client: enabled: false
+		}
+	}
+}
+`, appsBundle, modPath, namespace)
+
+	dbData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		redis: {
+			module: url: "file://%[2]s"
+			namespace: "%[3]s"
+			values: client: enabled: false
+		}
+	}
+}
+`, dbBundle, modPath, namespace)
+
+	_, err = executeCommandWithIn("bundle apply -f - -p main --wait --history-limit 10", strings.NewReader(appsData))
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = executeCommandWithIn("bundle apply -f - -p main --wait --history-limit 10", strings.NewReader(dbData))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	t.Run("lists bundles as table", func(t *testing.T) {
+		g := NewWithT(t)
+
+		output, err := executeCommand("bundle ls")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(MatchRegexp(fmt.Sprintf(`%s\s+2\s+\S+\s+1`, appsBundle)))
+		g.Expect(output).To(MatchRegexp(fmt.Sprintf(`%s\s+1\s+\S+\s+1`, dbBundle)))
+	})
+
+	t.Run("lists bundles as JSON", func(t *testing.T) {
+		g := NewWithT(t)
+
+		output, err := executeCommand("bundle list -o json")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var items []bundleListItem
+		g.Expect(json.Unmarshal([]byte(jsonFromOutput(output)), &items)).To(Succeed())
+
+		counts := make(map[string]int)
+		for _, item := range items {
+			counts[item.Name] = item.Instances
+			if item.Name == appsBundle || item.Name == dbBundle {
+				g.Expect(item.LastApplied).ToNot(BeEmpty())
+				g.Expect(item.Revision).To(Equal(1))
+			}
+		}
+		g.Expect(counts).To(HaveKeyWithValue(appsBundle, 2))
+		g.Expect(counts).To(HaveKeyWithValue(dbBundle, 1))
+	})
+
+	t.Run("fails for unknown output format", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := executeCommand("bundle list -o yaml")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unknown --output=yaml"))
+	})
+}
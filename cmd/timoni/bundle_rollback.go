@@ -0,0 +1,383 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+var bundleRollbackCmd = &cobra.Command{
+	Use:   "rollback [BUNDLE NAME]",
+	Short: "Roll back the instances of a bundle to a previous revision",
+	Long: `The bundle rollback command reapplies the objects recorded by a previous bundle apply,
+and deletes the objects and instances added since that revision.
+`,
+	Example: `  # Roll back a bundle to the revision prior to the last apply
+  timoni bundle rollback my-app
+
+  # Roll back a bundle to a specific revision
+  timoni bundle rollback my-app --to-revision 3
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBundleRollbackCmd,
+}
+
+type bundleRollbackFlags struct {
+	toRevision   int
+	wait         bool
+	historyLimit int
+}
+
+var bundleRollbackArgs bundleRollbackFlags
+
+func init() {
+	bundleRollbackCmd.Flags().IntVar(&bundleRollbackArgs.toRevision, "to-revision", 0,
+		"The bundle revision to roll back to, defaults to the revision prior to the last one.")
+	bundleRollbackCmd.Flags().BoolVar(&bundleRollbackArgs.wait, "wait", true,
+		"Wait for the restored Kubernetes objects to become ready.")
+	bundleRollbackCmd.Flags().IntVar(&bundleRollbackArgs.historyLimit, "history-limit", 0,
+		"The number of bundle revisions kept in the cluster, older revisions are deleted. "+
+			"When not set, the revisions are pruned by the next 'bundle apply' with the limit set for the bundle.")
+	bundleCmd.AddCommand(bundleRollbackCmd)
+}
+
+func runBundleRollbackCmd(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if bundleRollbackArgs.toRevision < 0 {
+		return errors.New("--to-revision must be a positive number")
+	}
+	if bundleRollbackArgs.historyLimit < 0 {
+		return errors.New("--history-limit must be a positive number")
+	}
+
+	rt, err := buildRuntime(bundleArgs.runtimeFiles)
+	if err != nil {
+		return err
+	}
+
+	clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+	if len(clusters) == 0 {
+		return errors.New("no cluster found")
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+	defer cancel()
+
+	for _, cluster := range clusters {
+		kubeconfigArgs.Context = &cluster.KubeContext
+
+		rm, err := runtime.NewResourceManager(kubeconfigArgs)
+		if err != nil {
+			return err
+		}
+
+		log := LoggerBundle(ctx, name, cluster.Name)
+
+		revm := runtime.NewRevisionManager(rm)
+		latest, err := revm.Latest(ctx, name)
+		if err != nil {
+			return err
+		}
+		if latest == 0 {
+			return fmt.Errorf("no revisions found for bundle %s, "+
+				"the revisions are recorded by 'timoni bundle apply --history-limit'", name)
+		}
+
+		target := bundleRollbackArgs.toRevision
+		if target == 0 {
+			target = latest - 1
+		}
+		if target < 1 {
+			return fmt.Errorf("bundle %s has no revision prior to %d", name, latest)
+		}
+		if target == latest {
+			return fmt.Errorf("revision %d is the current revision of bundle %s", target, name)
+		}
+
+		revisions, err := revm.Get(ctx, name, target)
+		if err != nil {
+			return err
+		}
+		current, err := revm.Get(ctx, name, latest)
+		if err != nil {
+			return err
+		}
+
+		log.Info(fmt.Sprintf("rolling back from revision %d to revision %d", latest, target))
+
+		if err := rollbackBundleInstances(ctx, rm, name, cluster.Name, current, revisions); err != nil {
+			return err
+		}
+
+		rev := &bundleRevision{}
+		for _, r := range revisions {
+			rev.add(r.Instance, r.Objects)
+		}
+		revision, err := rev.store(ctx, rm, name, bundleRollbackArgs.historyLimit)
+		if err != nil {
+			return err
+		}
+
+		log.Info(fmt.Sprintf("rolled back successfully to revision %d, stored as revision %d", target, revision))
+	}
+	return nil
+}
+
+// rollbackBundleInstances deletes the instances recorded in the current revision which
+// are not part of the target revision, then restores the target revision instances.
+// The instances are deleted in reverse dependency order and restored in dependency order.
+func rollbackBundleInstances(ctx context.Context, rm *ssa.ResourceManager, bundle, cluster string,
+	current, target []*runtime.InstanceRevision) error {
+	log := LoggerBundle(ctx, bundle, cluster)
+
+	sm := runtime.NewStorageManager(rm)
+	installed, err := sm.List(ctx, "", bundle)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(target))
+	for _, rev := range target {
+		keep[rev.Instance.Namespace+"/"+rev.Instance.Name] = true
+	}
+	recorded := make(map[string]bool, len(current))
+	for _, rev := range current {
+		recorded[rev.Instance.Namespace+"/"+rev.Instance.Name] = true
+	}
+
+	var added []*apiv1.Instance
+	for _, instance := range installed {
+		id := instance.Namespace + "/" + instance.Name
+		if recorded[id] && !keep[id] {
+			added = append(added, instance)
+		}
+	}
+
+	stale, err := bundleInstancesFromStorage(bundle, cluster, added)
+	if err != nil {
+		return err
+	}
+	for index := len(stale) - 1; index >= 0; index-- {
+		instance := stale[index]
+		log.Info(fmt.Sprintf("deleting instance %s in namespace %s",
+			colorizeSubject(instance.Name), colorizeSubject(instance.Namespace)))
+		if _, err := deleteBundleInstance(ctx, instance, bundleRollbackArgs.wait, false); err != nil {
+			return err
+		}
+	}
+
+	records := make([]*apiv1.Instance, len(target))
+	byID := make(map[string]*runtime.InstanceRevision, len(target))
+	for i, rev := range target {
+		records[i] = rev.Instance
+		byID[rev.Instance.Namespace+"/"+rev.Instance.Name] = rev
+	}
+	ordered, err := bundleInstancesFromStorage(bundle, cluster, records)
+	if err != nil {
+		return err
+	}
+	for _, instance := range ordered {
+		rev := byID[instance.Namespace+"/"+instance.Name]
+		if err := restoreInstanceRevision(ctx, rm, sm, bundle, cluster, rev); err != nil {
+			return fmt.Errorf("rollback of instance %s failed: %w", instance.Name, err)
+		}
+	}
+	return nil
+}
+
+// restoreInstanceRevision reapplies the objects of the instance revision, restores
+// the instance storage record and deletes the objects added since the revision.
+func restoreInstanceRevision(ctx context.Context, rm *ssa.ResourceManager, sm *runtime.StorageManager,
+	bundle, cluster string, rev *runtime.InstanceRevision) error {
+	instance := rev.Instance
+	log := LoggerBundleInstance(ctx, bundle, cluster, instance.Name)
+	log.Info(fmt.Sprintf("restoring %s in namespace %s",
+		colorizeSubject(instance.Name), colorizeSubject(instance.Namespace)))
+
+	staleObjects, err := sm.GetStaleObjects(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("getting stale objects failed: %w", err)
+	}
+
+	if _, err := sm.Get(ctx, instance.Name, instance.Namespace); err != nil {
+		if err := sm.Apply(ctx, instance, true); err != nil {
+			return fmt.Errorf("instance init failed: %w", err)
+		}
+	}
+
+	applyOpts := runtime.ApplyOptions(true, rootArgs.timeout)
+	applyOpts.WaitInterval = 5 * time.Second
+	cs, err := runtime.ApplyAllOrdered(ctx, rm, rev.Objects, applyOpts)
+	if err != nil {
+		return err
+	}
+	for _, change := range cs.Entries {
+		log.Info(colorizeJoin(change))
+	}
+
+	waitOptions := ssa.WaitOptions{
+		Interval: applyOpts.WaitInterval,
+		Timeout:  rootArgs.timeout,
+		FailFast: true,
+	}
+
+	if bundleRollbackArgs.wait {
+		spin := StartSpinner(fmt.Sprintf("waiting for %v resource(s) to become ready...", len(rev.Objects)))
+		err = rm.Wait(rev.Objects, waitOptions)
+		spin.Stop()
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("resources %s", colorizeReady("ready")))
+	}
+
+	if err := sm.Apply(ctx, instance, true); err != nil {
+		return fmt.Errorf("storing instance failed: %w", err)
+	}
+
+	if len(staleObjects) > 0 {
+		deleteOpts := runtime.DeleteOptions(instance.Name, instance.Namespace)
+		changeSet, err := rm.DeleteAll(ctx, staleObjects, deleteOpts)
+		if err != nil {
+			return fmt.Errorf("pruning objects failed: %w", err)
+		}
+		for _, change := range changeSet.Entries {
+			log.Info(colorizePruneChange(change))
+		}
+
+		deletedObjects := runtime.SelectObjectsFromSet(changeSet, ssa.DeletedAction)
+		if bundleRollbackArgs.wait && len(deletedObjects) > 0 {
+			spin := StartSpinner(fmt.Sprintf("waiting for %v resource(s) to be finalized...", len(deletedObjects)))
+			err = rm.WaitForTermination(deletedObjects, waitOptions)
+			spin.Stop()
+			if err != nil {
+				return fmt.Errorf("waiting for termination failed: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// bundleRevision collects the state of the bundle instances applied on a cluster,
+// to be stored as a new bundle revision once all the instances are applied.
+type bundleRevision struct {
+	instances []*runtime.InstanceRevision
+}
+
+// add records the storage record and the applied objects of an instance.
+// The instance is recorded without the metadata of its storage Secret, so that
+// the revisions are the same whether the instance was applied or skipped.
+func (r *bundleRevision) add(instance *apiv1.Instance, objects []*unstructured.Unstructured) {
+	record := instance.DeepCopy()
+	record.Labels = runtime.InstanceLabels(instance.Labels)
+	record.Annotations = nil
+	record.CreationTimestamp = metav1.Time{}
+	r.instances = append(r.instances, &runtime.InstanceRevision{
+		Instance: record,
+		Objects:  objects,
+	})
+}
+
+// store records the instances as the next revision of the bundle and returns its number.
+// The installed instances of the bundle that were not applied, e.g. when using --instance,
+// are carried over from the previous revision. If no instance changed since the previous
+// revision, no revision is stored and the previous revision number is returned.
+// The revisions exceeding the history limit are deleted, if the limit is set.
+func (r *bundleRevision) store(ctx context.Context, rm *ssa.ResourceManager, bundle string, limit int) (int, error) {
+	revm := runtime.NewRevisionManager(rm)
+	latest, err := revm.Latest(ctx, bundle)
+	if err != nil {
+		return 0, err
+	}
+
+	revisions := r.instances
+	if latest > 0 {
+		previous, err := revm.Get(ctx, bundle, latest)
+		if err != nil {
+			return 0, err
+		}
+
+		installed, err := runtime.NewStorageManager(rm).List(ctx, "", bundle)
+		if err != nil {
+			return 0, err
+		}
+		isInstalled := make(map[string]bool, len(installed))
+		for _, instance := range installed {
+			isInstalled[instance.Namespace+"/"+instance.Name] = true
+		}
+
+		applied := make(map[string]bool, len(r.instances))
+		for _, rev := range r.instances {
+			applied[rev.Instance.Namespace+"/"+rev.Instance.Name] = true
+		}
+		for _, rev := range previous {
+			id := rev.Instance.Namespace + "/" + rev.Instance.Name
+			if !applied[id] && isInstalled[id] {
+				revisions = append(revisions, rev)
+			}
+		}
+
+		if revisionUpToDate(previous, revisions) {
+			return latest, nil
+		}
+	}
+
+	for _, rev := range revisions {
+		rev.Revision = latest + 1
+		if err := revm.Apply(ctx, bundle, rev); err != nil {
+			return 0, err
+		}
+	}
+
+	if limit > 0 {
+		if err := revm.Prune(ctx, bundle, limit); err != nil {
+			return 0, err
+		}
+	}
+	return latest + 1, nil
+}
+
+// revisionUpToDate returns true if both revisions contain the same instances
+// with the same objects digest, module, values and metadata.
+func revisionUpToDate(previous, current []*runtime.InstanceRevision) bool {
+	if len(previous) != len(current) {
+		return false
+	}
+	stored := make(map[string]*apiv1.Instance, len(previous))
+	for _, rev := range previous {
+		stored[rev.Instance.Namespace+"/"+rev.Instance.Name] = rev.Instance
+	}
+	for _, rev := range current {
+		s, ok := stored[rev.Instance.Namespace+"/"+rev.Instance.Name]
+		if !ok || !instanceUpToDate(s, rev.Instance) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+func Test_BundleRollback(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := rnd("my-bundle", 5)
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleV1 := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: domain: "v1.internal"
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace)
+
+	bundleV2 := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: {
+				domain: "v2.internal"
+				server: enabled: false
+			}
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: server: enabled: false
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace)
+
+	frontendClient := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "frontend-client",
+			Namespace: namespace,
+		},
+	}
+	frontendServer := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "frontend-server",
+			Namespace: namespace,
+		},
+	}
+	backendClient := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "backend-client",
+			Namespace: namespace,
+		},
+	}
+
+	t.Run("fails without revisions", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := executeCommand(fmt.Sprintf("bundle rollback %s", bundleName))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("no revisions found for bundle " + bundleName))
+	})
+
+	t.Run("restores the previous revision", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := executeCommandWithIn("bundle apply -f - -p main --wait --history-limit 10", strings.NewReader(bundleV1))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = executeCommandWithIn("bundle apply -f - -p main --wait --history-limit 10", strings.NewReader(bundleV2))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(envTestClient.Get(context.Background(), client.ObjectKeyFromObject(frontendClient), frontendClient)).To(Succeed())
+		g.Expect(frontendClient.Data["server"]).To(Equal("tcp://v2.internal:9090"))
+		g.Expect(envTestClient.Get(context.Background(), client.ObjectKeyFromObject(backendClient), backendClient)).To(Succeed())
+		err = envTestClient.Get(context.Background(), client.ObjectKeyFromObject(frontendServer), frontendServer)
+		g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		output, err := executeCommand(fmt.Sprintf("bundle rollback %s --wait", bundleName))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("rolled back successfully to revision 1, stored as revision 3"))
+
+		g.Expect(envTestClient.Get(context.Background(), client.ObjectKeyFromObject(frontendClient), frontendClient)).To(Succeed())
+		g.Expect(frontendClient.Data["server"]).To(Equal("tcp://v1.internal:9090"))
+		g.Expect(envTestClient.Get(context.Background(), client.ObjectKeyFromObject(frontendServer), frontendServer)).To(Succeed())
+
+		err = envTestClient.Get(context.Background(), client.ObjectKeyFromObject(backendClient), backendClient)
+		g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		backendStorage := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "timoni.backend",
+				Namespace: namespace,
+			},
+		}
+		err = envTestClient.Get(context.Background(), client.ObjectKeyFromObject(backendStorage), backendStorage)
+		g.Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("restores a specific revision", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := executeCommand(fmt.Sprintf("bundle rollback %s --to-revision 2 --wait", bundleName))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(envTestClient.Get(context.Background(), client.ObjectKeyFromObject(frontendClient), frontendClient)).To(Succeed())
+		g.Expect(frontendClient.Data["server"]).To(Equal("tcp://v2.internal:9090"))
+		g.Expect(envTestClient.Get(context.Background(), client.ObjectKeyFromObject(backendClient), backendClient)).To(Succeed())
+	})
+
+	t.Run("caps the stored revisions", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := executeCommandWithIn("bundle apply -f - -p main --wait --history-limit 2", strings.NewReader(bundleV1))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		secrets := &corev1.SecretList{}
+		g.Expect(envTestClient.List(context.Background(), secrets, client.InNamespace(namespace),
+			client.MatchingLabels{apiv1.BundleNameLabelKey: bundleName, "app.kubernetes.io/component": "revision"})).To(Succeed())
+
+		revisions := make(map[string]bool)
+		for _, secret := range secrets.Items {
+			revisions[secret.Labels[apiv1.BundleRevisionLabelKey]] = true
+		}
+		g.Expect(revisions).To(Equal(map[string]bool{"4": true, "5": true}))
+
+		_, err = executeCommand(fmt.Sprintf("bundle rollback %s --to-revision 1", bundleName))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("revision 1 of bundle " + bundleName + " not found"))
+	})
+}
+
+func Test_BundleRevisionStore(t *testing.T) {
+	ctx := context.Background()
+
+	rm := ssa.NewResourceManager(newFakeApplyClient(), nil, ssa.Owner{Field: apiv1.FieldManager, Group: "instance.timoni.sh"})
+	sm := runtime.NewStorageManager(rm)
+	revm := runtime.NewRevisionManager(rm)
+	bundleName := "my-bundle"
+
+	instance := &apiv1.Instance{
+		Module: apiv1.ModuleReference{Version: "1.0.0", Digest: "sha256:a"},
+		Values: "values: {}",
+		Digest: "sha256:b",
+	}
+	instance.Name = "frontend"
+	instance.Namespace = "apps"
+	instance.Labels = map[string]string{apiv1.BundleNameLabelKey: bundleName}
+
+	storeRevision := func(g *WithT, instance *apiv1.Instance, limit int) int {
+		g.Expect(sm.Apply(ctx, instance.DeepCopy(), false)).To(Succeed())
+		rev := &bundleRevision{}
+		rev.add(instance, nil)
+		revision, err := rev.store(ctx, rm, bundleName, limit)
+		g.Expect(err).ToNot(HaveOccurred())
+		return revision
+	}
+
+	t.Run("records the applied instance", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(storeRevision(g, instance, 2)).To(Equal(1))
+	})
+
+	t.Run("skips the revision of the stored instance", func(t *testing.T) {
+		g := NewWithT(t)
+		stored, err := sm.Get(ctx, instance.Name, instance.Namespace)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(storeRevision(g, stored, 2)).To(Equal(1))
+	})
+
+	t.Run("doesn't prune without a limit", func(t *testing.T) {
+		g := NewWithT(t)
+		for i := 0; i < 3; i++ {
+			instance.Digest = fmt.Sprintf("sha256:c%d", i)
+			g.Expect(storeRevision(g, instance, 0)).To(Equal(i + 2))
+		}
+		revisions, err := revm.List(ctx, bundleName)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(revisions).To(HaveLen(4))
+	})
+
+	t.Run("prunes the revisions over the limit", func(t *testing.T) {
+		g := NewWithT(t)
+		instance.Digest = "sha256:d"
+		g.Expect(storeRevision(g, instance, 2)).To(Equal(5))
+		revisions, err := revm.List(ctx, bundleName)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(revisions).To(ConsistOf(4, 5))
+	})
+}
@@ -0,0 +1,489 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/flags"
+	"github.com/stefanprodan/timoni/internal/oci"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+var bundleSbomCmd = &cobra.Command{
+	Use:   "sbom",
+	Short: "Generate a Software Bill of Materials for all instances from a bundle",
+	Long: `The bundle sbom command generates a Software Bill of Materials listing the modules
+and the container images deployed by the instances defined in a bundle.
+The digests of the container images are resolved from the remote registries where possible.
+`,
+	Example: `  # Generate a CycloneDX SBOM for a bundle
+  timoni bundle sbom -f bundle.cue
+
+  # Generate an SPDX SBOM and write it to a file
+  timoni bundle sbom -f bundle.cue --format spdx > bundle.spdx.json
+`,
+	Args: cobra.NoArgs,
+	RunE: runBundleSbomCmd,
+}
+
+type bundleSbomFlags struct {
+	pkg    flags.Package
+	files  []string
+	format string
+	creds  flags.Credentials
+}
+
+var bundleSbomArgs bundleSbomFlags
+
+const (
+	sbomFormatCycloneDX = "cyclonedx"
+	sbomFormatSPDX      = "spdx"
+)
+
+func init() {
+	bundleSbomCmd.Flags().VarP(&bundleSbomArgs.pkg, bundleSbomArgs.pkg.Type(), bundleSbomArgs.pkg.Shorthand(), bundleSbomArgs.pkg.Description())
+	bundleSbomCmd.Flags().StringSliceVarP(&bundleSbomArgs.files, "file", "f", nil,
+		"The local path to bundle.cue files.")
+	bundleSbomCmd.Flags().StringVar(&bundleSbomArgs.format, "format", sbomFormatCycloneDX,
+		"The SBOM format, can be 'cyclonedx' or 'spdx'.")
+	bundleSbomCmd.Flags().Var(&bundleSbomArgs.creds, bundleSbomArgs.creds.Type(), bundleSbomArgs.creds.Description())
+	bundleCmd.AddCommand(bundleSbomCmd)
+}
+
+// sbomComponent is a module or a container image deployed by a bundle.
+type sbomComponent struct {
+	Type       string
+	Name       string
+	Repository string
+	Version    string
+	Digest     string
+}
+
+const (
+	sbomComponentModule = "module"
+	sbomComponentImage  = "image"
+)
+
+func runBundleSbomCmd(cmd *cobra.Command, _ []string) error {
+	switch bundleSbomArgs.format {
+	case sbomFormatCycloneDX, sbomFormatSPDX:
+	default:
+		return fmt.Errorf("unknown --format=%s, can be %s or %s",
+			bundleSbomArgs.format, sbomFormatCycloneDX, sbomFormatSPDX)
+	}
+
+	files := bundleSbomArgs.files
+	if len(files) == 0 {
+		return errors.New("no bundle provided with -f")
+	}
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
+	}
+	defer removeStdinFile()
+
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := cuecontext.New()
+	bm := engine.NewBundleBuilder(ctx, files)
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(bundleArgs.moduleRoot)
+	bm.SetOverlays(bundleArgs.overlays)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	runtimeValues := make(map[string]string)
+
+	if bundleArgs.runtimeFromEnv {
+		maps.Copy(runtimeValues, engine.GetEnv())
+	}
+
+	if len(bundleArgs.runtimeFiles) > 0 {
+		kctx, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+		defer cancel()
+
+		rt, err := buildRuntime(bundleArgs.runtimeFiles)
+		if err != nil {
+			return err
+		}
+
+		clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+		if len(clusters) > 1 {
+			return errors.New("you must select a cluster with --runtime-cluster")
+		}
+		if len(clusters) == 0 {
+			return errors.New("no cluster found")
+		}
+
+		cluster := clusters[0]
+		kubeconfigArgs.Context = &cluster.KubeContext
+
+		rm, err := runtime.NewResourceManager(kubeconfigArgs)
+		if err != nil {
+			return err
+		}
+
+		reader := runtime.NewResourceReader(rm)
+		rv, err := reader.Read(kctx, rt.Refs)
+		if err != nil {
+			return err
+		}
+
+		maps.Copy(runtimeValues, rv)
+		maps.Copy(runtimeValues, cluster.NameGroupValues())
+	}
+
+	if err := bm.InitWorkspace(tmpDir, runtimeValues); err != nil {
+		return describeErr(tmpDir, "failed to parse bundle", err)
+	}
+
+	v, warnings, err := bm.Build()
+	if err != nil {
+		return describeErr(tmpDir, "failed to build bundle", err)
+	}
+
+	if err := reportBundleWarnings(LoggerFrom(cmd.Context()), warnings); err != nil {
+		return err
+	}
+
+	bundle, err := bm.GetBundle(v)
+	if err != nil {
+		return err
+	}
+
+	overrideBundleNamespace(LoggerBundle(cmd.Context(), bundle.Name, apiv1.RuntimeDefaultName), bundle)
+
+	ctxPull, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	if err := fetchBundleInstanceModules(ctxPull, bundle.Instances, tmpDir); err != nil {
+		return err
+	}
+
+	var modules, images []sbomComponent
+	for _, instance := range bundle.Instances {
+		refs, err := bundleInstanceImages(ctx, instance, tmpDir, bundleSbomArgs.pkg.String())
+		if err != nil {
+			return err
+		}
+
+		modules = append(modules, sbomComponent{
+			Type:       sbomComponentModule,
+			Name:       instance.Module.Name,
+			Repository: instance.Module.Repository,
+			Version:    instance.Module.Version,
+			Digest:     instance.Module.Digest,
+		})
+
+		opts := oci.Options(ctxPull, bundleSbomArgs.creds.String(), rootArgs.registryInsecure)
+		for _, ref := range refs {
+			image, err := newImageComponent(ref, opts)
+			if err != nil {
+				return err
+			}
+			images = append(images, image)
+		}
+	}
+
+	components := uniqueComponents(append(modules, images...))
+
+	var doc any
+	switch bundleSbomArgs.format {
+	case sbomFormatSPDX:
+		doc = newSPDXDocument(bundle.Name, components, time.Now().UTC())
+	default:
+		doc = newCycloneDXDocument(bundle.Name, components, time.Now().UTC())
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("converting SBOM failed: %w", err)
+	}
+
+	_, err = cmd.OutOrStdout().Write(append(data, '\n'))
+	return err
+}
+
+// bundleInstanceImages builds the instance and returns the container images
+// referenced in its config values.
+func bundleInstanceImages(cuectx *cue.Context, instance *engine.BundleInstance, rootDir, pkg string) ([]string, error) {
+	modDir := path.Join(rootDir, instance.Name, "module")
+	builder := engine.NewModuleBuilder(
+		cuectx,
+		instance.Name,
+		instance.Namespace,
+		modDir,
+		pkg,
+	)
+
+	if err := builder.WriteSchemaFile(); err != nil {
+		return nil, err
+	}
+
+	modName, err := builder.GetModuleName()
+	if err != nil {
+		return nil, err
+	}
+	instance.Module.Name = modName
+
+	if err := builder.WriteValuesFileWithDefaults(instance.Values); err != nil {
+		return nil, err
+	}
+
+	builder.SetVersionInfo(instance.Module.Version, "")
+
+	buildResult, err := builder.Build()
+	if err != nil {
+		return nil, describeErr(modDir, "build failed for "+instance.Name, err)
+	}
+
+	return builder.GetContainerImages(buildResult)
+}
+
+// newImageComponent parses the image reference and resolves its digest
+// from the remote registry if the reference is not pinned to a digest.
+func newImageComponent(imageRef string, opts []crane.Option) (sbomComponent, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return sbomComponent{}, fmt.Errorf("'%s' invalid image reference: %w", imageRef, err)
+	}
+
+	repo := ref.Context().Name()
+	image := sbomComponent{
+		Type:       sbomComponentImage,
+		Name:       repo[strings.LastIndex(repo, "/")+1:],
+		Repository: repo,
+	}
+
+	// A reference in the format repo:tag@digest is parsed as a digest,
+	// extract the tag from the original reference.
+	if p := strings.TrimPrefix(strings.Split(imageRef, "@")[0], repo); strings.HasPrefix(p, ":") {
+		image.Version = strings.TrimPrefix(p, ":")
+	} else if tag, ok := ref.(name.Tag); ok {
+		image.Version = tag.TagStr()
+	}
+
+	if digest, err := oci.ResolveImageDigest(imageRef, opts); err == nil {
+		image.Digest = digest
+	}
+
+	return image, nil
+}
+
+// uniqueComponents removes the duplicate components and sorts them by type and repository.
+func uniqueComponents(components []sbomComponent) []sbomComponent {
+	seen := make(map[sbomComponent]bool)
+	var list []sbomComponent
+	for _, c := range components {
+		if !seen[c] {
+			seen[c] = true
+			list = append(list, c)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Type != list[j].Type {
+			return list[i].Type == sbomComponentModule
+		}
+		return list[i].Repository+list[i].Version < list[j].Repository+list[j].Version
+	})
+	return list
+}
+
+// purl returns the package URL of the component in the OCI format
+// 'pkg:oci/<name>@<digest>?repository_url=<repository>&tag=<version>'.
+func (c sbomComponent) purl() string {
+	repo := strings.TrimPrefix(c.Repository, apiv1.ArtifactPrefix)
+	p := "pkg:oci/" + url.PathEscape(c.Name[strings.LastIndex(c.Name, "/")+1:])
+	if c.Digest != "" {
+		p += "@" + url.PathEscape(c.Digest)
+	}
+
+	q := url.Values{}
+	q.Set("repository_url", repo)
+	if c.Version != "" {
+		q.Set("tag", c.Version)
+	}
+	return p + "?" + q.Encode()
+}
+
+type cycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef  string          `json:"bom-ref,omitempty"`
+	Type    string          `json:"type"`
+	Name    string          `json:"name"`
+	Version string          `json:"version,omitempty"`
+	PURL    string          `json:"purl,omitempty"`
+	Hashes  []cycloneDXHash `json:"hashes,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+func newCycloneDXDocument(bundle string, components []sbomComponent, created time.Time) cycloneDXDocument {
+	doc := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.New().String(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: created.Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: apiv1.FieldManager, Version: VERSION}},
+			Component: cycloneDXComponent{Type: "application", Name: bundle},
+		},
+	}
+
+	for _, c := range components {
+		component := cycloneDXComponent{
+			BOMRef:  c.purl(),
+			Type:    "container",
+			Name:    c.Repository,
+			Version: c.Version,
+			PURL:    c.purl(),
+		}
+		if c.Type == sbomComponentModule {
+			component.Type = "library"
+		}
+		if alg, hex, ok := strings.Cut(c.Digest, ":"); ok && alg == "sha256" {
+			component.Hashes = []cycloneDXHash{{Alg: "SHA-256", Content: hex}}
+		}
+		doc.Components = append(doc.Components, component)
+	}
+
+	return doc
+}
+
+type spdxDocument struct {
+	SPDXVersion       string           `json:"spdxVersion"`
+	DataLicense       string           `json:"dataLicense"`
+	SPDXID            string           `json:"SPDXID"`
+	Name              string           `json:"name"`
+	DocumentNamespace string           `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo `json:"creationInfo"`
+	Packages          []spdxPackage    `json:"packages"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+func newSPDXDocument(bundle string, components []sbomComponent, created time.Time) spdxDocument {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              bundle,
+		DocumentNamespace: fmt.Sprintf("https://timoni.sh/spdx/%s-%s", bundle, uuid.New().String()),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.Format(time.RFC3339),
+			Creators: []string{fmt.Sprintf("Tool: %s-%s", apiv1.FieldManager, VERSION)},
+		},
+	}
+
+	for i, c := range components {
+		pkg := spdxPackage{
+			Name:             c.Repository,
+			SPDXID:           fmt.Sprintf("SPDXRef-Package-%s-%d", c.Type, i),
+			VersionInfo:      c.Version,
+			DownloadLocation: "NOASSERTION",
+			PrimaryPurpose:   "CONTAINER",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  c.purl(),
+			}},
+		}
+		if c.Type == sbomComponentModule {
+			pkg.PrimaryPurpose = "LIBRARY"
+		}
+		if alg, hex, ok := strings.Cut(c.Digest, ":"); ok && alg == "sha256" {
+			pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: hex}}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+	}
+
+	return doc
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	. "github.com/onsi/gomega"
+)
+
+func Test_BundleSbom(t *testing.T) {
+	g := NewWithT(t)
+
+	bundleName := "my-bundle"
+	modPath := "testdata/module"
+	namespace := rnd("my-namespace", 5)
+	modName := rnd("my-mod", 5)
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, modName)
+	modVer := "1.0.0"
+	imgDigest := "sha256:b49fbaac0eedc22c1cfcd26684707179cccbed0df205171bae3e1bae61326a10"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	modDigest, err := crane.Digest(fmt.Sprintf("%s:%s", modURL, modVer))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	bundleData := fmt.Sprintf(`
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "%[1]s"
+	instances: {
+		frontend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: {}
+		}
+		backend: {
+			module: {
+				url:     "oci://%[2]s"
+				version: "%[3]s"
+			}
+			namespace: "%[4]s"
+			values: {}
+		}
+	}
+}
+`, bundleName, modURL, modVer, namespace)
+
+	bundlePath := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(bundlePath, []byte(bundleData), 0644)).ToNot(HaveOccurred())
+
+	t.Run("generates CycloneDX SBOM", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle sbom -f %s -p main", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var doc cycloneDXDocument
+		g.Expect(json.Unmarshal([]byte(output), &doc)).To(Succeed())
+		g.Expect(doc.BOMFormat).To(Equal("CycloneDX"))
+		g.Expect(doc.Metadata.Component.Name).To(Equal(bundleName))
+		g.Expect(doc.Components).To(HaveLen(2))
+
+		module := doc.Components[0]
+		g.Expect(module.Type).To(Equal("library"))
+		g.Expect(module.Name).To(Equal("oci://" + modURL))
+		g.Expect(module.Version).To(Equal(modVer))
+		g.Expect(module.Hashes).To(HaveLen(1))
+		g.Expect("sha256:" + module.Hashes[0].Content).To(Equal(modDigest))
+
+		image := doc.Components[1]
+		g.Expect(image.Type).To(Equal("container"))
+		g.Expect(image.Name).To(Equal("cgr.dev/chainguard/timoni"))
+		g.Expect(image.Version).To(Equal("latest-dev"))
+		g.Expect(image.Hashes).To(HaveLen(1))
+		g.Expect("sha256:" + image.Hashes[0].Content).To(Equal(imgDigest))
+	})
+
+	t.Run("generates SPDX SBOM", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf("bundle sbom -f %s -p main --format spdx", bundlePath))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var doc spdxDocument
+		g.Expect(json.Unmarshal([]byte(output), &doc)).To(Succeed())
+		g.Expect(doc.SPDXVersion).To(Equal("SPDX-2.3"))
+		g.Expect(doc.Name).To(Equal(bundleName))
+		g.Expect(doc.Packages).To(HaveLen(2))
+
+		g.Expect(doc.Packages[0].Name).To(Equal("oci://" + modURL))
+		g.Expect(doc.Packages[0].PrimaryPurpose).To(Equal("LIBRARY"))
+		g.Expect("sha256:" + doc.Packages[0].Checksums[0].ChecksumValue).To(Equal(modDigest))
+
+		g.Expect(doc.Packages[1].Name).To(Equal("cgr.dev/chainguard/timoni"))
+		g.Expect(doc.Packages[1].PrimaryPurpose).To(Equal("CONTAINER"))
+		g.Expect("sha256:" + doc.Packages[1].Checksums[0].ChecksumValue).To(Equal(imgDigest))
+	})
+
+	t.Run("fails for unknown format", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand(fmt.Sprintf("bundle sbom -f %s -p main --format xml", bundlePath))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unknown --format=xml"))
+	})
+}
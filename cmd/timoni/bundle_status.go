@@ -41,6 +41,9 @@ var bundleStatusCmd = &cobra.Command{
 
   # Show the status using a named bundle
   timoni bundle status my-app
+
+  # Show the status of the instances matching a label selector
+  timoni bundle status my-app --selector team=payments
 `,
 	RunE: runBundleStatusCmd,
 }
@@ -48,6 +51,7 @@ var bundleStatusCmd = &cobra.Command{
 type bundleStatusFlags struct {
 	name     string
 	filename string
+	selector string
 }
 
 var bundleStatusArgs bundleStatusFlags
@@ -55,6 +59,8 @@ var bundleStatusArgs bundleStatusFlags
 func init() {
 	bundleStatusCmd.Flags().StringVarP(&bundleStatusArgs.filename, "file", "f", "",
 		"The local path to bundle.cue file.")
+	bundleStatusCmd.Flags().StringVarP(&bundleStatusArgs.selector, "selector", "l", "",
+		"Select the instances by label selector, e.g. 'team=payments,tier!=db'.")
 	bundleCmd.AddCommand(bundleStatusCmd)
 }
 
@@ -71,10 +77,20 @@ func runBundleStatusCmd(cmd *cobra.Command, args []string) error {
 			return err
 		}
 		bundleStatusArgs.name = name
+
+		if !bundleFileHasInstances(cuectx, bundleStatusArgs.filename) {
+			LoggerBundle(cmd.Context(), name, apiv1.RuntimeDefaultName).Info(noBundleInstancesMsg)
+			return nil
+		}
 	default:
 		bundleStatusArgs.name = args[0]
 	}
 
+	selector, err := parseInstanceSelector(bundleStatusArgs.selector)
+	if err != nil {
+		return err
+	}
+
 	rt, err := buildRuntime(bundleArgs.runtimeFiles)
 	if err != nil {
 		return err
@@ -102,6 +118,7 @@ func runBundleStatusCmd(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
+		instances = selectInstancesByLabels(instances, selector)
 
 		log := LoggerBundle(ctx, bundleStatusArgs.name, cluster.Name)
 
@@ -0,0 +1,215 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/format"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/runtime"
+)
+
+var bundleValuesCmd = &cobra.Command{
+	Use:   "values",
+	Short: "Print the effective values of an instance from a bundle",
+	Long: `The bundle values command prints the values passed to the module of a bundle instance,
+after the bundle files, overlays, inherited and conditional values are merged.
+The sensitive values of the instance are redacted, unless --show-secrets is set.
+The command doesn't pull the module and doesn't make any changes to the cluster.
+`,
+	Example: `  # Print the values of the frontend instance
+  timoni bundle values -f bundle.cue --instance frontend
+
+  # Print the values merged from multiple bundle files in YAML format
+  timoni bundle values -f bundle.cue -f bundle.prod.cue --instance frontend -o yaml
+`,
+	Args: cobra.NoArgs,
+	RunE: runBundleValuesCmd,
+}
+
+type bundleValuesFlags struct {
+	files       []string
+	instance    string
+	output      string
+	showSecrets bool
+}
+
+var bundleValuesArgs bundleValuesFlags
+
+func init() {
+	bundleValuesCmd.Flags().StringSliceVarP(&bundleValuesArgs.files, "file", "f", nil,
+		"The local path to bundle.cue files.")
+	bundleValuesCmd.Flags().StringVar(&bundleValuesArgs.instance, "instance", "",
+		"The name of the instance whose values should be printed.")
+	bundleValuesCmd.Flags().StringVarP(&bundleValuesArgs.output, "output", "o", "cue",
+		"The format in which the values should be printed, can be 'cue' or 'yaml'.")
+	bundleValuesCmd.Flags().BoolVar(&bundleValuesArgs.showSecrets, "show-secrets", false,
+		"Print the sensitive values of the instance instead of redacting them.")
+	bundleCmd.AddCommand(bundleValuesCmd)
+}
+
+func runBundleValuesCmd(cmd *cobra.Command, _ []string) error {
+	if o := bundleValuesArgs.output; o != "cue" && o != "yaml" {
+		return fmt.Errorf("unknown --output=%s, can be cue or yaml", o)
+	}
+	if bundleValuesArgs.instance == "" {
+		return errors.New("no instance provided with --instance")
+	}
+
+	files := bundleValuesArgs.files
+	if len(files) == 0 {
+		return errors.New("no bundle provided with -f")
+	}
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
+	}
+	defer removeStdinFile()
+
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := cuecontext.New()
+	bm := engine.NewBundleBuilder(ctx, files)
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(bundleArgs.moduleRoot)
+	bm.SetOverlays(bundleArgs.overlays)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	runtimeValues := make(map[string]string)
+
+	if bundleArgs.runtimeFromEnv {
+		maps.Copy(runtimeValues, engine.GetEnv())
+	}
+
+	if len(bundleArgs.runtimeFiles) > 0 {
+		kctx, cancel := context.WithTimeout(cmd.Context(), rootArgs.timeout)
+		defer cancel()
+
+		rt, err := buildRuntime(bundleArgs.runtimeFiles)
+		if err != nil {
+			return err
+		}
+
+		clusters := rt.SelectClusters(bundleArgs.runtimeCluster, bundleArgs.runtimeClusterGroup)
+		if len(clusters) > 1 {
+			return errors.New("you must select a cluster with --runtime-cluster")
+		}
+		if len(clusters) == 0 {
+			return errors.New("no cluster found")
+		}
+
+		cluster := clusters[0]
+		kubeconfigArgs.Context = &cluster.KubeContext
+
+		rm, err := runtime.NewResourceManager(kubeconfigArgs)
+		if err != nil {
+			return err
+		}
+
+		reader := runtime.NewResourceReader(rm)
+		rv, err := reader.Read(kctx, rt.Refs)
+		if err != nil {
+			return err
+		}
+
+		maps.Copy(runtimeValues, rv)
+		maps.Copy(runtimeValues, cluster.NameGroupValues())
+	}
+
+	if err := bm.InitWorkspace(tmpDir, runtimeValues); err != nil {
+		return describeErr(tmpDir, "failed to parse bundle", err)
+	}
+
+	v, warnings, err := bm.Build()
+	if err != nil {
+		return describeErr(tmpDir, "failed to build bundle", err)
+	}
+
+	if err := reportBundleWarnings(LoggerFrom(cmd.Context()), warnings); err != nil {
+		return err
+	}
+
+	bundle, err := bm.GetBundle(v)
+	if err != nil {
+		return err
+	}
+
+	var instance *engine.BundleInstance
+	for _, i := range bundle.Instances {
+		if i.Name == bundleValuesArgs.instance {
+			instance = i
+			break
+		}
+	}
+	if instance == nil {
+		return fmt.Errorf("instance %s not found in bundle %s", bundleValuesArgs.instance, bundle.Name)
+	}
+
+	values := map[string]any{}
+	if instance.Values.Exists() {
+		if err := instance.Values.Decode(&values); err != nil {
+			return fmt.Errorf("decoding the values of instance %s failed: %w", instance.Name, err)
+		}
+	}
+
+	if !bundleValuesArgs.showSecrets && len(instance.Sensitive) > 0 {
+		if err := engine.RedactValues(values, instance.Sensitive); err != nil {
+			return fmt.Errorf("instance %s: %w", instance.Name, err)
+		}
+	}
+
+	var data []byte
+	switch bundleValuesArgs.output {
+	case "yaml":
+		data, err = yaml.Marshal(values)
+		if err != nil {
+			return fmt.Errorf("converting values to YAML failed: %w", err)
+		}
+	default:
+		out := ctx.Encode(values)
+		if out.Err() != nil {
+			return fmt.Errorf("converting values to CUE failed: %w", out.Err())
+		}
+		node, err := format.Node(out.Syntax(cue.Final(), cue.Concrete(true)))
+		if err != nil {
+			return fmt.Errorf("converting values to CUE failed: %w", err)
+		}
+		data = []byte(fmt.Sprintf("%s: %s\n", apiv1.ValuesSelector, node))
+	}
+
+	_, err = cmd.OutOrStdout().Write(data)
+	return err
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_BundleValues(t *testing.T) {
+	bundleData := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name: "my-bundle"
+	instances: {
+		frontend: {
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			namespace: "apps"
+			values: {
+				replicas: 1
+				image: tag: "1.0.0"
+				password: "s3cr3t"
+			}
+			sensitive: ["password"]
+		}
+	}
+}
+`
+	prodData := `
+bundle: instances: frontend: values: {
+	image: repository: "ghcr.io/org/app"
+	resources: limits: cpu: "100m"
+}
+`
+	tmpDir := t.TempDir()
+	bundlePath := filepath.Join(tmpDir, "bundle.cue")
+	prodPath := filepath.Join(tmpDir, "bundle.prod.cue")
+	if err := os.WriteFile(bundlePath, []byte(bundleData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prodPath, []byte(prodData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("prints the merged values in YAML format", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle values -f %s -f %s --instance frontend -o yaml --show-secrets",
+			bundlePath, prodPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var values map[string]any
+		g.Expect(yaml.Unmarshal([]byte(output), &values)).To(Succeed())
+		g.Expect(values).To(Equal(map[string]any{
+			"replicas": float64(1),
+			"password": "s3cr3t",
+			"image": map[string]any{
+				"repository": "ghcr.io/org/app",
+				"tag":        "1.0.0",
+			},
+			"resources": map[string]any{
+				"limits": map[string]any{"cpu": "100m"},
+			},
+		}))
+	})
+
+	t.Run("prints the values in CUE format with the secrets redacted", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"bundle values -f %s -f %s --instance frontend",
+			bundlePath, prodPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(HavePrefix("values: {"))
+		g.Expect(output).To(ContainSubstring(`repository: "ghcr.io/org/app"`))
+		g.Expect(output).To(ContainSubstring(`password: "***"`))
+		g.Expect(output).ToNot(ContainSubstring("s3cr3t"))
+	})
+
+	t.Run("fails for unknown instance", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand(fmt.Sprintf(
+			"bundle values -f %s --instance backend",
+			bundlePath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("instance backend not found in bundle my-bundle"))
+	})
+}
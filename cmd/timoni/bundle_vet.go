@@ -55,6 +55,10 @@ with Timoni's schema and optionally prints the computed value.
   -f bundle.cue \
   -r runtime.cue \
   --print-value
+
+  # Validate the instance values against a policy schema stored in a container registry
+  timoni bundle vet -f bundle.cue \
+  --policy oci://ghcr.io/org/policies/values:v1
 `,
 	Args: cobra.NoArgs,
 	RunE: runBundleVetCmd,
@@ -83,20 +87,11 @@ func runBundleVetCmd(cmd *cobra.Command, args []string) error {
 	if len(files) == 0 {
 		return fmt.Errorf("no bundle provided with -f")
 	}
-	var stdinFile string
-	for i, file := range files {
-		if file == "-" {
-			stdinFile, err := saveReaderToFile(cmd.InOrStdin())
-			if err != nil {
-				return err
-			}
-			files[i] = stdinFile
-			break
-		}
-	}
-	if stdinFile != "" {
-		defer os.Remove(stdinFile)
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
 	}
+	defer removeStdinFile()
 
 	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
 	if err != nil {
@@ -106,6 +101,22 @@ func runBundleVetCmd(cmd *cobra.Command, args []string) error {
 
 	cuectx := cuecontext.New()
 	bm := engine.NewBundleBuilder(cuectx, files)
+	if !bundleArgs.noCache {
+		bm.SetCacheDir(rootArgs.cacheDir)
+	}
+	bm.SetModuleRoot(bundleArgs.moduleRoot)
+	bm.SetOverlays(bundleArgs.overlays)
+	bm.SetEnvFile(bundleArgs.envFile)
+	bm.SetStrict(bundleArgs.strict)
+	bm.SetLegacyTemplates(bundleArgs.legacyTemplates, nil)
+
+	var policy *engine.ValuesPolicy
+	if bundleArgs.policy != "" {
+		policy, err = pullValuesPolicy(cmd.Context(), cuectx, bundleArgs.policy, "")
+		if err != nil {
+			return err
+		}
+	}
 
 	runtimeValues := make(map[string]string)
 
@@ -159,22 +170,33 @@ func runBundleVetCmd(cmd *cobra.Command, args []string) error {
 			return describeErr(workspace, "failed to parse bundle", err)
 		}
 
-		v, err := bm.Build()
+		v, warnings, err := bm.Build()
 		if err != nil {
 			return describeErr(workspace, "failed to build bundle", err)
 		}
 
+		if err := reportBundleWarnings(LoggerFrom(cmd.Context()), warnings); err != nil {
+			return err
+		}
+
 		bundle, err := bm.GetBundle(v)
 		if err != nil {
 			return err
 		}
 
 		log = LoggerBundle(logr.NewContext(cmd.Context(), log), bundle.Name, apiv1.RuntimeDefaultName)
+		overrideBundleNamespace(log, bundle)
 
 		if len(bundle.Instances) == 0 {
 			return fmt.Errorf("no instances found in bundle")
 		}
 
+		if policy != nil {
+			if err := validateValuesPolicy(policy, bundle, workspace); err != nil {
+				return err
+			}
+		}
+
 		if bundleVetArgs.printValue {
 			val := v.LookupPath(cue.ParsePath("bundle"))
 			if val.Err() != nil {
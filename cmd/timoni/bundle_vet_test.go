@@ -406,3 +406,59 @@ runtime: {
 	g.Expect(err).ToNot(HaveOccurred())
 	g.Expect(output).To(BeEquivalentTo(bundleComputed))
 }
+
+func Test_BundleVet_Policy(t *testing.T) {
+	g := NewWithT(t)
+
+	policyCue := `
+package policy
+
+values: {
+	image?: pullPolicy?: "IfNotPresent" | "Always"
+	...
+}
+`
+	bundleCue := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name:       "podinfo"
+	instances: {
+		podinfo: {
+			module: url:     "oci://ghcr.io/stefanprodan/modules/podinfo"
+			module: version: "latest"
+			namespace: "podinfo"
+			values: image: pullPolicy: "%s"
+		}
+	}
+}
+`
+	policyDir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(policyDir, "policy.cue"), []byte(policyCue), 0644)).ToNot(HaveOccurred())
+
+	policyRepo := fmt.Sprintf("oci://%s/%s", dockerRegistry, rnd("policy", 5))
+	_, err := executeCommand(fmt.Sprintf("artifact push %s -f %s -t v1 --content-type generic", policyRepo, policyDir))
+	g.Expect(err).ToNot(HaveOccurred())
+	policyURL := policyRepo + ":v1"
+
+	wd := t.TempDir()
+	bundlePath := filepath.Join(wd, "bundle.cue")
+
+	t.Run("accepts allowed values", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(os.WriteFile(bundlePath, []byte(fmt.Sprintf(bundleCue, "Always")), 0644)).ToNot(HaveOccurred())
+
+		output, err := executeCommand(fmt.Sprintf("bundle vet -f %s --policy %s", bundlePath, policyURL))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("bundle is valid"))
+	})
+
+	t.Run("rejects disallowed values", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(os.WriteFile(bundlePath, []byte(fmt.Sprintf(bundleCue, "Never")), 0644)).ToNot(HaveOccurred())
+
+		_, err := executeCommand(fmt.Sprintf("bundle vet -f %s --policy %s", bundlePath, policyURL))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("instance podinfo values violate policy"))
+		g.Expect(err.Error()).To(ContainSubstring("image.pullPolicy"))
+	})
+}
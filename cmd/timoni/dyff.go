@@ -31,6 +31,8 @@ import (
 	"sigs.k8s.io/yaml"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/runtime"
 )
 
 // DyffPrinter is a printer that prints dyff reports.
@@ -83,20 +85,85 @@ func diffYAML(liveFile, mergedFile string, output io.Writer) error {
 	return printer.Print(output, report)
 }
 
+const (
+	dryRunPhaseHook  = "hook"
+	dryRunPhaseApply = "apply"
+	dryRunPhasePrune = "prune"
+)
+
+// dryRunEntry is an object from the dry-run preview labeled
+// with the phase of the operation it belongs to.
+type dryRunEntry struct {
+	Phase  string
+	Object *unstructured.Unstructured
+}
+
+// newDryRunPlan aggregates the objects of all apply sets, the hooks and the objects
+// subject to pruning, in the order they would be processed by apply.
+// The hooks are placed by their timoni.sh/hook annotation, regardless of the
+// name of the apply set they are defined in, while the other objects are
+// listed in the order of their apply sets.
+func newDryRunPlan(sets []engine.ResourceSet, staleObjects []*unstructured.Unstructured) ([]dryRunEntry, error) {
+	var plan []dryRunEntry
+	add := func(phase string, objects []*unstructured.Unstructured) {
+		sorted := make([]*unstructured.Unstructured, len(objects))
+		copy(sorted, objects)
+		sort.Sort(ssa.SortableUnstructureds(sorted))
+		for _, r := range sorted {
+			plan = append(plan, dryRunEntry{
+				Phase:  phase,
+				Object: r,
+			})
+		}
+	}
+
+	var hooks runtime.Hooks
+	var mainSets []engine.ResourceSet
+	for _, set := range sets {
+		setObjects, setHooks, err := runtime.SplitHooks(set.Objects)
+		if err != nil {
+			return nil, err
+		}
+		hooks.Add(setHooks)
+		mainSets = append(mainSets, engine.ResourceSet{Name: set.Name, Objects: setObjects})
+	}
+
+	add(fmt.Sprintf("%s/%s", dryRunPhaseHook, apiv1.HookPreApply), hooks.PreApply)
+	for _, set := range mainSets {
+		add(fmt.Sprintf("%s/%s", dryRunPhaseApply, set.Name), set.Objects)
+	}
+	add(fmt.Sprintf("%s/%s", dryRunPhaseHook, apiv1.HookPostApply), hooks.PostApply)
+	add(dryRunPhasePrune, staleObjects)
+
+	return plan, nil
+}
+
 func instanceDryRunDiff(ctx context.Context,
 	rm *ssa.ResourceManager,
-	objects []*unstructured.Unstructured,
+	sets []engine.ResourceSet,
 	staleObjects []*unstructured.Unstructured,
 	nsExists bool,
 	tmpDir string,
 	withDiff bool) error {
 	log := LoggerFrom(ctx)
 	diffOpts := ssa.DefaultDiffOptions()
-	sort.Sort(ssa.SortableUnstructureds(objects))
 
-	for _, r := range objects {
+	plan, err := newDryRunPlan(sets, staleObjects)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range plan {
+		phase := colorizePhase(entry.Phase)
+		r := entry.Object
+
+		if entry.Phase == dryRunPhasePrune {
+			log.Info(colorizeJoin(phase, r, ssa.DeletedAction, dryRunServer))
+			continue
+		}
+
 		if !nsExists {
-			log.Info(colorizeJoin(r, ssa.CreatedAction, dryRunServer))
+			log.Info(colorizeJoin(phase, r, ssa.CreatedAction, dryRunServer))
 			continue
 		}
 
@@ -106,18 +173,18 @@ func instanceDryRunDiff(ctx context.Context,
 				if ssa.AnyInMetadata(r, map[string]string{
 					apiv1.ForceAction: apiv1.EnabledValue,
 				}) {
-					log.Info(colorizeJoin(r, ssa.CreatedAction, dryRunServer))
+					log.Info(colorizeJoin(phase, r, ssa.CreatedAction, dryRunServer))
 				} else {
-					log.Error(nil, colorizeJoin(r, "immutable", dryRunServer))
+					log.Error(nil, colorizeJoin(phase, r, "immutable", dryRunServer))
 				}
 			} else {
-				log.Error(err, colorizeUnstructured(r))
+				log.Error(err, colorizeJoin(phase, r))
 			}
 
 			continue
 		}
 
-		log.Info(colorizeJoin(change, dryRunServer))
+		log.Info(colorizeJoin(phase, change, dryRunServer))
 		if withDiff && change.Action == ssa.ConfiguredAction {
 			liveYAML, _ := yaml.Marshal(liveObject)
 			liveFile := filepath.Join(tmpDir, "live.yaml")
@@ -137,9 +204,5 @@ func instanceDryRunDiff(ctx context.Context,
 		}
 	}
 
-	for _, r := range staleObjects {
-		log.Info(colorizeJoin(r, ssa.DeletedAction, dryRunServer))
-	}
-
 	return nil
 }
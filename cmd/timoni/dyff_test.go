@@ -22,6 +22,10 @@ import (
 	"testing"
 
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
 )
 
 func TestDiffYAML(t *testing.T) {
@@ -46,3 +50,63 @@ func TestDiffYAML(t *testing.T) {
 	g.Expect(err).ToNot(HaveOccurred())
 	g.Expect(buf.String()).To(ContainSubstring("name: test-pod-merged"))
 }
+
+func TestNewDryRunPlan(t *testing.T) {
+	g := NewWithT(t)
+
+	newObject := func(apiVersion, kind, name string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetName(name)
+		u.SetNamespace("default")
+		return u
+	}
+
+	migrate := newObject("batch/v1", "Job", "migrate")
+	migrate.SetAnnotations(map[string]string{apiv1.HookAnnotation: apiv1.HookPreApply})
+	smoke := newObject("batch/v1", "Job", "smoke")
+	smoke.SetAnnotations(map[string]string{apiv1.HookAnnotation: apiv1.HookPostApply})
+
+	sets := []engine.ResourceSet{
+		{
+			Name:    "pre-apply",
+			Objects: []*unstructured.Unstructured{newObject("v1", "ServiceAccount", "app")},
+		},
+		{
+			Name:    "app",
+			Objects: []*unstructured.Unstructured{smoke, newObject("v1", "ConfigMap", "app"), migrate},
+		},
+	}
+	stale := []*unstructured.Unstructured{newObject("v1", "Secret", "old")}
+
+	plan, err := newDryRunPlan(sets, stale)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(plan).To(HaveLen(5))
+
+	g.Expect(plan[0].Phase).To(Equal("hook/pre-apply"))
+	g.Expect(plan[0].Object.GetName()).To(Equal("migrate"))
+
+	g.Expect(plan[1].Phase).To(Equal("apply/pre-apply"))
+	g.Expect(plan[1].Object.GetKind()).To(Equal("ServiceAccount"))
+
+	g.Expect(plan[2].Phase).To(Equal("apply/app"))
+	g.Expect(plan[2].Object.GetKind()).To(Equal("ConfigMap"))
+
+	g.Expect(plan[3].Phase).To(Equal("hook/post-apply"))
+	g.Expect(plan[3].Object.GetName()).To(Equal("smoke"))
+
+	g.Expect(plan[4].Phase).To(Equal("prune"))
+	g.Expect(plan[4].Object.GetName()).To(Equal("old"))
+
+	t.Run("rejects invalid hook phases", func(t *testing.T) {
+		g := NewWithT(t)
+
+		invalid := newObject("batch/v1", "Job", "invalid")
+		invalid.SetAnnotations(map[string]string{apiv1.HookAnnotation: "pre-delete"})
+
+		_, err := newDryRunPlan([]engine.ResourceSet{{Name: "app", Objects: []*unstructured.Unstructured{invalid}}}, nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("pre-delete"))
+	})
+}
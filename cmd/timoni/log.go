@@ -50,7 +50,10 @@ func NewConsoleLogger() logr.Logger {
 		}
 	}
 
-	zlog := zerolog.New(zconfig).With().Timestamp().Logger()
+	zlog := zerolog.New(zconfig).With().Timestamp().Logger().Level(zerolog.InfoLevel)
+	if rootArgs.verbose {
+		zlog = zlog.Level(zerolog.DebugLevel)
+	}
 
 	// Discard the container registry client logger.
 	gcrLog.Warn.SetOutput(io.Discard)
@@ -174,6 +177,10 @@ func colorizeDryRun(dryRun dryRunType) string {
 	return colorDryRun.Sprint(string(dryRun))
 }
 
+func colorizePhase(phase string) string {
+	return colorCallerPrefix.Sprint("[" + phase + "]")
+}
+
 func colorizeError(err error) string {
 	return colorError.Sprint(err.Error())
 }
@@ -281,6 +288,15 @@ func LoggerFrom(ctx context.Context, keysAndValues ...interface{}) logr.Logger {
 	return newLogger.WithValues(keysAndValues...)
 }
 
+// engineLogger returns the logger passed to the bundle and module builders,
+// the engine logs are discarded unless the verbose flag is set.
+func engineLogger(log logr.Logger) logr.Logger {
+	if !rootArgs.verbose {
+		return logr.Discard()
+	}
+	return log
+}
+
 // StartSpinner starts a spinner with the given message.
 func StartSpinner(msg string) *spinner.Spinner {
 	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
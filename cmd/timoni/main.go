@@ -29,6 +29,9 @@ import (
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/stefanprodan/timoni/internal/flags"
+	"github.com/stefanprodan/timoni/internal/oci"
 )
 
 var (
@@ -57,11 +60,15 @@ var rootCmd = &cobra.Command{
 }
 
 type rootFlags struct {
-	timeout          time.Duration
-	prettyLog        bool
-	coloredLog       bool
-	cacheDir         string
-	registryInsecure bool
+	timeout            time.Duration
+	prettyLog          bool
+	coloredLog         bool
+	verbose            bool
+	cacheDir           string
+	registryInsecure   bool
+	registryRetries    int
+	registryRetryDelay time.Duration
+	registryMirrors    flags.RegistryMirrors
 }
 
 var (
@@ -69,6 +76,9 @@ var (
 		prettyLog:  true,
 		coloredLog: !color.NoColor,
 		timeout:    5 * time.Minute,
+
+		registryRetries:    oci.DefaultRetryOptions().Attempts,
+		registryRetryDelay: oci.DefaultRetryOptions().Delay,
 	}
 	logger         logr.Logger
 	kubeconfigArgs = genericclioptions.NewConfigFlags(false)
@@ -81,10 +91,17 @@ func init() {
 		"Adds timestamps to the logs.")
 	rootCmd.PersistentFlags().BoolVar(&rootArgs.coloredLog, "log-color", rootArgs.coloredLog,
 		"Adds colorized output to the logs. (defaults to false when no tty)")
+	rootCmd.PersistentFlags().BoolVar(&rootArgs.verbose, "verbose", false,
+		"Prints the debug logs of the build and apply phases.")
 	rootCmd.PersistentFlags().StringVar(&rootArgs.cacheDir, "cache-dir", "",
 		"Artifacts cache dir, can be disable with 'TIMONI_CACHING=false' env var. (defaults to \"$HOME/.timoni/cache\")")
 	rootCmd.PersistentFlags().BoolVar(&rootArgs.registryInsecure, "registry-insecure", false,
 		"If true, allows connecting to a container registry without TLS or with a self-signed certificate.")
+	rootCmd.PersistentFlags().IntVar(&rootArgs.registryRetries, "registry-retries", rootArgs.registryRetries,
+		"The maximum number of attempts for pulling a module when the container registry returns a transient error, such as 429 or 503.")
+	rootCmd.PersistentFlags().DurationVar(&rootArgs.registryRetryDelay, "registry-retry-delay", rootArgs.registryRetryDelay,
+		"The wait time before retrying a failed module pull, doubled after each attempt.")
+	rootCmd.PersistentFlags().Var(&rootArgs.registryMirrors, "registry-mirror", rootArgs.registryMirrors.Description())
 
 	addKubeConfigFlags(rootCmd)
 
@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -116,8 +117,25 @@ func executeCommandWithIn(cmd string, in io.Reader) (string, error) {
 	return result, err
 }
 
+// jsonFromOutput strips the log lines written before the JSON document
+// in the output captured by executeCommand.
+func jsonFromOutput(output string) string {
+	for _, prefix := range []string{"{", "["} {
+		if strings.HasPrefix(output, prefix) {
+			return output
+		}
+		if i := strings.Index(output, "\n"+prefix); i >= 0 {
+			return output[i+1:]
+		}
+	}
+	return output
+}
+
 func resetCmdArgs() {
-	applyArgs = applyFlags{}
+	rootArgs.registryMirrors = nil
+	applyArgs = applyFlags{
+		forceConflicts: true,
+	}
 	buildArgs = buildFlags{}
 	deleteArgs = deleteFlags{}
 	statusArgs = statusFlags{}
@@ -127,14 +145,40 @@ func resetCmdArgs() {
 	vetModArgs = vetModFlags{
 		name: "default",
 	}
+	valueGraphModArgs = valueGraphModFlags{
+		name:   "default",
+		output: "dot",
+	}
+	valuesShowModArgs = valuesShowModFlags{
+		output: "yaml",
+	}
 	listArgs = listFlags{}
 	pullModArgs = pullModFlags{}
 	pushModArgs = pushModFlags{}
 	bundleArgs = bundleFlags{}
-	bundleApplyArgs = bundleApplyFlags{}
+	bundleApplyArgs = bundleApplyFlags{
+		forceConflicts:  true,
+		createNamespace: true,
+		applyRetryDelay: defaultApplyRetryDelay,
+	}
+	bundleRollbackArgs = bundleRollbackFlags{}
 	bundleVetArgs = bundleVetFlags{}
+	bundleListArgs = bundleListFlags{}
 	bundleDelArgs = bundleDelFlags{}
-	bundleBuildArgs = bundleBuildFlags{}
+	bundleBuildArgs = bundleBuildFlags{
+		output: "yaml",
+	}
+	bundleImagesArgs = bundleImagesFlags{}
+	bundleInspectArgs = bundleInspectFlags{}
+	bundleGraphArgs = bundleGraphFlags{}
+	bundleValuesArgs = bundleValuesFlags{
+		output: "cue",
+	}
+	bundleDiffArgs = bundleDiffFlags{}
+	bundleExportArgs = bundleExportFlags{
+		format:   exportFormatFlux,
+		interval: 10 * time.Minute,
+	}
 	vendorCrdArgs = vendorCrdFlags{}
 	vendorK8sArgs = vendorK8sFlags{}
 	pushArtifactArgs = pushArtifactFlags{}
@@ -22,21 +22,27 @@ import (
 
 	"github.com/spf13/cobra"
 
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 	"github.com/stefanprodan/timoni/internal/flags"
 	"github.com/stefanprodan/timoni/internal/oci"
 )
 
 var listModCmd = &cobra.Command{
 	Use:     "list [MODULE URL]",
-	Aliases: []string{"ls"},
+	Aliases: []string{"ls", "list-versions"},
 	Short:   "List the versions of a module",
-	Long:    `The list command prints a table with the module versions and their digests.`,
+	Long: `The list command prints a table with the module versions and their digests,
+ordered by semver from the newest to the oldest version.
+The tags which are not valid semver versions are listed separately when --all is set.`,
 	Example: `  # Print the versions and digests of a module
   timoni mod list oci://docker.io/org/app 
 
   # Print the versions without digests
   timoni mod list oci://docker.io/org/app --with-digest=false
 
+  # Print the versions and the other tags of a module, e.g. branch names
+  timoni mod list-versions oci://docker.io/org/app --all
+
   # Print the versions of a module from GitHub Container Registry
   timoni mod list oci://ghcr.io/org/manifests/app \
 	--creds timoni:$GITHUB_TOKEN
@@ -47,6 +53,7 @@ var listModCmd = &cobra.Command{
 type listModFlags struct {
 	creds      flags.Credentials
 	withDigest bool
+	all        bool
 }
 
 var listModArgs listModFlags
@@ -55,6 +62,8 @@ func init() {
 	listModCmd.Flags().Var(&listModArgs.creds, listModArgs.creds.Type(), listModArgs.creds.Description())
 	listModCmd.Flags().BoolVar(&listModArgs.withDigest, "with-digest", true,
 		"Resolve the digest of each version.")
+	listModCmd.Flags().BoolVar(&listModArgs.all, "all", false,
+		"List the tags which are not valid semver versions after the module versions.")
 	modCmd.AddCommand(listModCmd)
 }
 
@@ -76,6 +85,14 @@ func listModCmdRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	var tags []apiv1.ModuleReference
+	if listModArgs.all {
+		tags, err = oci.ListModuleTags(ociURL, listModArgs.withDigest, opts)
+		if err != nil {
+			return err
+		}
+	}
+
 	spin.Stop()
 	var rows [][]string
 	for _, v := range list {
@@ -88,5 +105,14 @@ func listModCmdRun(cmd *cobra.Command, args []string) error {
 
 	printTable(rootCmd.OutOrStdout(), []string{"version", "digest"}, rows)
 
+	if len(tags) > 0 {
+		rows = nil
+		for _, v := range tags {
+			rows = append(rows, []string{v.Version, v.Digest})
+		}
+		fmt.Fprintln(rootCmd.OutOrStdout())
+		printTable(rootCmd.OutOrStdout(), []string{"tag", "digest"}, rows)
+	}
+
 	return nil
 }
@@ -18,6 +18,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -52,3 +53,42 @@ func Test_ListMod(t *testing.T) {
 		g.Expect(output).To(ContainSubstring(v))
 	}
 }
+
+func Test_ListMod_All(t *testing.T) {
+	g := NewWithT(t)
+	modPath := "testdata/module"
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, rnd("my-mod", 5))
+
+	for _, v := range []string{"1.0.0", "1.10.0", "1.2.0"} {
+		_, err := executeCommand(fmt.Sprintf(
+			"mod push %s oci://%s -v %s",
+			modPath,
+			modURL,
+			v,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	_, err := executeCommand(fmt.Sprintf(
+		"artifact tag oci://%s:1.10.0 -t main",
+		modURL,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	output, err := executeCommand(fmt.Sprintf(
+		"mod list-versions oci://%s --with-digest=false",
+		modURL,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(output).ToNot(ContainSubstring("main"))
+	g.Expect(strings.Index(output, "1.10.0")).To(BeNumerically("<", strings.Index(output, "1.2.0")))
+	g.Expect(strings.Index(output, "1.2.0")).To(BeNumerically("<", strings.Index(output, "1.0.0")))
+
+	output, err = executeCommand(fmt.Sprintf(
+		"mod list-versions oci://%s --with-digest=false --all",
+		modURL,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(output).To(ContainSubstring("TAG"))
+	g.Expect(strings.Index(output, "1.0.0")).To(BeNumerically("<", strings.Index(output, "main")))
+}
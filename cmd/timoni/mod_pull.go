@@ -124,25 +124,37 @@ func pullCmdRun(cmd *cobra.Command, args []string) error {
 
 	log := LoggerFrom(cmd.Context())
 
+	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	opts := oci.Options(ctx, pullModArgs.creds.String(), rootArgs.registryInsecure)
+
 	if pullModArgs.verify != "" {
-		err := oci.VerifyArtifact(log,
-			pullModArgs.verify,
-			ociURL,
-			pullModArgs.cosignKey,
-			pullModArgs.certificateIdentity,
-			pullModArgs.certificateIdentityRegexp,
-			pullModArgs.certificateOidcIssuer,
-			pullModArgs.certificateOidcIssuerRegexp)
+		if pullModArgs.verify != "cosign" {
+			return fmt.Errorf("verifier not supported: %s", pullModArgs.verify)
+		}
+
+		verify := oci.VerifyOptions{
+			Key:              pullModArgs.cosignKey,
+			Identity:         pullModArgs.certificateIdentity,
+			IdentityRegexp:   pullModArgs.certificateIdentityRegexp,
+			OIDCIssuer:       pullModArgs.certificateOidcIssuer,
+			OIDCIssuerRegexp: pullModArgs.certificateOidcIssuerRegexp,
+		}
+		digest, err := oci.VerifyModule(log, ociURL, verify, opts)
+		if err != nil {
+			return fmt.Errorf("verifying module signature failed: %w", err)
+		}
+		log.Info(fmt.Sprintf("verified signature of %s", colorizeSubject(ociURL)))
+
+		// Pull the verified artifact by digest, in case the tag was moved after the verification.
+		ociURL, err = oci.PinDigest(ociURL, digest)
 		if err != nil {
 			return err
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
-	defer cancel()
-
 	spin := StartSpinner(fmt.Sprintf("pulling %s", ociURL))
-	opts := oci.Options(ctx, pullModArgs.creds.String(), rootArgs.registryInsecure)
 	err := oci.PullArtifact(ociURL, pullModArgs.output, apiv1.AnyContentType, opts)
 	spin.Stop()
 	if err != nil {
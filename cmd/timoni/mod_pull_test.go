@@ -24,6 +24,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/crane"
 	. "github.com/onsi/gomega"
 )
 
@@ -74,3 +75,68 @@ func Test_PullMod(t *testing.T) {
 	})
 	g.Expect(fsErr).ToNot(HaveOccurred())
 }
+
+func Test_PullMod_Verify(t *testing.T) {
+	g := NewWithT(t)
+	modPath := "testdata/module"
+	modURL := fmt.Sprintf("%s/%s", dockerRegistry, rnd("my-mod", 5))
+	modVer := "1.0.0"
+
+	_, err := executeCommand(fmt.Sprintf(
+		"mod push %s oci://%s -v %s",
+		modPath,
+		modURL,
+		modVer,
+	))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	digest, err := crane.Digest(fmt.Sprintf("%s:%s", modURL, modVer))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// fakeCosign writes a cosign executable to PATH that records
+	// the verified reference and exits with the given code.
+	binDir := t.TempDir()
+	argsFile := filepath.Join(binDir, "cosign-args")
+	fakeCosign := func(g *WithT, code int) {
+		content := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\nexit %d\n", argsFile, code)
+		g.Expect(os.WriteFile(filepath.Join(binDir, "cosign"), []byte(content), 0755)).To(Succeed())
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	t.Run("pulls the verified digest", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeCosign(g, 0)
+
+		tmpDir := t.TempDir()
+		_, err := executeCommand(fmt.Sprintf(
+			"mod pull oci://%s -v %s -o %s --verify cosign --cosign-key cosign.pub",
+			modURL,
+			modVer,
+			tmpDir,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		args, err := os.ReadFile(argsFile)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(args)).To(Equal(fmt.Sprintf("verify --key cosign.pub %s@%s\n", modURL, digest)))
+		g.Expect(filepath.Join(tmpDir, "timoni.cue")).To(BeAnExistingFile())
+	})
+
+	t.Run("fails for invalid signature", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeCosign(g, 1)
+
+		tmpDir := t.TempDir()
+		_, err := executeCommand(fmt.Sprintf(
+			"mod pull oci://%s -v %s -o %s --verify cosign --cosign-key cosign.pub",
+			modURL,
+			modVer,
+			tmpDir,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("verifying module signature failed"))
+
+		_, err = os.Stat(filepath.Join(tmpDir, "timoni.cue"))
+		g.Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+}
@@ -98,6 +98,8 @@ func runConfigShowModCmd(cmd *cobra.Command, args []string) error {
 		"",
 		rootArgs.registryInsecure,
 	)
+	fetcher.SetRetry(rootArgs.registryRetries, rootArgs.registryRetryDelay)
+	fetcher.SetMirrors(rootArgs.registryMirrors)
 	mod, err := fetcher.Fetch()
 	if err != nil {
 		return err
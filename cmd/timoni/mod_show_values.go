@@ -0,0 +1,204 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/flags"
+)
+
+var valuesShowModCmd = &cobra.Command{
+	Use:   "values [MODULE PATH]",
+	Short: "Output the values schema of a local module",
+	Long: `The values command parses the local module and outputs the values that can be set
+by the instance consumers, with their types, defaults and whether they are required.
+With --examples, the command lists the example values files shipped in the module's
+examples directory, that can be used as a starting point with 'timoni build --example'.`,
+	Example: `  # print the values schema of a module in the current directory
+  timoni mod show values
+
+  # print the values schema of a module package as commented CUE
+  timoni mod show values ./my-module -p main -o cue
+
+  # list the example values files of a module
+  timoni mod show values ./my-module --examples
+`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runValuesShowModCmd,
+}
+
+type valuesShowModFlags struct {
+	path     string
+	pkg      flags.Package
+	output   string
+	examples bool
+}
+
+var valuesShowModArgs valuesShowModFlags
+
+func init() {
+	valuesShowModCmd.Flags().VarP(&valuesShowModArgs.pkg, valuesShowModArgs.pkg.Type(), valuesShowModArgs.pkg.Shorthand(), valuesShowModArgs.pkg.Description())
+	valuesShowModCmd.Flags().StringVarP(&valuesShowModArgs.output, "output", "o", "yaml",
+		"The format in which the values schema should be printed, can be 'yaml' or 'cue'.")
+	valuesShowModCmd.Flags().BoolVar(&valuesShowModArgs.examples, "examples", false,
+		"List the example values files shipped in the module's examples directory.")
+	showModCmd.AddCommand(valuesShowModCmd)
+}
+
+func runValuesShowModCmd(cmd *cobra.Command, args []string) error {
+	if o := valuesShowModArgs.output; o != "yaml" && o != "cue" {
+		return fmt.Errorf("unknown --output=%s, can be yaml or cue", o)
+	}
+
+	valuesShowModArgs.path = "."
+	if len(args) == 1 {
+		valuesShowModArgs.path = args[0]
+	}
+
+	if fs, err := os.Stat(valuesShowModArgs.path); err != nil || !fs.IsDir() {
+		return fmt.Errorf("module not found at path %s", valuesShowModArgs.path)
+	}
+
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctxPull, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	fetcher := engine.NewFetcher(
+		ctxPull,
+		valuesShowModArgs.path,
+		apiv1.LatestVersion,
+		tmpDir,
+		rootArgs.cacheDir,
+		"",
+		rootArgs.registryInsecure,
+	)
+	fetcher.SetRetry(rootArgs.registryRetries, rootArgs.registryRetryDelay)
+	fetcher.SetMirrors(rootArgs.registryMirrors)
+	if _, err := fetcher.Fetch(); err != nil {
+		return err
+	}
+
+	if valuesShowModArgs.examples {
+		return printModuleExamples(cmd.OutOrStdout(), fetcher.GetModuleRoot())
+	}
+
+	builder := engine.NewModuleBuilder(
+		cuecontext.New(),
+		"module-name",
+		*kubeconfigArgs.Namespace,
+		fetcher.GetModuleRoot(),
+		valuesShowModArgs.pkg.String(),
+	)
+
+	if err := builder.WriteSchemaFile(); err != nil {
+		return err
+	}
+
+	fields, err := builder.GetValuesSchema()
+	if err != nil {
+		return describeErr(fetcher.GetModuleRoot(), "failed to get values schema", err)
+	}
+
+	if valuesShowModArgs.output == "cue" {
+		return writeValuesSchemaCUE(cmd.OutOrStdout(), fields)
+	}
+
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	_, err = cmd.OutOrStdout().Write(data)
+	return err
+}
+
+// printModuleExamples writes the names and paths of the module's example values files as a table.
+func printModuleExamples(w io.Writer, moduleRoot string) error {
+	examples, err := engine.ListModuleExamples(moduleRoot)
+	if err != nil {
+		return err
+	}
+	if len(examples) == 0 {
+		return fmt.Errorf("no examples found in the %s directory of the module", engine.ModuleExamplesDir)
+	}
+
+	var rows [][]string
+	for _, example := range examples {
+		rows = append(rows, []string{example.Name, example.Path})
+	}
+	printTable(w, []string{"name", "path"}, rows)
+	return nil
+}
+
+// writeValuesSchemaCUE writes the values fields as a CUE definition,
+// with the field type and description as comments.
+func writeValuesSchemaCUE(w io.Writer, fields []engine.ValueField) error {
+	var sb strings.Builder
+	sb.WriteString("values: {\n")
+	for i, field := range fields {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		if field.Description != "" {
+			sb.WriteString(fmt.Sprintf("\t// %s\n", field.Description))
+		}
+
+		typ := strings.NewReplacer("struct", "{...}", "list", "[...]").Replace(field.Type)
+		switch {
+		case field.Required:
+			sb.WriteString(fmt.Sprintf("\t// %s, required\n", field.Type))
+		case field.Optional:
+			sb.WriteString(fmt.Sprintf("\t// %s, optional\n", field.Type))
+		default:
+			sb.WriteString(fmt.Sprintf("\t// %s\n", field.Type))
+		}
+
+		label := strings.Join(field.Labels, ": ")
+		switch {
+		case field.Default != nil:
+			def, err := json.Marshal(field.Default)
+			if err != nil {
+				return fmt.Errorf("encoding the default of %s failed: %w", field.Path, err)
+			}
+			sb.WriteString(fmt.Sprintf("\t%s: *%s | %s\n", label, def, typ))
+		case field.Required:
+			sb.WriteString(fmt.Sprintf("\t%s!: %s\n", label, typ))
+		default:
+			sb.WriteString(fmt.Sprintf("\t%s?: %s\n", label, typ))
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
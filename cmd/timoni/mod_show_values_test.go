@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+)
+
+func Test_ShowValues(t *testing.T) {
+	modPath := "testdata/module"
+
+	t.Run("prints the values schema as YAML", func(t *testing.T) {
+		g := NewWithT(t)
+
+		output, err := executeCommand(fmt.Sprintf(
+			"mod show values %s -p main",
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var fields []map[string]any
+		g.Expect(yaml.Unmarshal([]byte(output), &fields)).To(Succeed())
+		g.Expect(fields).To(ContainElement(map[string]any{
+			"path":    "domain",
+			"type":    "string",
+			"default": "example.internal",
+		}))
+		g.Expect(output).ToNot(ContainSubstring("path: moduleVersion"))
+	})
+
+	t.Run("prints the values schema as CUE", func(t *testing.T) {
+		g := NewWithT(t)
+
+		output, err := executeCommand(fmt.Sprintf(
+			"mod show values %s -o cue",
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("\t// string\n\tdomain: *\"example.internal\" | string\n"))
+
+		v := cuecontext.New().CompileString(output)
+		g.Expect(v.Err()).ToNot(HaveOccurred())
+		domain, ok := v.LookupPath(cue.ParsePath("values.domain")).Default()
+		g.Expect(ok).To(BeTrue())
+		g.Expect(domain.String()).To(Equal("example.internal"))
+	})
+
+	t.Run("lists the module examples", func(t *testing.T) {
+		g := NewWithT(t)
+
+		output, err := executeCommand(fmt.Sprintf(
+			"mod show values %s --examples",
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(MatchRegexp(`minimal\s+examples/minimal.cue`))
+		g.Expect(output).To(MatchRegexp(`ns\s+examples/ns.yaml`))
+	})
+
+	t.Run("fails for unknown output format", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := executeCommand(fmt.Sprintf(
+			"mod show values %s -o json",
+			modPath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unknown --output=json"))
+	})
+}
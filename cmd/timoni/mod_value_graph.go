@@ -0,0 +1,185 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/spf13/cobra"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/flags"
+)
+
+var valueGraphModCmd = &cobra.Command{
+	Use:   "value-graph [MODULE PATH]",
+	Short: "Print the graph of values used by the Kubernetes objects of a local module",
+	Long: `The value-graph command builds the local module and traces the CUE references
+of the Kubernetes objects fields back to the module values.
+The graph links each value to the object fields that derive from it.`,
+	Example: `  # Print the value graph in DOT format
+  timoni mod value-graph ./path/to/module | dot -Tsvg > graph.svg
+
+  # Print the value graph in Mermaid format using custom values
+  timoni mod value-graph ./path/to/module \
+  --values ./values.cue \
+  --output mermaid
+`,
+	RunE: runValueGraphModCmd,
+}
+
+type valueGraphModFlags struct {
+	path        string
+	pkg         flags.Package
+	valuesFiles []string
+	name        string
+	output      string
+}
+
+var valueGraphModArgs valueGraphModFlags
+
+func init() {
+	valueGraphModCmd.Flags().StringVar(&valueGraphModArgs.name, "name", "default", "Name of the instance used to build the module")
+	valueGraphModCmd.Flags().VarP(&valueGraphModArgs.pkg, valueGraphModArgs.pkg.Type(), valueGraphModArgs.pkg.Shorthand(), valueGraphModArgs.pkg.Description())
+	valueGraphModCmd.Flags().StringSliceVarP(&valueGraphModArgs.valuesFiles, "values", "f", nil,
+		"The local path to values files (cue, yaml or json format).")
+	valueGraphModCmd.Flags().StringVarP(&valueGraphModArgs.output, "output", "o", "dot",
+		"The format in which the graph should be printed, can be 'dot' or 'mermaid'.")
+	modCmd.AddCommand(valueGraphModCmd)
+}
+
+func runValueGraphModCmd(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		valueGraphModArgs.path = "."
+	} else {
+		valueGraphModArgs.path = args[0]
+	}
+
+	if fs, err := os.Stat(valueGraphModArgs.path); err != nil || !fs.IsDir() {
+		return fmt.Errorf("module not found at path %s", valueGraphModArgs.path)
+	}
+
+	var render func([]engine.ValueEdge) string
+	switch valueGraphModArgs.output {
+	case "dot":
+		render = renderValueGraphDOT
+	case "mermaid":
+		render = renderValueGraphMermaid
+	default:
+		return fmt.Errorf("unknown --output=%s, can be dot or mermaid", valueGraphModArgs.output)
+	}
+
+	tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctxPull, cancel := context.WithTimeout(context.Background(), rootArgs.timeout)
+	defer cancel()
+
+	fetcher := engine.NewFetcher(
+		ctxPull,
+		valueGraphModArgs.path,
+		apiv1.LatestVersion,
+		tmpDir,
+		rootArgs.cacheDir,
+		"",
+		rootArgs.registryInsecure,
+	)
+	fetcher.SetRetry(rootArgs.registryRetries, rootArgs.registryRetryDelay)
+	fetcher.SetMirrors(rootArgs.registryMirrors)
+	if _, err := fetcher.Fetch(); err != nil {
+		return err
+	}
+
+	builder := engine.NewModuleBuilder(
+		cuecontext.New(),
+		valueGraphModArgs.name,
+		*kubeconfigArgs.Namespace,
+		fetcher.GetModuleRoot(),
+		valueGraphModArgs.pkg.String(),
+	)
+
+	if err := builder.WriteSchemaFile(); err != nil {
+		return err
+	}
+
+	if len(valueGraphModArgs.valuesFiles) > 0 {
+		valuesCue, err := convertToCue(cmd, valueGraphModArgs.valuesFiles)
+		if err != nil {
+			return err
+		}
+		err = builder.MergeValuesFile(valuesCue)
+		if err != nil {
+			return err
+		}
+	}
+
+	buildResult, err := builder.Build()
+	if err != nil {
+		return describeErr(fetcher.GetModuleRoot(), "build failed", err)
+	}
+
+	edges, err := builder.GetValueGraph(buildResult)
+	if err != nil {
+		return fmt.Errorf("tracing values failed: %w", err)
+	}
+
+	_, err = cmd.OutOrStdout().Write([]byte(render(edges)))
+	return err
+}
+
+// renderValueGraphDOT renders the edges as a Graphviz digraph.
+func renderValueGraphDOT(edges []engine.ValueEdge) string {
+	var sb strings.Builder
+	sb.WriteString("digraph values {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	for _, e := range edges {
+		sb.WriteString(fmt.Sprintf("  %q -> %q;\n", e.Value, e.Object+":"+e.Field))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// renderValueGraphMermaid renders the edges as a Mermaid flowchart.
+// The node IDs are generated since Mermaid doesn't allow special characters in IDs.
+func renderValueGraphMermaid(edges []engine.ValueEdge) string {
+	ids := make(map[string]string)
+	nodeID := func(label string) string {
+		if id, ok := ids[label]; ok {
+			return id
+		}
+		id := fmt.Sprintf("n%d", len(ids))
+		ids[label] = id
+		return fmt.Sprintf("%s[\"%s\"]", id, strings.ReplaceAll(label, `"`, "#quot;"))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("graph LR\n")
+	for _, e := range edges {
+		from := nodeID(e.Value)
+		to := nodeID(e.Object + ":" + e.Field)
+		sb.WriteString(fmt.Sprintf("  %s --> %s\n", from, to))
+	}
+	return sb.String()
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestModValueGraph(t *testing.T) {
+	modPath := "testdata/module"
+
+	t.Run("prints graph in DOT format", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"mod value-graph %s -p main -n test --name app",
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(output).To(HavePrefix("digraph values {"))
+		g.Expect(output).To(ContainSubstring(`"values.domain" -> "ConfigMap/test/app-client:data.server";`))
+		g.Expect(output).To(ContainSubstring(`"values.team" -> "ConfigMap/test/app-server:metadata.labels.\"app.kubernetes.io/team\"";`))
+	})
+
+	t.Run("prints graph in Mermaid format", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"mod value-graph %s -p main -n test --name app -o mermaid",
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(output).To(HavePrefix("graph LR\n"))
+		g.Expect(output).To(ContainSubstring(`["values.domain"] --> `))
+		g.Expect(output).To(ContainSubstring(`["ConfigMap/test/app-client:data.server"]`))
+	})
+
+	t.Run("fails with unknown output format", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := executeCommand(fmt.Sprintf(
+			"mod value-graph %s -p main -o svg",
+			modPath,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unknown --output=svg"))
+	})
+}
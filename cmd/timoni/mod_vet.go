@@ -39,12 +39,17 @@ var vetModCmd = &cobra.Command{
 	Use:     "vet [MODULE PATH]",
 	Aliases: []string{"lint"},
 	Short:   "Validate a local module",
-	Long:    `The vet command builds the local module and validates the resulting Kubernetes objects.`,
+	Long: `The vet command builds the local module and validates the resulting Kubernetes objects.
+With --schema-only, the module is loaded without building the Kubernetes objects,
+and the config values that have no defaults are reported.`,
 	Example: `  # validate module using default values
   timoni mod vet
 
   # validate module using debug values
   timoni mod vet ./path/to/module --debug
+
+  # validate the module schema without building the objects
+  timoni mod vet ./path/to/module --schema-only
 `,
 	RunE: runVetModCmd,
 }
@@ -55,6 +60,7 @@ type vetModFlags struct {
 	debug       bool
 	valuesFiles []string
 	name        string
+	schemaOnly  bool
 }
 
 var vetModArgs vetModFlags
@@ -66,6 +72,8 @@ func init() {
 		"Use debug_values.cue if found in the module root instead of the default values.")
 	vetModCmd.Flags().StringSliceVarP(&vetModArgs.valuesFiles, "values", "f", nil,
 		"The local path to values files (cue, yaml or json format).")
+	vetModCmd.Flags().BoolVar(&vetModArgs.schemaOnly, "schema-only", false,
+		"Validate the module schema and report the values without defaults, without building the Kubernetes objects.")
 	modCmd.AddCommand(vetModCmd)
 }
 
@@ -101,6 +109,8 @@ func runVetModCmd(cmd *cobra.Command, args []string) error {
 		"",
 		rootArgs.registryInsecure,
 	)
+	fetcher.SetRetry(rootArgs.registryRetries, rootArgs.registryRetryDelay)
+	fetcher.SetMirrors(rootArgs.registryMirrors)
 	mod, err := fetcher.Fetch()
 	if err != nil {
 		return err
@@ -129,6 +139,7 @@ func runVetModCmd(cmd *cobra.Command, args []string) error {
 		fetcher.GetModuleRoot(),
 		vetModArgs.pkg.String(),
 	)
+	builder.SetTimoniVersion(VERSION)
 
 	if err := builder.WriteSchemaFile(); err != nil {
 		return err
@@ -150,6 +161,22 @@ func runVetModCmd(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if vetModArgs.schemaOnly {
+		missing, err := builder.VetSchema(tags...)
+		if err != nil {
+			return describeErr(fetcher.GetModuleRoot(), "validation failed", err)
+		}
+
+		for _, p := range missing {
+			log.Info(fmt.Sprintf("%s %s",
+				colorizeSubject(p), colorizeWarning("no default value")))
+		}
+
+		log.Info(fmt.Sprintf("%s %s",
+			colorizeSubject(mod.Name), colorizeInfo("valid module")))
+		return nil
+	}
+
 	buildResult, err := builder.Build(tags...)
 	if err != nil {
 		return describeErr(fetcher.GetModuleRoot(), "validation failed", err)
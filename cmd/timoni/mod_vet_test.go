@@ -18,9 +18,12 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/gomega"
+	cp "github.com/otiai10/copy"
 )
 
 func TestModVet(t *testing.T) {
@@ -159,3 +162,51 @@ func TestModVetSetNamespaceName(t *testing.T) {
 		g.Expect(err.Error()).To(ContainSubstring("cannot find package"))
 	})
 }
+
+func TestModVetSchemaOnly(t *testing.T) {
+	modPath := "testdata/module"
+
+	newModule := func(g *WithT, extra string) string {
+		moduleRoot := filepath.Join(t.TempDir(), "module")
+		g.Expect(cp.Copy(modPath, moduleRoot)).To(Succeed())
+		extraFile := filepath.Join(moduleRoot, "templates", "extra.cue")
+		g.Expect(os.WriteFile(extraFile, []byte(extra), 0644)).To(Succeed())
+		return moduleRoot
+	}
+
+	t.Run("vets module schema", func(t *testing.T) {
+		g := NewWithT(t)
+		output, err := executeCommand(fmt.Sprintf(
+			"mod vet %s -p main --schema-only",
+			modPath,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		g.Expect(output).To(ContainSubstring("timoni.sh/test valid"))
+		g.Expect(output).ToNot(ContainSubstring("no default value"))
+		g.Expect(output).ToNot(ContainSubstring("ConfigMap"))
+	})
+
+	t.Run("reports values without defaults", func(t *testing.T) {
+		g := NewWithT(t)
+		moduleRoot := newModule(g, "package templates\n#Config: replicas: int\n")
+		output, err := executeCommand(fmt.Sprintf(
+			"mod vet %s -p main --schema-only",
+			moduleRoot,
+		))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(output).To(ContainSubstring("values.replicas no default value"))
+	})
+
+	t.Run("fails with file positions", func(t *testing.T) {
+		g := NewWithT(t)
+		moduleRoot := newModule(g, "package templates\n#Config: replicas: _unknown\n")
+		_, err := executeCommand(fmt.Sprintf(
+			"mod vet %s -p main --schema-only",
+			moduleRoot,
+		))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(`reference "_unknown" not found`))
+		g.Expect(err.Error()).To(ContainSubstring("extra.cue:2"))
+	})
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+	"github.com/stefanprodan/timoni/internal/engine"
+	"github.com/stefanprodan/timoni/internal/oci"
+)
+
+// validateKyvernoPolicies evaluates the objects against the Kyverno policies found in dir
+// and logs the violations. When enforce is set, the violations of the rules with
+// the Enforce validation failure action result in an error, while the violations
+// of the Audit rules are reported as warnings.
+func validateKyvernoPolicies(log logr.Logger, dir string, enforce bool, objects []*unstructured.Unstructured) error {
+	policies, err := engine.LoadKyvernoPolicies(dir)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	violations, err := engine.ValidateKyvernoPolicies(policies, objects)
+	if err != nil {
+		return err
+	}
+	for _, v := range violations {
+		msg := fmt.Sprintf("policy %s rule %s: %s", v.Policy, v.Rule, v.Message)
+		if enforce && v.Enforce {
+			failed++
+			log.Error(errors.New(msg), colorizeSubject(v.Object))
+		} else {
+			log.Info(colorizeJoin(colorizeSubject(v.Object), colorizeWarning("warning"), msg))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d policy violation(s) found", failed)
+	}
+	return nil
+}
+
+// pullValuesPolicy pulls the CUE schema artifact from the OCI URL and loads
+// the policy that the bundle instance values are validated against.
+func pullValuesPolicy(ctx context.Context, cuectx *cue.Context, ociURL, creds string) (*engine.ValuesPolicy, error) {
+	if !strings.HasPrefix(ociURL, apiv1.ArtifactPrefix) {
+		return nil, fmt.Errorf("invalid policy URL '%s', must start with %s", ociURL, apiv1.ArtifactPrefix)
+	}
+
+	dstDir, err := os.MkdirTemp("", apiv1.FieldManager)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dstDir)
+
+	spin := StartSpinner(fmt.Sprintf("pulling %s", ociURL))
+	opts := oci.Options(ctx, creds, rootArgs.registryInsecure)
+	err = oci.PullArtifact(oci.RewriteURL(ociURL, rootArgs.registryMirrors), dstDir, apiv1.AnyContentType, opts)
+	spin.Stop()
+	if err != nil {
+		return nil, fmt.Errorf("pulling policy failed: %w", err)
+	}
+
+	return engine.LoadValuesPolicy(cuectx, dstDir)
+}
+
+// validateValuesPolicy validates the values of the bundle instances against the policy,
+// the violations are reported with the positions of the offending fields.
+func validateValuesPolicy(policy *engine.ValuesPolicy, bundle *engine.Bundle, workspace string) error {
+	for _, instance := range bundle.Instances {
+		if err := policy.Validate(instance.Values); err != nil {
+			return describeErr(workspace, fmt.Sprintf("instance %s values violate policy", instance.Name), err)
+		}
+	}
+	return nil
+}
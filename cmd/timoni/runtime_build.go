@@ -64,20 +64,11 @@ func runRuntimeBuildCmd(cmd *cobra.Command, args []string) error {
 	if len(files) == 0 {
 		return errors.New("no runtime provided with -f")
 	}
-	var stdinFile string
-	for i, file := range files {
-		if file == "-" {
-			stdinFile, err := saveReaderToFile(cmd.InOrStdin())
-			if err != nil {
-				return err
-			}
-			files[i] = stdinFile
-			break
-		}
-	}
-	if stdinFile != "" {
-		defer os.Remove(stdinFile)
+	files, removeStdinFile, err := saveStdinToFile(cmd.InOrStdin(), files)
+	if err != nil {
+		return err
 	}
+	defer removeStdinFile()
 
 	rt, err := buildRuntime(files)
 	if err != nil {
@@ -0,0 +1,4 @@
+values: {
+	domain: "minimal.internal"
+	client: enabled: false
+}
@@ -17,31 +17,117 @@ limitations under the License.
 package engine
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/format"
 	"cuelang.org/go/cue/load"
 	"cuelang.org/go/cue/parser"
 	"cuelang.org/go/encoding/json"
 	"cuelang.org/go/encoding/yaml"
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-logr/logr"
+	cp "github.com/otiai10/copy"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 )
 
+// bundleSchemas holds the CUE schemas of the supported bundle API versions.
+var bundleSchemas = map[string]string{
+	apiv1.GroupVersion.Version: apiv1.BundleSchema,
+}
+
+// SupportedBundleAPIVersions returns the sorted list of the supported bundle API versions.
+func SupportedBundleAPIVersions() []string {
+	versions := make([]string, 0, len(bundleSchemas))
+	for v := range bundleSchemas {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
 // BundleBuilder compiles CUE definitions to Go Bundle objects.
 type BundleBuilder struct {
 	ctx      *cue.Context
 	files    []string
 	injector *RuntimeInjector
+	cacheDir string
+	observer Observer
+	log      logr.Logger
+
+	// moduleRoot is the directory containing the cue.mod
+	// from which the bundle CUE imports are resolved.
+	moduleRoot string
+	workspace  string
+
+	// overlays are the files unified on top of the bundle files,
+	// with the instance values overriding the values from the bundle.
+	overlays []string
+	schema   string
+
+	// warnings are the issues found in the bundle files that don't fail the build.
+	warnings []string
+
+	// envFile is the path to a .env file with runtime values,
+	// which are overridden by the values passed to InitWorkspace.
+	envFile string
+
+	// templates enables the rendering of the files marked with '.tmpl'
+	// using Go text/template, with templateValues exposed as '.Values'.
+	templates      bool
+	templateValues map[string]any
+
+	// bundlePath is the CUE path at which the bundle is defined,
+	// when empty the bundle is looked up at the top-level 'bundle' field.
+	bundlePath string
+
+	// strict rejects the regular top-level fields other than the bundle,
+	// e.g. a misspelled 'bundel' field.
+	strict bool
+
+	// renderer renders the objects of the instances iterated by ForEachInstance,
+	// which belong to the bundle returned by the last GetBundle call.
+	renderer InstanceRenderer
+	bundle   *Bundle
+
+	// decrypted holds the content of the workspace files decrypted in-memory,
+	// which are loaded by the CUE loader without being written to disk.
+	decrypted map[string][]byte
+
+	// external is set when the workspace files contain values injected from
+	// the environment, files or handlers, which are never written to the cache.
+	external bool
+
+	// sources maps the workspace files to the bundle files they were created from.
+	sources map[string]string
+
+	// bundleSources are the bundle and overlay files with the instances they declare.
+	bundleSources []bundleSource
 }
 
 type Bundle struct {
 	Name      string
 	Instances []*BundleInstance
+
+	// CUEVersion is the version of the CUE language used to build the bundle.
+	CUEVersion string
+
+	// Order is the list of namespaces in the order their instances are applied,
+	// after the instances are ordered by their dependencies.
+	Order []string
 }
 
 type BundleInstance struct {
@@ -51,6 +137,109 @@ type BundleInstance struct {
 	Namespace string
 	Module    apiv1.ModuleReference
 	Values    cue.Value
+	DependsOn []string
+
+	// ValuesFrom is the name of the instance whose values
+	// are used as the base for this instance values.
+	ValuesFrom string
+
+	// NamespaceOverridable is false when the instance
+	// opts out of the bundle namespace override.
+	NamespaceOverridable bool
+
+	// SecretRefs are the names of the Secrets referenced by the instance objects,
+	// which must exist in the instance namespace before it is applied.
+	SecretRefs []string
+
+	// Labels are set on the instance storage, and are used
+	// to select the instances of a bundle by label selector.
+	Labels map[string]string
+
+	// Disabled is true when the instance sets 'enabled: false',
+	// and it is excluded from the bundle by GetBundle.
+	Disabled bool
+
+	// Timeout is the duration to wait for the instance objects to be applied
+	// and become ready, zero means the global timeout is used.
+	Timeout time.Duration
+
+	// ApplyRetries is the number of times the apply of the instance objects
+	// is retried on transient errors, nil means the global value is used.
+	ApplyRetries *int
+
+	// DeletePolicy determines which of the instance objects are removed
+	// from the cluster when the instance is deleted.
+	DeletePolicy string
+
+	// WaitFor are the conditions that the instance objects must
+	// meet after they are applied for the instance to be ready.
+	WaitFor []apiv1.WaitCondition
+
+	// NamespaceMetadata holds the labels and annotations
+	// set on the instance namespace when it's created.
+	NamespaceMetadata apiv1.NamespaceMetadata
+
+	// Sensitive are the paths of the values which
+	// are redacted when the instance objects are printed.
+	Sensitive []string
+}
+
+// OverrideNamespace sets the namespace of all the bundle instances to the given value.
+// It returns the names of the instances that opted out of the override.
+func (b *Bundle) OverrideNamespace(namespace string) []string {
+	var skipped []string
+	for _, instance := range b.Instances {
+		if !instance.NamespaceOverridable {
+			skipped = append(skipped, instance.Name)
+			continue
+		}
+		instance.Namespace = namespace
+	}
+	return skipped
+}
+
+// SelectInstances removes from the bundle the instances not in the given list.
+// When withDeps is true, the instances listed in the dependsOn field of the selected
+// instances are kept too, transitively. The order of the instances is preserved.
+// It returns an error listing the available instances if a name is not found.
+func (b *Bundle) SelectInstances(names []string, withDeps bool) error {
+	index := make(map[string]*BundleInstance, len(b.Instances))
+	available := make([]string, 0, len(b.Instances))
+	for _, instance := range b.Instances {
+		index[instance.Name] = instance
+		available = append(available, instance.Name)
+	}
+
+	selected := make(map[string]bool, len(names))
+	var selectInstance func(name string)
+	selectInstance = func(name string) {
+		if selected[name] {
+			return
+		}
+		selected[name] = true
+		if instance, ok := index[name]; ok && withDeps {
+			for _, dep := range instance.DependsOn {
+				selectInstance(dep)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if _, ok := index[name]; !ok {
+			return fmt.Errorf("instance %s not found in bundle %s, available instances: %s",
+				name, b.Name, strings.Join(available, ", "))
+		}
+		selectInstance(name)
+	}
+
+	list := make([]*BundleInstance, 0, len(selected))
+	for _, instance := range b.Instances {
+		if selected[instance.Name] {
+			list = append(list, instance)
+		}
+	}
+	b.Instances = list
+	return nil
 }
 
 // NewBundleBuilder creates a BundleBuilder for the given module and package.
@@ -62,20 +251,151 @@ func NewBundleBuilder(ctx *cue.Context, files []string) *BundleBuilder {
 		ctx:      ctx,
 		files:    files,
 		injector: NewRuntimeInjector(ctx),
+		log:      logr.Discard(),
 	}
 	return b
 }
 
+// SetCacheDir enables the caching of the built bundle values in the specified directory.
+// The cache entries are keyed by the hash of the workspace files, including the bundle schema,
+// and only the most recently used bundleCacheMaxEntries entries are kept.
+func (b *BundleBuilder) SetCacheDir(dir string) {
+	b.cacheDir = dir
+}
+
+// SetObserver sets the observer that records the duration of the build phases.
+// When no observer is set, the phases are not timed.
+func (b *BundleBuilder) SetObserver(observer Observer) {
+	b.observer = observer
+}
+
+// SetLogger sets the logger used to trace the build phases at debug level (V(1))
+// and to report the build results. When no logger is set, the logs are discarded.
+func (b *BundleBuilder) SetLogger(log logr.Logger) {
+	b.log = log
+}
+
+// SetModuleRoot enables the resolution of the CUE imports from the specified directory,
+// which must contain a cue.mod with the module declaration and the vendored packages.
+// The subdirectories of the module root are copied to the workspace with their structure preserved.
+func (b *BundleBuilder) SetModuleRoot(dir string) {
+	b.moduleRoot = dir
+}
+
+// SetOverlays sets the files of an overlay bundle, which is built separately and merged
+// on top of the base bundle files. The instances are matched by name: the overlay values
+// override the base values, while the other instance fields are unified.
+// The instances defined only in the overlay are added to the bundle.
+func (b *BundleBuilder) SetOverlays(files []string) {
+	b.overlays = files
+}
+
+// SetEnvFile sets the path to a .env file from which the runtime values are read.
+// The values passed to InitWorkspace, e.g. from the process environment, take precedence.
+func (b *BundleBuilder) SetEnvFile(file string) {
+	b.envFile = file
+}
+
+// SetLegacyTemplates enables the rendering of the bundle files with the '.tmpl' marker
+// in their name, e.g. 'bundle.tmpl.cue', using Go text/template after the runtime injection.
+// The runtime values are exposed to the templates as '.Env' and the given values as '.Values'.
+// This is a transitional mode for configs that use Go template syntax for substitutions,
+// the files without the marker are not rendered.
+func (b *BundleBuilder) SetLegacyTemplates(enabled bool, values map[string]any) {
+	b.templates = enabled
+	b.templateValues = values
+}
+
+// SetBundlePath sets the CUE path at which the bundle is defined, e.g. 'config.myBundle',
+// for bundles embedded in a larger configuration. The bundle schema is applied at this path,
+// and the bundle fields are looked up relative to it.
+// By default, the bundle is defined at the top-level 'bundle' field.
+func (b *BundleBuilder) SetBundlePath(path string) {
+	b.bundlePath = path
+}
+
+// SetStrict enables the strict mode, in which the build fails if the bundle files
+// contain regular top-level fields other than the bundle. The hidden fields and the
+// definitions, e.g. '_values' and '#Config', are allowed.
+func (b *BundleBuilder) SetStrict(strict bool) {
+	b.strict = strict
+}
+
+// SetInjectorHandlers registers custom handlers for the @timoni() attribute directives
+// found in the bundle files. The handlers are invoked by InitWorkspace, next to the
+// built-in runtime and read handlers.
+func (b *BundleBuilder) SetInjectorHandlers(handlers InjectorHandlers) error {
+	injector, err := NewRuntimeInjectorWithHandlers(b.ctx, handlers)
+	if err != nil {
+		return err
+	}
+	b.injector = injector
+	return nil
+}
+
+// selector returns the CUE path of the given bundle selector relative to the bundle path.
+func (b *BundleBuilder) selector(s apiv1.Selector) string {
+	if b.bundlePath == "" {
+		return s.String()
+	}
+	_, field, _ := strings.Cut(s.String(), ".")
+	return b.bundlePath + "." + field
+}
+
 // InitWorkspace copies the bundle definitions to the specified workspace,
 // sets the bundle schema, and then it injects the runtime values based on @timoni() attributes.
+// The bundle schema is selected based on the apiVersion found in the bundle definitions.
+// The files encrypted with SOPS are decrypted in-memory and are never written to the workspace.
 // A workspace must be initialised before calling Build.
 func (b *BundleBuilder) InitWorkspace(workspace string, runtimeValues map[string]string) error {
-	var files []string
-	for i, file := range b.files {
-		_, fn := filepath.Split(file)
-		content, err := os.ReadFile(file)
+	if b.bundlePath != "" {
+		if err := cue.ParsePath(b.bundlePath).Err(); err != nil {
+			return fmt.Errorf("invalid bundle path %s: %w", b.bundlePath, err)
+		}
+	}
+
+	if b.envFile != "" {
+		vars, err := ReadEnvFile(b.envFile)
 		if err != nil {
-			return fmt.Errorf("failed to read %s: %w", fn, err)
+			return err
+		}
+		maps.Copy(vars, runtimeValues)
+		runtimeValues = vars
+	}
+
+	if b.moduleRoot != "" {
+		b.log.V(1).Info("copying imports", "moduleRoot", b.moduleRoot, "workspace", workspace)
+		if err := b.copyImports(workspace); err != nil {
+			return err
+		}
+	}
+
+	b.warnings = nil
+	b.bundleSources = nil
+	b.external = false
+	var files, overlays []string
+	var injection time.Duration
+	apiVersion := ""
+	for i, file := range append(append([]string{}, b.files...), b.overlays...) {
+		_, fn := filepath.Split(file)
+		overlay := i >= len(b.files)
+
+		var err error
+		// The workspace files of a previous initialisation are read from memory if decrypted.
+		content, decrypted := b.decrypted[file]
+		if !decrypted {
+			content, err = os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", fn, err)
+			}
+		}
+
+		if IsSOPSEncrypted(content) {
+			content, err = DecryptSOPS(fn, content)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", fn, err)
+			}
+			decrypted = true
 		}
 
 		var parsefn func(string, []byte) (ast.Node, error)
@@ -98,72 +418,589 @@ func (b *BundleBuilder) InitWorkspace(workspace string, runtimeValues map[string
 		if err != nil {
 			return fmt.Errorf("failed to parse %s: %w", fn, err)
 		}
+		b.warnings = append(b.warnings, b.injector.ListWarnings(node)...)
+		if b.injector.HasExternalValues(node) {
+			b.external = true
+		}
+
+		// The workspace files of a previous initialisation are mapped to their bundle file.
+		srcFile := file
+		if src, ok := b.sources[file]; ok {
+			srcFile = src
+		}
+
+		// Resolve the relative paths of read attributes against the bundle file location.
+		dir, err := filepath.Abs(filepath.Dir(srcFile))
+		if err != nil {
+			return fmt.Errorf("failed to resolve the path of %s: %w", fn, err)
+		}
+
+		source, err := b.newBundleSource(srcFile, node, dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the path of %s: %w", fn, err)
+		}
+		b.bundleSources = append(b.bundleSources, source)
 
-		data, err := b.injector.Inject(node, runtimeValues)
+		b.log.V(1).Info("injecting runtime values", "file", fn)
+		timer := startPhase(b.observer)
+		data, err := b.injector.InjectFromDir(node, runtimeValues, dir)
 		if err != nil {
 			return fmt.Errorf("failed to inject %s: %w", fn, err)
 		}
+		injection += timer.elapsed()
+
+		if b.templates && isTemplateFile(fn) {
+			b.external = true
+			b.log.V(1).Info("rendering template", "file", fn)
+			data, err = renderTemplate(fn, data, runtimeValues, b.templateValues)
+			if err != nil {
+				return err
+			}
+		}
+
+		if ver := b.lookupAPIVersion(data); ver != "" {
+			if apiVersion != "" && ver != apiVersion {
+				return fmt.Errorf("conflicting bundle API versions %s and %s found in %s", apiVersion, ver, fn)
+			}
+			apiVersion = ver
+		}
 
-		dstFile := filepath.Join(workspace, fmt.Sprintf("%v.%s.cue", i, fn))
-		if err := os.WriteFile(dstFile, data, os.ModePerm); err != nil {
+		dstName := fmt.Sprintf("%v.%s.cue", i, fn)
+		if overlay {
+			dstName = "overlay." + dstName
+		}
+
+		dstFile := filepath.Join(workspace, dstName)
+		if decrypted {
+			if dstFile, err = filepath.Abs(dstFile); err != nil {
+				return fmt.Errorf("failed to resolve the path of %s: %w", fn, err)
+			}
+			if b.decrypted == nil {
+				b.decrypted = make(map[string][]byte)
+			}
+			b.decrypted[dstFile] = data
+		} else if err := os.WriteFile(dstFile, data, os.ModePerm); err != nil {
 			return fmt.Errorf("failed to write %s: %w", fn, err)
 		}
 
-		files = append(files, dstFile)
+		if b.sources == nil {
+			b.sources = make(map[string]string)
+		}
+		if src, ok := b.sources[file]; ok {
+			b.sources[dstFile] = src
+		} else {
+			b.sources[dstFile] = file
+		}
+
+		if overlay {
+			overlays = append(overlays, dstFile)
+		} else {
+			files = append(files, dstFile)
+		}
+	}
+
+	if b.observer != nil {
+		b.observer.ObservePhase(PhaseInjection, injection)
+	}
+
+	if apiVersion == "" {
+		apiVersion = apiv1.GroupVersion.Version
+	}
+
+	schema, ok := bundleSchemas[apiVersion]
+	if !ok {
+		return fmt.Errorf("%s: unsupported bundle API version %s, must be one of: %s",
+			b.selector(apiv1.BundleAPIVersionSelector), apiVersion, strings.Join(SupportedBundleAPIVersions(), ", "))
+	}
+
+	if b.bundlePath != "" {
+		schema = b.relocateSchema(schema)
 	}
 
 	schemaFile := filepath.Join(workspace, fmt.Sprintf("%v.schema.cue", len(b.files)+1))
 	files = append(files, schemaFile)
-	if err := os.WriteFile(schemaFile, []byte(apiv1.BundleSchema), os.ModePerm); err != nil {
+	if err := os.WriteFile(schemaFile, []byte(schema), os.ModePerm); err != nil {
 		return err
 	}
 
 	b.files = files
+	b.overlays = overlays
+	b.schema = schema
+	b.workspace = workspace
+	return nil
+}
+
+// InjectedFile holds the content of a bundle file after the runtime values injection.
+type InjectedFile struct {
+	// Source is the path of the bundle file.
+	Source string
+
+	// Content is the CUE definition generated by the runtime injector.
+	Content []byte
+}
+
+// InjectedFiles returns the bundle and overlay files, in the order they are loaded,
+// with the @timoni() attributes replaced by the runtime values.
+// A workspace must be initialised with InitWorkspace before calling this function.
+func (b *BundleBuilder) InjectedFiles() ([]InjectedFile, error) {
+	if b.workspace == "" {
+		return nil, fmt.Errorf("no workspace found, InitWorkspace must be called before InjectedFiles")
+	}
+
+	var list []InjectedFile
+	for _, file := range append(append([]string{}, b.files...), b.overlays...) {
+		src, ok := b.sources[file]
+		if !ok {
+			// Skip the schema file.
+			continue
+		}
+
+		content, decrypted := b.decrypted[file]
+		if !decrypted {
+			var err error
+			content, err = os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(src), err)
+			}
+		}
+		list = append(list, InjectedFile{Source: src, Content: content})
+	}
+	return list, nil
+}
+
+// copyImports copies the subdirectories of the module root to the workspace,
+// including the cue.mod, so that the imports can be resolved by the CUE loader.
+// The files at the top of the module root are skipped, as the bundle files
+// are copied to the workspace by InitWorkspace.
+func (b *BundleBuilder) copyImports(workspace string) error {
+	if _, err := os.Stat(filepath.Join(b.moduleRoot, "cue.mod")); err != nil {
+		return fmt.Errorf("module root %s must contain a cue.mod directory: %w", b.moduleRoot, err)
+	}
+
+	root, err := filepath.EvalSymlinks(filepath.Clean(b.moduleRoot))
+	if err != nil {
+		return fmt.Errorf("failed to resolve module root %s: %w", b.moduleRoot, err)
+	}
+	skip := func(src string, info os.FileInfo) bool {
+		return !info.IsDir() && filepath.Dir(src) == root
+	}
+	if err := copyDereferenced(root, workspace, skip); err != nil {
+		return fmt.Errorf("failed to copy imports from %s: %w", b.moduleRoot, err)
+	}
+	return nil
+}
+
+// copyDereferenced copies the src directory to dst, replacing the symlinks with the content
+// of their targets, so that the workspace doesn't contain links that dangle once copied.
+// The deep copy mode of otiai10/copy is not used, as it resolves the relative links
+// against the working directory instead of the link location.
+func copyDereferenced(src, dst string, skip func(src string, info os.FileInfo) bool) error {
+	opt := cp.Options{
+		Skip: func(info os.FileInfo, src, dest string) (bool, error) {
+			if info.Mode()&os.ModeSymlink == 0 {
+				return skip != nil && skip(src, info), nil
+			}
+
+			target, err := filepath.EvalSymlinks(src)
+			if err != nil {
+				return false, fmt.Errorf("failed to resolve symlink %s: %w", src, err)
+			}
+			info, err = os.Stat(target)
+			if err != nil {
+				return false, err
+			}
+			if skip != nil && skip(src, info) {
+				return true, nil
+			}
+			return true, copyDereferenced(target, dest, nil)
+		},
+	}
+	return cp.Copy(src, dst, opt)
+}
+
+// relocateSchema returns the bundle schema with the #Bundle definition
+// applied at the bundle path instead of the top-level 'bundle' field.
+func (b *BundleBuilder) relocateSchema(schema string) string {
+	var labels []string
+	for _, sel := range cue.ParsePath(b.bundlePath).Selectors() {
+		labels = append(labels, sel.String())
+	}
+	return strings.Replace(schema, "\nbundle: #Bundle", "\n"+strings.Join(labels, ": ")+": #Bundle", 1)
+}
+
+// lookupAPIVersion returns the bundle API version if it is set to a concrete value
+// in the given CUE file. Files that can't be compiled on their own are skipped.
+func (b *BundleBuilder) lookupAPIVersion(data []byte) string {
+	v := b.ctx.CompileBytes(data)
+	if v.Err() != nil {
+		return ""
+	}
+	ver, err := v.LookupPath(cue.ParsePath(b.selector(apiv1.BundleAPIVersionSelector))).String()
+	if err != nil {
+		return ""
+	}
+	return ver
+}
+
+// CUEVersion returns the version of the CUE language used by the builder.
+func (b *BundleBuilder) CUEVersion() string {
+	return CUEVersion()
+}
+
+// checkCUEVersion verifies that the CUE version used by the builder
+// satisfies the semver constraint set in the bundle cueVersion field.
+func (b *BundleBuilder) checkCUEVersion(v cue.Value) error {
+	selector := b.selector(apiv1.BundleCUEVersionSelector)
+	vConstraint := v.LookupPath(cue.ParsePath(selector))
+	if !vConstraint.Exists() {
+		return nil
+	}
+
+	expected, err := vConstraint.String()
+	if err != nil {
+		return fmt.Errorf("lookup %s failed: %w", selector, err)
+	}
+
+	constraint, err := semver.NewConstraint(expected)
+	if err != nil {
+		return fmt.Errorf("%s: invalid semver constraint %s: %w", selector, expected, err)
+	}
+
+	current, err := semver.NewVersion(b.CUEVersion())
+	if err != nil {
+		return fmt.Errorf("%s: unable to determine the CUE version used by the builder: %w",
+			selector, err)
+	}
+
+	if !constraint.Check(current) {
+		return fmt.Errorf("%s: the bundle requires CUE version %s, but the builder uses %s",
+			selector, expected, current.Original())
+	}
+
 	return nil
 }
 
 // Build builds a CUE instance for the specified files and returns the CUE value.
 // A workspace must be initialised with InitWorkspace before calling this function.
-func (b *BundleBuilder) Build() (cue.Value, error) {
+// If a cache directory is set, the value is loaded from cache when the workspace files are unchanged.
+// The cache is disabled when the workspace contains decrypted files, or values injected
+// from the environment, files or handlers, to avoid writing secrets to disk.
+// If the bundle specifies a cueVersion constraint, an error is returned
+// when the CUE version used by the builder doesn't satisfy it.
+// The warnings found in the bundle files are returned alongside the value,
+// and it's up to the caller to decide if they should fail the build.
+func (b *BundleBuilder) Build() (cue.Value, []string, error) {
 	var value cue.Value
+	var cacheFile string
+	if b.cacheDir != "" && len(b.decrypted) == 0 && !b.external {
+		hash, err := b.hashFiles()
+		if err != nil {
+			return value, b.warnings, err
+		}
+
+		cacheFile = filepath.Join(b.cacheDir, fmt.Sprintf("%s.bundle.cue", hash))
+		if data, err := os.ReadFile(cacheFile); err == nil {
+			if v := b.ctx.CompileBytes(data); v.Err() == nil {
+				b.log.V(1).Info("using cached build", "file", cacheFile)
+				now := time.Now()
+				_ = os.Chtimes(cacheFile, now, now)
+				if err := b.checkUnknownFields(v); err != nil {
+					return value, b.warnings, err
+				}
+				return v, b.warnings, b.checkCUEVersion(v)
+			}
+			// Remove the corrupted entry and rebuild.
+			_ = os.Remove(cacheFile)
+		}
+	}
+
+	overlay := make(map[string]load.Source, len(b.decrypted))
+	for file, data := range b.decrypted {
+		overlay[file] = load.FromBytes(data)
+	}
+
 	cfg := &load.Config{
 		Package:   "_",
 		DataFiles: true,
+		Overlay:   overlay,
+	}
+	if b.moduleRoot != "" {
+		cfg.ModuleRoot = b.workspace
+		cfg.Dir = b.workspace
 	}
 
+	b.log.V(1).Info("loading workspace", "files", len(b.files), "overlays", len(b.overlays))
+	timer := startPhase(b.observer)
 	ix := load.Instances(b.files, cfg)
 	if len(ix) == 0 {
-		return value, fmt.Errorf("no instances found")
+		return value, b.warnings, fmt.Errorf("no instances found")
 	}
 
 	inst := ix[0]
 	if inst.Err != nil {
-		return value, fmt.Errorf("instance error: %w", inst.Err)
+		return value, b.warnings, fmt.Errorf("instance error: %w", inst.Err)
 	}
+	timer.stop(PhaseLoading)
 
+	b.log.V(1).Info("building bundle")
+	timer = startPhase(b.observer)
 	v := b.ctx.BuildInstance(inst)
 	if v.Err() != nil {
-		return value, v.Err()
+		return value, b.warnings, v.Err()
+	}
+
+	if len(b.overlays) > 0 {
+		ox := load.Instances(b.overlays, cfg)
+		if len(ox) == 0 {
+			return value, b.warnings, fmt.Errorf("no overlay instances found")
+		}
+		if ox[0].Err != nil {
+			return value, b.warnings, fmt.Errorf("overlay instance error: %w", ox[0].Err)
+		}
+
+		overlay := b.ctx.BuildInstance(ox[0])
+		if overlay.Err() != nil {
+			return value, b.warnings, overlay.Err()
+		}
+
+		merged, err := mergeBundleOverlay(b.ctx, v, overlay, b.schema,
+			cue.ParsePath(b.selector(apiv1.BundleInstancesSelector)))
+		if err != nil {
+			return value, b.warnings, err
+		}
+		v = merged
 	}
 
+	v, err := expandForEach(b.ctx, v,
+		cue.ParsePath(b.selector(apiv1.BundleForEachSelector)),
+		cue.ParsePath(b.selector(apiv1.BundleInstancesSelector)))
+	if err != nil {
+		return value, b.warnings, err
+	}
+	timer.stop(PhaseBuilding)
+
+	b.log.V(1).Info("validating bundle")
+	timer = startPhase(b.observer)
 	if err := v.Validate(cue.Concrete(true)); err != nil {
-		return value, err
+		return value, b.warnings, err
+	}
+	timer.stop(PhaseValidation)
+
+	if err := b.checkUnknownFields(v); err != nil {
+		return value, b.warnings, err
+	}
+
+	if err := b.checkCUEVersion(v); err != nil {
+		return value, b.warnings, err
+	}
+
+	if cacheFile != "" {
+		if err := b.writeCache(cacheFile, v); err != nil {
+			return value, b.warnings, err
+		}
+	}
+
+	b.log.Info("bundle built", "warnings", len(b.warnings))
+	return v, b.warnings, nil
+}
+
+// checkUnknownFields returns an error listing the regular top-level fields
+// other than the bundle, if the strict mode is enabled.
+func (b *BundleBuilder) checkUnknownFields(v cue.Value) error {
+	if !b.strict {
+		return nil
+	}
+
+	root, _, _ := strings.Cut(b.selector(apiv1.BundleAPIVersionSelector), ".")
+	iter, err := v.Fields()
+	if err != nil {
+		return err
 	}
 
-	return v, nil
+	var unknown []string
+	for iter.Next() {
+		if name := iter.Selector().String(); name != root {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown top-level field(s) %s, only '%s' is allowed in strict mode",
+			strings.Join(unknown, ", "), root)
+	}
+	return nil
+}
+
+// hashFiles computes the SHA-256 hash of the workspace files names and contents.
+// When a module root is set, the imported files are included in the hash.
+func (b *BundleBuilder) hashFiles() (string, error) {
+	h := sha256.New()
+	// Cached entries built with a different CUE version are not reused,
+	// as the evaluation result may differ between releases.
+	_, _ = fmt.Fprintf(h, "cue\x00%s\x00", b.CUEVersion())
+	for _, file := range append(append([]string{}, b.files...), b.overlays...) {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+		_, _ = fmt.Fprintf(h, "%s\x00%d\x00", filepath.Base(file), len(content))
+		h.Write(content)
+	}
+
+	if b.moduleRoot != "" {
+		err := filepath.WalkDir(b.workspace, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Dir(path) == filepath.Clean(b.workspace) {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(b.workspace, path)
+			_, _ = fmt.Fprintf(h, "%s\x00%d\x00", rel, len(content))
+			h.Write(content)
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to hash imports: %w", err)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// bundleCacheMaxEntries is the number of bundle builds kept in the cache directory.
+const bundleCacheMaxEntries = 50
+
+// writeCache stores the exported value in the cache file, including the definitions
+// and hidden fields referenced by the conditional values expressions.
+// The file is written to a temporary location and then renamed
+// to avoid reading partial entries from concurrent builds.
+func (b *BundleBuilder) writeCache(cacheFile string, v cue.Value) error {
+	data, err := format.Node(v.Syntax(cue.Final(), cue.Definitions(true), cue.Hidden(true)))
+	if err != nil {
+		return fmt.Errorf("failed to export bundle: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(b.cacheDir, "*.bundle.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write bundle cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write bundle cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle cache: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), cacheFile); err != nil {
+		return fmt.Errorf("failed to write bundle cache: %w", err)
+	}
+
+	b.evictCache()
+	return nil
+}
+
+// evictCache removes the least recently used entries from the cache directory,
+// keeping at most bundleCacheMaxEntries. Errors are ignored, as the entries
+// may be removed by concurrent builds.
+func (b *BundleBuilder) evictCache() {
+	entries, err := filepath.Glob(filepath.Join(b.cacheDir, "*.bundle.cue"))
+	if err != nil || len(entries) <= bundleCacheMaxEntries {
+		return
+	}
+
+	modTimes := make(map[string]time.Time, len(entries))
+	for _, entry := range entries {
+		if info, err := os.Stat(entry); err == nil {
+			modTimes[entry] = info.ModTime()
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return modTimes[entries[i]].After(modTimes[entries[j]])
+	})
+
+	for _, entry := range entries[bundleCacheMaxEntries:] {
+		_ = os.Remove(entry)
+	}
 }
 
 // GetBundle returns a Bundle from the bundle CUE value.
+// The disabled instances are removed from the bundle, after the values are inherited.
+// The bundle instances are sorted by name and then
+// ordered based on their dependencies.
 func (b *BundleBuilder) GetBundle(v cue.Value) (*Bundle, error) {
-	bundleNameValue := v.LookupPath(cue.ParsePath(apiv1.BundleName.String()))
+	bundle, err := b.LookupBundle(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := InheritValues(bundle.Instances); err != nil {
+		return nil, err
+	}
+
+	bundle.Instances = removeDisabledInstances(bundle.Instances)
+
+	SortByNamespaceOrder(bundle.Instances, bundle.Order)
+	bundle.Instances, err = SortByDependencies(bundle.Instances)
+	if err != nil {
+		return nil, err
+	}
+
+	b.log.Info("bundle loaded", "name", bundle.Name, "instances", len(bundle.Instances))
+	b.bundle = bundle
+	return bundle, nil
+}
+
+// InstanceRenderer returns the Kubernetes objects of a bundle instance.
+type InstanceRenderer func(instance *BundleInstance) ([]*unstructured.Unstructured, error)
+
+// SetRenderer sets the function used by ForEachInstance to render the bundle instances.
+func (b *BundleBuilder) SetRenderer(renderer InstanceRenderer) {
+	b.renderer = renderer
+}
+
+// ForEachInstance renders the instances of the bundle returned by GetBundle in order,
+// and calls fn with the objects of each instance as soon as they are rendered.
+// The objects are not retained by the builder, so that the memory usage is
+// bounded by the largest instance instead of the whole bundle.
+// The iteration stops at the first error returned by the renderer or by fn.
+func (b *BundleBuilder) ForEachInstance(fn func(BundleInstance, []*unstructured.Unstructured) error) error {
+	if b.bundle == nil {
+		return fmt.Errorf("no bundle found, GetBundle must be called before ForEachInstance")
+	}
+	if b.renderer == nil {
+		return fmt.Errorf("no renderer set, SetRenderer must be called before ForEachInstance")
+	}
+
+	for _, instance := range b.bundle.Instances {
+		objects, err := b.renderer(instance)
+		if err != nil {
+			return err
+		}
+		if err := fn(*instance, objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LookupBundle returns a Bundle from the bundle CUE value with the instances sorted by name.
+// Unlike GetBundle, the instances are not ordered based on their dependencies
+// and their values are not inherited, so that the bundle can be inspected
+// even if its instances have circular or undefined references.
+func (b *BundleBuilder) LookupBundle(v cue.Value) (*Bundle, error) {
+	bundleNameValue := v.LookupPath(cue.ParsePath(b.selector(apiv1.BundleName)))
 	bundleName, err := bundleNameValue.String()
 	if err != nil {
-		return nil, fmt.Errorf("lookup %s failed: %w", apiv1.BundleName.String(), bundleNameValue.Err())
+		return nil, fmt.Errorf("lookup %s failed: %w", b.selector(apiv1.BundleName), bundleNameValue.Err())
 	}
 
-	instances := v.LookupPath(cue.ParsePath(apiv1.BundleInstancesSelector.String()))
+	instances := v.LookupPath(cue.ParsePath(b.selector(apiv1.BundleInstancesSelector)))
 	if instances.Err() != nil {
-		return nil, fmt.Errorf("lookup %s failed: %w", apiv1.BundleInstancesSelector.String(), instances.Err())
+		return nil, fmt.Errorf("lookup %s failed: %w", b.selector(apiv1.BundleInstancesSelector), instances.Err())
 	}
 
 	var list []*BundleInstance
@@ -185,10 +1022,141 @@ func (b *BundleBuilder) GetBundle(v cue.Value) (*Bundle, error) {
 		vVersion := expr.LookupPath(cue.ParsePath(apiv1.BundleModuleVersionSelector.String()))
 		version, _ := vVersion.String()
 
+		// The relative paths of local modules are resolved against the working directory.
+		if modPath, ok := strings.CutPrefix(url, apiv1.LocalModulePrefix); ok {
+			if digest != "" {
+				return nil, fmt.Errorf("%s of instance %s can't be set for the local module %s",
+					apiv1.BundleModuleDigestSelector.String(), name, url)
+			}
+			absPath, err := filepath.Abs(modPath)
+			if err != nil {
+				return nil, fmt.Errorf("resolving the local module of instance %s failed: %w", name, err)
+			}
+			url = apiv1.LocalModulePrefix + absPath
+		}
+
 		vNamespace := expr.LookupPath(cue.ParsePath(apiv1.BundleNamespaceSelector.String()))
 		namespace, _ := vNamespace.String()
 
+		overridable := true
+		vOverridable := expr.LookupPath(cue.ParsePath(apiv1.BundleNamespaceOverridableSelector.String()))
+		if v, err := vOverridable.Bool(); err == nil {
+			overridable = v
+		}
+
 		values := expr.LookupPath(cue.ParsePath(apiv1.BundleValuesSelector.String()))
+		values, err = applyConditionalValues(expr, values)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", name, err)
+		}
+
+		vValuesFrom := expr.LookupPath(cue.ParsePath(apiv1.BundleValuesFromSelector.String()))
+		valuesFrom, _ := vValuesFrom.String()
+
+		var dependsOn []string
+		vDependsOn := expr.LookupPath(cue.ParsePath(apiv1.BundleDependsOnSelector.String()))
+		if vDependsOn.Exists() {
+			if err := vDependsOn.Decode(&dependsOn); err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleDependsOnSelector.String(), name, err)
+			}
+		}
+
+		var secretRefs []string
+		vSecretRefs := expr.LookupPath(cue.ParsePath(apiv1.BundleSecretRefsSelector.String()))
+		if vSecretRefs.Exists() {
+			if err := vSecretRefs.Decode(&secretRefs); err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleSecretRefsSelector.String(), name, err)
+			}
+		}
+
+		disabled := false
+		vEnabled := expr.LookupPath(cue.ParsePath(apiv1.BundleEnabledSelector.String()))
+		if v, err := vEnabled.Bool(); err == nil {
+			disabled = !v
+		}
+
+		var timeout time.Duration
+		vTimeout := expr.LookupPath(cue.ParsePath(apiv1.BundleTimeoutSelector.String()))
+		if vTimeout.Exists() {
+			t, err := vTimeout.String()
+			if err == nil {
+				timeout, err = time.ParseDuration(t)
+			}
+			if err == nil && timeout < 0 {
+				err = fmt.Errorf("negative duration %s", t)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleTimeoutSelector.String(), name, err)
+			}
+		}
+
+		var applyRetries *int
+		vApplyRetries := expr.LookupPath(cue.ParsePath(apiv1.BundleApplyRetriesSelector.String()))
+		if vApplyRetries.Exists() {
+			var retries int
+			if err := vApplyRetries.Decode(&retries); err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleApplyRetriesSelector.String(), name, err)
+			}
+			applyRetries = &retries
+		}
+
+		deletePolicy := apiv1.DeletePolicyDelete
+		vDeletePolicy := expr.LookupPath(cue.ParsePath(apiv1.BundleDeletePolicySelector.String()))
+		if vDeletePolicy.Exists() {
+			p, err := vDeletePolicy.String()
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleDeletePolicySelector.String(), name, err)
+			}
+			switch p {
+			case apiv1.DeletePolicyDelete, apiv1.DeletePolicyOrphan, apiv1.DeletePolicyKeepNamespace:
+				deletePolicy = p
+			default:
+				return nil, fmt.Errorf("invalid %s '%s' of instance %s, must be one of: %s, %s, %s",
+					apiv1.BundleDeletePolicySelector.String(), p, name,
+					apiv1.DeletePolicyDelete, apiv1.DeletePolicyOrphan, apiv1.DeletePolicyKeepNamespace)
+			}
+		}
+
+		var waitFor []apiv1.WaitCondition
+		vWaitFor := expr.LookupPath(cue.ParsePath(apiv1.BundleWaitForSelector.String()))
+		if vWaitFor.Exists() {
+			if err := vWaitFor.Decode(&waitFor); err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleWaitForSelector.String(), name, err)
+			}
+		}
+
+		var nsMetadata apiv1.NamespaceMetadata
+		vNsMetadata := expr.LookupPath(cue.ParsePath(apiv1.BundleNamespaceMetadataSelector.String()))
+		if vNsMetadata.Exists() {
+			if err := vNsMetadata.Decode(&nsMetadata); err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleNamespaceMetadataSelector.String(), name, err)
+			}
+		}
+
+		var sensitive []string
+		vSensitive := expr.LookupPath(cue.ParsePath(apiv1.BundleSensitiveSelector.String()))
+		if vSensitive.Exists() {
+			if err := vSensitive.Decode(&sensitive); err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleSensitiveSelector.String(), name, err)
+			}
+		}
+
+		var labels map[string]string
+		vLabels := expr.LookupPath(cue.ParsePath(apiv1.BundleLabelsSelector.String()))
+		if vLabels.Exists() {
+			if err := vLabels.Decode(&labels); err != nil {
+				return nil, fmt.Errorf("decoding %s of instance %s failed: %w",
+					apiv1.BundleLabelsSelector.String(), name, err)
+			}
+		}
 
 		list = append(list, &BundleInstance{
 			Bundle:    bundleName,
@@ -199,12 +1167,244 @@ func (b *BundleBuilder) GetBundle(v cue.Value) (*Bundle, error) {
 				Version:    version,
 				Digest:     digest,
 			},
-			Values: values,
+			Values:               values,
+			ValuesFrom:           valuesFrom,
+			DependsOn:            dependsOn,
+			NamespaceOverridable: overridable,
+			SecretRefs:           secretRefs,
+			Labels:               labels,
+			Disabled:             disabled,
+			Timeout:              timeout,
+			ApplyRetries:         applyRetries,
+			DeletePolicy:         deletePolicy,
+			WaitFor:              waitFor,
+			NamespaceMetadata:    nsMetadata,
+			Sensitive:            sensitive,
 		})
 	}
 
+	// CUE struct fields are ordered by definition, which varies
+	// when a bundle is split across multiple files.
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	var order []string
+	vOrder := v.LookupPath(cue.ParsePath(b.selector(apiv1.BundleOrderSelector)))
+	if vOrder.Exists() {
+		if err := vOrder.Decode(&order); err != nil {
+			return nil, fmt.Errorf("decoding %s failed: %w", b.selector(apiv1.BundleOrderSelector), err)
+		}
+	}
+
 	return &Bundle{
-		Name:      bundleName,
-		Instances: list,
+		Name:       bundleName,
+		Instances:  list,
+		CUEVersion: b.CUEVersion(),
+		Order:      order,
 	}, nil
 }
+
+// applyConditionalValues merges into the instance values the conditional values
+// whose 'when' expression evaluates to true. The expressions are evaluated in the
+// scope of the instance, with references resolved against the instance fields,
+// e.g. 'namespace', and the top-level fields and definitions of the bundle.
+func applyConditionalValues(instance cue.Value, values cue.Value) (cue.Value, error) {
+	conditionals := instance.LookupPath(cue.ParsePath(apiv1.BundleConditionalValuesSelector.String()))
+	if !conditionals.Exists() {
+		return values, nil
+	}
+
+	iter, err := conditionals.List()
+	if err != nil {
+		return values, err
+	}
+
+	for iter.Next() {
+		item := iter.Value()
+		when, err := item.LookupPath(cue.ParsePath("when")).String()
+		if err != nil {
+			return values, err
+		}
+
+		condition := instance.Context().CompileString(when, cue.Scope(instance), cue.InferBuiltins(true))
+		enabled, err := condition.Bool()
+		if err != nil {
+			return values, fmt.Errorf("evaluating the expression '%s' failed: %w", when, err)
+		}
+		if !enabled {
+			continue
+		}
+
+		values = values.Unify(item.LookupPath(cue.ParsePath(apiv1.BundleValuesSelector.String())))
+		if values.Err() != nil {
+			return values, fmt.Errorf("merging the values of the expression '%s' failed: %w", when, values.Err())
+		}
+	}
+
+	return values, nil
+}
+
+// removeDisabledInstances returns the enabled instances. The dependencies on
+// disabled instances are removed, as the disabled instances are not applied.
+func removeDisabledInstances(instances []*BundleInstance) []*BundleInstance {
+	disabled := make(map[string]bool)
+	for _, instance := range instances {
+		if instance.Disabled {
+			disabled[instance.Name] = true
+		}
+	}
+	if len(disabled) == 0 {
+		return instances
+	}
+
+	var list []*BundleInstance
+	for _, instance := range instances {
+		if disabled[instance.Name] {
+			continue
+		}
+		var dependsOn []string
+		for _, dep := range instance.DependsOn {
+			if !disabled[dep] {
+				dependsOn = append(dependsOn, dep)
+			}
+		}
+		instance.DependsOn = dependsOn
+		list = append(list, instance)
+	}
+	return list
+}
+
+// InheritValues merges the values of the instance referenced by valuesFrom
+// into the values of each instance, with the local values taking precedence.
+// The references are resolved regardless of the instances order and
+// an instance can inherit values from an instance that inherits in turn.
+func InheritValues(instances []*BundleInstance) error {
+	index := make(map[string]*BundleInstance, len(instances))
+	for _, instance := range instances {
+		index[instance.Name] = instance
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(instances))
+
+	var visit func(instance *BundleInstance, path []string) error
+	visit = func(instance *BundleInstance, path []string) error {
+		switch state[instance.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("circular values inheritance detected: %s",
+				strings.Join(append(path, instance.Name), " -> "))
+		}
+
+		state[instance.Name] = visiting
+		if instance.ValuesFrom != "" {
+			base, ok := index[instance.ValuesFrom]
+			if !ok {
+				return fmt.Errorf("instance %s inherits values from %s which is not defined in the bundle",
+					instance.Name, instance.ValuesFrom)
+			}
+			if err := visit(base, append(path, instance.Name)); err != nil {
+				return err
+			}
+
+			values, err := MergeValue(instance.Values, base.Values)
+			if err != nil {
+				return fmt.Errorf("merging values of instance %s from %s failed: %w",
+					instance.Name, instance.ValuesFrom, err)
+			}
+			instance.Values = values
+		}
+		state[instance.Name] = visited
+		return nil
+	}
+
+	for _, instance := range instances {
+		if err := visit(instance, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SortByNamespaceOrder orders the instances by the position of their namespace
+// in the given list, with the instances in unlisted namespaces placed last.
+// The relative order of the instances in the same position is preserved.
+func SortByNamespaceOrder(instances []*BundleInstance, order []string) {
+	if len(order) == 0 {
+		return
+	}
+
+	rank := make(map[string]int, len(order))
+	for i, ns := range order {
+		if _, ok := rank[ns]; !ok {
+			rank[ns] = i
+		}
+	}
+	rankOf := func(instance *BundleInstance) int {
+		if r, ok := rank[instance.Namespace]; ok {
+			return r
+		}
+		return len(order)
+	}
+
+	sort.SliceStable(instances, func(i, j int) bool {
+		return rankOf(instances[i]) < rankOf(instances[j])
+	})
+}
+
+// SortByDependencies orders the instances so that each instance comes after
+// the instances listed in its dependsOn field. The relative order of
+// independent instances is preserved.
+func SortByDependencies(instances []*BundleInstance) ([]*BundleInstance, error) {
+	index := make(map[string]*BundleInstance, len(instances))
+	for _, instance := range instances {
+		index[instance.Name] = instance
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(instances))
+	sorted := make([]*BundleInstance, 0, len(instances))
+
+	var visit func(instance *BundleInstance, path []string) error
+	visit = func(instance *BundleInstance, path []string) error {
+		switch state[instance.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("circular dependency detected: %s",
+				strings.Join(append(path, instance.Name), " -> "))
+		}
+
+		state[instance.Name] = visiting
+		for _, dep := range instance.DependsOn {
+			target, ok := index[dep]
+			if !ok {
+				return fmt.Errorf("instance %s depends on %s which is not defined in the bundle",
+					instance.Name, dep)
+			}
+			if err := visit(target, append(path, instance.Name)); err != nil {
+				return err
+			}
+		}
+		state[instance.Name] = visited
+		sorted = append(sorted, instance)
+		return nil
+	}
+
+	for _, instance := range instances {
+		if err := visit(instance, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
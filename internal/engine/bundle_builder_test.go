@@ -17,10 +17,21 @@ limitations under the License.
 package engine
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/parser"
+	"github.com/go-logr/logr/funcr"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 )
 
 func TestGetBundle(t *testing.T) {
@@ -62,4 +73,1871 @@ bundle: {
 		g.Expect(b.Instances[0].Name).To(Equal("pod-info"))
 		g.Expect(b.Instances[1].Name).To(Equal("podinfo"))
 	})
+	t.Run("Get bundle with instances sorted by name", func(t *testing.T) {
+		g := NewWithT(t)
+		instance := `
+    %[1]s: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        values: {}
+    }
+`
+		names := []string{"frontend", "backend", "cache"}
+		reversed := []string{"cache", "backend", "frontend"}
+
+		for _, order := range [][]string{names, reversed} {
+			var instances string
+			for _, name := range order {
+				instances += fmt.Sprintf(instance, name)
+			}
+			bundle := fmt.Sprintf(`
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+%s
+    }
+}
+`, instances)
+
+			v := ctx.CompileString(bundle)
+			builder := NewBundleBuilder(ctx, []string{})
+			b, err := builder.GetBundle(v)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(b.Instances).To(HaveLen(3))
+			g.Expect(b.Instances[0].Name).To(Equal("backend"))
+			g.Expect(b.Instances[1].Name).To(Equal("cache"))
+			g.Expect(b.Instances[2].Name).To(Equal("frontend"))
+		}
+	})
+	t.Run("Get bundle with secret references", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        secretRefs: ["podinfo-auth", "podinfo-tls"]
+        values: {}
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances[0].SecretRefs).To(Equal([]string{"podinfo-auth", "podinfo-tls"}))
+	})
+	t.Run("Get bundle with instance labels", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        labels: team: "payments"
+        values: {}
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances[0].Labels).To(Equal(map[string]string{"team": "payments"}))
+	})
+	t.Run("Get bundle with instance timeout", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+        backend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+        }
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+            timeout: "10m30s"
+        }
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances[0].Timeout).To(BeZero())
+		g.Expect(b.Instances[1].Timeout).To(Equal(10*time.Minute + 30*time.Second))
+	})
+	t.Run("Get bundle with instance apply retries", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+        backend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+        }
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+            applyRetries: 3
+        }
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances[0].ApplyRetries).To(BeNil())
+		g.Expect(b.Instances[1].ApplyRetries).To(HaveValue(Equal(3)))
+	})
+	t.Run("Get bundle with instance delete policy", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+        backend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+        }
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+            deletePolicy: "keep-namespace"
+        }
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances[0].DeletePolicy).To(Equal(apiv1.DeletePolicyDelete))
+		g.Expect(b.Instances[1].DeletePolicy).To(Equal(apiv1.DeletePolicyKeepNamespace))
+	})
+	t.Run("Fails to get bundle with invalid delete policy", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        deletePolicy: "retain"
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		_, err := builder.GetBundle(v)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("invalid deletePolicy 'retain' of instance podinfo"))
+	})
+	t.Run("Get bundle with wait conditions", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        waitFor: [{
+            kind:     "Service"
+            name:     "podinfo"
+            jsonPath: "status.loadBalancer.ingress"
+        }, {
+            kind:     "Pod"
+            jsonPath: "{.status.phase}"
+            value:    "Running"
+        }]
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances[0].WaitFor).To(Equal([]apiv1.WaitCondition{
+			{Kind: "Service", Name: "podinfo", JSONPath: "status.loadBalancer.ingress"},
+			{Kind: "Pod", JSONPath: "{.status.phase}", Value: "Running"},
+		}))
+	})
+	t.Run("Get bundle with local module", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+        backend: {
+            module: url: "file://./testdata/module"
+            namespace: "podinfo"
+        }
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+        }
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		wd, err := os.Getwd()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances[0].Module.Repository).To(Equal("file://" + filepath.Join(wd, "testdata", "module")))
+		g.Expect(b.Instances[1].Module.Repository).To(Equal("oci://ghcr.io/stefanprodan/modules/podinfo"))
+	})
+	t.Run("Get bundle fails for local module with digest", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "file://./testdata/module"
+        module: digest: "sha256:abc"
+        namespace: "podinfo"
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		_, err := builder.GetBundle(v)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("can't be set for the local module"))
+	})
+	t.Run("Get bundle fails for invalid instance timeout", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        timeout: "10 minutes"
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		_, err := builder.GetBundle(v)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("decoding timeout of instance podinfo failed"))
+	})
+	t.Run("Get bundle without disabled instances", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+            dependsOn: ["backend", "cache"]
+            valuesFrom: "cache"
+        }
+        backend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+            enabled: true
+        }
+        cache: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/redis"
+            namespace: "podinfo"
+            enabled: false
+            values: maxmemory: 256
+        }
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+
+		lookup, err := builder.LookupBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(lookup.Instances).To(HaveLen(3))
+
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(2))
+		g.Expect(b.Instances[0].Name).To(Equal("backend"))
+		g.Expect(b.Instances[1].Name).To(Equal("frontend"))
+		g.Expect(b.Instances[1].DependsOn).To(Equal([]string{"backend"}))
+
+		maxmemory, err := b.Instances[1].Values.LookupPath(cue.ParsePath("maxmemory")).Int64()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(maxmemory).To(BeEquivalentTo(256))
+	})
+}
+
+func TestSortByDependencies(t *testing.T) {
+	t.Run("orders instances after their dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		instances := []*BundleInstance{
+			{Name: "backend", DependsOn: []string{"database"}},
+			{Name: "cache"},
+			{Name: "database"},
+			{Name: "frontend", DependsOn: []string{"backend", "cache"}},
+		}
+
+		sorted, err := SortByDependencies(instances)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var names []string
+		for _, instance := range sorted {
+			names = append(names, instance.Name)
+		}
+		g.Expect(names).To(Equal([]string{"database", "backend", "cache", "frontend"}))
+	})
+
+	t.Run("fails on circular dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		instances := []*BundleInstance{
+			{Name: "backend", DependsOn: []string{"frontend"}},
+			{Name: "frontend", DependsOn: []string{"backend"}},
+		}
+
+		_, err := SortByDependencies(instances)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("backend -> frontend -> backend"))
+	})
+
+	t.Run("fails on undefined dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		instances := []*BundleInstance{
+			{Name: "frontend", DependsOn: []string{"backend"}},
+		}
+
+		_, err := SortByDependencies(instances)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("backend which is not defined"))
+	})
+}
+
+func TestSortByNamespaceOrder(t *testing.T) {
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    order: ["cert-manager", "monitoring"]
+    instances: {
+        app: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "apps"
+        }
+        "cert-manager": {
+            module: url: "oci://ghcr.io/stefanprodan/modules/cert-manager"
+            namespace: "cert-manager"
+        }
+        issuer: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/issuer"
+            namespace: "cert-manager"
+            dependsOn: ["cert-manager"]
+        }
+        prometheus: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/prometheus"
+            namespace: "monitoring"
+            dependsOn: ["web"]
+        }
+        web: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "apps"
+        }
+    }
+}
+`
+
+	t.Run("orders instances by namespace after their dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		file := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+		v, _, err := builder.Build()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Order).To(Equal([]string{"cert-manager", "monitoring"}))
+
+		var names []string
+		for _, instance := range b.Instances {
+			names = append(names, instance.Name)
+		}
+		g.Expect(names).To(Equal([]string{"cert-manager", "issuer", "web", "prometheus", "app"}))
+	})
+
+	t.Run("preserves the order without namespaces", func(t *testing.T) {
+		g := NewWithT(t)
+		instances := []*BundleInstance{
+			{Name: "a", Namespace: "apps"},
+			{Name: "b", Namespace: "infra"},
+		}
+
+		SortByNamespaceOrder(instances, nil)
+		g.Expect(instances[0].Name).To(Equal("a"))
+		g.Expect(instances[1].Name).To(Equal("b"))
+	})
+}
+
+func TestInheritValues(t *testing.T) {
+	ctx := cuecontext.New()
+
+	t.Run("merges values from the referenced instance", func(t *testing.T) {
+		g := NewWithT(t)
+		bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+        backend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+            valuesFrom: "frontend"
+            values: replicas: 3
+        }
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "podinfo"
+            values: {
+                replicas: 1
+                caching: redisURL: "tcp://redis:6379"
+            }
+        }
+    }
+}
+`
+		v := ctx.CompileString(bundle)
+		builder := NewBundleBuilder(ctx, []string{})
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(2))
+
+		backend := b.Instances[0]
+		g.Expect(backend.Name).To(Equal("backend"))
+		g.Expect(backend.ValuesFrom).To(Equal("frontend"))
+
+		replicas, err := backend.Values.LookupPath(cue.ParsePath("replicas")).Int64()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replicas).To(BeEquivalentTo(3))
+
+		url, err := backend.Values.LookupPath(cue.ParsePath("caching.redisURL")).String()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(url).To(Equal("tcp://redis:6379"))
+
+		replicas, err = b.Instances[1].Values.LookupPath(cue.ParsePath("replicas")).Int64()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replicas).To(BeEquivalentTo(1))
+	})
+
+	t.Run("fails on circular inheritance", func(t *testing.T) {
+		g := NewWithT(t)
+		instances := []*BundleInstance{
+			{Name: "backend", ValuesFrom: "frontend"},
+			{Name: "frontend", ValuesFrom: "backend"},
+		}
+
+		err := InheritValues(instances)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("backend -> frontend -> backend"))
+	})
+
+	t.Run("fails on undefined instances", func(t *testing.T) {
+		g := NewWithT(t)
+		instances := []*BundleInstance{
+			{Name: "frontend", ValuesFrom: "backend"},
+		}
+
+		err := InheritValues(instances)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("inherits values from backend which is not defined"))
+	})
+}
+
+func TestInitWorkspace_APIVersion(t *testing.T) {
+	bundle := `
+bundle: {
+    apiVersion: "%s"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        values: {}
+    }
+}
+`
+
+	t.Run("builds bundle with supported apiVersion", func(t *testing.T) {
+		g := NewWithT(t)
+		file := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(file, []byte(fmt.Sprintf(bundle, "v1alpha1")), 0644)).To(Succeed())
+
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+
+		v, _, err := builder.Build()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(1))
+	})
+
+	t.Run("fails for unsupported apiVersion", func(t *testing.T) {
+		g := NewWithT(t)
+		file := filepath.Join(t.TempDir(), "bundle.cue")
+		g.Expect(os.WriteFile(file, []byte(fmt.Sprintf(bundle, "v2")), 0644)).To(Succeed())
+
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		err := builder.InitWorkspace(t.TempDir(), nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unsupported bundle API version v2, must be one of: v1alpha1"))
+	})
+}
+
+func TestInitWorkspace_ReadFile(t *testing.T) {
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        values: tls: {
+            crt: string @timoni(read:file:./tls.crt)
+            key: string @timoni(read:file:"%s")
+        }
+    }
+}
+`
+	g := NewWithT(t)
+	bundleDir := filepath.Join(t.TempDir(), "bundles", "podinfo")
+	g.Expect(os.MkdirAll(bundleDir, os.ModePerm)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(bundleDir, "tls.crt"), []byte("my-crt"), 0644)).To(Succeed())
+
+	keyFile := filepath.Join(t.TempDir(), "tls.key")
+	g.Expect(os.WriteFile(keyFile, []byte("my-key"), 0644)).To(Succeed())
+
+	file := filepath.Join(bundleDir, "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(fmt.Sprintf(bundle, keyFile)), 0644)).To(Succeed())
+
+	// run from a different working directory than the bundle file
+	wd, err := os.Getwd()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(os.Chdir(t.TempDir())).To(Succeed())
+	defer os.Chdir(wd)
+
+	builder := NewBundleBuilder(cuecontext.New(), []string{file})
+	g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+
+	assertValues := func(g *WithT, crtValue string) {
+		v, _, err := builder.Build()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(1))
+
+		crt, err := b.Instances[0].Values.LookupPath(cue.ParsePath("tls.crt")).String()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(crt).To(Equal(crtValue))
+
+		key, err := b.Instances[0].Values.LookupPath(cue.ParsePath("tls.key")).String()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(key).To(Equal("my-key"))
+	}
+	assertValues(g, "my-crt")
+
+	// reinitialise the workspace as done for each cluster by bundle apply,
+	// the relative paths are resolved against the bundle file, not the workspace copy
+	g.Expect(os.WriteFile(filepath.Join(bundleDir, "tls.crt"), []byte("my-new-crt"), 0644)).To(Succeed())
+	g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+	assertValues(g, "my-new-crt")
+}
+
+func TestInitWorkspace_ModuleRoot(t *testing.T) {
+	bundle := `
+import (
+	"mycompany.com/common"
+	"example.com/bundles/lib"
+)
+
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: lib.#Namespace
+        values: replicas: common.#Replicas
+    }
+}
+`
+	g := NewWithT(t)
+	moduleRoot := t.TempDir()
+	files := map[string]string{
+		"cue.mod/module.cue":                          `module: "example.com/bundles"`,
+		"cue.mod/pkg/mycompany.com/common/common.cue": "package common\n\n#Replicas: 2\n",
+		"lib/lib.cue":                                 "package lib\n\n#Namespace: \"apps\"\n",
+		"bundle.cue":                                  bundle,
+	}
+	for name, content := range files {
+		file := filepath.Join(moduleRoot, name)
+		g.Expect(os.MkdirAll(filepath.Dir(file), os.ModePerm)).To(Succeed())
+		g.Expect(os.WriteFile(file, []byte(content), 0644)).To(Succeed())
+	}
+
+	build := func(g *WithT, cacheDir string) *Bundle {
+		builder := NewBundleBuilder(cuecontext.New(), []string{filepath.Join(moduleRoot, "bundle.cue")})
+		builder.SetModuleRoot(moduleRoot)
+		builder.SetCacheDir(cacheDir)
+		g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+
+		v, _, err := builder.Build()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(1))
+		return b
+	}
+
+	t.Run("builds bundle with imports", func(t *testing.T) {
+		g := NewWithT(t)
+		b := build(g, t.TempDir())
+		g.Expect(b.Instances[0].Namespace).To(Equal("apps"))
+
+		replicas, err := b.Instances[0].Values.LookupPath(cue.ParsePath("replicas")).Int64()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replicas).To(BeEquivalentTo(2))
+	})
+
+	t.Run("invalidates the cache when imports change", func(t *testing.T) {
+		g := NewWithT(t)
+		cacheDir := t.TempDir()
+		g.Expect(build(g, cacheDir).Instances[0].Namespace).To(Equal("apps"))
+
+		libFile := filepath.Join(moduleRoot, "lib", "lib.cue")
+		g.Expect(os.WriteFile(libFile, []byte("package lib\n\n#Namespace: \"web\"\n"), 0644)).To(Succeed())
+		g.Expect(build(g, cacheDir).Instances[0].Namespace).To(Equal("web"))
+	})
+
+	t.Run("fails without cue.mod", func(t *testing.T) {
+		g := NewWithT(t)
+		builder := NewBundleBuilder(cuecontext.New(), []string{filepath.Join(moduleRoot, "bundle.cue")})
+		builder.SetModuleRoot(t.TempDir())
+		err := builder.InitWorkspace(t.TempDir(), nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("must contain a cue.mod directory"))
+	})
+}
+
+func TestInitWorkspace_Symlinks(t *testing.T) {
+	bundle := `
+import "example.com/bundles/lib"
+
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: lib.#Namespace
+    }
+}
+`
+	g := NewWithT(t)
+	repo := t.TempDir()
+	files := map[string]string{
+		"shared/lib/lib.cue":         "package lib\n\n#Namespace: \"apps\"\n",
+		"shared/bundle.cue":          bundle,
+		"bundles/cue.mod/module.cue": `module: "example.com/bundles"`,
+	}
+	for name, content := range files {
+		file := filepath.Join(repo, name)
+		g.Expect(os.MkdirAll(filepath.Dir(file), os.ModePerm)).To(Succeed())
+		g.Expect(os.WriteFile(file, []byte(content), 0644)).To(Succeed())
+	}
+
+	// The links are relative, so they would dangle if copied as is to the workspace.
+	moduleRoot := filepath.Join(repo, "bundles")
+	g.Expect(os.Symlink(filepath.Join("..", "shared", "lib"), filepath.Join(moduleRoot, "lib"))).To(Succeed())
+	g.Expect(os.Symlink(filepath.Join("..", "shared", "bundle.cue"), filepath.Join(moduleRoot, "bundle.cue"))).To(Succeed())
+
+	workspace := t.TempDir()
+	builder := NewBundleBuilder(cuecontext.New(), []string{filepath.Join(moduleRoot, "bundle.cue")})
+	builder.SetModuleRoot(moduleRoot)
+	g.Expect(builder.InitWorkspace(workspace, nil)).To(Succeed())
+
+	info, err := os.Lstat(filepath.Join(workspace, "lib", "lib.cue"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(info.Mode().IsRegular()).To(BeTrue())
+
+	v, _, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	b, err := builder.GetBundle(v)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(b.Instances).To(HaveLen(1))
+	g.Expect(b.Instances[0].Namespace).To(Equal("apps"))
+}
+
+func TestInitWorkspace_EnvFile(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: string @timoni(runtime:string:TEST_ENVFILE_NAMESPACE)
+        values: replicas: int @timoni(runtime:number:TEST_ENVFILE_REPLICAS)
+    }
+}
+`
+	dir := t.TempDir()
+	file := filepath.Join(dir, "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+	envFile := filepath.Join(dir, ".env")
+	g.Expect(os.WriteFile(envFile, []byte("TEST_ENVFILE_NAMESPACE=apps\nTEST_ENVFILE_REPLICAS=1\n"), 0644)).To(Succeed())
+
+	// The process environment takes precedence over the env file.
+	t.Setenv("TEST_ENVFILE_REPLICAS", "3")
+
+	builder := NewBundleBuilder(cuecontext.New(), []string{file})
+	builder.SetEnvFile(envFile)
+	g.Expect(builder.InitWorkspace(t.TempDir(), GetEnv())).To(Succeed())
+
+	v, _, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	b, err := builder.GetBundle(v)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(b.Instances[0].Namespace).To(Equal("apps"))
+	replicas, err := b.Instances[0].Values.LookupPath(cue.ParsePath("replicas")).Int64()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(replicas).To(BeEquivalentTo(3))
+
+	g.Expect(os.WriteFile(envFile, []byte("TEST_ENVFILE_NAMESPACE=apps\nTEST_ENVFILE_REPLICAS\n"), 0644)).To(Succeed())
+	err = builder.InitWorkspace(t.TempDir(), GetEnv())
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring(".env:2: invalid entry"))
+}
+
+func TestInitWorkspace_SOPS(t *testing.T) {
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        values: caching: enabled: true
+    }
+}
+`
+	// fakeSOPS writes a sops executable to PATH that checks that the
+	// encrypted document is passed through stdin and then runs the given script.
+	fakeSOPS := func(g *WithT, script string) {
+		binDir := t.TempDir()
+		content := "#!/bin/sh\ngrep -q '^sops:' || exit 2\n" + script
+		g.Expect(os.WriteFile(filepath.Join(binDir, "sops"), []byte(content), 0755)).To(Succeed())
+		t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+
+	g := NewWithT(t)
+	file := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+
+	encrypted, err := os.ReadFile("testdata/sops/values.enc.yaml")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(IsSOPSEncrypted(encrypted)).To(BeTrue())
+	g.Expect(IsSOPSEncrypted([]byte(bundle))).To(BeFalse())
+
+	t.Run("decrypts values in-memory", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeSOPS(g, `cat <<EOF
+bundle:
+    instances:
+        podinfo:
+            values:
+                caching:
+                    redisURL: tcp://:my-password@redis:6379
+EOF
+`)
+		workspace := t.TempDir()
+		cacheDir := t.TempDir()
+		builder := NewBundleBuilder(cuecontext.New(), []string{file, "testdata/sops/values.enc.yaml"})
+		builder.SetCacheDir(cacheDir)
+		g.Expect(builder.InitWorkspace(workspace, nil)).To(Succeed())
+
+		// reinitialise the workspace as done for each cluster by bundle apply
+		g.Expect(builder.InitWorkspace(workspace, nil)).To(Succeed())
+
+		v, _, err := builder.Build()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		url, err := b.Instances[0].Values.LookupPath(cue.ParsePath("caching.redisURL")).String()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(url).To(Equal("tcp://:my-password@redis:6379"))
+
+		for _, dir := range []string{workspace, cacheDir} {
+			entries, err := os.ReadDir(dir)
+			g.Expect(err).ToNot(HaveOccurred())
+			for _, entry := range entries {
+				data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(string(data)).ToNot(ContainSubstring("my-password"))
+			}
+		}
+	})
+
+	t.Run("fails without leaking the ciphertext", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeSOPS(g, `echo "Failed to get the data key required to decrypt the SOPS file." >&2
+exit 128
+`)
+		builder := NewBundleBuilder(cuecontext.New(), []string{file, "testdata/sops/values.enc.yaml"})
+		err := builder.InitWorkspace(t.TempDir(), nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("failed to decrypt values.enc.yaml"))
+		g.Expect(err.Error()).To(ContainSubstring("Failed to get the data key"))
+		g.Expect(err.Error()).ToNot(ContainSubstring("ENC["))
+	})
+}
+
+func TestBundle_SelectInstances(t *testing.T) {
+	newBundle := func() *Bundle {
+		return &Bundle{
+			Name: "apps",
+			Instances: []*BundleInstance{
+				{Name: "database"},
+				{Name: "backend", DependsOn: []string{"database"}},
+				{Name: "cache"},
+				{Name: "frontend", DependsOn: []string{"backend", "cache"}},
+				{Name: "worker"},
+			},
+		}
+	}
+	names := func(b *Bundle) []string {
+		var list []string
+		for _, instance := range b.Instances {
+			list = append(list, instance.Name)
+		}
+		return list
+	}
+
+	t.Run("selects instances with their dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		b := newBundle()
+		g.Expect(b.SelectInstances([]string{"frontend"}, true)).To(Succeed())
+		g.Expect(names(b)).To(Equal([]string{"database", "backend", "cache", "frontend"}))
+	})
+
+	t.Run("selects instances without dependencies", func(t *testing.T) {
+		g := NewWithT(t)
+		b := newBundle()
+		g.Expect(b.SelectInstances([]string{"worker", "frontend"}, false)).To(Succeed())
+		g.Expect(names(b)).To(Equal([]string{"frontend", "worker"}))
+	})
+
+	t.Run("fails for unknown instances", func(t *testing.T) {
+		g := NewWithT(t)
+		b := newBundle()
+		err := b.SelectInstances([]string{"web"}, true)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("available instances: database, backend, cache, frontend, worker"))
+		g.Expect(b.Instances).To(HaveLen(5))
+	})
+}
+
+func TestBundle_OverrideNamespace(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "apps"
+    instances: {
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "frontend"
+            values: {}
+        }
+        backend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "backend"
+            values: {}
+        }
+        redis: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/redis"
+            namespace: "redis"
+            namespaceOverridable: false
+            values: {}
+        }
+    }
+}
+`
+	file := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+
+	builder := NewBundleBuilder(cuecontext.New(), []string{file})
+	g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+
+	v, _, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	b, err := builder.GetBundle(v)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	skipped := b.OverrideNamespace("preview")
+	g.Expect(skipped).To(ConsistOf("redis"))
+
+	namespaces := make(map[string]string)
+	for _, instance := range b.Instances {
+		namespaces[instance.Name] = instance.Namespace
+	}
+	g.Expect(namespaces).To(Equal(map[string]string{
+		"frontend": "preview",
+		"backend":  "preview",
+		"redis":    "redis",
+	}))
+}
+
+type fakeObserver struct {
+	phases map[Phase]time.Duration
+}
+
+func (o *fakeObserver) ObservePhase(phase Phase, duration time.Duration) {
+	o.phases[phase] += duration
+}
+
+func TestBundleBuilder_Observer(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: string @timoni(runtime:string:NAMESPACE)
+        values: replicas: 2
+    }
+}
+`
+	file := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+
+	observer := &fakeObserver{phases: make(map[Phase]time.Duration)}
+	builder := NewBundleBuilder(cuecontext.New(), []string{file})
+	builder.SetObserver(observer)
+
+	g.Expect(builder.InitWorkspace(t.TempDir(), map[string]string{"NAMESPACE": "apps"})).To(Succeed())
+	g.Expect(observer.phases).To(HaveKey(PhaseInjection))
+
+	_, _, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(observer.phases).To(HaveLen(4))
+	g.Expect(observer.phases).To(HaveKey(PhaseLoading))
+	g.Expect(observer.phases).To(HaveKey(PhaseBuilding))
+	g.Expect(observer.phases).To(HaveKey(PhaseValidation))
+	for phase, duration := range observer.phases {
+		g.Expect(duration).To(BeNumerically(">", 0), string(phase))
+	}
+}
+
+func TestBundleBuilder_Logger(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: string @timoni(runtime:string:NAMESPACE)
+        values: replicas: 2
+    }
+}
+`
+	file := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+
+	var lines []string
+	log := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 1})
+
+	builder := NewBundleBuilder(cuecontext.New(), []string{file})
+	builder.SetLogger(log)
+
+	g.Expect(builder.InitWorkspace(t.TempDir(), map[string]string{"NAMESPACE": "apps"})).To(Succeed())
+	v, _, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = builder.GetBundle(v)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	output := strings.Join(lines, "\n")
+	for _, msg := range []string{
+		"injecting runtime values",
+		"loading workspace",
+		"building bundle",
+		"validating bundle",
+	} {
+		g.Expect(output).To(ContainSubstring(fmt.Sprintf(`"level"=1 "msg"="%s"`, msg)))
+	}
+	g.Expect(output).To(ContainSubstring(`"level"=0 "msg"="bundle built"`))
+	g.Expect(output).To(ContainSubstring(`"level"=0 "msg"="bundle loaded" "name"="podinfo" "instances"=1`))
+
+	lines = nil
+	builder = NewBundleBuilder(cuecontext.New(), []string{file})
+	builder.SetLogger(funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{}))
+	g.Expect(builder.InitWorkspace(t.TempDir(), map[string]string{"NAMESPACE": "apps"})).To(Succeed())
+	_, _, err = builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(lines).To(HaveLen(1))
+	g.Expect(lines[0]).To(ContainSubstring("bundle built"))
+}
+
+func TestBundleBuilder_LegacyTemplates(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "{{ .Env.NAMESPACE }}"
+        values: image: tag: "{{ .Values.tag }}"
+    }
+}
+`
+	plain := `
+bundle: instances: podinfo: values: message: "{{ .Env.NAMESPACE }}"
+`
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "bundle.tmpl.cue")
+	g.Expect(os.WriteFile(tmplFile, []byte(bundle), 0644)).To(Succeed())
+	plainFile := filepath.Join(dir, "plain.cue")
+	g.Expect(os.WriteFile(plainFile, []byte(plain), 0644)).To(Succeed())
+
+	t.Run("renders marked files", func(t *testing.T) {
+		g := NewWithT(t)
+		builder := NewBundleBuilder(cuecontext.New(), []string{tmplFile, plainFile})
+		builder.SetLegacyTemplates(true, map[string]any{"tag": "6.5.4"})
+
+		g.Expect(builder.InitWorkspace(t.TempDir(), map[string]string{"NAMESPACE": "apps"})).To(Succeed())
+		v, _, err := builder.Build()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		b, err := builder.GetBundle(v)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances[0].Namespace).To(Equal("apps"))
+
+		values := b.Instances[0].Values
+		tag, err := values.LookupPath(cue.ParsePath("image.tag")).String()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(tag).To(Equal("6.5.4"))
+
+		message, err := values.LookupPath(cue.ParsePath("message")).String()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(message).To(Equal("{{ .Env.NAMESPACE }}"))
+	})
+
+	t.Run("fails for missing template values", func(t *testing.T) {
+		g := NewWithT(t)
+		builder := NewBundleBuilder(cuecontext.New(), []string{tmplFile})
+		builder.SetLegacyTemplates(true, nil)
+
+		err := builder.InitWorkspace(t.TempDir(), map[string]string{"NAMESPACE": "apps"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("failed to render template bundle.tmpl.cue"))
+	})
+
+	t.Run("ignores marked files when disabled", func(t *testing.T) {
+		g := NewWithT(t)
+		builder := NewBundleBuilder(cuecontext.New(), []string{tmplFile})
+
+		g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+		files, err := builder.InjectedFiles()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(files[0].Content)).To(ContainSubstring(`"{{ .Env.NAMESPACE }}"`))
+	})
+}
+
+func TestBundleBuilder_Cache(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "%s"
+        values: replicas: 2
+    }
+}
+`
+	cacheDir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "bundle.cue")
+
+	build := func() (*Bundle, error) {
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		builder.SetCacheDir(cacheDir)
+		if err := builder.InitWorkspace(t.TempDir(), nil); err != nil {
+			return nil, err
+		}
+		v, _, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		return builder.GetBundle(v)
+	}
+
+	g.Expect(os.WriteFile(file, []byte(fmt.Sprintf(bundle, "apps")), 0644)).To(Succeed())
+	b, err := build()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(b.Instances[0].Namespace).To(Equal("apps"))
+
+	entries, err := filepath.Glob(filepath.Join(cacheDir, "*.bundle.cue"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(1))
+
+	// Tamper with the cache entry to assert that the second build reads from it.
+	data, err := os.ReadFile(entries[0])
+	g.Expect(err).ToNot(HaveOccurred())
+	data = []byte(strings.Replace(string(data), `"apps"`, `"cached"`, 1))
+	g.Expect(os.WriteFile(entries[0], data, 0644)).To(Succeed())
+
+	b, err = build()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(b.Instances[0].Namespace).To(Equal("cached"))
+	replicas, err := b.Instances[0].Values.LookupPath(cue.ParsePath("replicas")).Int64()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(replicas).To(BeEquivalentTo(2))
+
+	// Changing the input invalidates the cache.
+	g.Expect(os.WriteFile(file, []byte(fmt.Sprintf(bundle, "prod")), 0644)).To(Succeed())
+	b, err = build()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(b.Instances[0].Namespace).To(Equal("prod"))
+
+	entries, err = filepath.Glob(filepath.Join(cacheDir, "*.bundle.cue"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(2))
+}
+
+func TestBundleBuilder_CacheExternalValues(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "apps"
+        values: password: string @timoni(runtime:string:PASSWORD)
+    }
+}
+`
+	file := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+
+	cacheDir := t.TempDir()
+	builder := NewBundleBuilder(cuecontext.New(), []string{file})
+	builder.SetCacheDir(cacheDir)
+	g.Expect(builder.InitWorkspace(t.TempDir(), map[string]string{"PASSWORD": "my-password"})).To(Succeed())
+
+	v, _, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	b, err := builder.GetBundle(v)
+	g.Expect(err).ToNot(HaveOccurred())
+	password, err := b.Instances[0].Values.LookupPath(cue.ParsePath("password")).String()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(password).To(Equal("my-password"))
+
+	entries, err := os.ReadDir(cacheDir)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(BeEmpty())
+}
+
+func TestBundleBuilder_CacheEviction(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "apps"
+    }
+}
+`
+	file := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+
+	cacheDir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	for i := 0; i < bundleCacheMaxEntries; i++ {
+		entry := filepath.Join(cacheDir, fmt.Sprintf("%d.bundle.cue", i))
+		g.Expect(os.WriteFile(entry, []byte("{}"), 0644)).To(Succeed())
+		g.Expect(os.Chtimes(entry, old, old.Add(time.Duration(i)*time.Second))).To(Succeed())
+	}
+
+	builder := NewBundleBuilder(cuecontext.New(), []string{file})
+	builder.SetCacheDir(cacheDir)
+	g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+	_, _, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	entries, err := filepath.Glob(filepath.Join(cacheDir, "*.bundle.cue"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(entries).To(HaveLen(bundleCacheMaxEntries))
+	g.Expect(filepath.Join(cacheDir, "0.bundle.cue")).ToNot(BeAnExistingFile())
+	g.Expect(filepath.Join(cacheDir, "1.bundle.cue")).To(BeAnExistingFile())
+}
+
+func TestBundleBuilder_CUEVersion(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    cueVersion: "%s"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "apps"
+    }
+}
+`
+	version := NewBundleBuilder(cuecontext.New(), nil).CUEVersion()
+	g.Expect(version).ToNot(BeEmpty())
+	g.Expect(version).ToNot(Equal("unknown"))
+
+	build := func(constraint string) (*Bundle, error) {
+		file := filepath.Join(t.TempDir(), "bundle.cue")
+		if err := os.WriteFile(file, []byte(fmt.Sprintf(bundle, constraint)), 0644); err != nil {
+			return nil, err
+		}
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		if err := builder.InitWorkspace(t.TempDir(), nil); err != nil {
+			return nil, err
+		}
+		v, _, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		return builder.GetBundle(v)
+	}
+
+	t.Run("builds when the version matches", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build(">=" + version)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.CUEVersion).To(Equal(version))
+	})
+
+	t.Run("fails when the version differs", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := build("<0.1.0")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("the bundle requires CUE version <0.1.0, but the builder uses " + version))
+	})
+}
+
+func TestBundleBuilder_ConditionalValues(t *testing.T) {
+	bundle := `
+#domain: "%s"
+
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "apps"
+        values: replicas: 2
+        conditionalValues: [{
+            when: "#domain != \"\""
+            values: ingress: {
+                enabled: true
+                host:    #domain
+            }
+        }, {
+            when: "namespace == \"prod\""
+            values: replicas: 3
+        }]
+    }
+}
+`
+
+	buildWithCache := func(domain, cacheDir string) (*Bundle, error) {
+		file := filepath.Join(t.TempDir(), "bundle.cue")
+		if err := os.WriteFile(file, []byte(fmt.Sprintf(bundle, domain)), 0644); err != nil {
+			return nil, err
+		}
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		builder.SetCacheDir(cacheDir)
+		if err := builder.InitWorkspace(t.TempDir(), nil); err != nil {
+			return nil, err
+		}
+		v, _, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		return builder.GetBundle(v)
+	}
+
+	build := func(domain string) (*Bundle, error) {
+		return buildWithCache(domain, "")
+	}
+
+	t.Run("includes the values when the condition is true", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build("example.com")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(1))
+
+		values, err := b.Instances[0].Values.MarshalJSON()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(values)).To(MatchJSON(`{"replicas":2,"ingress":{"enabled":true,"host":"example.com"}}`))
+	})
+
+	t.Run("excludes the values when the condition is false", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build("")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(1))
+
+		values, err := b.Instances[0].Values.MarshalJSON()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(values)).To(MatchJSON(`{"replicas":2}`))
+	})
+
+	t.Run("evaluates the expressions from cache", func(t *testing.T) {
+		g := NewWithT(t)
+		cacheDir := t.TempDir()
+		for i := 0; i < 2; i++ {
+			b, err := buildWithCache("example.com", cacheDir)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(b.Instances).To(HaveLen(1))
+
+			values, err := b.Instances[0].Values.MarshalJSON()
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(values)).To(MatchJSON(`{"replicas":2,"ingress":{"enabled":true,"host":"example.com"}}`))
+
+			entries, err := filepath.Glob(filepath.Join(cacheDir, "*.bundle.cue"))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(entries).To(HaveLen(1))
+		}
+	})
+}
+
+func TestBundleBuilder_Overlays(t *testing.T) {
+	base := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "apps"
+            values: {
+                replicas: 1
+                ui: color: "blue"
+            }
+        }
+        backend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "apps"
+            values: replicas: 1
+        }
+    }
+}
+`
+	build := func(overlay string) (*Bundle, error) {
+		dir := t.TempDir()
+		baseFile := filepath.Join(dir, "bundle.cue")
+		overlayFile := filepath.Join(dir, "overlay.cue")
+		if err := os.WriteFile(baseFile, []byte(base), 0644); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(overlayFile, []byte(overlay), 0644); err != nil {
+			return nil, err
+		}
+		builder := NewBundleBuilder(cuecontext.New(), []string{baseFile})
+		builder.SetOverlays([]string{overlayFile})
+		if err := builder.InitWorkspace(t.TempDir(), nil); err != nil {
+			return nil, err
+		}
+		v, _, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		return builder.GetBundle(v)
+	}
+
+	t.Run("merges instances by name", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build(`
+bundle: instances: {
+    frontend: values: replicas: 3
+    cache: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/redis"
+        namespace: "apps"
+    }
+}
+`)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("podinfo"))
+		g.Expect(b.Instances).To(HaveLen(3))
+
+		instances := make(map[string]*BundleInstance)
+		for _, i := range b.Instances {
+			instances[i.Name] = i
+		}
+
+		frontend := instances["frontend"]
+		g.Expect(frontend).ToNot(BeNil())
+		replicas, err := frontend.Values.LookupPath(cue.ParsePath("replicas")).Int64()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replicas).To(BeEquivalentTo(3))
+		color, err := frontend.Values.LookupPath(cue.ParsePath("ui.color")).String()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(color).To(Equal("blue"))
+
+		backend := instances["backend"]
+		g.Expect(backend).ToNot(BeNil())
+		replicas, err = backend.Values.LookupPath(cue.ParsePath("replicas")).Int64()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replicas).To(BeEquivalentTo(1))
+
+		cache := instances["cache"]
+		g.Expect(cache).ToNot(BeNil())
+		g.Expect(cache.Module.Repository).To(Equal("oci://ghcr.io/stefanprodan/modules/redis"))
+	})
+
+	t.Run("fails on conflicting fields", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := build(`
+bundle: instances: backend: namespace: "prod"
+`)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("instance backend"))
+	})
+}
+
+func TestBundleBuilder_BundlePath(t *testing.T) {
+	bundle := `
+config: {
+    env: "staging"
+    myBundle: {
+        apiVersion: "v1alpha1"
+        name:       "podinfo"
+        instances: podinfo: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "apps"
+            values: replicas: 2
+        }
+    }
+}
+`
+	build := func(path string, overlays ...string) (*Bundle, error) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "bundle.cue")
+		if err := os.WriteFile(file, []byte(bundle), 0644); err != nil {
+			return nil, err
+		}
+		var overlayFiles []string
+		for i, overlay := range overlays {
+			overlayFile := filepath.Join(dir, fmt.Sprintf("overlay%d.cue", i))
+			if err := os.WriteFile(overlayFile, []byte(overlay), 0644); err != nil {
+				return nil, err
+			}
+			overlayFiles = append(overlayFiles, overlayFile)
+		}
+
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		builder.SetBundlePath(path)
+		builder.SetOverlays(overlayFiles)
+		if err := builder.InitWorkspace(t.TempDir(), nil); err != nil {
+			return nil, err
+		}
+		v, _, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		return builder.GetBundle(v)
+	}
+
+	t.Run("extracts the bundle from a custom path", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build("config.myBundle")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Name).To(Equal("podinfo"))
+		g.Expect(b.Instances).To(HaveLen(1))
+		g.Expect(b.Instances[0].Name).To(Equal("podinfo"))
+		g.Expect(b.Instances[0].Module.Version).To(Equal("latest"))
+	})
+
+	t.Run("merges overlays at the custom path", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build("config.myBundle", `config: myBundle: instances: podinfo: values: replicas: 3`)
+		g.Expect(err).ToNot(HaveOccurred())
+		replicas, err := b.Instances[0].Values.LookupPath(cue.ParsePath("replicas")).Int64()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(replicas).To(BeEquivalentTo(3))
+	})
+
+	t.Run("fails to find the bundle at the default path", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := build("")
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("fails on invalid path", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := build("config.[")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("invalid bundle path config.["))
+	})
+}
+
+func TestBundleBuilder_Strict(t *testing.T) {
+	bundle := `
+_replicas: 2
+#Values: replicas: int
+bundle: {
+	apiVersion: "v1alpha1"
+	name:       "podinfo"
+	instances: podinfo: {
+		module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+		namespace: "apps"
+		values: #Values & {replicas: _replicas}
+	}
+}
+`
+	build := func(data string, strict bool) (*Bundle, error) {
+		file := filepath.Join(t.TempDir(), "bundle.cue")
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			return nil, err
+		}
+
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		builder.SetStrict(strict)
+		if err := builder.InitWorkspace(t.TempDir(), nil); err != nil {
+			return nil, err
+		}
+		v, _, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		return builder.GetBundle(v)
+	}
+
+	t.Run("allows hidden fields and definitions", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build(bundle, true)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(1))
+	})
+
+	t.Run("ignores unknown fields by default", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build(bundle+"instaces: frontend: namespace: \"apps\"\n", false)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(b.Instances).To(HaveLen(1))
+	})
+
+	t.Run("fails on unknown fields", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := build(bundle+"instaces: frontend: namespace: \"apps\"\n", true)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unknown top-level field(s) instaces"))
+	})
+}
+
+func TestBundleBuilder_ForEach(t *testing.T) {
+	bundle := `
+bundle: {
+	apiVersion: "v1alpha1"
+	name:       "podinfo"
+	instances: podinfo: {
+		module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+		namespace: "apps"
+		values: region: "global"
+	}
+	forEach: regional: {
+		params: [{region: "eu"}, {region: "us"}, {region: "ap"}]
+		#template: {
+			#param: region: string
+			name:   "podinfo-\(#param.region)"
+			module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+			namespace: "apps-\(#param.region)"
+			dependsOn: ["podinfo"]
+			values: region: #param.region
+		}
+	}
+}
+`
+	build := func(data string) (*Bundle, error) {
+		file := filepath.Join(t.TempDir(), "bundle.cue")
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			return nil, err
+		}
+
+		builder := NewBundleBuilder(cuecontext.New(), []string{file})
+		if err := builder.InitWorkspace(t.TempDir(), nil); err != nil {
+			return nil, err
+		}
+		v, _, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		return builder.GetBundle(v)
+	}
+
+	t.Run("expands the template for each params", func(t *testing.T) {
+		g := NewWithT(t)
+		b, err := build(bundle)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var names []string
+		for _, instance := range b.Instances {
+			names = append(names, instance.Name)
+		}
+		g.Expect(names).To(Equal([]string{"podinfo", "podinfo-ap", "podinfo-eu", "podinfo-us"}))
+
+		for _, instance := range b.Instances[1:] {
+			region := strings.TrimPrefix(instance.Name, "podinfo-")
+			g.Expect(instance.Namespace).To(Equal("apps-" + region))
+			g.Expect(instance.DependsOn).To(Equal([]string{"podinfo"}))
+			g.Expect(instance.Values.LookupPath(cue.ParsePath("region")).String()).To(Equal(region))
+		}
+	})
+
+	t.Run("fails on name collision with an instance", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := build(bundle + `
+bundle: forEach: global: {
+	params: [{name: "podinfo"}]
+	#template: {
+		#param: name: string
+		name: #param.name
+		module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+		namespace: "apps"
+	}
+}
+`)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("instance podinfo is already defined in the bundle"))
+	})
+
+	t.Run("fails on name collision between params", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := build(strings.Replace(bundle, `{region: "ap"}`, `{region: "eu"}`, 1))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("instance podinfo-eu is already generated by forEach regional"))
+	})
+}
+
+func TestBundleBuilder_Warnings(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: podinfo: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "apps"
+        values: replicas: 2 @timoni(runtime:REPLICAS)
+    }
+}
+`
+	file := filepath.Join(t.TempDir(), "bundle.cue")
+	g.Expect(os.WriteFile(file, []byte(bundle), 0644)).To(Succeed())
+
+	builder := NewBundleBuilder(cuecontext.New(), []string{file})
+	g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+
+	v, warnings, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(warnings).To(HaveLen(1))
+	g.Expect(warnings[0]).To(ContainSubstring("bundle.cue:8:"))
+	g.Expect(warnings[0]).To(ContainSubstring("unknown attribute '@timoni(runtime:REPLICAS)' is ignored"))
+
+	b, err := builder.GetBundle(v)
+	g.Expect(err).ToNot(HaveOccurred())
+	replicas, err := b.Instances[0].Values.LookupPath(cue.ParsePath("replicas")).Int64()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(replicas).To(BeEquivalentTo(2))
+}
+
+func TestBundleBuilder_ForEachInstance(t *testing.T) {
+	g := NewWithT(t)
+	bundle := `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+    instances: {
+        frontend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "apps"
+            dependsOn: ["backend"]
+        }
+        backend: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+            namespace: "apps"
+        }
+        cache: {
+            module: url: "oci://ghcr.io/stefanprodan/modules/redis"
+            namespace: "apps"
+        }
+    }
+}
+`
+	ctx := cuecontext.New()
+	builder := NewBundleBuilder(ctx, []string{})
+	g.Expect(builder.ForEachInstance(nil)).To(MatchError(ContainSubstring("GetBundle must be called")))
+
+	_, err := builder.GetBundle(ctx.CompileString(bundle))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	builder.SetRenderer(func(instance *BundleInstance) ([]*unstructured.Unstructured, error) {
+		object := &unstructured.Unstructured{}
+		object.SetAPIVersion("v1")
+		object.SetKind("ConfigMap")
+		object.SetName(instance.Name)
+		object.SetNamespace(instance.Namespace)
+		return []*unstructured.Unstructured{object}, nil
+	})
+
+	var calls []string
+	err = builder.ForEachInstance(func(instance BundleInstance, objects []*unstructured.Unstructured) error {
+		g.Expect(objects).To(HaveLen(1))
+		g.Expect(objects[0].GetName()).To(Equal(instance.Name))
+		calls = append(calls, instance.Name)
+		return nil
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(calls).To(Equal([]string{"backend", "cache", "frontend"}))
+
+	calls = nil
+	err = builder.ForEachInstance(func(instance BundleInstance, objects []*unstructured.Unstructured) error {
+		calls = append(calls, instance.Name)
+		return fmt.Errorf("failed to write %s", instance.Name)
+	})
+	g.Expect(err).To(MatchError("failed to write backend"))
+	g.Expect(calls).To(HaveLen(1))
+}
+
+func TestBundleBuilder_SourceFiles(t *testing.T) {
+	g := NewWithT(t)
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"bundle.cue": `
+bundle: {
+    apiVersion: "v1alpha1"
+    name:       "podinfo"
+}
+`,
+		"frontend.cue": `
+bundle: instances: frontend: {
+    module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+    namespace: "podinfo"
+    values: ui: message: string @timoni(read:file:./message.txt)
+}
+`,
+		"backend.cue": `
+bundle: instances: {
+    backend: {
+        module: url: "oci://ghcr.io/stefanprodan/modules/podinfo"
+        namespace: "podinfo"
+        valuesFrom: "frontend"
+    }
+    cache: {
+        module: url: "file://./testdata/module"
+        namespace: "podinfo"
+    }
+}
+`,
+		"message.txt": "hello",
+	}
+	for name, content := range files {
+		g.Expect(os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	path := func(name string) string {
+		return filepath.Join(tmpDir, name)
+	}
+	builder := NewBundleBuilder(cuecontext.New(), []string{path("bundle.cue"), path("frontend.cue"), path("backend.cue")})
+	g.Expect(builder.InitWorkspace(t.TempDir(), nil)).To(Succeed())
+
+	_, err := builder.SourceFiles("frontend")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("GetBundle must be called before SourceFiles"))
+
+	v, _, err := builder.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = builder.GetBundle(v)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	modPath, err := filepath.Abs("testdata/module")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	for name, expected := range map[string][]string{
+		"frontend": {path("bundle.cue"), path("frontend.cue"), path("message.txt")},
+		"backend":  {path("backend.cue"), path("bundle.cue"), path("frontend.cue"), path("message.txt")},
+		"cache":    {path("backend.cue"), path("bundle.cue"), modPath},
+	} {
+		sources, err := builder.SourceFiles(name)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(sources).To(ConsistOf(expected), name)
+	}
+
+	_, err = builder.SourceFiles("unknown")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestDeclaredInstances(t *testing.T) {
+	g := NewWithT(t)
+	path := []string{"bundle", "instances"}
+
+	for src, expected := range map[string][]string{
+		`bundle: instances: {b: {}, a: {}}`:                  {"a", "b"},
+		`bundle: {name: "test", instances: a: {}}`:           {"a"},
+		`bundle: name: "test"`:                               nil,
+		`bundle: instances: {for n in ["a", "b"] {(n): {}}}`: nil,
+		`#instances: a: {}
+bundle: instances: #instances`: nil,
+	} {
+		f, err := parser.ParseFile("bundle.cue", src)
+		g.Expect(err).ToNot(HaveOccurred())
+		names, ok := declaredInstances(f, path)
+		g.Expect(names).To(Equal(expected), src)
+		g.Expect(ok).To(Equal(expected != nil), src)
+	}
 }
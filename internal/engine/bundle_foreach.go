@@ -0,0 +1,91 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+
+	"cuelang.org/go/cue"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// expandForEach returns a new value with the instances generated by the bundle templates
+// found at forEachPath added to the instances found at instancesPath.
+// For every item of the template params, the template is filled with the item
+// at '#param', and the resulting instance is named after the template 'name' field.
+// The generated names must not collide with each other or with the bundle instances.
+func expandForEach(ctx *cue.Context, v cue.Value, forEachPath, instancesPath cue.Path) (cue.Value, error) {
+	forEach := v.LookupPath(forEachPath)
+	if !forEach.Exists() {
+		return v, nil
+	}
+
+	instances := v.LookupPath(instancesPath)
+	generated := make(map[string]string)
+
+	iter, err := forEach.Fields()
+	if err != nil {
+		return v, err
+	}
+	for iter.Next() {
+		key := iter.Selector().Unquoted()
+
+		template := iter.Value().LookupPath(cue.ParsePath(apiv1.BundleForEachTemplateSelector.String()))
+		if !template.Exists() {
+			return v, fmt.Errorf("%s is missing from forEach %s", apiv1.BundleForEachTemplateSelector, key)
+		}
+
+		params, err := iter.Value().LookupPath(cue.ParsePath(apiv1.BundleForEachParamsSelector.String())).List()
+		if err != nil {
+			return v, fmt.Errorf("decoding %s of forEach %s failed: %w", apiv1.BundleForEachParamsSelector, key, err)
+		}
+
+		for i := 0; params.Next(); i++ {
+			instance := template.FillPath(cue.ParsePath(apiv1.BundleForEachParamSelector.String()), params.Value())
+			if err := instance.Err(); err != nil {
+				return v, fmt.Errorf("forEach %s: applying %s[%d] failed: %w",
+					key, apiv1.BundleForEachParamsSelector, i, err)
+			}
+
+			name, err := instance.LookupPath(cue.ParsePath(apiv1.BundleForEachNameSelector.String())).String()
+			if err != nil {
+				return v, fmt.Errorf("forEach %s: deriving the instance name from %s[%d] failed: %w",
+					key, apiv1.BundleForEachParamsSelector, i, err)
+			}
+
+			if other, ok := generated[name]; ok {
+				return v, fmt.Errorf("forEach %s: instance %s is already generated by forEach %s", key, name, other)
+			}
+			if instances.LookupPath(cue.MakePath(cue.Str(name))).Exists() {
+				return v, fmt.Errorf("forEach %s: instance %s is already defined in the bundle", key, name)
+			}
+			generated[name] = key
+
+			// Copy the instance fields without the name and the template definitions.
+			out, err := fillFieldsExcept(ctx.CompileString("{}"), instance, nil,
+				[]cue.Selector{cue.Str(apiv1.BundleForEachNameSelector.String())})
+			if err != nil {
+				return v, err
+			}
+
+			p := cue.MakePath(append(instancesPath.Selectors(), cue.Str(name))...)
+			v = v.FillPath(p, out)
+		}
+	}
+	return v, v.Err()
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+
+	"cuelang.org/go/cue"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// mergeBundleOverlay returns a new value containing the base bundle with the overlay merged on top.
+// The bundle fields are unified, while the instances found at the given path
+// are merged by name using mergeBundleInstance.
+// The result is unified with the bundle schema, as the overlay-only instances are not validated.
+func mergeBundleOverlay(ctx *cue.Context, base, overlay cue.Value, schema string, instancesPath cue.Path) (cue.Value, error) {
+	out := ctx.CompileString(schema)
+	if out.Err() != nil {
+		return out, fmt.Errorf("compiling bundle schema failed: %w", out.Err())
+	}
+
+	// Copy all the fields, except for the instances, from the base and the overlay.
+	for _, v := range []cue.Value{base, overlay} {
+		var err error
+		out, err = fillFieldsExcept(out, v, nil, instancesPath.Selectors())
+		if err != nil {
+			return out, err
+		}
+	}
+	if err := out.Validate(); err != nil {
+		return out, fmt.Errorf("failed to merge overlay: %w", err)
+	}
+
+	baseInstances := base.LookupPath(instancesPath)
+	overlayInstances := overlay.LookupPath(instancesPath)
+
+	iter, err := baseInstances.Fields()
+	if err != nil {
+		return out, err
+	}
+	for iter.Next() {
+		p := cue.MakePath(append(instancesPath.Selectors(), iter.Selector())...)
+		instance := iter.Value()
+		if o := overlayInstances.LookupPath(cue.MakePath(iter.Selector())); o.Exists() {
+			instance, err = mergeBundleInstance(ctx, iter.Selector().Unquoted(), instance, o)
+			if err != nil {
+				return out, err
+			}
+		}
+		out = out.FillPath(p, instance)
+	}
+
+	if overlayInstances.Exists() {
+		iter, err = overlayInstances.Fields()
+		if err != nil {
+			return out, err
+		}
+		for iter.Next() {
+			if baseInstances.LookupPath(cue.MakePath(iter.Selector())).Exists() {
+				continue
+			}
+			p := cue.MakePath(append(instancesPath.Selectors(), iter.Selector())...)
+			out = out.FillPath(p, iter.Value())
+		}
+	}
+
+	return out, nil
+}
+
+// fillFieldsExcept fills out with the fields of the value found at the prefix path,
+// descending into the fields along the except path, and skipping the field at its end.
+func fillFieldsExcept(out, v cue.Value, prefix, except []cue.Selector) (cue.Value, error) {
+	if len(except) == 0 {
+		return out, nil
+	}
+
+	value := v.LookupPath(cue.MakePath(prefix...))
+	if !value.Exists() {
+		return out, nil
+	}
+
+	iter, err := value.Fields()
+	if err != nil {
+		return out, err
+	}
+	for iter.Next() {
+		p := append(append([]cue.Selector{}, prefix...), iter.Selector())
+		if iter.Selector().String() == except[0].String() {
+			out, err = fillFieldsExcept(out, v, p, except[1:])
+			if err != nil {
+				return out, err
+			}
+			continue
+		}
+		out = out.FillPath(cue.MakePath(p...), iter.Value())
+	}
+	return out, nil
+}
+
+// mergeBundleInstance returns a new instance value with the overlay values
+// merged on top of the base values, and the other fields unified.
+// If the fields can't be unified, an error containing the instance name is returned.
+func mergeBundleInstance(ctx *cue.Context, name string, base, overlay cue.Value) (cue.Value, error) {
+	out := ctx.CompileString("{}")
+	valuesPath := cue.ParsePath(apiv1.BundleValuesSelector.String())
+
+	for _, v := range []cue.Value{base, overlay} {
+		iter, err := v.Fields()
+		if err != nil {
+			return out, fmt.Errorf("failed to merge overlay of instance %s: %w", name, err)
+		}
+		for iter.Next() {
+			p := cue.MakePath(iter.Selector())
+			if p.String() != valuesPath.String() {
+				out = out.FillPath(p, iter.Value())
+			}
+		}
+	}
+	if err := out.Validate(); err != nil {
+		return out, fmt.Errorf("failed to merge overlay of instance %s: %w", name, err)
+	}
+
+	values := base.LookupPath(valuesPath)
+	if o := overlay.LookupPath(valuesPath); o.Exists() {
+		if values.Exists() {
+			values, _ = MergeValue(o, values)
+		} else {
+			values = o
+		}
+	}
+	if values.Exists() {
+		out = out.FillPath(valuesPath, values)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// bundleSource holds the instances declared by a bundle file
+// and the local files read by its @timoni() attributes.
+type bundleSource struct {
+	// path is the absolute path of the bundle file.
+	path string
+
+	// instances are the names of the instances declared in the file,
+	// nil means the file is shared by all the bundle instances.
+	instances []string
+
+	// reads are the absolute paths of the files read by the injector.
+	reads []string
+}
+
+// newBundleSource records the instances declared in the parsed bundle file
+// and the files referenced by its read attributes.
+func (b *BundleBuilder) newBundleSource(file string, node ast.Node, dir string) (bundleSource, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return bundleSource{}, err
+	}
+
+	var labels []string
+	for _, sel := range cue.ParsePath(b.selector(apiv1.BundleInstancesSelector)).Selectors() {
+		labels = append(labels, sel.Unquoted())
+	}
+
+	src := bundleSource{path: path}
+	src.instances, _ = declaredInstances(node, labels)
+	for _, fp := range b.injector.ListReadFiles(node, dir) {
+		if abs, err := filepath.Abs(fp); err == nil {
+			src.reads = append(src.reads, abs)
+		}
+	}
+	return src, nil
+}
+
+// declaredInstances returns the sorted names of the instances declared
+// in the bundle file at the given path. It returns false if the file doesn't
+// declare any instances, or if they can't be determined without evaluating
+// the file, e.g. when the instances are generated by comprehensions.
+func declaredInstances(node ast.Node, path []string) ([]string, bool) {
+	var decls []ast.Decl
+	switch n := node.(type) {
+	case *ast.File:
+		decls = n.Decls
+	case *ast.StructLit:
+		decls = n.Elts
+	default:
+		return nil, false
+	}
+
+	names := make(map[string]bool)
+	if !collectInstances(decls, path, names) || len(names) == 0 {
+		return nil, false
+	}
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, true
+}
+
+// collectInstances adds to names the labels of the fields found at the given path.
+func collectInstances(decls []ast.Decl, path []string, names map[string]bool) bool {
+	for _, decl := range decls {
+		switch d := decl.(type) {
+		case *ast.Package, *ast.ImportDecl, *ast.CommentGroup, *ast.Attribute, *ast.LetClause:
+			continue
+		case *ast.Field:
+			name, _, err := ast.LabelName(d.Label)
+			if err != nil {
+				return false
+			}
+			if len(path) == 0 {
+				names[name] = true
+				continue
+			}
+			if name != path[0] {
+				continue
+			}
+			st, ok := d.Value.(*ast.StructLit)
+			if !ok {
+				return false
+			}
+			if !collectInstances(st.Elts, path[1:], names) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SourceFiles returns the sorted paths of the local files from which the named
+// instance is built: the bundle files that declare the instance or that don't declare
+// any instances, the files read by their @timoni() attributes, and the directory of
+// the local module. The files of the instances from which the values are inherited
+// are included too. GetBundle must be called before SourceFiles.
+func (b *BundleBuilder) SourceFiles(name string) ([]string, error) {
+	if b.bundle == nil {
+		return nil, fmt.Errorf("no bundle found, GetBundle must be called before SourceFiles")
+	}
+
+	index := make(map[string]*BundleInstance, len(b.bundle.Instances))
+	for _, instance := range b.bundle.Instances {
+		index[instance.Name] = instance
+	}
+	instance, ok := index[name]
+	if !ok {
+		return nil, fmt.Errorf("instance %s not found in bundle %s", name, b.bundle.Name)
+	}
+
+	files := make(map[string]bool)
+	addSources := func(name string) {
+		for _, src := range b.bundleSources {
+			if src.instances != nil && !slices.Contains(src.instances, name) {
+				continue
+			}
+			files[src.path] = true
+			for _, fp := range src.reads {
+				files[fp] = true
+			}
+		}
+	}
+
+	addSources(name)
+	seen := map[string]bool{name: true}
+	for from := instance.ValuesFrom; from != "" && !seen[from]; {
+		seen[from] = true
+		addSources(from)
+		parent, ok := index[from]
+		if !ok {
+			break
+		}
+		from = parent.ValuesFrom
+	}
+
+	if modPath, ok := strings.CutPrefix(instance.Module.Repository, apiv1.LocalModulePrefix); ok {
+		files[modPath] = true
+	}
+
+	list := make([]string, 0, len(files))
+	for fp := range files {
+		list = append(list, fp)
+	}
+	sort.Strings(list)
+	return list, nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// templateMarker is the file name marker of the bundle files rendered with Go text/template.
+const templateMarker = ".tmpl."
+
+// isTemplateFile returns true if the file name contains the template marker,
+// e.g. 'bundle.tmpl.cue'.
+func isTemplateFile(name string) bool {
+	return strings.Contains(name, templateMarker)
+}
+
+// renderTemplate executes the Go template in data with the runtime values
+// exposed as '.Env' and the given values as '.Values'.
+// Referencing a missing key fails the rendering.
+func renderTemplate(name string, data []byte, env map[string]string, values map[string]any) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	if env == nil {
+		env = map[string]string{}
+	}
+	if values == nil {
+		values = map[string]any{}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]any{
+		"Env":    env,
+		"Values": values,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
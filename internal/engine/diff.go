@@ -0,0 +1,190 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/fluxcd/pkg/ssa"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ChangeSet holds the differences between the built objects
+// of an instance and their live state in the cluster.
+type ChangeSet struct {
+	Entries []ObjectDiff
+}
+
+// ObjectDiff holds the differences between a built object and its live state.
+type ObjectDiff struct {
+	// Subject is the object ID in the format 'Kind/Namespace/Name'.
+	Subject string
+
+	// Set is the name of the resource set the object belongs to.
+	Set string
+
+	// Action is CreatedAction if the object doesn't exist in the cluster,
+	// ConfiguredAction if it has changes and UnchangedAction otherwise.
+	Action ssa.Action
+
+	// Object is the built object.
+	Object *unstructured.Unstructured
+
+	// Changes are the fields of the built object whose value
+	// differs from the live object, sorted by path.
+	Changes []FieldChange
+}
+
+// FieldChange holds the live and the desired value of an object field.
+type FieldChange struct {
+	// Path is the field path, e.g. 'spec.template.spec.containers[0].image'.
+	Path string
+
+	// Old is the live value, nil if the field is not set in the cluster.
+	Old any
+
+	// New is the value of the built object.
+	New any
+}
+
+// DiffInstance compares the objects of the instance resource sets with their
+// live state read from the cluster. Only the fields set in the built objects
+// are compared, the fields defaulted or managed by the cluster are ignored.
+func DiffInstance(ctx context.Context, sets []ResourceSet, reader client.Reader) (*ChangeSet, error) {
+	cs := &ChangeSet{}
+	for _, set := range sets {
+		for _, object := range set.Objects {
+			diff := ObjectDiff{
+				Subject: ssa.FmtUnstructured(object),
+				Set:     set.Name,
+				Object:  object,
+			}
+
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(object.GroupVersionKind())
+			err := reader.Get(ctx, client.ObjectKeyFromObject(object), live)
+			switch {
+			case apierrors.IsNotFound(err):
+				diff.Action = ssa.CreatedAction
+			case err != nil:
+				return nil, fmt.Errorf("failed to get %s: %w", diff.Subject, err)
+			default:
+				diff.Changes = diffFields("", object.Object, live.Object)
+				sort.SliceStable(diff.Changes, func(i, j int) bool {
+					return diff.Changes[i].Path < diff.Changes[j].Path
+				})
+				diff.Action = ssa.UnchangedAction
+				if len(diff.Changes) > 0 {
+					diff.Action = ssa.ConfiguredAction
+				}
+			}
+
+			cs.Entries = append(cs.Entries, diff)
+		}
+	}
+	return cs, nil
+}
+
+// diffFields returns the changes between the desired and the live values
+// for all the fields set in the desired value. Empty maps and lists
+// match unset live fields, as they are dropped by the API server.
+func diffFields(path string, desired, live any) []FieldChange {
+	switch d := desired.(type) {
+	case map[string]any:
+		l, ok := live.(map[string]any)
+		if !ok {
+			if len(d) == 0 && live == nil {
+				return nil
+			}
+			return []FieldChange{{Path: path, Old: live, New: desired}}
+		}
+		var changes []FieldChange
+		for key, value := range d {
+			changes = append(changes, diffFields(fieldPath(path, key), value, l[key])...)
+		}
+		return changes
+	case []any:
+		l, ok := live.([]any)
+		if !ok || len(l) != len(d) {
+			if len(d) == 0 && live == nil {
+				return nil
+			}
+			return []FieldChange{{Path: path, Old: live, New: desired}}
+		}
+		var changes []FieldChange
+		for i := range d {
+			changes = append(changes, diffFields(fmt.Sprintf("%s[%d]", path, i), d[i], l[i])...)
+		}
+		return changes
+	default:
+		if scalarEqual(desired, live) {
+			return nil
+		}
+		return []FieldChange{{Path: path, Old: live, New: desired}}
+	}
+}
+
+// scalarEqual reports whether the values are equal, numbers of
+// different types, e.g. int64 and float64, are compared by value.
+func scalarEqual(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	x, ok := toFloat(a)
+	if !ok {
+		return false
+	}
+	y, ok := toFloat(b)
+	return ok && x == y
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+var simpleFieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// fieldPath appends the key to the path, keys containing
+// dots or other special characters are enclosed in brackets.
+func fieldPath(path, key string) string {
+	if !simpleFieldName.MatchString(key) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDiffInstance(t *testing.T) {
+	g := NewWithT(t)
+
+	live := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+			Labels: map[string]string{
+				"app.kubernetes.io/name": "app",
+			},
+		},
+		Data: map[string]string{
+			"level": "info",
+			"port":  "8080",
+		},
+	}
+	reader := fake.NewClientBuilder().WithObjects(live).Build()
+
+	configMap := func(name string, data map[string]any) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]any{
+				"name":      name,
+				"namespace": "default",
+				"labels": map[string]any{
+					"app.kubernetes.io/name": "app",
+				},
+			},
+			"data": data,
+		}}
+	}
+
+	sets := []ResourceSet{
+		{
+			Name: "app",
+			Objects: []*unstructured.Unstructured{
+				configMap("app", map[string]any{"level": "debug", "port": "8080", "tls": "true"}),
+				configMap("new", map[string]any{"level": "info"}),
+			},
+		},
+		{
+			Name:    "unchanged",
+			Objects: []*unstructured.Unstructured{configMap("app", map[string]any{"port": "8080"})},
+		},
+	}
+
+	cs, err := DiffInstance(context.Background(), sets, reader)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cs.Entries).To(HaveLen(3))
+
+	modified := cs.Entries[0]
+	g.Expect(modified.Subject).To(Equal("ConfigMap/default/app"))
+	g.Expect(modified.Set).To(Equal("app"))
+	g.Expect(modified.Action).To(Equal(ssa.ConfiguredAction))
+	g.Expect(modified.Changes).To(Equal([]FieldChange{
+		{Path: "data.level", Old: "info", New: "debug"},
+		{Path: "data.tls", Old: nil, New: "true"},
+	}))
+
+	g.Expect(cs.Entries[1].Subject).To(Equal("ConfigMap/default/new"))
+	g.Expect(cs.Entries[1].Action).To(Equal(ssa.CreatedAction))
+	g.Expect(cs.Entries[1].Changes).To(BeEmpty())
+
+	g.Expect(cs.Entries[2].Action).To(Equal(ssa.UnchangedAction))
+	g.Expect(cs.Entries[2].Changes).To(BeEmpty())
+}
+
+func TestDiffFields(t *testing.T) {
+	g := NewWithT(t)
+
+	desired := map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]any{"app.kubernetes.io/version": "v2"},
+		},
+		"spec": map[string]any{
+			"replicas":  int64(2),
+			"resources": map[string]any{},
+			"containers": []any{
+				map[string]any{"name": "app", "image": "app:v2"},
+			},
+			"ports": []any{int64(80), int64(443)},
+		},
+	}
+	live := map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]any{"app.kubernetes.io/version": "v1"},
+			"uid":         "123",
+		},
+		"spec": map[string]any{
+			"replicas": float64(2),
+			"containers": []any{
+				map[string]any{"name": "app", "image": "app:v1", "imagePullPolicy": "IfNotPresent"},
+			},
+			"ports": []any{int64(80)},
+		},
+	}
+
+	changes := diffFields("", desired, live)
+	g.Expect(changes).To(ConsistOf(
+		FieldChange{Path: `metadata.annotations["app.kubernetes.io/version"]`, Old: "v1", New: "v2"},
+		FieldChange{Path: "spec.containers[0].image", Old: "app:v1", New: "app:v2"},
+		FieldChange{Path: "spec.ports", Old: []any{int64(80)}, New: []any{int64(80), int64(443)}},
+	))
+}
@@ -23,6 +23,9 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 	"github.com/stefanprodan/timoni/internal/oci"
@@ -37,6 +40,10 @@ type Fetcher struct {
 	version  string
 	creds    string
 	insecure bool
+	retry    oci.RetryOptions
+	mirrors  []oci.Mirror
+	layers   *oci.LayerCache
+	verify   oci.VerifyOptions
 }
 
 // NewFetcher creates a Fetcher for the given module.
@@ -49,9 +56,36 @@ func NewFetcher(ctx context.Context, src, version, dst, cacheDir, creds string,
 		cacheDir: cacheDir,
 		creds:    creds,
 		insecure: insecure,
+		retry:    oci.DefaultRetryOptions(),
 	}
 }
 
+// SetRetry sets the maximum number of attempts and the base delay
+// for retrying the module pull on transient registry errors.
+func (f *Fetcher) SetRetry(attempts int, delay time.Duration) {
+	f.retry = oci.RetryOptions{
+		Attempts: attempts,
+		Delay:    delay,
+	}
+}
+
+// SetMirrors sets the registry mirrors used to rewrite the module URL before pulling.
+func (f *Fetcher) SetMirrors(mirrors []oci.Mirror) {
+	f.mirrors = mirrors
+}
+
+// SetLayerCache sets the cache shared with other fetchers, so that
+// the module layers already pulled by them are not pulled again.
+func (f *Fetcher) SetLayerCache(layers *oci.LayerCache) {
+	f.layers = layers
+}
+
+// SetVerify sets the trusted signers of the module. If set, the
+// remote module is pulled only if it has a valid Cosign signature.
+func (f *Fetcher) SetVerify(verify oci.VerifyOptions) {
+	f.verify = verify
+}
+
 func (f *Fetcher) GetModuleRoot() string {
 	return filepath.Join(f.dst, "module")
 }
@@ -59,8 +93,8 @@ func (f *Fetcher) GetModuleRoot() string {
 // Fetch copies the module contents to the destination directory.
 // If the module source is a remote OCI repository, the artifact is pulled
 // from the registry and its contents extracted to the destination dir.
-// If the module source is a local directory, the module required
-// files are validated and the module contents is copied to the
+// If the module source is a local directory, optionally prefixed with 'file://',
+// the module required files are validated and the module contents is copied to the
 // destination dir while excluding files based on the timoni.ignore patters.
 func (f *Fetcher) Fetch() (*apiv1.ModuleReference, error) {
 	dstDir := f.GetModuleRoot()
@@ -72,40 +106,96 @@ func (f *Fetcher) Fetch() (*apiv1.ModuleReference, error) {
 	return f.fetchLocalModule(dstDir)
 }
 
-func (f *Fetcher) fetchLocalModule(dstDir string) (*apiv1.ModuleReference, error) {
-	if fs, err := os.Stat(f.src); err != nil || !fs.IsDir() {
-		return nil, fmt.Errorf("module not found at path %s", f.src)
+// Resolve checks that the module exists without fetching its contents.
+// If the module source is a remote OCI repository, the manifest of the module
+// version is looked up in the registry. If the module source is a local directory,
+// the presence of the module required files is checked.
+func (f *Fetcher) Resolve() error {
+	if strings.HasPrefix(f.src, "oci://") {
+		ociURL := f.remoteURL()
+		opts := oci.Options(f.ctx, f.creds, f.insecure)
+		return oci.Retry(f.ctx, f.retry, func() error {
+			return oci.CheckArtifact(ociURL, opts)
+		})
+	}
+
+	return checkLocalModule(strings.TrimPrefix(f.src, apiv1.LocalModulePrefix))
+}
+
+// checkLocalModule returns an error if the module required files are not found in the src dir.
+func checkLocalModule(src string) error {
+	if fs, err := os.Stat(src); err != nil || !fs.IsDir() {
+		return fmt.Errorf("module not found at path %s", src)
 	}
 
-	modFile := path.Join(f.src, "cue.mod", "module.cue")
-	timoniFile := path.Join(f.src, "timoni.cue")
-	valuesFile := path.Join(f.src, "values.cue")
+	modFile := path.Join(src, "cue.mod", "module.cue")
+	timoniFile := path.Join(src, "timoni.cue")
+	valuesFile := path.Join(src, "values.cue")
 
 	for _, requiredFile := range []string{modFile, timoniFile, valuesFile} {
 		if _, err := os.Stat(requiredFile); err != nil {
-			return nil, fmt.Errorf("required file not found: %s", requiredFile)
+			return fmt.Errorf("required file not found: %s", requiredFile)
 		}
 	}
 
+	return nil
+}
+
+func (f *Fetcher) fetchLocalModule(dstDir string) (*apiv1.ModuleReference, error) {
+	src := strings.TrimPrefix(f.src, apiv1.LocalModulePrefix)
+	if err := checkLocalModule(src); err != nil {
+		return nil, err
+	}
+
 	mr := apiv1.ModuleReference{
 		Repository: f.src,
 		Version:    defaultDevelVersion,
 		Digest:     "unknown",
 	}
 
-	return &mr, CopyModule(f.src, dstDir)
+	return &mr, CopyModule(src, dstDir)
 }
 
-func (f *Fetcher) fetchRemoteModule(dstDir string) (*apiv1.ModuleReference, error) {
-	ociURL := fmt.Sprintf("%s:%s", f.src, f.version)
+// remoteURL returns the OCI URL of the module version, rewritten to the matching mirror if any.
+func (f *Fetcher) remoteURL() string {
+	src := oci.RewriteURL(f.src, f.mirrors)
 	if strings.HasPrefix(f.version, "@") {
-		ociURL = fmt.Sprintf("%s%s", f.src, f.version)
+		return fmt.Sprintf("%s%s", src, f.version)
+	}
+	return fmt.Sprintf("%s:%s", src, f.version)
+}
+
+func (f *Fetcher) fetchRemoteModule(dstDir string) (*apiv1.ModuleReference, error) {
+	ociURL := f.remoteURL()
+
+	if f.verify.Enabled() {
+		opts := oci.Options(f.ctx, f.creds, f.insecure)
+		digest, err := oci.VerifyModule(logr.FromContextOrDiscard(f.ctx), ociURL, f.verify, opts)
+		if err != nil {
+			return nil, fmt.Errorf("verifying module signature failed: %w", err)
+		}
+
+		// Pull the verified artifact by digest, in case the tag was moved after the verification.
+		ociURL, err = oci.PinDigest(ociURL, digest)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
 		return nil, err
 	}
 
+	layers := f.layers
+	if layers == nil {
+		var err error
+		layers, err = oci.NewLayerCache(f.cacheDir)
+		if err != nil {
+			return nil, err
+		}
+		defer layers.Close()
+	}
+
 	opts := oci.Options(f.ctx, f.creds, f.insecure)
-	return oci.PullModule(ociURL, dstDir, f.cacheDir, opts)
+	return oci.PullModuleWithRetry(f.ctx, ociURL, dstDir, layers, opts, f.retry)
 }
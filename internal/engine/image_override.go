@@ -0,0 +1,142 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ImageOverride replaces the tag of the container images from a repository.
+type ImageOverride struct {
+	// Repository is the normalised name of the matched image repository.
+	Repository string
+
+	// MatchTag restricts the override to the images with this tag,
+	// when empty the images are matched by repository only.
+	MatchTag string
+
+	// Tag is the tag set on the matching images.
+	Tag string
+}
+
+// ParseImageOverride parses an override in the format 'repository[:tag]=tag',
+// e.g. 'ghcr.io/org/app=v2.0' or 'ghcr.io/org/app:v1.0=v2.0'.
+func ParseImageOverride(str string) (ImageOverride, error) {
+	src, tag, ok := strings.Cut(str, "=")
+	if !ok || src == "" || tag == "" {
+		return ImageOverride{}, fmt.Errorf("invalid image override '%s', must be in the format 'repository[:tag]=tag'", str)
+	}
+
+	repo, matchTag := splitImageTag(src)
+	repository, err := name.NewRepository(repo, name.WeakValidation)
+	if err != nil {
+		return ImageOverride{}, fmt.Errorf("invalid image override '%s': %w", str, err)
+	}
+	if _, err := name.NewTag(repo+":"+tag, name.WeakValidation); err != nil {
+		return ImageOverride{}, fmt.Errorf("invalid image override '%s': %w", str, err)
+	}
+
+	return ImageOverride{
+		Repository: repository.Name(),
+		MatchTag:   matchTag,
+		Tag:        tag,
+	}, nil
+}
+
+// String returns the override in the format 'repository[:tag]=tag'.
+func (o ImageOverride) String() string {
+	if o.MatchTag != "" {
+		return fmt.Sprintf("%s:%s=%s", o.Repository, o.MatchTag, o.Tag)
+	}
+	return fmt.Sprintf("%s=%s", o.Repository, o.Tag)
+}
+
+// Override returns the image with the tag replaced if it matches
+// the override repository and tag, and false otherwise.
+// The digest of a matching image is removed, as it pins the old tag.
+func (o ImageOverride) Override(image string) (string, bool) {
+	ref, err := name.ParseReference(image, name.WeakValidation)
+	if err != nil || ref.Context().Name() != o.Repository {
+		return image, false
+	}
+
+	repo, tag := splitImageTag(image)
+	if o.MatchTag != "" && tag != o.MatchTag {
+		return image, false
+	}
+	return repo + ":" + o.Tag, true
+}
+
+// OverrideImage returns the image rewritten by the first matching override,
+// or the image unchanged if no override matches.
+func OverrideImage(image string, overrides []ImageOverride) string {
+	for _, o := range overrides {
+		if newImage, ok := o.Override(image); ok {
+			return newImage
+		}
+	}
+	return image
+}
+
+// OverrideImages sets the tag of the matching images found in the objects,
+// under any field named 'image', and returns the number of rewritten images.
+func OverrideImages(objects []*unstructured.Unstructured, overrides []ImageOverride) int {
+	if len(overrides) == 0 {
+		return 0
+	}
+
+	count := 0
+	var walk func(v any)
+	walk = func(v any) {
+		switch x := v.(type) {
+		case map[string]any:
+			for key, val := range x {
+				if image, ok := val.(string); ok && key == "image" {
+					if newImage := OverrideImage(image, overrides); newImage != image {
+						x[key] = newImage
+						count++
+					}
+					continue
+				}
+				walk(val)
+			}
+		case []any:
+			for _, item := range x {
+				walk(item)
+			}
+		}
+	}
+
+	for _, object := range objects {
+		walk(object.Object)
+	}
+	return count
+}
+
+// splitImageTag returns the image without the digest, split into
+// the repository and the tag, which is empty if the image has no tag.
+func splitImageTag(image string) (string, string) {
+	repo, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		return repo[:i], repo[i+1:]
+	}
+	return repo, ""
+}
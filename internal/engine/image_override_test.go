@@ -0,0 +1,112 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseImageOverride(t *testing.T) {
+	g := NewWithT(t)
+
+	for value, expected := range map[string]ImageOverride{
+		"myrepo/app=v2.0":           {Repository: "index.docker.io/myrepo/app", Tag: "v2.0"},
+		"ghcr.io/org/api:v1=v1.1":   {Repository: "ghcr.io/org/api", MatchTag: "v1", Tag: "v1.1"},
+		"localhost:5000/web=latest": {Repository: "localhost:5000/web", Tag: "latest"},
+	} {
+		o, err := ParseImageOverride(value)
+		g.Expect(err).ToNot(HaveOccurred(), value)
+		g.Expect(o).To(Equal(expected), value)
+	}
+
+	o, err := ParseImageOverride("ghcr.io/org/api:v1=v1.1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(o.String()).To(Equal("ghcr.io/org/api:v1=v1.1"))
+
+	for _, value := range []string{"myrepo/app", "myrepo/app=", "=v2.0", "MyRepo/App=v2.0", "myrepo/app=v2.0:bad"} {
+		_, err := ParseImageOverride(value)
+		g.Expect(err).To(HaveOccurred(), value)
+		g.Expect(err.Error()).To(ContainSubstring("invalid image override"), value)
+	}
+}
+
+func TestOverrideImages(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "app"},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{
+					"initContainers": []any{
+						map[string]any{"name": "migrate", "image": "ghcr.io/org/api:v0"},
+					},
+					"containers": []any{
+						map[string]any{"name": "app", "image": "myrepo/app:v1.0@sha256:b49fbaac0eedc22c1cfcd26684707179cccbed0df205171bae3e1bae61326a10"},
+						map[string]any{"name": "api", "image": "ghcr.io/org/api:v1"},
+						map[string]any{"name": "proxy", "image": "docker.io/myrepo/proxy:v1.0"},
+					},
+				},
+			},
+		},
+	}}
+	job := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]any{"name": "job"},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{
+						map[string]any{"name": "job", "image": "docker.io/myrepo/app"},
+					},
+				},
+			},
+		},
+	}}
+
+	var overrides []ImageOverride
+	for _, value := range []string{"myrepo/app=v2.0", "ghcr.io/org/api:v1=v1.1"} {
+		o, err := ParseImageOverride(value)
+		g.Expect(err).ToNot(HaveOccurred())
+		overrides = append(overrides, o)
+	}
+	g.Expect(OverrideImages([]*unstructured.Unstructured{deployment, job}, overrides)).To(Equal(3))
+
+	images := func(object *unstructured.Unstructured, field string) []string {
+		containers, _, err := unstructured.NestedSlice(object.Object, "spec", "template", "spec", field)
+		g.Expect(err).ToNot(HaveOccurred())
+		var list []string
+		for _, c := range containers {
+			list = append(list, c.(map[string]any)["image"].(string))
+		}
+		return list
+	}
+
+	g.Expect(images(deployment, "containers")).To(Equal([]string{
+		"myrepo/app:v2.0",
+		"ghcr.io/org/api:v1.1",
+		"docker.io/myrepo/proxy:v1.0",
+	}))
+	g.Expect(images(deployment, "initContainers")).To(Equal([]string{"ghcr.io/org/api:v0"}))
+	g.Expect(images(job, "containers")).To(Equal([]string{"docker.io/myrepo/app:v2.0"}))
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SetManagedFieldsPreview sets on each object the managed fields entry that a server-side
+// apply performed by the given field manager would record, claiming all the fields set in the object.
+// The preview is computed without the OpenAPI schema, the lists of objects with a name field
+// are keyed by name, and the other lists are considered atomic.
+func SetManagedFieldsPreview(objects []*unstructured.Unstructured, manager string) error {
+	for _, object := range objects {
+		fields := make(map[string]any)
+		for key, value := range object.Object {
+			switch key {
+			case "apiVersion", "kind", "status":
+				continue
+			case "metadata":
+				if metadata, ok := value.(map[string]any); ok {
+					if set := metadataFieldsSet(metadata); len(set) > 0 {
+						fields["f:metadata"] = set
+					}
+				}
+				continue
+			}
+			fields["f:"+key] = fieldsSet(value)
+		}
+
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			return fmt.Errorf("computing managed fields of %s failed: %w", object.GetName(), err)
+		}
+
+		object.SetManagedFields([]metav1.ManagedFieldsEntry{
+			{
+				Manager:    manager,
+				Operation:  metav1.ManagedFieldsOperationApply,
+				APIVersion: object.GetAPIVersion(),
+				FieldsType: "FieldsV1",
+				FieldsV1:   &metav1.FieldsV1{Raw: raw},
+			},
+		})
+	}
+	return nil
+}
+
+// metadataFieldsSet returns the fields set of the object metadata,
+// without the fields identifying the object.
+func metadataFieldsSet(metadata map[string]any) map[string]any {
+	set := make(map[string]any)
+	for key, value := range metadata {
+		switch key {
+		case "name", "namespace", "generateName", "managedFields":
+			continue
+		}
+		set["f:"+key] = fieldsSet(value)
+	}
+	return set
+}
+
+// fieldsSet returns the FieldsV1 representation of the value.
+func fieldsSet(value any) map[string]any {
+	set := make(map[string]any)
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			set["f:"+key] = fieldsSet(field)
+		}
+	case []any:
+		for _, item := range v {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				return map[string]any{}
+			}
+			name, ok := obj["name"].(string)
+			if !ok {
+				return map[string]any{}
+			}
+			key, err := json.Marshal(map[string]string{"name": name})
+			if err != nil {
+				return map[string]any{}
+			}
+			itemSet := fieldsSet(obj)
+			itemSet["."] = map[string]any{}
+			set["k:"+string(key)] = itemSet
+		}
+	}
+	return set
+}
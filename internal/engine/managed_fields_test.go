@@ -0,0 +1,68 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSetManagedFieldsPreview(t *testing.T) {
+	g := NewWithT(t)
+
+	object := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":      "app",
+			"namespace": "default",
+			"labels":    map[string]any{"app": "web"},
+		},
+		"spec": map[string]any{
+			"replicas": int64(2),
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{
+						map[string]any{"name": "app", "image": "nginx", "args": []any{"-v"}},
+					},
+				},
+			},
+		},
+	}}
+
+	err := SetManagedFieldsPreview([]*unstructured.Unstructured{object}, "timoni")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	fields := object.GetManagedFields()
+	g.Expect(fields).To(HaveLen(1))
+	g.Expect(fields[0].Manager).To(Equal("timoni"))
+	g.Expect(fields[0].Operation).To(Equal(metav1.ManagedFieldsOperationApply))
+	g.Expect(fields[0].APIVersion).To(Equal("apps/v1"))
+	g.Expect(fields[0].FieldsType).To(Equal("FieldsV1"))
+	g.Expect(string(fields[0].FieldsV1.Raw)).To(MatchJSON(`{
+	"f:metadata": {"f:labels": {"f:app": {}}},
+	"f:spec": {
+		"f:replicas": {},
+		"f:template": {"f:spec": {"f:containers": {
+			"k:{\"name\":\"app\"}": {".": {}, "f:args": {}, "f:image": {}, "f:name": {}}
+		}}}
+	}
+}`))
+}
@@ -28,8 +28,15 @@ import (
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/build"
 	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/format"
 	"cuelang.org/go/cue/load"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/encoding/json"
+	"cuelang.org/go/encoding/yaml"
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-logr/logr"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 )
@@ -44,16 +51,22 @@ const (
 	defaultKubeVersion = "1.27.5"
 )
 
+// ReservedTags is the list of CUE tags and tag variables injected by Timoni at build time.
+var ReservedTags = []string{"name", "namespace", "moduleVersion", "kubeVersion"}
+
 // ModuleBuilder compiles CUE definitions to Kubernetes objects.
 type ModuleBuilder struct {
 	ctx           *cue.Context
 	moduleRoot    string
 	pkgName       string
 	pkgPath       string
+	extraPkgs     []string
 	name          string
 	namespace     string
 	moduleVersion string
 	kubeVersion   string
+	timoniVersion string
+	log           logr.Logger
 }
 
 // NewModuleBuilder creates a ModuleBuilder for the given module and package.
@@ -70,18 +83,85 @@ func NewModuleBuilder(ctx *cue.Context, name, namespace, moduleRoot, pkgName str
 		namespace:     namespace,
 		moduleVersion: defaultDevelVersion,
 		kubeVersion:   defaultKubeVersion,
+		log:           logr.Discard(),
 	}
 
 	if kv := os.Getenv("TIMONI_KUBE_VERSION"); kv != "" {
 		b.kubeVersion = kv
 	}
 
-	if pkgName != defaultPackage {
-		b.pkgPath = filepath.Join(moduleRoot, pkgName)
-	}
+	b.pkgPath = b.packagePath(pkgName)
 	return b
 }
 
+// packagePath returns the directory of the given package,
+// the default package is located at the module root.
+func (b *ModuleBuilder) packagePath(pkgName string) string {
+	if pkgName == defaultPackage {
+		return b.moduleRoot
+	}
+	return filepath.Join(b.moduleRoot, pkgName)
+}
+
+// SetLogger sets the logger used to trace the build phases at debug level (V(1))
+// and to report the build results. When no logger is set, the logs are discarded.
+func (b *ModuleBuilder) SetLogger(log logr.Logger) {
+	b.log = log
+}
+
+// SetExtraPackages sets the packages which are loaded from the module and unified
+// at build time with the main package. The values and the instance schema
+// are written only to the main package.
+func (b *ModuleBuilder) SetExtraPackages(pkgNames []string) {
+	b.extraPkgs = pkgNames
+}
+
+// ListModulePackages returns the packages of the module, the default package
+// followed by the subdirectories that contain a package with the same name.
+func ListModulePackages(moduleRoot string) ([]string, error) {
+	entries, err := os.ReadDir(moduleRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []string
+	if hasPackage(moduleRoot, defaultPackage) {
+		pkgs = append(pkgs, defaultPackage)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || name == "cue.mod" || strings.HasPrefix(name, ".") || name == defaultPackage {
+			continue
+		}
+		if hasPackage(filepath.Join(moduleRoot, name), name) {
+			pkgs = append(pkgs, name)
+		}
+	}
+
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages found in %s", moduleRoot)
+	}
+	return pkgs, nil
+}
+
+// hasPackage returns true if the directory contains CUE files of the given package.
+func hasPackage(dir, pkgName string) bool {
+	files, err := filepath.Glob(filepath.Join(dir, "*.cue"))
+	if err != nil {
+		return false
+	}
+	for _, file := range files {
+		f, err := parser.ParseFile(file, nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		if f.PackageName() == pkgName {
+			return true
+		}
+	}
+	return false
+}
+
 // MergeValuesFile merges the given values overlays into the module's root values.cue.
 func (b *ModuleBuilder) MergeValuesFile(overlays [][]byte) error {
 	vb := NewValuesBuilder(b.ctx)
@@ -101,6 +181,75 @@ func (b *ModuleBuilder) MergeValuesFile(overlays [][]byte) error {
 	return os.WriteFile(defaultFile, []byte(cueGen), 0644)
 }
 
+// TrimValuesToSchema removes the fields that are not allowed by the module's values schema
+// from the given overlays, and returns the trimmed overlays and the paths of the removed fields.
+// The schema file must be written with WriteSchemaFile before calling this function.
+func (b *ModuleBuilder) TrimValuesToSchema(overlays [][]byte) ([][]byte, []string, error) {
+	modValue, err := b.buildModule()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	schema := modValue.LookupPath(cue.ParsePath(apiv1.ValuesSelector.String()))
+	if !schema.Exists() {
+		return nil, nil, fmt.Errorf("lookup %s failed: %w", apiv1.ValuesSelector, schema.Err())
+	}
+
+	var trimmed []string
+	result := make([][]byte, len(overlays))
+	for i, overlay := range overlays {
+		overlayVal, err := ExtractValueFromBytes(b.ctx, overlay, apiv1.ValuesSelector.String())
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading values failed: %w", err)
+		}
+
+		out, paths := trimValue(overlayVal, schema, apiv1.ValuesSelector.String())
+		trimmed = append(trimmed, paths...)
+
+		data, err := format.Node(out.Syntax(cue.Docs(true), cue.Attributes(true)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("formatting values failed: %w", err)
+		}
+		result[i] = []byte(fmt.Sprintf("%s: %s\n", apiv1.ValuesSelector, data))
+	}
+
+	return result, trimmed, nil
+}
+
+// trimValue returns a copy of v without the struct fields that the schema doesn't allow.
+// List elements are kept as they are.
+func trimValue(v, schema cue.Value, path string) (cue.Value, []string) {
+	if v.IncompleteKind() != cue.StructKind || schema.IncompleteKind()&cue.StructKind == 0 {
+		return v, nil
+	}
+
+	iter, err := v.Fields(cue.Optional(true), cue.Definitions(true))
+	if err != nil {
+		return v, nil
+	}
+
+	var trimmed []string
+	out := v.Context().CompileString("{}")
+	for iter.Next() {
+		sel := iter.Selector()
+		fieldPath := path + "." + sel.String()
+		if !schema.Allows(sel) {
+			trimmed = append(trimmed, fieldPath)
+			continue
+		}
+
+		field := iter.Value()
+		if s := schema.LookupPath(cue.MakePath(sel)); s.Exists() {
+			var paths []string
+			field, paths = trimValue(field, s, fieldPath)
+			trimmed = append(trimmed, paths...)
+		}
+		out = out.FillPath(cue.MakePath(sel), field)
+	}
+
+	return out, trimmed
+}
+
 // WriteValuesFileWithDefaults merges the module's root values.cue with the supplied value.
 func (b *ModuleBuilder) WriteValuesFileWithDefaults(val cue.Value) error {
 	valData := []byte(fmt.Sprintf("%s: %v", apiv1.ValuesSelector.String(), val))
@@ -145,10 +294,249 @@ func (b *ModuleBuilder) SetVersionInfo(moduleVersion, kubeVersion string) {
 	}
 }
 
+// SetTimoniVersion sets the version of the running Timoni binary, which is compared
+// at build time with the minimum version required by the module in 'timoni.minVersion'.
+// When not set, the module required version is not checked.
+func (b *ModuleBuilder) SetTimoniVersion(version string) {
+	b.timoniVersion = version
+}
+
+// checkMinVersion returns an error if the Timoni version is older
+// than the minimum version required by the module.
+func (b *ModuleBuilder) checkMinVersion(modValue cue.Value) error {
+	if b.timoniVersion == "" {
+		return nil
+	}
+
+	v := modValue.LookupPath(cue.ParsePath(apiv1.MinVersionSelector.String()))
+	if !v.Exists() {
+		return nil
+	}
+
+	minVersion, err := v.String()
+	if err != nil {
+		return fmt.Errorf("lookup %s failed: %w", apiv1.MinVersionSelector, err)
+	}
+
+	required, err := semver.NewVersion(minVersion)
+	if err != nil {
+		return fmt.Errorf("%s: invalid semver version %s: %w", apiv1.MinVersionSelector, minVersion, err)
+	}
+
+	current, err := semver.NewVersion(b.timoniVersion)
+	if err != nil {
+		return fmt.Errorf("invalid timoni version %s: %w", b.timoniVersion, err)
+	}
+
+	if current.LessThan(required) {
+		return fmt.Errorf("the module requires timoni version %s or newer, but the current version is %s, please upgrade timoni",
+			minVersion, b.timoniVersion)
+	}
+
+	return nil
+}
+
 // Build builds the Timoni instance for the specified module and returns its CUE value.
+// The optional tags in the format key=value are injected in the fields annotated with @tag(key).
 // If the instance validation fails, the returned error may represent more than one error,
 // retrievable with errors.Errors.
 func (b *ModuleBuilder) Build(tags ...string) (cue.Value, error) {
+	modValue, err := b.buildModule(tags...)
+	if err != nil {
+		return modValue, err
+	}
+
+	// Check the required version before validating the instance,
+	// as a too old Timoni version may fail with unrelated errors.
+	if err := b.checkMinVersion(modValue); err != nil {
+		return modValue, err
+	}
+
+	// Extract the Timoni instance from the build value.
+	instance := modValue.LookupPath(cue.ParsePath(apiv1.InstanceSelector.String()))
+	if instance.Err() != nil {
+		return modValue, fmt.Errorf("lookup %s failed: %w", apiv1.InstanceSelector, instance.Err())
+	}
+
+	// Validate the Timoni instance which should be concrete and final.
+	b.log.V(1).Info("validating instance", "name", b.name, "namespace", b.namespace)
+	if err := instance.Validate(cue.Concrete(true), cue.Final()); err != nil {
+		return modValue, err
+	}
+
+	b.log.Info("instance built", "name", b.name, "namespace", b.namespace)
+	return modValue, nil
+}
+
+// VetSchema loads the module package without validating the Timoni instance,
+// verifies that the required Timoni fields are defined, and returns the paths
+// of the config values that have no default.
+func (b *ModuleBuilder) VetSchema(tags ...string) ([]string, error) {
+	modValue, err := b.buildModule(tags...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sel := range []apiv1.Selector{
+		apiv1.APIVersionSelector,
+		apiv1.InstanceSelector,
+		apiv1.ApplySelector,
+		apiv1.ValuesSelector,
+	} {
+		if !modValue.LookupPath(cue.ParsePath(sel.String())).Exists() {
+			return nil, fmt.Errorf("required field %s not found", sel)
+		}
+	}
+
+	// Report the conflicting values without requiring the config to be concrete.
+	if err := modValue.Validate(); err != nil {
+		return nil, err
+	}
+
+	config := modValue.LookupPath(cue.ParsePath(apiv1.ConfigValuesSelector.String()))
+	if config.Err() != nil {
+		return nil, fmt.Errorf("lookup %s failed: %w", apiv1.ConfigValuesSelector, config.Err())
+	}
+
+	return missingDefaults(config, apiv1.ValuesSelector.String()), nil
+}
+
+// missingDefaults walks the given value and returns the paths
+// of the fields that don't evaluate to a concrete value.
+func missingDefaults(v cue.Value, path string) []string {
+	if v.IncompleteKind() == cue.StructKind {
+		var paths []string
+		iter, err := v.Fields()
+		if err != nil {
+			return []string{path}
+		}
+		for iter.Next() {
+			paths = append(paths, missingDefaults(iter.Value(), path+"."+iter.Selector().String())...)
+		}
+		return paths
+	}
+
+	if d, ok := v.Default(); ok {
+		v = d
+	}
+	if err := v.Validate(cue.Concrete(true)); err != nil {
+		return []string{path}
+	}
+	return nil
+}
+
+// ValueField describes a module value that can be set by the instance consumers.
+type ValueField struct {
+	// Path is the CUE path of the field relative to the values.
+	Path string `json:"path"`
+
+	// Labels are the CUE selectors of the field path.
+	Labels []string `json:"-"`
+
+	// Type is the CUE kind of the field, e.g. 'string' or 'int|string'.
+	Type string `json:"type"`
+
+	// Default is the value used when the field is not set,
+	// nil if the field has no default.
+	Default any `json:"default,omitempty"`
+
+	// Required is true if the field has no default and must be set.
+	Required bool `json:"required,omitempty"`
+
+	// Optional is true if the field is marked with '?'.
+	Optional bool `json:"optional,omitempty"`
+
+	// Description is the doc comment of the field.
+	Description string `json:"description,omitempty"`
+}
+
+// GetValuesSchema loads the module package without validating the Timoni instance,
+// and returns the values fields with their types and defaults, ordered as defined.
+// The fields injected by Timoni with @tag() attributes, and the fields derived
+// from them, are not included.
+func (b *ModuleBuilder) GetValuesSchema(tags ...string) ([]ValueField, error) {
+	modValue, err := b.buildModule(tags...)
+	if err != nil {
+		return nil, err
+	}
+
+	values := modValue.LookupPath(cue.ParsePath(apiv1.ValuesSelector.String()))
+	if !values.Exists() {
+		return nil, fmt.Errorf("required field %s not found", apiv1.ValuesSelector)
+	}
+	config := modValue.LookupPath(cue.ParsePath(apiv1.ConfigValuesSelector.String()))
+	if config.Err() != nil {
+		return nil, fmt.Errorf("lookup %s failed: %w", apiv1.ConfigValuesSelector, config.Err())
+	}
+
+	return valueFields(values, config, nil, false)
+}
+
+// valueFields walks the values and returns their leaf fields. The config
+// is used to skip the values set by Timoni when building the instance.
+func valueFields(v, config cue.Value, labels []string, optional bool) ([]ValueField, error) {
+	if v.IncompleteKind() == cue.StructKind {
+		iter, err := v.Fields(cue.Optional(true))
+		if err != nil {
+			return nil, err
+		}
+		var fields []ValueField
+		hasFields := false
+		for iter.Next() {
+			hasFields = true
+			sel := iter.Selector()
+			label := strings.TrimRight(sel.String(), "?!")
+			list, err := valueFields(iter.Value(), config, append(append([]string{}, labels...), label),
+				sel.ConstraintType() == cue.OptionalConstraint)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, list...)
+		}
+		if hasFields || len(labels) == 0 {
+			return fields, nil
+		}
+	}
+
+	path := strings.Join(labels, ".")
+	cfgValue := config.LookupPath(cue.ParsePath(path))
+	if attr := cfgValue.Attribute("tag"); attr.Err() == nil {
+		return nil, nil
+	}
+
+	field := ValueField{
+		Path:     path,
+		Labels:   labels,
+		Type:     v.IncompleteKind().String(),
+		Optional: optional,
+	}
+
+	d, _ := v.Default()
+	switch {
+	case optional:
+	case d.Validate(cue.Concrete(true)) == nil:
+		if err := d.Decode(&field.Default); err != nil {
+			return nil, fmt.Errorf("decoding %s failed: %w", path, err)
+		}
+	default:
+		if cfgValue.Exists() && cfgValue.Validate(cue.Concrete(true)) == nil {
+			// The value is computed from the fields injected by Timoni.
+			return nil, nil
+		}
+		field.Required = true
+	}
+
+	for _, doc := range v.Doc() {
+		field.Description += doc.Text()
+	}
+	field.Description = strings.TrimSpace(strings.NewReplacer(
+		"\n", " ", "+nodoc", "", "+required", "", "+optional", "").Replace(field.Description))
+
+	return []ValueField{field}, nil
+}
+
+// buildModule loads the module package and returns its CUE value without validating the Timoni instance.
+func (b *ModuleBuilder) buildModule(tags ...string) (cue.Value, error) {
 	var value cue.Value
 	cfg := &load.Config{
 		ModuleRoot: b.moduleRoot,
@@ -177,7 +565,26 @@ func (b *ModuleBuilder) Build(tags ...string) (cue.Value, error) {
 		cfg.Tags = append(cfg.Tags, tags...)
 	}
 
-	modInstances := load.Instances([]string{}, cfg)
+	// The extra packages are loaded together with the main package,
+	// as the tags are injected across all the loaded instances.
+	var args []string
+	if len(b.extraPkgs) > 0 {
+		cfg.Package = ""
+		args = append(args, ".:"+b.pkgName)
+		for _, pkgName := range b.extraPkgs {
+			rel, err := filepath.Rel(b.pkgPath, b.packagePath(pkgName))
+			if err != nil {
+				return value, err
+			}
+			if !strings.HasPrefix(rel, ".") {
+				rel = "./" + rel
+			}
+			args = append(args, fmt.Sprintf("%s:%s", filepath.ToSlash(rel), pkgName))
+		}
+	}
+
+	b.log.V(1).Info("loading module", "package", b.pkgName, "extraPackages", b.extraPkgs)
+	modInstances := load.Instances(args, cfg)
 	if len(modInstances) == 0 {
 		return value, errors.New("no instances found")
 	}
@@ -187,25 +594,81 @@ func (b *ModuleBuilder) Build(tags ...string) (cue.Value, error) {
 		return value, fmt.Errorf("instance error: %w", modInstance.Err)
 	}
 
+	b.log.V(1).Info("building module", "package", b.pkgName)
 	modValue := b.ctx.BuildInstance(modInstance)
 	if modValue.Err() != nil {
 		return value, modValue.Err()
 	}
 
-	// Extract the Timoni instance from the build value.
-	instance := modValue.LookupPath(cue.ParsePath(apiv1.InstanceSelector.String()))
-	if instance.Err() != nil {
-		return modValue, fmt.Errorf("lookup %s failed: %w", apiv1.InstanceSelector, instance.Err())
+	modValue, err := b.unifyDataFiles(modValue, modInstance.OrphanedFiles)
+	if err != nil {
+		return value, err
 	}
 
-	// Validate the Timoni instance which should be concrete and final.
-	if err := instance.Validate(cue.Concrete(true), cue.Final()); err != nil {
-		return modValue, err
+	for i, pkgInstance := range modInstances[1:] {
+		pkgName := b.extraPkgs[i]
+		if pkgInstance.Err != nil {
+			return value, fmt.Errorf("instance error for package %s: %w", pkgName, pkgInstance.Err)
+		}
+
+		pkgValue := b.ctx.BuildInstance(pkgInstance)
+		if pkgValue.Err() != nil {
+			return value, fmt.Errorf("building package %s failed: %w", pkgName, pkgValue.Err())
+		}
+
+		modValue = modValue.Unify(pkgValue)
+		if err := modValue.Validate(); err != nil {
+			return value, fmt.Errorf("unifying package %s with %s failed: %w", pkgName, b.pkgName, err)
+		}
 	}
 
 	return modValue, nil
 }
 
+// unifyDataFiles extracts the values from the JSON and YAML files found in the
+// module package directory and unifies them with the module value.
+// The files with other encodings are skipped.
+func (b *ModuleBuilder) unifyDataFiles(value cue.Value, files []*build.File) (cue.Value, error) {
+	for _, file := range files {
+		name := filepath.Base(file.Filename)
+		if file.ExcludeReason != nil {
+			continue
+		}
+		if file.Encoding != build.JSON && file.Encoding != build.YAML {
+			b.log.V(1).Info("skipping data file with unsupported encoding", "file", name, "encoding", file.Encoding)
+			continue
+		}
+
+		src, err := os.ReadFile(file.Filename)
+		if err != nil {
+			return value, fmt.Errorf("reading data file %s failed: %w", name, err)
+		}
+
+		var data cue.Value
+		switch file.Encoding {
+		case build.JSON:
+			expr, err := json.Extract(file.Filename, src)
+			if err != nil {
+				return value, fmt.Errorf("extracting JSON from %s failed: %w", name, err)
+			}
+			data = b.ctx.BuildExpr(expr)
+		case build.YAML:
+			f, err := yaml.Extract(file.Filename, src)
+			if err != nil {
+				return value, fmt.Errorf("extracting YAML from %s failed: %w", name, err)
+			}
+			data = b.ctx.BuildFile(f)
+		}
+
+		b.log.V(1).Info("unifying data file", "file", name)
+		value = value.Unify(data)
+		if value.Err() != nil {
+			return value, fmt.Errorf("unifying data file %s failed: %w", name, value.Err())
+		}
+	}
+	return value, nil
+}
+
 // GetAPIVersion returns the list of API version of the Timoni's CUE definition.
 func (b *ModuleBuilder) GetAPIVersion(value cue.Value) (string, error) {
 	ver := value.LookupPath(cue.ParsePath(apiv1.APIVersionSelector.String()))
@@ -18,6 +18,7 @@ package engine
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"testing"
 
@@ -63,3 +64,251 @@ func TestModuleBuilder(t *testing.T) {
 
 	g.Expect(fmt.Sprintf("%v", objects)).To(BeEquivalentTo(fmt.Sprintf("%v", gold)))
 }
+
+func TestModuleBuilder_Tags(t *testing.T) {
+	g := NewWithT(t)
+	moduleRoot := path.Join(t.TempDir(), "module")
+
+	err := CopyModule("testdata/module", moduleRoot)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	tagsFile := "package main\n\nenv: *\"dev\" | string @tag(env)\n"
+	err = os.WriteFile(path.Join(moduleRoot, "tags.cue"), []byte(tagsFile), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ctx := cuecontext.New()
+	mb := NewModuleBuilder(ctx, "test-name", "test-namespace", moduleRoot, "main")
+
+	for tag, expected := range map[string]string{
+		"":          "dev",
+		"env=dev":   "dev",
+		"env=prod":  "prod",
+		"env=stage": "stage",
+	} {
+		var tags []string
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+
+		val, err := mb.Build(tags...)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		env, err := val.LookupPath(cue.ParsePath("env")).String()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(env).To(Equal(expected))
+	}
+
+	_, err = mb.Build("unknown=value")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestModuleBuilder_DataFiles(t *testing.T) {
+	g := NewWithT(t)
+	moduleRoot := path.Join(t.TempDir(), "module")
+
+	err := CopyModule("testdata/module", moduleRoot)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	jsonFile := `{"shared": {"region": "eu-west-1", "replicas": 2}}`
+	err = os.WriteFile(path.Join(moduleRoot, "shared.json"), []byte(jsonFile), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	yamlFile := "shared:\n  team: test\n"
+	err = os.WriteFile(path.Join(moduleRoot, "shared.yaml"), []byte(yamlFile), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ctx := cuecontext.New()
+	mb := NewModuleBuilder(ctx, "test-name", "test-namespace", moduleRoot, "main")
+
+	val, err := mb.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	region, err := val.LookupPath(cue.ParsePath("shared.region")).String()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(region).To(Equal("eu-west-1"))
+
+	replicas, err := val.LookupPath(cue.ParsePath("shared.replicas")).Int64()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(replicas).To(BeEquivalentTo(2))
+
+	team, err := val.LookupPath(cue.ParsePath("shared.team")).String()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(team).To(Equal("test"))
+
+	err = os.WriteFile(path.Join(moduleRoot, "conflict.json"), []byte(`{"shared": {"region": "us-east-1"}}`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = mb.Build()
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("unifying data file"))
+}
+
+func TestModuleBuilder_GetValueGraph(t *testing.T) {
+	g := NewWithT(t)
+	moduleRoot := path.Join(t.TempDir(), "module")
+
+	err := CopyModule("testdata/module", moduleRoot)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ctx := cuecontext.New()
+	mb := NewModuleBuilder(ctx, "test-name", "test-namespace", moduleRoot, "main")
+	g.Expect(mb.WriteSchemaFile()).To(Succeed())
+	mb.SetVersionInfo("1.0.0", "1.28.0")
+
+	val, err := mb.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	edges, err := mb.GetValueGraph(val)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	obj := "ConfigMap/test-namespace/test-name"
+	g.Expect(edges).To(ContainElements(
+		ValueEdge{Value: "values.hostname", Object: obj, Field: "data.url"},
+		ValueEdge{Value: "values.metadata.name", Object: obj, Field: "metadata.name"},
+		ValueEdge{Value: "values.moduleVersion", Object: obj, Field: "data.moduleVersion"},
+	))
+	g.Expect(edges).ToNot(ContainElement(HaveField("Field", "apiVersion")))
+}
+
+func TestModuleBuilder_TrimValuesToSchema(t *testing.T) {
+	g := NewWithT(t)
+	moduleRoot := path.Join(t.TempDir(), "module")
+
+	err := CopyModule("testdata/module", moduleRoot)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ctx := cuecontext.New()
+	mb := NewModuleBuilder(ctx, "test-name", "test-namespace", moduleRoot, "main")
+	g.Expect(mb.WriteSchemaFile()).To(Succeed())
+
+	overlays, trimmed, err := mb.TrimValuesToSchema([][]byte{
+		[]byte(`values: {
+	hostname: "example.com"
+	replicaCount: 3
+	metadata: finalizers: ["helm"]
+}`),
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(trimmed).To(ConsistOf("values.replicaCount", "values.metadata.finalizers"))
+
+	g.Expect(mb.MergeValuesFile(overlays)).To(Succeed())
+	mb.SetVersionInfo("1.0.0", "1.28.0")
+
+	val, err := mb.Build()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	hostname, err := val.LookupPath(cue.ParsePath("values.hostname")).String()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(hostname).To(Equal("example.com"))
+}
+
+func TestModuleBuilder_VetSchema(t *testing.T) {
+	newModule := func(g *WithT, extra string) *ModuleBuilder {
+		moduleRoot := path.Join(t.TempDir(), "module")
+		g.Expect(CopyModule("testdata/module", moduleRoot)).To(Succeed())
+		if extra != "" {
+			extraFile := path.Join(moduleRoot, "templates", "extra.cue")
+			g.Expect(os.WriteFile(extraFile, []byte(extra), 0644)).To(Succeed())
+		}
+		return NewModuleBuilder(cuecontext.New(), "default", "default", moduleRoot, "main")
+	}
+
+	t.Run("vets module with defaults", func(t *testing.T) {
+		g := NewWithT(t)
+		missing, err := newModule(g, "").VetSchema()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(missing).To(BeEmpty())
+	})
+
+	t.Run("reports values without defaults", func(t *testing.T) {
+		g := NewWithT(t)
+		missing, err := newModule(g, `package templates
+#Config: {
+	replicas: int
+	team!:    string
+	tier?:    string
+}
+`).VetSchema()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(missing).To(ConsistOf("values.replicas", "values.team"))
+	})
+
+	t.Run("fails for unresolved references", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := newModule(g, `package templates
+#Config: replicas: _unknown
+`).VetSchema()
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(`reference "_unknown" not found`))
+	})
+}
+
+func TestModuleBuilder_GetValuesSchema(t *testing.T) {
+	g := NewWithT(t)
+	moduleRoot := path.Join(t.TempDir(), "module")
+	g.Expect(CopyModule("testdata/module", moduleRoot)).To(Succeed())
+	extraFile := path.Join(moduleRoot, "templates", "extra.cue")
+	g.Expect(os.WriteFile(extraFile, []byte(`package templates
+#Config: {
+	// Replicas is the number of pods.
+	replicas: *1 | int
+	team!:    string
+	tier?:    string
+}
+`), 0644)).To(Succeed())
+
+	builder := NewModuleBuilder(cuecontext.New(), "default", "default", moduleRoot, "main")
+	fields, err := builder.GetValuesSchema()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	index := make(map[string]ValueField, len(fields))
+	for _, field := range fields {
+		index[field.Path] = field
+	}
+
+	g.Expect(index).To(HaveKeyWithValue("hostname", ValueField{
+		Path:    "hostname",
+		Labels:  []string{"hostname"},
+		Type:    "string",
+		Default: "default.internal",
+	}))
+	g.Expect(index).To(HaveKeyWithValue("replicas", ValueField{
+		Path:        "replicas",
+		Labels:      []string{"replicas"},
+		Type:        "int",
+		Default:     1,
+		Description: "Replicas is the number of pods.",
+	}))
+	g.Expect(index["team"].Required).To(BeTrue())
+	g.Expect(index["tier"].Optional).To(BeTrue())
+	g.Expect(index["tier"].Required).To(BeFalse())
+
+	// The fields set by Timoni at build time are excluded.
+	g.Expect(index).ToNot(HaveKey("metadata.name"))
+	g.Expect(index).ToNot(HaveKey("moduleVersion"))
+	g.Expect(index).ToNot(HaveKey("kubeVersion"))
+}
+
+func TestListModulePackages(t *testing.T) {
+	g := NewWithT(t)
+	moduleRoot := path.Join(t.TempDir(), "module")
+
+	err := CopyModule("testdata/module", moduleRoot)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	err = os.MkdirAll(path.Join(moduleRoot, "extras"), os.ModePerm)
+	g.Expect(err).ToNot(HaveOccurred())
+	err = os.WriteFile(path.Join(moduleRoot, "extras", "extras.cue"), []byte("package extras\n"), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	err = os.MkdirAll(path.Join(moduleRoot, "other"), os.ModePerm)
+	g.Expect(err).ToNot(HaveOccurred())
+	err = os.WriteFile(path.Join(moduleRoot, "other", "other.cue"), []byte("package extras\n"), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	pkgs, err := ListModulePackages(moduleRoot)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pkgs).To(ContainElements("main", "extras"))
+	g.Expect(pkgs[0]).To(Equal("main"))
+	g.Expect(pkgs).ToNot(ContainElement("other"))
+}
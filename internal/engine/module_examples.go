@@ -0,0 +1,104 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ModuleExamplesDir is the directory, relative to the module root,
+// where the module authors ship example values files.
+const ModuleExamplesDir = "examples"
+
+// moduleExampleExtensions are the supported formats of the example values files.
+var moduleExampleExtensions = []string{".cue", ".yaml", ".yml", ".json"}
+
+// ModuleExample is a values file found in the module's examples directory.
+type ModuleExample struct {
+	// Name is the file name without the extension.
+	Name string `json:"name"`
+
+	// Path is the path of the file relative to the module root.
+	Path string `json:"path"`
+}
+
+// ListModuleExamples returns the example values files found in
+// the examples directory of the module, sorted by name.
+// If the module has no examples directory, an empty list is returned.
+func ListModuleExamples(moduleRoot string) ([]ModuleExample, error) {
+	entries, err := os.ReadDir(filepath.Join(moduleRoot, ModuleExamplesDir))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading module examples failed: %w", err)
+	}
+
+	var examples []ModuleExample
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || !slices.Contains(moduleExampleExtensions, ext) {
+			continue
+		}
+		examples = append(examples, ModuleExample{
+			Name: strings.TrimSuffix(entry.Name(), ext),
+			Path: filepath.Join(ModuleExamplesDir, entry.Name()),
+		})
+	}
+
+	sort.SliceStable(examples, func(i, j int) bool {
+		return examples[i].Name < examples[j].Name
+	})
+	return examples, nil
+}
+
+// GetModuleExample returns the absolute path of the example values file with the
+// given name. An error listing the available examples is returned if the
+// example is not found, or if multiple files match the name.
+func GetModuleExample(moduleRoot, name string) (string, error) {
+	examples, err := ListModuleExamples(moduleRoot)
+	if err != nil {
+		return "", err
+	}
+
+	var names, matches []string
+	for _, example := range examples {
+		names = append(names, example.Name)
+		if example.Name == name {
+			matches = append(matches, example.Path)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		if len(names) == 0 {
+			return "", fmt.Errorf("example '%s' not found, the module has no examples", name)
+		}
+		return "", fmt.Errorf("example '%s' not found, available examples: %s", name, strings.Join(slices.Compact(names), ", "))
+	case 1:
+		return filepath.Join(moduleRoot, matches[0]), nil
+	default:
+		return "", fmt.Errorf("example '%s' is ambiguous, found %s", name, strings.Join(matches, ", "))
+	}
+}
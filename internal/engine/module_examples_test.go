@@ -0,0 +1,65 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestModuleExamples(t *testing.T) {
+	g := NewWithT(t)
+	moduleRoot := t.TempDir()
+
+	examples, err := ListModuleExamples(moduleRoot)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(examples).To(BeEmpty())
+
+	_, err = GetModuleExample(moduleRoot, "minimal")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("the module has no examples"))
+
+	examplesDir := filepath.Join(moduleRoot, ModuleExamplesDir)
+	g.Expect(os.MkdirAll(filepath.Join(examplesDir, "nested"), os.ModePerm)).To(Succeed())
+	for _, name := range []string{"minimal.cue", "ha.yaml", "README.md", "dup.json", "dup.yml"} {
+		g.Expect(os.WriteFile(filepath.Join(examplesDir, name), []byte("values: {}"), 0644)).To(Succeed())
+	}
+
+	examples, err = ListModuleExamples(moduleRoot)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(examples).To(Equal([]ModuleExample{
+		{Name: "dup", Path: filepath.Join("examples", "dup.json")},
+		{Name: "dup", Path: filepath.Join("examples", "dup.yml")},
+		{Name: "ha", Path: filepath.Join("examples", "ha.yaml")},
+		{Name: "minimal", Path: filepath.Join("examples", "minimal.cue")},
+	}))
+
+	examplePath, err := GetModuleExample(moduleRoot, "ha")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(examplePath).To(Equal(filepath.Join(examplesDir, "ha.yaml")))
+
+	_, err = GetModuleExample(moduleRoot, "full")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("example 'full' not found, available examples: dup, ha, minimal"))
+
+	_, err = GetModuleExample(moduleRoot, "dup")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("example 'dup' is ambiguous"))
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// objectHeaderFields are the top-level fields written first, in this order.
+var objectHeaderFields = []string{"apiVersion", "kind", "metadata"}
+
+// MarshalObjectYAML returns the object as YAML with the fields in a stable order:
+// apiVersion, kind and metadata first, followed by the other top-level fields sorted
+// by name, with the status last. The nested fields are sorted by name, so that
+// building the same objects always produces byte-identical output.
+func MarshalObjectYAML(object *unstructured.Unstructured) ([]byte, error) {
+	fields := make(map[string]any, len(object.Object))
+	for key, value := range object.Object {
+		fields[key] = value
+	}
+
+	var buf bytes.Buffer
+	write := func(m map[string]any) error {
+		data, err := yaml.Marshal(m)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+
+	for _, key := range objectHeaderFields {
+		if value, ok := fields[key]; ok {
+			if err := write(map[string]any{key: value}); err != nil {
+				return nil, err
+			}
+			delete(fields, key)
+		}
+	}
+
+	status, hasStatus := fields["status"]
+	delete(fields, "status")
+
+	if len(fields) > 0 {
+		if err := write(fields); err != nil {
+			return nil, err
+		}
+	}
+	if hasStatus {
+		if err := write(map[string]any{"status": status}); err != nil {
+			return nil, err
+		}
+	}
+
+	if buf.Len() == 0 {
+		return []byte("{}\n"), nil
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMarshalObjectYAML(t *testing.T) {
+	g := NewWithT(t)
+
+	object := &unstructured.Unstructured{Object: map[string]any{
+		"status": map[string]any{"replicas": int64(1)},
+		"spec": map[string]any{
+			"selector": map[string]any{"app": "test"},
+			"ports":    []any{map[string]any{"port": int64(80), "name": "http"}},
+		},
+		"metadata": map[string]any{"namespace": "default", "name": "test"},
+		"kind":     "Service",
+		"data":     map[string]any{"z": "1", "a": "2"},
+	}}
+	object.SetAPIVersion("v1")
+
+	expected := `apiVersion: v1
+kind: Service
+metadata:
+  name: test
+  namespace: default
+data:
+  a: "2"
+  z: "1"
+spec:
+  ports:
+  - name: http
+    port: 80
+  selector:
+    app: test
+status:
+  replicas: 1
+`
+	for i := 0; i < 10; i++ {
+		data, err := MarshalObjectYAML(object)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(data)).To(Equal(expected))
+	}
+
+	data, err := MarshalObjectYAML(&unstructured.Unstructured{Object: map[string]any{}})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal("{}\n"))
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import "time"
+
+// Phase is a stage of the bundle build pipeline.
+type Phase string
+
+const (
+	// PhaseInjection is the injection of the runtime values into the bundle files.
+	PhaseInjection Phase = "injection"
+
+	// PhaseLoading is the loading of the workspace files into a CUE instance.
+	PhaseLoading Phase = "loading"
+
+	// PhaseBuilding is the evaluation of the CUE instance.
+	PhaseBuilding Phase = "building"
+
+	// PhaseValidation is the validation of the bundle value against the schema.
+	PhaseValidation Phase = "validation"
+)
+
+// Observer records the duration of the build pipeline phases,
+// e.g. by exporting them as Prometheus histograms.
+type Observer interface {
+	// ObservePhase is called at the end of each phase with its duration.
+	ObservePhase(phase Phase, duration time.Duration)
+}
+
+// NopObserver is an Observer that discards all the recorded phases.
+type NopObserver struct{}
+
+// ObservePhase implements Observer.
+func (NopObserver) ObservePhase(Phase, time.Duration) {}
+
+// phaseTimer measures the duration of a phase for an observer.
+// The zero value is a no-op timer that doesn't read the clock.
+type phaseTimer struct {
+	observer Observer
+	start    time.Time
+}
+
+// startPhase returns a timer for the given observer,
+// or a no-op timer when the observer is nil.
+func startPhase(observer Observer) phaseTimer {
+	if observer == nil {
+		return phaseTimer{}
+	}
+	return phaseTimer{observer: observer, start: time.Now()}
+}
+
+// elapsed returns the duration since the timer was started.
+func (t phaseTimer) elapsed() time.Duration {
+	if t.observer == nil {
+		return 0
+	}
+	return time.Since(t.start)
+}
+
+// stop records the phase duration.
+func (t phaseTimer) stop(phase Phase) {
+	if t.observer == nil {
+		return
+	}
+	t.observer.ObservePhase(phase, time.Since(t.start))
+}
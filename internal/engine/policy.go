@@ -0,0 +1,132 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fluxcd/pkg/ssa"
+	kyvernov1 "github.com/kyverno/kyverno/api/kyverno/v1"
+	"github.com/kyverno/kyverno/pkg/config"
+	kyvernoengine "github.com/kyverno/kyverno/pkg/engine"
+	engineapi "github.com/kyverno/kyverno/pkg/engine/api"
+	"github.com/kyverno/kyverno/pkg/engine/factories"
+	"github.com/kyverno/kyverno/pkg/engine/jmespath"
+	"github.com/kyverno/kyverno/pkg/engine/policycontext"
+	"github.com/kyverno/kyverno/pkg/imageverifycache"
+	kyvernoyaml "github.com/kyverno/kyverno/pkg/utils/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// PolicyViolation describes an object that fails a policy rule.
+type PolicyViolation struct {
+	Policy  string
+	Rule    string
+	Object  string
+	Message string
+
+	// Enforce is set when the policy validation failure action is Enforce.
+	Enforce bool
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%s violates policy %s rule %s: %s", v.Object, v.Policy, v.Rule, v.Message)
+}
+
+// LoadKyvernoPolicies reads the Kyverno ClusterPolicies and Policies
+// from the YAML files found in the given directory.
+func LoadKyvernoPolicies(dir string) ([]kyvernov1.PolicyInterface, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading policies failed: %w", err)
+	}
+
+	var policies []kyvernov1.PolicyInterface
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s failed: %w", entry.Name(), err)
+		}
+
+		list, _, err := kyvernoyaml.GetPolicy(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s failed: %w", entry.Name(), err)
+		}
+		policies = append(policies, list...)
+	}
+
+	return policies, nil
+}
+
+// ValidateKyvernoPolicies evaluates the objects against the validation rules
+// of the given policies with the Kyverno engine and returns the violations.
+// The engine runs offline, a rule that requires access to the cluster
+// or to a container registry results in an error.
+func ValidateKyvernoPolicies(policies []kyvernov1.PolicyInterface, objects []*unstructured.Unstructured) ([]PolicyViolation, error) {
+	cfg := config.NewDefaultConfiguration(false)
+	jp := jmespath.New(cfg)
+	eng := kyvernoengine.NewEngine(
+		cfg,
+		config.NewDefaultMetricsConfiguration(),
+		jp,
+		nil,
+		nil,
+		imageverifycache.DisabledImageVerifyCache(),
+		factories.DefaultContextLoaderFactory(nil),
+		nil,
+		"",
+	)
+
+	var violations []PolicyViolation
+	for _, obj := range objects {
+		for _, policy := range policies {
+			policyContext, err := policycontext.NewPolicyContext(jp, *obj, kyvernov1.Create, nil, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", ssa.FmtUnstructured(obj), err)
+			}
+			policyContext = policyContext.
+				WithPolicy(policy).
+				WithResourceKind(obj.GroupVersionKind(), "")
+
+			response := eng.Validate(context.Background(), policyContext)
+			for _, rule := range response.PolicyResponse.Rules {
+				switch rule.Status() {
+				case engineapi.RuleStatusFail:
+					violations = append(violations, PolicyViolation{
+						Policy:  policy.GetName(),
+						Rule:    rule.Name(),
+						Object:  ssa.FmtUnstructured(obj),
+						Message: rule.Message(),
+						Enforce: response.GetValidationFailureAction().Enforce(),
+					})
+				case engineapi.RuleStatusError:
+					return nil, fmt.Errorf("%s: evaluating policy %s rule %s failed: %s",
+						ssa.FmtUnstructured(obj), policy.GetName(), rule.Name(), rule.Message())
+				}
+			}
+		}
+	}
+	return violations, nil
+}
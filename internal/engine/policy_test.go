@@ -0,0 +1,356 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+)
+
+func TestValidateKyvernoPolicies(t *testing.T) {
+	g := NewWithT(t)
+
+	policies, err := LoadKyvernoPolicies("testdata/policies")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(policies).To(HaveLen(2))
+
+	objects, err := ssa.ReadObjects(bytes.NewReader([]byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: labeled
+  namespace: default
+  labels:
+    team: dev
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unlabeled
+  namespace: default
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: pinned
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: ghcr.io/stefanprodan/podinfo:6.5.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: latest
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: ghcr.io/stefanprodan/podinfo:latest
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: excluded
+  namespace: kube-system
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: ghcr.io/stefanprodan/podinfo:latest
+`)))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	violations, err := ValidateKyvernoPolicies(policies, objects)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(violations).To(HaveLen(2))
+
+	g.Expect(violations[0].Object).To(Equal("ConfigMap/default/unlabeled"))
+	g.Expect(violations[0].Policy).To(Equal("require-labels"))
+	g.Expect(violations[0].Rule).To(Equal("check-team"))
+	g.Expect(violations[0].Message).To(ContainSubstring("/metadata/labels"))
+
+	g.Expect(violations[1].Object).To(Equal("Deployment/default/latest"))
+	g.Expect(violations[1].Policy).To(Equal("disallow-latest-tag"))
+	g.Expect(violations[1].Message).To(ContainSubstring("/spec/template/spec/containers/0/image"))
+}
+
+func TestLoadKyvernoPolicies_Invalid(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(`
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: test
+spec:
+  rules:
+    - name: test
+      match:
+        any:
+          - resources:
+              kinds:
+                - ConfigMap
+      validate:
+        pattrn:
+          metadata:
+            name: "?*"
+`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = LoadKyvernoPolicies(dir)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("pattrn"))
+}
+
+func TestValidateKyvernoPolicies_Deny(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(`
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: deny-test
+spec:
+  validationFailureAction: Enforce
+  rules:
+    - name: deny-name
+      match:
+        any:
+          - resources:
+              kinds:
+                - ConfigMap
+      validate:
+        message: "the name test is reserved"
+        deny:
+          conditions:
+            any:
+              - key: "{{ request.object.metadata.name }}"
+                operator: Equals
+                value: test
+`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	policies, err := LoadKyvernoPolicies(dir)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	objects, err := ssa.ReadObjects(bytes.NewReader([]byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  namespace: default
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: allowed
+  namespace: default
+`)))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	violations, err := ValidateKyvernoPolicies(policies, objects)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(violations).To(HaveLen(1))
+	g.Expect(violations[0].Object).To(Equal("ConfigMap/default/test"))
+	g.Expect(violations[0].Message).To(ContainSubstring("the name test is reserved"))
+}
+
+func TestValidateKyvernoPolicies_MatchAll(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(`
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: require-labels
+spec:
+  validationFailureAction: Enforce
+  rules:
+    - name: check-team
+      match:
+        all:
+          - resources:
+              kinds:
+                - ConfigMap
+          - resources:
+              namespaces:
+                - apps
+      validate:
+        pattern:
+          metadata:
+            labels:
+              team: "?*"
+`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	policies, err := LoadKyvernoPolicies(dir)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	objects, err := ssa.ReadObjects(bytes.NewReader([]byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: selected
+  namespace: apps
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other-namespace
+  namespace: default
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: other-kind
+  namespace: apps
+`)))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	violations, err := ValidateKyvernoPolicies(policies, objects)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(violations).To(HaveLen(1))
+	g.Expect(violations[0].Object).To(Equal("ConfigMap/apps/selected"))
+	g.Expect(violations[0].Enforce).To(BeTrue())
+}
+
+func TestValidateKyvernoPolicies_FailureAction(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(`
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: require-labels
+spec:
+  rules:
+    - name: audit
+      match:
+        resources:
+          kinds:
+            - ConfigMap
+      validate:
+        pattern:
+          metadata:
+            labels:
+              team: "?*"
+---
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: require-annotations
+spec:
+  validationFailureAction: enforce
+  rules:
+    - name: enforce
+      match:
+        resources:
+          kinds:
+            - ConfigMap
+      validate:
+        pattern:
+          metadata:
+            annotations:
+              owner: "?*"
+`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	policies, err := LoadKyvernoPolicies(dir)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	objects, err := ssa.ReadObjects(bytes.NewReader([]byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  namespace: default
+`)))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	violations, err := ValidateKyvernoPolicies(policies, objects)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(violations).To(HaveLen(2))
+	g.Expect(violations[0].Rule).To(Equal("audit"))
+	g.Expect(violations[0].Enforce).To(BeFalse())
+	g.Expect(violations[1].Rule).To(Equal("enforce"))
+	g.Expect(violations[1].Enforce).To(BeTrue())
+}
+
+func TestValidateKyvernoPolicies_Offline(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "policy.yaml"), []byte(`
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: api-call
+spec:
+  rules:
+    - name: lookup
+      match:
+        any:
+          - resources:
+              kinds:
+                - ConfigMap
+      context:
+        - name: namespaces
+          apiCall:
+            urlPath: "/api/v1/namespaces"
+            jmesPath: "items | length(@)"
+      validate:
+        deny:
+          conditions:
+            any:
+              - key: "{{ namespaces }}"
+                operator: GreaterThan
+                value: 10
+`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	policies, err := LoadKyvernoPolicies(dir)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	objects, err := ssa.ReadObjects(bytes.NewReader([]byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  namespace: default
+`)))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = ValidateKyvernoPolicies(policies, objects)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("evaluating policy api-call rule lookup failed"))
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RedactedValue is the placeholder of the sensitive values in the printed objects.
+const RedactedValue = "***"
+
+// SensitiveMinLength is the minimum length of the sensitive values redacted from
+// the fields which contain them. The shorter values, such as ports, PINs or flags,
+// are redacted only from the fields matching them exactly.
+const SensitiveMinLength = 6
+
+// SensitiveValue is a concrete value found at a sensitive path.
+type SensitiveValue struct {
+	// Path is the sensitive path under which the value was found.
+	Path string
+
+	// Value is the string, number or bool value, formatted as in JSON for the non-string values.
+	Value string
+}
+
+// IsShort returns true if the value is shorter than SensitiveMinLength.
+func (v SensitiveValue) IsShort() bool {
+	return len(v.Value) < SensitiveMinLength
+}
+
+// SensitiveValues returns the concrete strings, numbers and bools found in the values at
+// the given paths. If a path points to a struct or a list, all the values nested under it
+// are returned. An error is returned if a path is not found in the values.
+func SensitiveValues(values cue.Value, paths []string) ([]SensitiveValue, error) {
+	var result []SensitiveValue
+	for _, p := range paths {
+		v := values.LookupPath(cue.ParsePath(p))
+		if !v.Exists() {
+			return nil, fmt.Errorf("sensitive value '%s' not found", p)
+		}
+
+		v.Walk(func(v cue.Value) bool {
+			var value string
+			switch v.IncompleteKind() {
+			case cue.StringKind:
+				value, _ = v.String()
+			case cue.IntKind, cue.FloatKind, cue.NumberKind, cue.BoolKind:
+				if data, err := v.MarshalJSON(); err == nil {
+					value = string(data)
+				}
+			}
+			if value != "" {
+				result = append(result, SensitiveValue{Path: p, Value: value})
+			}
+			return true
+		}, nil)
+	}
+	return result, nil
+}
+
+// RedactValues replaces the values found at the given paths with RedactedValue.
+// If a path points to a struct or a list, the whole struct or list is replaced.
+// An error is returned if a path is not found in the values.
+func RedactValues(values map[string]any, paths []string) error {
+	for _, p := range paths {
+		selectors := cue.ParsePath(p).Selectors()
+		if len(selectors) == 0 {
+			return fmt.Errorf("sensitive value '%s' not found", p)
+		}
+
+		var parent any = values
+		for i, sel := range selectors {
+			last := i == len(selectors)-1
+			switch node := parent.(type) {
+			case map[string]any:
+				key := sel.Unquoted()
+				if _, ok := node[key]; !ok {
+					return fmt.Errorf("sensitive value '%s' not found", p)
+				}
+				if last {
+					node[key] = RedactedValue
+				}
+				parent = node[key]
+			case []any:
+				if sel.Type() != cue.IndexLabel || sel.Index() >= len(node) {
+					return fmt.Errorf("sensitive value '%s' not found", p)
+				}
+				if last {
+					node[sel.Index()] = RedactedValue
+				}
+				parent = node[sel.Index()]
+			default:
+				return fmt.Errorf("sensitive value '%s' not found", p)
+			}
+		}
+	}
+	return nil
+}
+
+// RedactObjects replaces with RedactedValue the fields of the objects which contain
+// any of the sensitive values. The short sensitive values, and the non-string fields,
+// are matched only if the field is equal to the value. The Secrets data is base64
+// decoded before comparing. The fields which identify the objects, such as the kind,
+// name and namespace, are never redacted.
+func RedactObjects(objects []*unstructured.Unstructured, sensitive []SensitiveValue) {
+	if len(sensitive) == 0 {
+		return
+	}
+
+	contains := func(s string) bool {
+		for _, v := range sensitive {
+			if s == v.Value || (!v.IsShort() && strings.Contains(s, v.Value)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, object := range objects {
+		for key, value := range object.Object {
+			switch key {
+			case "apiVersion", "kind":
+				continue
+			case "metadata":
+				if metadata, ok := value.(map[string]any); ok {
+					for field, v := range metadata {
+						if field != "name" && field != "namespace" {
+							metadata[field] = redactFields(v, contains)
+						}
+					}
+					continue
+				}
+			case "data":
+				if data, ok := value.(map[string]any); ok && object.GetAPIVersion() == "v1" && object.GetKind() == "Secret" {
+					for field, v := range data {
+						encoded, ok := v.(string)
+						if !ok {
+							continue
+						}
+						decoded, err := base64.StdEncoding.DecodeString(encoded)
+						if err != nil {
+							decoded = []byte(encoded)
+						}
+						if contains(string(decoded)) {
+							data[field] = RedactedValue
+						}
+					}
+					continue
+				}
+			}
+			object.Object[key] = redactFields(value, contains)
+		}
+	}
+}
+
+// redactFields returns the value with all the strings, numbers and bools
+// matched by the contains function replaced with RedactedValue.
+func redactFields(value any, contains func(string) bool) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			v[key] = redactFields(field, contains)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactFields(item, contains)
+		}
+	case string:
+		if contains(v) {
+			return RedactedValue
+		}
+	case int, int64, float64, bool:
+		if contains(fmt.Sprint(v)) {
+			return RedactedValue
+		}
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSensitiveValues(t *testing.T) {
+	g := NewWithT(t)
+
+	values := cuecontext.New().CompileString(`
+auth: {
+	user:     "admin"
+	password: "s3cr3t"
+}
+token: "abc123"
+pin: 1234
+tls: enabled: true
+replicas: 2
+`)
+
+	sensitive, err := SensitiveValues(values, []string{"auth", "token", "pin", "tls"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(sensitive).To(ConsistOf(
+		SensitiveValue{Path: "auth", Value: "admin"},
+		SensitiveValue{Path: "auth", Value: "s3cr3t"},
+		SensitiveValue{Path: "token", Value: "abc123"},
+		SensitiveValue{Path: "pin", Value: "1234"},
+		SensitiveValue{Path: "tls", Value: "true"},
+	))
+	g.Expect(SensitiveValue{Value: "abc123"}.IsShort()).To(BeFalse())
+	g.Expect(SensitiveValue{Value: "1234"}.IsShort()).To(BeTrue())
+
+	_, err = SensitiveValues(values, []string{"auth.key"})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("sensitive value 'auth.key' not found"))
+}
+
+func TestRedactObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	secret := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]any{"name": "app"},
+		"data": map[string]any{
+			"password": base64.StdEncoding.EncodeToString([]byte("s3cr3t")),
+			// the base64 encoding of the value doesn't appear in the encoded URL
+			"url":  base64.StdEncoding.EncodeToString([]byte("redis://:s3cr3t@redis:6379")),
+			"user": base64.StdEncoding.EncodeToString([]byte("admin")),
+		},
+	}}
+	deployment := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":        "s3cr3t",
+			"annotations": map[string]any{"checksum": "s3cr3t"},
+		},
+		"spec": map[string]any{
+			"replicas": int64(2),
+			"args":     []any{"--password=s3cr3t", "--verbose", "--pin=1234"},
+			"pin":      int64(1234),
+			"port":     int64(12345),
+			"env":      []any{"1234"},
+		},
+	}}
+
+	RedactObjects([]*unstructured.Unstructured{secret, deployment}, []SensitiveValue{
+		{Path: "password", Value: "s3cr3t"},
+		{Path: "pin", Value: "1234"},
+	})
+
+	g.Expect(secret.Object["data"]).To(HaveKeyWithValue("password", RedactedValue))
+	g.Expect(secret.Object["data"]).To(HaveKeyWithValue("url", RedactedValue))
+	g.Expect(secret.Object["data"]).To(HaveKeyWithValue("user", base64.StdEncoding.EncodeToString([]byte("admin"))))
+
+	spec := deployment.Object["spec"].(map[string]any)
+	// the short values are redacted only from the fields equal to them
+	g.Expect(spec["args"]).To(Equal([]any{RedactedValue, "--verbose", "--pin=1234"}))
+	g.Expect(spec["pin"]).To(Equal(RedactedValue))
+	g.Expect(spec["port"]).To(Equal(int64(12345)))
+	g.Expect(spec["env"]).To(Equal([]any{RedactedValue}))
+	g.Expect(spec["replicas"]).To(Equal(int64(2)))
+	g.Expect(deployment.GetAnnotations()).To(HaveKeyWithValue("checksum", RedactedValue))
+	g.Expect(deployment.GetName()).To(Equal("s3cr3t"))
+}
+
+func TestRedactValues(t *testing.T) {
+	g := NewWithT(t)
+
+	values := map[string]any{
+		"auth": map[string]any{
+			"user":     "admin",
+			"password": "s3cr3t",
+		},
+		"tokens":   []any{"abc123", "def456"},
+		"replicas": int64(2),
+		"user":     "admin",
+	}
+
+	g.Expect(RedactValues(values, []string{"auth.password", "tokens[1]"})).To(Succeed())
+	g.Expect(values).To(Equal(map[string]any{
+		"auth": map[string]any{
+			"user":     "admin",
+			"password": RedactedValue,
+		},
+		"tokens":   []any{"abc123", RedactedValue},
+		"replicas": int64(2),
+		"user":     "admin",
+	}))
+
+	g.Expect(RedactValues(values, []string{"auth"})).To(Succeed())
+	g.Expect(values["auth"]).To(Equal(RedactedValue))
+
+	err := RedactValues(values, []string{"tls.key"})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("sensitive value 'tls.key' not found"))
+}
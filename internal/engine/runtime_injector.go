@@ -17,8 +17,14 @@ limitations under the License.
 package engine
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/ast"
@@ -30,22 +36,77 @@ import (
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 )
 
+// InjectorRequest holds the attribute and the runtime context passed to an InjectorHandler.
+type InjectorRequest struct {
+	// Body is the attribute body, e.g. 'vault:secret/app' for '@timoni(vault:secret/app)'.
+	Body string
+
+	// Args is the attribute body without the directive prefix, e.g. 'secret/app'.
+	Args string
+
+	// Vars are the runtime values passed to Inject.
+	Vars map[string]string
+
+	// Dir is the directory against which relative paths are resolved.
+	Dir string
+}
+
+// InjectorHandler returns the value of a field with a @timoni() attribute.
+// If the returned expression is nil, the field is left untouched.
+type InjectorHandler func(req InjectorRequest) (ast.Expr, error)
+
+// InjectorHandlers is a registry of injector handlers keyed by directive name.
+type InjectorHandlers map[string]InjectorHandler
+
 // RuntimeInjector injects field values in CUE files based on @timoni() attributes.
 type RuntimeInjector struct {
-	ctx *cue.Context
+	ctx      *cue.Context
+	handlers InjectorHandlers
 }
 
-// NewRuntimeInjector creates an RuntimeInjector for the given context.
+// NewRuntimeInjector creates an RuntimeInjector for the given context,
+// with the built-in runtime, read and meta handlers registered.
 func NewRuntimeInjector(ctx *cue.Context) *RuntimeInjector {
-	return &RuntimeInjector{ctx: ctx}
+	in := &RuntimeInjector{ctx: ctx}
+	in.handlers = InjectorHandlers{
+		apiv1.RuntimeKind: in.injectRuntime,
+		apiv1.ReadKind:    in.injectRead,
+		apiv1.MetaKind:    in.injectMeta,
+	}
+	return in
+}
+
+// NewRuntimeInjectorWithHandlers creates an RuntimeInjector with the given handlers
+// registered next to the built-in ones. The handlers are invoked for the attributes
+// in the format '@timoni([DIRECTIVE]:[ARGS])'. An error is returned if a directive
+// name is invalid or conflicts with a built-in directive.
+func NewRuntimeInjectorWithHandlers(ctx *cue.Context, handlers InjectorHandlers) (*RuntimeInjector, error) {
+	in := NewRuntimeInjector(ctx)
+	for directive, handler := range handlers {
+		if directive == "" || strings.Contains(directive, apiv1.RuntimeDelimiter) {
+			return nil, fmt.Errorf("invalid injector directive '%s'", directive)
+		}
+		if _, ok := in.handlers[directive]; ok || directive == apiv1.ExprKind {
+			return nil, fmt.Errorf("injector directive '%s' is reserved", directive)
+		}
+		in.handlers[directive] = handler
+	}
+	return in, nil
 }
 
 // Inject searches for Timoni's attributes and
 // sets the CUE field value to the runtime value.
 // If an attribute does not match any runtime value,
 // the CUE field is left untouched.
+// Relative paths in read attributes are resolved against the working directory.
 func (in *RuntimeInjector) Inject(node ast.Node, vars map[string]string) ([]byte, error) {
-	output, err := in.inject(node, vars)
+	return in.InjectFromDir(node, vars, "")
+}
+
+// InjectFromDir is like Inject, but it resolves relative
+// paths in read attributes against the given directory.
+func (in *RuntimeInjector) InjectFromDir(node ast.Node, vars map[string]string, dir string) ([]byte, error) {
+	output, err := in.inject(node, vars, dir)
 	if err != nil {
 		return nil, err
 	}
@@ -76,8 +137,64 @@ func (in *RuntimeInjector) ListAttributes(f *ast.File) map[string]string {
 	return attrs
 }
 
-func (in *RuntimeInjector) inject(node ast.Node, vars map[string]string) (ast.Node, error) {
+// ListReadFiles returns the paths of the files referenced by the
+// '@timoni(read:file:[PATH])' attributes, with the relative paths
+// resolved against the given directory.
+func (in *RuntimeInjector) ListReadFiles(node ast.Node, dir string) []string {
+	var files []string
+
+	ast.Walk(node, nil, func(n ast.Node) {
+		switch x := n.(type) {
+		case *ast.Field:
+			for _, a := range x.Attrs {
+				if !apiv1.IsReadAttribute(a.Split()) {
+					continue
+				}
+				ra, _ := apiv1.NewReadAttribute(a.Split())
+				if ra.Type != apiv1.ReadFileType {
+					continue
+				}
+				fp := ra.Path
+				if !filepath.IsAbs(fp) && dir != "" {
+					fp = filepath.Join(dir, fp)
+				}
+				files = append(files, fp)
+			}
+		}
+	})
+
+	return files
+}
+
+// ListWarnings returns a warning for each @timoni() attribute that doesn't match
+// the runtime, read or expr syntax, or a registered directive, as the field value
+// is left unchanged by Inject.
+func (in *RuntimeInjector) ListWarnings(node ast.Node) []string {
+	var warnings []string
+
+	ast.Walk(node, nil, func(n ast.Node) {
+		switch x := n.(type) {
+		case *ast.Field:
+			for _, a := range x.Attrs {
+				key, body := a.Split()
+				if key != apiv1.FieldManager {
+					continue
+				}
+				if in.isKnownAttribute(key, body) {
+					continue
+				}
+				warnings = append(warnings, fmt.Sprintf("%s: unknown attribute '@%s(%s)' is ignored",
+					a.Pos().String(), apiv1.FieldManager, body))
+			}
+		}
+	})
+
+	return warnings
+}
+
+func (in *RuntimeInjector) inject(node ast.Node, vars map[string]string, dir string) (ast.Node, error) {
 	var err error
+	var hasExpr bool
 	f := func(c astutil.Cursor) bool {
 		n := c.Node()
 		switch n.(type) {
@@ -95,28 +212,347 @@ func (in *RuntimeInjector) inject(node ast.Node, vars map[string]string) (ast.No
 				}
 			}
 
-			if !apiv1.IsRuntimeAttribute(key, body) {
+			if apiv1.IsExprAttribute(key, body) {
+				hasExpr = true
 				return true
 			}
 
-			ra, _ := apiv1.NewRuntimeAttribute(key, body)
+			if key != apiv1.FieldManager {
+				return true
+			}
+
+			directive, args, _ := strings.Cut(body, apiv1.RuntimeDelimiter)
+			handler, ok := in.handlers[directive]
+			if !ok {
+				return true
+			}
 
-			if envVal, ok := vars[ra.Name]; ok {
-				switch ra.Type {
-				case "string":
-					field.Value = ast.NewLit(token.STRING, in.quoteString(envVal))
-				case "number":
-					field.Value = ast.NewLit(token.INT, envVal)
-				case "bool":
-					field.Value = ast.NewIdent(envVal)
+			value, herr := handler(InjectorRequest{
+				Body: body,
+				Args: args,
+				Vars: vars,
+				Dir:  dir,
+			})
+			if herr != nil {
+				err = herr
+				return false
+			}
+			if value != nil {
+				field.Value = value
+				c.Replace(field)
+			}
+		}
+		return true
+	}
+
+	output := astutil.Apply(node, f, nil)
+	if err != nil || !hasExpr {
+		return output, err
+	}
+
+	return in.injectExpr(output)
+}
+
+// HasExternalValues returns true if the node contains attributes that inject
+// values from outside the CUE files, such as runtime values, file contents
+// and the values returned by the registered handlers.
+func (in *RuntimeInjector) HasExternalValues(node ast.Node) bool {
+	found := false
+	ast.Walk(node, nil, func(n ast.Node) {
+		switch x := n.(type) {
+		case *ast.Field:
+			for _, a := range x.Attrs {
+				key, body := a.Split()
+				if key != apiv1.FieldManager || !in.isKnownAttribute(key, body) {
+					continue
+				}
+				switch directive, _, _ := strings.Cut(body, apiv1.RuntimeDelimiter); directive {
+				case apiv1.ExprKind, apiv1.MetaKind:
 				default:
-					err = fmt.Errorf("failed to parse attribute '@%s(%s)', unknown type '%s' must be string, number or bool",
-						apiv1.FieldManager, body, ra.Type)
-					return false
+					found = true
 				}
-				c.Replace(field)
 			}
 		}
+	})
+	return found
+}
+
+// isKnownAttribute returns true if the attribute matches
+// the syntax of a built-in or a registered directive.
+func (in *RuntimeInjector) isKnownAttribute(key, body string) bool {
+	directive, _, _ := strings.Cut(body, apiv1.RuntimeDelimiter)
+	switch directive {
+	case apiv1.RuntimeKind:
+		return apiv1.IsRuntimeAttribute(key, body)
+	case apiv1.ReadKind:
+		return apiv1.IsReadAttribute(key, body)
+	case apiv1.ExprKind:
+		return apiv1.IsExprAttribute(key, body)
+	case apiv1.MetaKind:
+		return apiv1.IsMetaAttribute(key, body)
+	}
+	_, ok := in.handlers[directive]
+	return key == apiv1.FieldManager && ok
+}
+
+// injectRuntime returns the runtime value referenced by the
+// '@timoni(runtime:[TYPE]:[NAME][,TRANSFORM...])' attribute, or nil if the value isn't set.
+func (in *RuntimeInjector) injectRuntime(req InjectorRequest) (ast.Expr, error) {
+	if !apiv1.IsRuntimeAttribute(apiv1.FieldManager, req.Body) {
+		return nil, nil
+	}
+
+	ra, _ := apiv1.NewRuntimeAttribute(apiv1.FieldManager, req.Body)
+	envVal, ok := req.Vars[ra.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	envVal, err := transformValue(envVal, ra.Transforms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attribute '@%s(%s)', %w", apiv1.FieldManager, req.Body, err)
+	}
+
+	switch ra.Type {
+	case "string":
+		return ast.NewLit(token.STRING, in.quoteString(envVal)), nil
+	case "number":
+		return ast.NewLit(token.INT, envVal), nil
+	case "bool":
+		return ast.NewIdent(envVal), nil
+	default:
+		return nil, fmt.Errorf("failed to parse attribute '@%s(%s)', unknown type '%s' must be string, number or bool",
+			apiv1.FieldManager, req.Body, ra.Type)
+	}
+}
+
+// injectRead returns the content of the file referenced by the
+// '@timoni(read:file:[PATH][,TRANSFORM...])' attribute.
+func (in *RuntimeInjector) injectRead(req InjectorRequest) (ast.Expr, error) {
+	if !apiv1.IsReadAttribute(apiv1.FieldManager, req.Body) {
+		return nil, nil
+	}
+
+	ra, _ := apiv1.NewReadAttribute(apiv1.FieldManager, req.Body)
+	if ra.Type != apiv1.ReadFileType {
+		return nil, fmt.Errorf("failed to parse attribute '@%s(%s)', unknown type '%s' must be %s",
+			apiv1.FieldManager, req.Body, ra.Type, apiv1.ReadFileType)
+	}
+
+	fp := ra.Path
+	if !filepath.IsAbs(fp) && req.Dir != "" {
+		fp = filepath.Join(req.Dir, fp)
+	}
+
+	content, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file for attribute '@%s(%s)': %w", apiv1.FieldManager, req.Body, err)
+	}
+
+	value, err := transformValue(string(content), ra.Transforms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attribute '@%s(%s)', %w", apiv1.FieldManager, req.Body, err)
+	}
+
+	return ast.NewLit(token.STRING, in.quoteString(value)), nil
+}
+
+// injectMeta returns the build metadata referenced by the
+// '@timoni(meta:[timestamp|revision][,TRANSFORM...])' attribute.
+// The revision is read from the TIMONI_REVISION env var, or from the Git
+// HEAD commit of the directory. The timestamp is read from the TIMONI_TIMESTAMP
+// env var, or from the commit time of the revision, in RFC3339 format.
+// If the revision is not known to Git, the timestamp must be set with TIMONI_TIMESTAMP.
+func (in *RuntimeInjector) injectMeta(req InjectorRequest) (ast.Expr, error) {
+	if !apiv1.IsMetaAttribute(apiv1.FieldManager, req.Body) {
+		return nil, fmt.Errorf("failed to parse attribute '@%s(%s)', invalid format must be @%s(%s%s[%s|%s])",
+			apiv1.FieldManager, req.Body, apiv1.FieldManager, apiv1.MetaKind, apiv1.RuntimeDelimiter,
+			apiv1.MetaTimestamp, apiv1.MetaRevision)
+	}
+
+	ma, _ := apiv1.NewMetaAttribute(apiv1.FieldManager, req.Body)
+	revision, err := buildRevision(req.Dir)
+	if err != nil && ma.Name == apiv1.MetaRevision {
+		return nil, fmt.Errorf("failed to resolve attribute '@%s(%s)', %w", apiv1.FieldManager, req.Body, err)
+	}
+
+	value := revision
+	if ma.Name == apiv1.MetaTimestamp {
+		value, err = buildTimestamp(req.Dir, revision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve attribute '@%s(%s)', %w", apiv1.FieldManager, req.Body, err)
+		}
+	}
+
+	value, err = transformValue(value, ma.Transforms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse attribute '@%s(%s)', %w", apiv1.FieldManager, req.Body, err)
+	}
+
+	return ast.NewLit(token.STRING, in.quoteString(value)), nil
+}
+
+// buildRevision returns the revision set with the TIMONI_REVISION
+// env var, or the Git commit SHA of HEAD in the given directory.
+func buildRevision(dir string) (string, error) {
+	if rev := os.Getenv(apiv1.MetaRevisionEnv); rev != "" {
+		return rev, nil
+	}
+
+	rev, err := gitShow(dir, "HEAD", "%H")
+	if err != nil {
+		return "", fmt.Errorf("the revision could not be determined from Git, set it with %s: %w",
+			apiv1.MetaRevisionEnv, err)
+	}
+	return rev, nil
+}
+
+// buildTimestamp returns the timestamp set with the TIMONI_TIMESTAMP env var,
+// or the Git commit time of the revision. The current time is returned only
+// when no revision is known, so that the builds of a revision are reproducible.
+func buildTimestamp(dir, revision string) (string, error) {
+	if ts := os.Getenv(apiv1.MetaTimestampEnv); ts != "" {
+		return ts, nil
+	}
+
+	if revision == "" {
+		return time.Now().UTC().Format(time.RFC3339), nil
+	}
+
+	ct, err := gitShow(dir, revision, "%ct")
+	if err == nil {
+		var sec int64
+		if sec, err = strconv.ParseInt(ct, 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC().Format(time.RFC3339), nil
+		}
+	}
+	return "", fmt.Errorf("the commit time of revision %s could not be determined from Git, set it with %s: %w",
+		revision, apiv1.MetaTimestampEnv, err)
+}
+
+// gitShow returns the formatted info of the given Git revision.
+func gitShow(dir, revision, format string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "--no-pager", "show", "-s", "--format="+format, "--end-of-options", revision)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// transformValue applies the transforms in order to the injected value.
+// The supported transforms are 'trim', 'lower', 'upper' and 'replace:[OLD]:[NEW]',
+// where OLD and NEW can be quoted to contain delimiters.
+func transformValue(value string, transforms []string) (string, error) {
+	for _, t := range transforms {
+		name, args, _ := strings.Cut(t, apiv1.RuntimeDelimiter)
+		switch {
+		case name == "trim" && args == "":
+			value = strings.TrimSpace(value)
+		case name == "lower" && args == "":
+			value = strings.ToLower(value)
+		case name == "upper" && args == "":
+			value = strings.ToUpper(value)
+		case name == "replace":
+			old, replacement, ok := cutTransformArgs(args)
+			if !ok || old == "" {
+				return "", fmt.Errorf("invalid transform '%s' must be replace%s[OLD]%s[NEW]",
+					t, apiv1.RuntimeDelimiter, apiv1.RuntimeDelimiter)
+			}
+			value = strings.ReplaceAll(value, old, replacement)
+		default:
+			return "", fmt.Errorf("unknown transform '%s' must be trim, lower, upper or replace", t)
+		}
+	}
+	return value, nil
+}
+
+// cutTransformArgs splits the 'OLD:NEW' arguments of the replace transform,
+// quoted arguments are unquoted.
+func cutTransformArgs(args string) (string, string, bool) {
+	var parts []string
+	for args != "" {
+		if strings.HasPrefix(args, `"`) {
+			q, err := strconv.QuotedPrefix(args)
+			if err != nil {
+				return "", "", false
+			}
+			p, _ := strconv.Unquote(q)
+			parts = append(parts, p)
+			args = args[len(q):]
+			if args != "" && !strings.HasPrefix(args, apiv1.RuntimeDelimiter) {
+				return "", "", false
+			}
+		} else {
+			p, _, _ := strings.Cut(args, apiv1.RuntimeDelimiter)
+			parts = append(parts, p)
+			args = args[len(p):]
+		}
+		if args != "" {
+			args = args[len(apiv1.RuntimeDelimiter):]
+			if args == "" {
+				parts = append(parts, "")
+			}
+		}
+	}
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// injectExpr sets the value of the fields with expression attributes
+// to the result of evaluating the CUE expression. The expressions are
+// evaluated after the runtime and read attributes are injected, and
+// their references are resolved against the top-level fields of the file.
+func (in *RuntimeInjector) injectExpr(node ast.Node) (ast.Node, error) {
+	src, err := format.Node(node)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := in.ctx.CompileBytes(src)
+	if scope.Err() != nil {
+		return nil, fmt.Errorf("failed to compile the scope of the expression attributes: %w", scope.Err())
+	}
+
+	f := func(c astutil.Cursor) bool {
+		field, ok := c.Node().(*ast.Field)
+		if !ok || len(field.Attrs) == 0 {
+			return true
+		}
+
+		var key, body string
+		for _, a := range field.Attrs {
+			key, body = a.Split()
+			if key == apiv1.FieldManager {
+				break
+			}
+		}
+
+		if !apiv1.IsExprAttribute(key, body) {
+			return true
+		}
+
+		ea, _ := apiv1.NewExprAttribute(key, body)
+		v := in.ctx.CompileString(ea.Expr, cue.Scope(scope), cue.InferBuiltins(true))
+		if verr := v.Validate(cue.Concrete(true)); verr != nil {
+			err = fmt.Errorf("failed to evaluate attribute '@%s(%s)': %w", apiv1.FieldManager, body, verr)
+			return false
+		}
+
+		expr, ok := v.Syntax(cue.Final(), cue.Concrete(true)).(ast.Expr)
+		if !ok {
+			err = fmt.Errorf("failed to evaluate attribute '@%s(%s)', the result is not a value", apiv1.FieldManager, body)
+			return false
+		}
+
+		field.Value = expr
+		c.Replace(field)
 		return true
 	}
 
@@ -17,8 +17,14 @@ limitations under the License.
 package engine
 
 import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/cuecontext"
 	"cuelang.org/go/cue/parser"
 	. "github.com/onsi/gomega"
@@ -127,3 +133,315 @@ secrets: {
 	g.Expect(err).ToNot(HaveOccurred())
 	g.Expect(string(result)).To(BeIdenticalTo(output))
 }
+
+func TestInjector_Expr(t *testing.T) {
+	ctx := cuecontext.New()
+
+	t.Setenv("REGISTRY", "ghcr.io/stefanprodan")
+
+	t.Run("evaluates expressions against the injected values", func(t *testing.T) {
+		g := NewWithT(t)
+
+		input := `package main
+
+#registry: string @timoni(runtime:string:REGISTRY)
+#image:    "podinfo"
+
+values: {
+	image: string @timoni(expr:"#registry + \"/\" + #image")
+	name:  string @timoni(expr:strings.ToUpper(#image))
+}
+`
+		output := `package main
+
+#registry: "ghcr.io/stefanprodan" @timoni(runtime:string:REGISTRY)
+#image:    "podinfo"
+
+values: {
+	image: "ghcr.io/stefanprodan/podinfo" @timoni(expr:"#registry + \"/\" + #image")
+	name:  "PODINFO"                      @timoni(expr:strings.ToUpper(#image))
+}
+`
+
+		f, err := parser.ParseFile("", []byte(input), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		result, err := NewRuntimeInjector(ctx).Inject(f, GetEnv())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(result)).To(BeIdenticalTo(output))
+	})
+
+	t.Run("fails for unresolved references", func(t *testing.T) {
+		g := NewWithT(t)
+
+		input := `package main
+
+#image: "podinfo"
+
+values: image: string @timoni(expr:#registry + "/" + #image)
+`
+
+		f, err := parser.ParseFile("", []byte(input), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewRuntimeInjector(ctx).Inject(f, GetEnv())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(`failed to evaluate attribute '@timoni(expr:#registry + "/" + #image)'`))
+	})
+}
+
+func TestInjector_Handlers(t *testing.T) {
+	ctx := cuecontext.New()
+
+	t.Run("invokes the custom handlers", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var calls []string
+		vault := func(req InjectorRequest) (ast.Expr, error) {
+			calls = append(calls, req.Args)
+			return ast.NewString(fmt.Sprintf("%s-%s", req.Vars["ENV"], req.Args)), nil
+		}
+
+		input := `package main
+
+values: {
+	env:      string @timoni(runtime:string:ENV)
+	password: string @timoni(vault:secret/app)
+	debug:    string @timoni(flags:debug)
+}
+`
+		output := `package main
+
+values: {
+	env:      "prod"            @timoni(runtime:string:ENV)
+	password: "prod-secret/app" @timoni(vault:secret/app)
+	debug:    string            @timoni(flags:debug)
+}
+`
+
+		f, err := parser.ParseFile("", []byte(input), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		in, err := NewRuntimeInjectorWithHandlers(ctx, InjectorHandlers{"vault": vault})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		result, err := in.Inject(f, map[string]string{"ENV": "prod"})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(result)).To(BeIdenticalTo(output))
+		g.Expect(calls).To(Equal([]string{"secret/app"}))
+
+		warnings := in.ListWarnings(f)
+		g.Expect(warnings).To(HaveLen(1))
+		g.Expect(warnings[0]).To(ContainSubstring("unknown attribute '@timoni(flags:debug)'"))
+	})
+
+	t.Run("fails with the handler error", func(t *testing.T) {
+		g := NewWithT(t)
+
+		vault := func(req InjectorRequest) (ast.Expr, error) {
+			return nil, fmt.Errorf("secret %s not found", req.Args)
+		}
+
+		f, err := parser.ParseFile("", []byte(`password: string @timoni(vault:secret/app)`), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		in, err := NewRuntimeInjectorWithHandlers(ctx, InjectorHandlers{"vault": vault})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = in.Inject(f, nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("secret secret/app not found"))
+	})
+
+	t.Run("fails for reserved directives", func(t *testing.T) {
+		g := NewWithT(t)
+
+		for _, directive := range []string{"runtime", "read", "expr"} {
+			_, err := NewRuntimeInjectorWithHandlers(ctx, InjectorHandlers{
+				directive: func(req InjectorRequest) (ast.Expr, error) { return nil, nil },
+			})
+			g.Expect(err).To(HaveOccurred())
+			g.Expect(err.Error()).To(ContainSubstring("is reserved"))
+		}
+	})
+}
+
+func TestInjector_Transforms(t *testing.T) {
+	ctx := cuecontext.New()
+
+	t.Run("chains transforms on file values", func(t *testing.T) {
+		g := NewWithT(t)
+		tmpDir := t.TempDir()
+		g.Expect(os.WriteFile(filepath.Join(tmpDir, "name.txt"), []byte("  My-App\n"), 0644)).To(Succeed())
+
+		input := `package main
+
+values: {
+	name:  string @timoni(read:file:name.txt,trim,lower)
+	label: string @timoni(read:file:"name.txt", trim, upper, replace:"-":"_")
+	env:   string @timoni(runtime:string:ENV,replace:prod:production)
+}
+`
+		output := `package main
+
+values: {
+	name:  "my-app"     @timoni(read:file:name.txt,trim,lower)
+	label: "MY_APP"     @timoni(read:file:"name.txt", trim, upper, replace:"-":"_")
+	env:   "production" @timoni(runtime:string:ENV,replace:prod:production)
+}
+`
+
+		f, err := parser.ParseFile("", []byte(input), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		in := NewRuntimeInjector(ctx)
+		g.Expect(in.ListReadFiles(f, tmpDir)).To(Equal([]string{filepath.Join(tmpDir, "name.txt"), filepath.Join(tmpDir, "name.txt")}))
+
+		result, err := in.InjectFromDir(f, map[string]string{"ENV": "prod"}, tmpDir)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(result)).To(BeIdenticalTo(output))
+		g.Expect(in.ListAttributes(f)).To(Equal(map[string]string{"ENV": "string"}))
+	})
+
+	t.Run("fails for unknown transforms", func(t *testing.T) {
+		g := NewWithT(t)
+		tmpDir := t.TempDir()
+		g.Expect(os.WriteFile(filepath.Join(tmpDir, "name.txt"), []byte("app"), 0644)).To(Succeed())
+
+		f, err := parser.ParseFile("", []byte(`name: string @timoni(read:file:name.txt,trim,base64)`), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewRuntimeInjector(ctx).InjectFromDir(f, nil, tmpDir)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("failed to parse attribute '@timoni(read:file:name.txt,trim,base64)', unknown transform 'base64'"))
+	})
+
+	t.Run("fails for invalid replace transforms", func(t *testing.T) {
+		g := NewWithT(t)
+
+		f, err := parser.ParseFile("", []byte(`env: string @timoni(runtime:string:ENV,replace:prod)`), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewRuntimeInjector(ctx).Inject(f, map[string]string{"ENV": "prod"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("invalid transform 'replace:prod' must be replace:[OLD]:[NEW]"))
+	})
+}
+
+func TestInjector_Meta(t *testing.T) {
+	ctx := cuecontext.New()
+
+	input := `package main
+
+values: {
+	revision:  string @timoni(meta:revision)
+	short:     string @timoni(meta:revision,replace:"1234567890":"")
+	timestamp: string @timoni(meta:timestamp)
+}
+`
+
+	t.Run("injects the supplied revision and timestamp", func(t *testing.T) {
+		g := NewWithT(t)
+		t.Setenv("TIMONI_REVISION", "abcdef1234567890")
+		t.Setenv("TIMONI_TIMESTAMP", "2024-01-02T03:04:05Z")
+
+		output := `package main
+
+values: {
+	revision:  "abcdef1234567890"     @timoni(meta:revision)
+	short:     "abcdef"               @timoni(meta:revision,replace:"1234567890":"")
+	timestamp: "2024-01-02T03:04:05Z" @timoni(meta:timestamp)
+}
+`
+
+		f, err := parser.ParseFile("", []byte(input), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		in := NewRuntimeInjector(ctx)
+		g.Expect(in.ListWarnings(f)).To(BeEmpty())
+
+		result, err := in.InjectFromDir(f, nil, t.TempDir())
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(result)).To(BeIdenticalTo(output))
+	})
+
+	t.Run("resolves the revision and timestamp from git", func(t *testing.T) {
+		g := NewWithT(t)
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git not found")
+		}
+		t.Setenv("TIMONI_REVISION", "")
+		t.Setenv("TIMONI_TIMESTAMP", "")
+		t.Setenv("GIT_COMMITTER_DATE", "2024-01-02T03:04:05Z")
+
+		tmpDir := t.TempDir()
+		git := func(args ...string) string {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+			cmd.Dir = tmpDir
+			out, err := cmd.CombinedOutput()
+			g.Expect(err).ToNot(HaveOccurred(), string(out))
+			return strings.TrimSpace(string(out))
+		}
+		git("init", "-q")
+		git("commit", "-q", "--allow-empty", "-m", "init")
+		revision := git("rev-parse", "HEAD")
+
+		f, err := parser.ParseFile("", []byte(input), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		result, err := NewRuntimeInjector(ctx).InjectFromDir(f, nil, tmpDir)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(string(result)).To(ContainSubstring(fmt.Sprintf(`revision:  "%s"`, revision)))
+		g.Expect(string(result)).To(ContainSubstring(`timestamp: "2024-01-02T03:04:05Z"`))
+	})
+
+	t.Run("fails for unknown revision without timestamp", func(t *testing.T) {
+		g := NewWithT(t)
+		t.Setenv("TIMONI_REVISION", "ci-build-1234")
+		t.Setenv("TIMONI_TIMESTAMP", "")
+
+		f, err := parser.ParseFile("", []byte(input), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewRuntimeInjector(ctx).InjectFromDir(f, nil, t.TempDir())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("the commit time of revision ci-build-1234 could not be determined"))
+		g.Expect(err.Error()).To(ContainSubstring("TIMONI_TIMESTAMP"))
+	})
+
+	t.Run("doesn't pass the revision as a git option", func(t *testing.T) {
+		g := NewWithT(t)
+		if _, err := exec.LookPath("git"); err != nil {
+			t.Skip("git not found")
+		}
+		tmpDir := t.TempDir()
+		outFile := filepath.Join(tmpDir, "out.txt")
+		t.Setenv("TIMONI_REVISION", "--output="+outFile)
+		t.Setenv("TIMONI_TIMESTAMP", "")
+
+		g.Expect(exec.Command("git", "init", "-q", tmpDir).Run()).To(Succeed())
+		cmd := exec.Command("git", "-c", "user.name=test", "-c", "user.email=test@example.com",
+			"commit", "-q", "--allow-empty", "-m", "init")
+		cmd.Dir = tmpDir
+		out, err := cmd.CombinedOutput()
+		g.Expect(err).ToNot(HaveOccurred(), string(out))
+
+		f, err := parser.ParseFile("", []byte(input), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewRuntimeInjector(ctx).InjectFromDir(f, nil, tmpDir)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(outFile).ToNot(BeAnExistingFile())
+	})
+
+	t.Run("fails for unknown metadata", func(t *testing.T) {
+		g := NewWithT(t)
+
+		f, err := parser.ParseFile("", []byte(`version: string @timoni(meta:version)`), parser.ParseComments)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = NewRuntimeInjector(ctx).Inject(f, nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("invalid format must be @timoni(meta:[timestamp|revision])"))
+	})
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// sopsMetadataField is the top-level field added by SOPS to the encrypted documents.
+const sopsMetadataField = "sops"
+
+// IsSOPSEncrypted reports whether the given YAML or JSON document
+// contains the SOPS metadata. CUE files encrypted by SOPS
+// are stored in the JSON format, with the content under the data field.
+func IsSOPSEncrypted(data []byte) bool {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	metadata, ok := doc[sopsMetadataField].(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = metadata["mac"]
+	return ok
+}
+
+// DecryptSOPS decrypts the SOPS document using the sops binary and the local key material.
+// The file name is used to select the SOPS format, and the document is passed
+// through stdin, so that the decrypted content is never written to disk.
+// The errors returned contain only the sops diagnostics and never the document content.
+func DecryptSOPS(fileName string, data []byte) ([]byte, error) {
+	sopsExecutable, err := exec.LookPath("sops")
+	if err != nil {
+		return nil, fmt.Errorf("executing sops failed: %w", err)
+	}
+
+	format := "binary"
+	switch filepath.Ext(fileName) {
+	case ".yaml", ".yml":
+		format = "yaml"
+	case ".json":
+		format = "json"
+	}
+
+	var stdout, stderr bytes.Buffer
+	sopsCmd := exec.Command(sopsExecutable, "--decrypt",
+		"--input-type", format, "--output-type", format, "/dev/stdin")
+	sopsCmd.Env = os.Environ()
+	sopsCmd.Stdin = bytes.NewReader(data)
+	sopsCmd.Stdout = &stdout
+	sopsCmd.Stderr = &stderr
+
+	if err := sopsCmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("sops decryption failed: %s", msg)
+			}
+		}
+		return nil, fmt.Errorf("sops decryption failed: %w", err)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -21,6 +21,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strconv"
 	"strings"
 
 	"cuelang.org/go/cue"
@@ -30,6 +33,28 @@ import (
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 )
 
+// cueModulePath is the Go module path of the CUE language implementation.
+const cueModulePath = "cuelang.org/go"
+
+// CUEVersion returns the version of the CUE language compiled into the binary,
+// as recorded in the Go build info. If the build info is not available,
+// the returned version is "unknown".
+func CUEVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == cueModulePath {
+			if dep.Replace != nil && dep.Replace.Version != "" {
+				dep = dep.Replace
+			}
+			return strings.TrimPrefix(dep.Version, "v")
+		}
+	}
+	return "unknown"
+}
+
 // GetEnv returns a map of all environment variables.
 func GetEnv() map[string]string {
 	vars := make(map[string]string)
@@ -41,6 +66,56 @@ func GetEnv() map[string]string {
 	return vars
 }
 
+// envKeyRegex matches the variable names allowed in env files.
+var envKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ReadEnvFile parses the KEY=VALUE entries of a .env file. Empty lines and lines
+// starting with '#' are skipped, and the 'export' prefix is allowed. The values can be
+// quoted with single or double quotes, while unquoted values end at an inline ' #' comment.
+// Malformed lines produce an error containing the line number.
+func ReadEnvFile(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	vars := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || !envKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: invalid entry, expected KEY=VALUE", filepath.Base(file), i+1)
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) > 0 && (value[0] == '"' || value[0] == '\''):
+			end := strings.LastIndexByte(value, value[0])
+			if end == 0 {
+				return nil, fmt.Errorf("%s:%d: unterminated quoted value of %s", filepath.Base(file), i+1, key)
+			}
+			if value[0] == '"' {
+				if value, err = strconv.Unquote(value[:end+1]); err != nil {
+					return nil, fmt.Errorf("%s:%d: invalid quoted value of %s: %w", filepath.Base(file), i+1, key, err)
+				}
+			} else {
+				value = value[1:end]
+			}
+		default:
+			if c := strings.Index(value, " #"); c >= 0 {
+				value = strings.TrimSpace(value[:c])
+			}
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
 // CopyModule copies the given module to the destination directory,
 // while excluding files that match the timoni.ignore patterns.
 func CopyModule(srcDir string, dstDir string) (err error) {
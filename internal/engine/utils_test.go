@@ -57,3 +57,41 @@ func TestCopyModule_Ignore(t *testing.T) {
 	})
 	g.Expect(fsErr).ToNot(HaveOccurred())
 }
+
+func TestReadEnvFile(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, ".env")
+	g.Expect(os.WriteFile(file, []byte(`
+# local config
+REGISTRY=ghcr.io/stefanprodan
+export REPLICAS=2
+DOMAIN = example.com # inline comment
+MESSAGE="hello # world\n"
+EMPTY=
+QUOTED='single quoted'
+`), 0644)).To(Succeed())
+
+	vars, err := ReadEnvFile(file)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(vars).To(Equal(map[string]string{
+		"REGISTRY": "ghcr.io/stefanprodan",
+		"REPLICAS": "2",
+		"DOMAIN":   "example.com",
+		"MESSAGE":  "hello # world\n",
+		"EMPTY":    "",
+		"QUOTED":   "single quoted",
+	}))
+
+	for content, expected := range map[string]string{
+		"KEY=value\nmalformed\n":    ".env:2: invalid entry",
+		"KEY=value\n\n1KEY=value\n": ".env:3: invalid entry",
+		"KEY=\"value\n":             ".env:1: unterminated quoted value of KEY",
+	} {
+		g.Expect(os.WriteFile(file, []byte(content), 0644)).To(Succeed())
+		_, err := ReadEnvFile(file)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(expected))
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// maxRefDepth limits how deep the expression tree of a field is searched for references.
+const maxRefDepth = 16
+
+// ValueEdge links a module value to an object field that derives from it.
+type ValueEdge struct {
+	// Value is the path of the input value, e.g. 'values.image.tag'.
+	Value string
+	// Object is the object reference in the format 'Kind/namespace/name'.
+	Object string
+	// Field is the path of the object field, e.g. 'spec.template.spec.containers[0].image'.
+	Field string
+}
+
+// GetValueGraph traces the CUE references of the instance objects fields
+// back to the module values, and returns the edges sorted by value and object.
+// A field is linked to a value when it refers to the instance config,
+// directly or through an expression such as string interpolation.
+func (b *ModuleBuilder) GetValueGraph(value cue.Value) ([]ValueEdge, error) {
+	objects := value.LookupPath(cue.ParsePath(apiv1.InstanceObjectsSelector.String()))
+	if objects.Err() != nil {
+		return nil, fmt.Errorf("lookup %s failed: %w", apiv1.InstanceObjectsSelector, objects.Err())
+	}
+
+	values := value.LookupPath(cue.ParsePath(apiv1.ValuesSelector.String()))
+
+	iter, err := objects.Fields()
+	if err != nil {
+		return nil, err
+	}
+
+	var edges []ValueEdge
+	seen := make(map[ValueEdge]bool)
+	for iter.Next() {
+		obj := iter.Value()
+		objRef := fmtObjectRef(obj)
+		walkFieldRefs(obj, nil, nil, func(field string, refs []cue.Path) {
+			for _, ref := range refs {
+				valuePath, ok := configValuePath(values, ref)
+				if !ok {
+					continue
+				}
+				e := ValueEdge{Value: valuePath, Object: objRef, Field: field}
+				if !seen[e] {
+					seen[e] = true
+					edges = append(edges, e)
+				}
+			}
+		})
+	}
+
+	sort.SliceStable(edges, func(i, j int) bool {
+		if edges[i].Value != edges[j].Value {
+			return edges[i].Value < edges[j].Value
+		}
+		if edges[i].Object != edges[j].Object {
+			return edges[i].Object < edges[j].Object
+		}
+		return edges[i].Field < edges[j].Field
+	})
+
+	return edges, nil
+}
+
+// walkFieldRefs visits the concrete fields of v and calls fn with the field path
+// and the references it derives from. References of a struct or list
+// are inherited by its fields, with the field selectors appended.
+func walkFieldRefs(v cue.Value, field []string, inherited []cue.Path, fn func(field string, refs []cue.Path)) {
+	refs := lookupRefs(v, 0)
+	if len(refs) == 0 {
+		refs = inherited
+	}
+
+	switch v.IncompleteKind() {
+	case cue.StructKind:
+		iter, err := v.Fields()
+		if err != nil {
+			return
+		}
+		for iter.Next() {
+			sel := iter.Selector()
+			walkFieldRefs(iter.Value(), append(field, "."+sel.String()), appendSelector(refs, sel), fn)
+		}
+	case cue.ListKind:
+		iter, err := v.List()
+		if err != nil {
+			return
+		}
+		for i := 0; iter.Next(); i++ {
+			walkFieldRefs(iter.Value(), append(field, fmt.Sprintf("[%d]", i)), appendSelector(refs, cue.Index(i)), fn)
+		}
+	default:
+		if len(refs) > 0 {
+			fn(strings.TrimPrefix(strings.Join(field, ""), "."), refs)
+		}
+	}
+}
+
+// lookupRefs returns the paths referenced by the value,
+// searching the operands of its expression when the value isn't a plain reference.
+func lookupRefs(v cue.Value, depth int) []cue.Path {
+	if depth > maxRefDepth {
+		return nil
+	}
+	if _, ref := v.ReferencePath(); len(ref.Selectors()) > 0 {
+		return []cue.Path{ref}
+	}
+
+	op, args := v.Expr()
+	if op == cue.NoOp {
+		return nil
+	}
+
+	var refs []cue.Path
+	for _, arg := range args {
+		refs = append(refs, lookupRefs(arg, depth+1)...)
+	}
+	return refs
+}
+
+func appendSelector(refs []cue.Path, sel cue.Selector) []cue.Path {
+	out := make([]cue.Path, 0, len(refs))
+	for _, ref := range refs {
+		out = append(out, cue.MakePath(append(ref.Selectors(), sel)...))
+	}
+	return out
+}
+
+// configValuePath maps a reference to the instance config, e.g. 'objects.app._config.image.tag',
+// to the module value path, e.g. 'values.image.tag'. It returns false if the value doesn't exist.
+func configValuePath(values cue.Value, ref cue.Path) (string, bool) {
+	sels := ref.Selectors()
+	start := -1
+	for i, sel := range sels {
+		switch sel.String() {
+		case "config", "_config", "#config", apiv1.ValuesSelector.String():
+			start = i + 1
+		}
+	}
+	if start < 0 || start >= len(sels) {
+		return "", false
+	}
+
+	path := cue.MakePath(sels[start:]...)
+	if !values.LookupPath(path).Exists() {
+		return "", false
+	}
+	return apiv1.ValuesSelector.String() + "." + path.String(), true
+}
+
+func fmtObjectRef(obj cue.Value) string {
+	kind, _ := obj.LookupPath(cue.ParsePath("kind")).String()
+	name, _ := obj.LookupPath(cue.ParsePath("metadata.name")).String()
+	namespace, _ := obj.LookupPath(cue.ParsePath("metadata.namespace")).String()
+	if namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, name)
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
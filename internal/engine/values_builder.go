@@ -18,6 +18,10 @@ package engine
 
 import (
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 
 	"cuelang.org/go/cue"
 
@@ -34,7 +38,12 @@ func NewValuesBuilder(ctx *cue.Context) *ValuesBuilder {
 	return &ValuesBuilder{ctx: ctx}
 }
 
+// unsetAttribute marks an overlay field for removal, e.g. 'env: DEBUG: _ @timoni(unset)'.
+const unsetAttribute = "unset"
+
 // MergeValues merges the given overlays in order using the base as the starting point.
+// The fields marked with @timoni(unset) in an overlay are removed from
+// the values merged so far, before the overlay is applied.
 func (b *ValuesBuilder) MergeValues(overlays [][]byte, base string) (cue.Value, error) {
 	baseVal, err := ExtractValueFromFile(b.ctx, base, apiv1.ValuesSelector.String())
 	if err != nil {
@@ -49,6 +58,11 @@ func (b *ValuesBuilder) MergeValues(overlays [][]byte, base string) (cue.Value,
 				fmt.Errorf("loading values from %s failed: %w", overlay, err)
 		}
 
+		for _, p := range unsetPaths(overlayVal, nil) {
+			baseVal = removePath(baseVal, p)
+			overlayVal = removePath(overlayVal, p)
+		}
+
 		baseVal, err = MergeValue(overlayVal, baseVal)
 		if err != nil {
 			return cue.Value{},
@@ -58,3 +72,142 @@ func (b *ValuesBuilder) MergeValues(overlays [][]byte, base string) (cue.Value,
 
 	return baseVal, nil
 }
+
+// unsetPaths returns the paths of the fields marked with @timoni(unset).
+// The fields nested under a marked field are not searched.
+func unsetPaths(v cue.Value, parent []cue.Selector) [][]cue.Selector {
+	iter, err := v.Fields(cue.Attributes(true), cue.Optional(true))
+	if err != nil {
+		return nil
+	}
+
+	var paths [][]cue.Selector
+	for iter.Next() {
+		path := append(slices.Clone(parent), iter.Selector())
+		if isUnset(iter.Value()) {
+			paths = append(paths, path)
+			continue
+		}
+		if iter.Value().IncompleteKind() == cue.StructKind {
+			paths = append(paths, unsetPaths(iter.Value(), path)...)
+		}
+	}
+	return paths
+}
+
+func isUnset(v cue.Value) bool {
+	attr := v.Attribute(apiv1.FieldManager)
+	if attr.Err() != nil {
+		return false
+	}
+	body, err := attr.String(0)
+	return err == nil && body == unsetAttribute
+}
+
+// removePath returns a copy of v without the field at the given path.
+// CUE values can't be deleted, so the parent structs are rebuilt from their remaining fields.
+func removePath(v cue.Value, path []cue.Selector) cue.Value {
+	if len(path) == 0 || v.IncompleteKind() != cue.StructKind {
+		return v
+	}
+
+	child := v.LookupPath(cue.MakePath(path[0]))
+	if !child.Exists() {
+		return v
+	}
+
+	iter, err := v.Fields(
+		cue.Attributes(true),
+		cue.Definitions(true),
+		cue.Hidden(true),
+		cue.Optional(true),
+		cue.Docs(true),
+	)
+	if err != nil {
+		return v
+	}
+
+	out := v.Context().CompileString("{}")
+	for iter.Next() {
+		sel := iter.Selector()
+		field := iter.Value()
+		if sel.String() == path[0].String() {
+			if len(path) == 1 {
+				continue
+			}
+			field = removePath(field, path[1:])
+		}
+		out = out.FillPath(cue.MakePath(sel), field)
+	}
+	return out
+}
+
+// ParseSetValues returns the nested fields defined by the overrides in the format
+// 'path.to.field=value'. The values are converted to numbers or booleans when possible,
+// while the values of the string overrides are always kept as strings.
+// An error is returned if a path is set more than once, or if it's nested under another path.
+func ParseSetValues(overrides, stringOverrides []string) (map[string]any, error) {
+	values := make(map[string]any)
+	for i, override := range append(append([]string{}, overrides...), stringOverrides...) {
+		p, raw, ok := strings.Cut(override, "=")
+		if !ok || p == "" {
+			return nil, fmt.Errorf("invalid override '%s', must be in the format 'path=value'", override)
+		}
+
+		path := cue.ParsePath(p)
+		if path.Err() != nil {
+			return nil, fmt.Errorf("invalid override path '%s': %w", p, path.Err())
+		}
+
+		var value any = raw
+		if i < len(overrides) {
+			value = coerceSetValue(raw)
+		}
+
+		m := values
+		selectors := path.Selectors()
+		for j, sel := range selectors {
+			if sel.LabelType() != cue.StringLabel {
+				return nil, fmt.Errorf("invalid override path '%s', only regular fields can be set", p)
+			}
+			key := sel.Unquoted()
+			next, exists := m[key]
+			if j == len(selectors)-1 {
+				if exists {
+					return nil, fmt.Errorf("conflicting override '%s', the path %s is already set", override, p)
+				}
+				m[key] = value
+				break
+			}
+			if !exists {
+				next = make(map[string]any)
+				m[key] = next
+			}
+			nested, ok := next.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("conflicting override '%s', the path %s is already set",
+					override, cue.MakePath(selectors[:j+1]...).String())
+			}
+			m = nested
+		}
+	}
+	return values, nil
+}
+
+// coerceSetValue converts the raw value of an override to an integer,
+// a float or a boolean, falling back to a string.
+func coerceSetValue(raw string) any {
+	switch raw {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return raw
+}
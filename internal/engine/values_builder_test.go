@@ -19,8 +19,10 @@ package engine
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
 	. "github.com/onsi/gomega"
 
@@ -53,3 +55,98 @@ func TestValuesBuilder(t *testing.T) {
 
 	g.Expect(fmt.Sprintf("%v", finalVal)).To(BeEquivalentTo(fmt.Sprintf("%v", goldVal)))
 }
+
+func TestValuesBuilder_Unset(t *testing.T) {
+	g := NewWithT(t)
+	ctx := cuecontext.New()
+
+	vb := NewValuesBuilder(ctx)
+
+	base := filepath.Join(t.TempDir(), "values.cue")
+	err := os.WriteFile(base, []byte(`
+values: {
+	env: {
+		LOG_LEVEL: "info"
+		DEBUG:     "true"
+	}
+	securityContext: capabilities: add: ["NET_ADMIN"]
+}
+`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	overlays := [][]byte{
+		[]byte(`values: env: PROFILE: "enabled"`),
+		[]byte(`values: {
+	env: {
+		DEBUG:     _ @timoni(unset)
+		PROFILE:   _ @timoni(unset)
+		LOG_LEVEL: "warn"
+	}
+	securityContext: capabilities: _ @timoni(unset)
+}`),
+	}
+
+	finalVal, err := vb.MergeValues(overlays, base)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	env := finalVal.LookupPath(cue.ParsePath("env"))
+	g.Expect(env.LookupPath(cue.ParsePath("DEBUG")).Exists()).To(BeFalse())
+	g.Expect(env.LookupPath(cue.ParsePath("PROFILE")).Exists()).To(BeFalse())
+
+	logLevel, err := env.LookupPath(cue.ParsePath("LOG_LEVEL")).String()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(logLevel).To(Equal("warn"))
+
+	g.Expect(finalVal.LookupPath(cue.ParsePath("securityContext")).Exists()).To(BeTrue())
+	g.Expect(finalVal.LookupPath(cue.ParsePath("securityContext.capabilities")).Exists()).To(BeFalse())
+	g.Expect(finalVal.Validate(cue.Concrete(true))).To(Succeed())
+}
+
+func TestParseSetValues(t *testing.T) {
+	t.Run("coerces the values", func(t *testing.T) {
+		g := NewWithT(t)
+
+		values, err := ParseSetValues(
+			[]string{"replicas=2", "ratio=0.5", "debug=true", "image.tag=6.5.0", `labels."app.kubernetes.io/part-of"=apps`},
+			[]string{"image.digest=123", "enabled=false"},
+		)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(values).To(Equal(map[string]any{
+			"replicas": int64(2),
+			"ratio":    0.5,
+			"debug":    true,
+			"enabled":  "false",
+			"image": map[string]any{
+				"tag":    "6.5.0",
+				"digest": "123",
+			},
+			"labels": map[string]any{
+				"app.kubernetes.io/part-of": "apps",
+			},
+		}))
+	})
+
+	t.Run("fails for conflicting paths", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := ParseSetValues([]string{"image.tag=1.0", "image.tag=2.0"}, nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("the path image.tag is already set"))
+
+		_, err = ParseSetValues([]string{"image=podinfo"}, []string{"image.tag=1.0"})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("the path image is already set"))
+	})
+
+	t.Run("fails for invalid overrides", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := ParseSetValues([]string{"replicas"}, nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("must be in the format 'path=value'"))
+
+		_, err = ParseSetValues([]string{"#config.replicas=2"}, nil)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("only regular fields can be set"))
+	})
+}
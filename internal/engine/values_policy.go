@@ -0,0 +1,83 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"cuelang.org/go/cue"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// ValuesPolicy is a CUE schema that the instance values must conform to,
+// in addition to the schema of the instance module.
+type ValuesPolicy struct {
+	schema cue.Value
+}
+
+// LoadValuesPolicy compiles the CUE files found at the root of the given directory
+// and returns the schema defined by their 'values' field.
+func LoadValuesPolicy(ctx *cue.Context, dir string) (*ValuesPolicy, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy failed: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && filepath.Ext(entry.Name()) == ".cue" {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no CUE files found in policy '%s'", dir)
+	}
+	sort.Strings(files)
+
+	policy := ctx.CompileString("{}")
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading policy failed: %w", err)
+		}
+		v := ctx.CompileBytes(data, cue.Filename(file))
+		if v.Err() != nil {
+			return nil, fmt.Errorf("compiling policy %s failed: %w", filepath.Base(file), v.Err())
+		}
+		policy = policy.Unify(v)
+	}
+
+	schema := policy.LookupPath(cue.ParsePath(apiv1.ValuesSelector.String()))
+	if !schema.Exists() {
+		return nil, fmt.Errorf("no '%s' schema found in policy", apiv1.ValuesSelector.String())
+	}
+	if schema.Err() != nil {
+		return nil, fmt.Errorf("invalid policy schema: %w", schema.Err())
+	}
+
+	return &ValuesPolicy{schema: schema}, nil
+}
+
+// Validate unifies the values with the policy schema and returns the
+// violations as a CUE error, which holds the positions of the offending fields.
+func (p *ValuesPolicy) Validate(values cue.Value) error {
+	return p.schema.Unify(values).Validate(cue.Concrete(true))
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/errors"
+	. "github.com/onsi/gomega"
+)
+
+func TestValuesPolicy(t *testing.T) {
+	g := NewWithT(t)
+	ctx := cuecontext.New()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "policy.cue"), []byte(`
+package policy
+
+values: {
+	image: pullPolicy?: "IfNotPresent" | "Always"
+	...
+}
+`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	policy, err := LoadValuesPolicy(ctx, dir)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	valid := ctx.CompileString(`{
+	image: pullPolicy: "Always"
+	replicas: 2
+}`)
+	g.Expect(policy.Validate(valid)).To(Succeed())
+
+	invalid := ctx.CompileString(`{
+	image: pullPolicy: "Never"
+	replicas: 2
+}`, cue.Filename("values.cue"))
+	err = policy.Validate(invalid)
+	g.Expect(err).To(HaveOccurred())
+	details := errors.Details(err, nil)
+	g.Expect(details).To(ContainSubstring("image.pullPolicy"))
+	g.Expect(details).To(ContainSubstring("values.cue:2:"))
+}
+
+func TestValuesPolicy_NoSchema(t *testing.T) {
+	g := NewWithT(t)
+	ctx := cuecontext.New()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "policy.cue"), []byte(`config: {}`), 0644)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = LoadValuesPolicy(ctx, dir)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("no 'values' schema"))
+
+	_, err = LoadValuesPolicy(ctx, t.TempDir())
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("no CUE files"))
+}
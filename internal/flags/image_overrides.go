@@ -0,0 +1,35 @@
+package flags
+
+import (
+	"strings"
+
+	"github.com/stefanprodan/timoni/internal/engine"
+)
+
+type ImageOverrides []engine.ImageOverride
+
+func (f *ImageOverrides) String() string {
+	var list []string
+	for _, o := range *f {
+		list = append(list, o.String())
+	}
+	return strings.Join(list, ",")
+}
+
+func (f *ImageOverrides) Set(str string) error {
+	o, err := engine.ParseImageOverride(str)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, o)
+	return nil
+}
+
+func (f *ImageOverrides) Type() string {
+	return "image-override"
+}
+
+func (f *ImageOverrides) Description() string {
+	return "Override the tag of the container images in the format 'repository[:tag]=tag', " +
+		"which is set on the images of all instances matching the repository and the optional tag, can be specified multiple times."
+}
@@ -0,0 +1,45 @@
+package flags
+
+import "strings"
+
+// AllPackages is the special package name that selects all the packages of a module.
+const AllPackages = "*"
+
+type Packages []string
+
+func (f *Packages) String() string {
+	if f == nil || len(*f) == 0 {
+		return f.Default()
+	}
+	return strings.Join(*f, ",")
+}
+
+func (f *Packages) Set(str string) error {
+	*f = append(*f, str)
+	return nil
+}
+
+func (f *Packages) Type() string {
+	return "package"
+}
+
+func (f *Packages) Default() string {
+	return "main"
+}
+
+func (f *Packages) Shorthand() string {
+	return "p"
+}
+
+func (f *Packages) Description() string {
+	return "The name of the module's package used for building the templates, can be specified multiple times " +
+		"to unify several packages, or set to '*' to unify all the packages of the module."
+}
+
+// Values returns the list of package names, or the default package if none was set.
+func (f *Packages) Values() []string {
+	if f == nil || len(*f) == 0 {
+		return []string{f.Default()}
+	}
+	return *f
+}
@@ -0,0 +1,35 @@
+package flags
+
+import (
+	"strings"
+
+	"github.com/stefanprodan/timoni/internal/oci"
+)
+
+type RegistryMirrors []oci.Mirror
+
+func (f *RegistryMirrors) String() string {
+	var list []string
+	for _, m := range *f {
+		list = append(list, m.String())
+	}
+	return strings.Join(list, ",")
+}
+
+func (f *RegistryMirrors) Set(str string) error {
+	m, err := oci.ParseMirror(str)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, m)
+	return nil
+}
+
+func (f *RegistryMirrors) Type() string {
+	return "mirror"
+}
+
+func (f *RegistryMirrors) Description() string {
+	return "The registry mirror in the format '<source>=<target>', which rewrites the module URLs " +
+		"starting with the source registry host or repository to the target, can be specified multiple times."
+}
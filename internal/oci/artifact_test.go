@@ -19,7 +19,9 @@ package oci
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -85,3 +87,62 @@ func TestArtifactOperations(t *testing.T) {
 	err = PullArtifact(imgVersionURL, dstPath, apiv1.AnyContentType, opts)
 	g.Expect(err).ToNot(HaveOccurred())
 }
+
+func TestResolveImageDigest(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	imgURL := fmt.Sprintf("oci://%s/%s:%s", dockerRegistry, rnd("my-image", 5), "1.0.0")
+	opts := Options(ctx, "", false)
+	digestURL, err := PushArtifact(imgURL, "testdata/module/", nil, "generic", nil, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	digest, err := ParseDigest(digestURL)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	resolved, err := ResolveImageDigest(strings.TrimPrefix(imgURL, apiv1.ArtifactPrefix), opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(resolved).To(Equal(digest.DigestStr()))
+
+	pinned, err := ResolveImageDigest("cgr.dev/chainguard/timoni@"+digest.DigestStr(), nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pinned).To(Equal(digest.DigestStr()))
+}
+
+func TestPullBundle(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	srcPath := t.TempDir()
+	for name, content := range map[string]string{
+		"bundle.cue":       "bundle: apiVersion: \"v1alpha1\"\n",
+		"values.yaml":      "bundle: name: podinfo\n",
+		"README.md":        "# podinfo\n",
+		"data/config.json": "{}\n",
+	} {
+		fp := filepath.Join(srcPath, name)
+		g.Expect(os.MkdirAll(filepath.Dir(fp), 0o755)).To(Succeed())
+		g.Expect(os.WriteFile(fp, []byte(content), 0o644)).To(Succeed())
+	}
+
+	imgURL := fmt.Sprintf("oci://%s/%s:%s", dockerRegistry, rnd("my-bundle", 5), "1.0.0")
+	opts := Options(ctx, "", false)
+	_, err := PushArtifact(imgURL, srcPath, nil, "bundle", nil, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	dstPath := t.TempDir()
+	files, err := PullBundle(imgURL, dstPath, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(files).To(Equal([]string{
+		filepath.Join(dstPath, "bundle.cue"),
+		filepath.Join(dstPath, "values.yaml"),
+	}))
+	g.Expect(filepath.Join(dstPath, "data", "config.json")).To(BeAnExistingFile())
+
+	emptyURL := fmt.Sprintf("oci://%s/%s:%s", dockerRegistry, rnd("my-bundle", 5), "1.0.0")
+	_, err = PushArtifact(emptyURL, filepath.Join(srcPath, "data"), []string{"*.json"}, "bundle", nil, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = PullBundle(emptyURL, t.TempDir(), opts)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("no bundle files found"))
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// LayerCache stores the compressed module layers by digest, so that a layer
+// shared by multiple modules is pulled once. The layers are stored in the cache dir,
+// if set, otherwise in a temporary dir which is removed on Close.
+// A LayerCache is safe for concurrent use, the pulls of the same layer are serialized.
+type LayerCache struct {
+	dir       string
+	ephemeral bool
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewLayerCache creates a LayerCache backed by the given dir.
+// If the dir is empty, the layers are cached for the lifetime of the LayerCache.
+func NewLayerCache(dir string) (*LayerCache, error) {
+	c := &LayerCache{
+		dir:   dir,
+		locks: make(map[string]*sync.Mutex),
+	}
+
+	if dir == "" {
+		tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
+		if err != nil {
+			return nil, err
+		}
+		c.dir = tmpDir
+		c.ephemeral = true
+	}
+
+	return c, nil
+}
+
+// Close removes the cached layers if the LayerCache has no cache dir.
+func (c *LayerCache) Close() error {
+	if c.ephemeral {
+		return os.RemoveAll(c.dir)
+	}
+	return nil
+}
+
+// lock acquires the lock of the given layer digest and returns its release function.
+func (c *LayerCache) lock(digest gcrv1.Hash) func() {
+	c.mu.Lock()
+	l, ok := c.locks[digest.Hex]
+	if !ok {
+		l = &sync.Mutex{}
+		c.locks[digest.Hex] = l
+	}
+	c.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// path returns the location of the layer in the cache at '<cache-dir>/<layer-digest-hex>.tgz'.
+func (c *LayerCache) path(digest gcrv1.Hash) string {
+	return path.Join(c.dir, fmt.Sprintf("%s.tgz", digest.Hex))
+}
+
+// remove deletes the layer from the cache, so that it's pulled again on the next fetch.
+func (c *LayerCache) remove(digest gcrv1.Hash) {
+	unlock := c.lock(digest)
+	defer unlock()
+	_ = os.Remove(c.path(digest))
+}
+
+// fetch returns the path of the cached layer, pulling
+// the compressed layer from the registry if it's not cached.
+func (c *LayerCache) fetch(repoURL string, digest gcrv1.Hash, opts []crane.Option) (string, error) {
+	unlock := c.lock(digest)
+	defer unlock()
+
+	cachedLayer := c.path(digest)
+	if _, err := os.Stat(cachedLayer); err == nil {
+		return cachedLayer, nil
+	}
+
+	layerDigest := digest.String()
+	blobURL := fmt.Sprintf("%s@%s", repoURL, layerDigest)
+	layer, err := crane.PullLayer(blobURL, opts...)
+	if err != nil {
+		return "", fmt.Errorf("pulling layer %s failed: %w", layerDigest, err)
+	}
+
+	remote, err := layer.Compressed()
+	if err != nil {
+		return "", fmt.Errorf("pulling layer %s failed: %w", layerDigest, err)
+	}
+
+	local, err := os.Create(cachedLayer)
+	if err != nil {
+		return "", fmt.Errorf("writing layer to storage failed: %w", err)
+	}
+
+	// Remove the partially written layer from cache,
+	// so that the pull can be retried.
+	if _, err := io.Copy(local, remote); err != nil {
+		_ = local.Close()
+		_ = os.Remove(cachedLayer)
+		return "", fmt.Errorf("writing layer to storage failed: %w", err)
+	}
+
+	if err := local.Close(); err != nil {
+		return "", fmt.Errorf("writing layer to storage failed: %w", err)
+	}
+
+	return cachedLayer, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// newCountingRegistry returns a registry proxy that counts the blob requests.
+func newCountingRegistry(t *testing.T) (string, *atomic.Int32) {
+	upstream, err := url.Parse(fmt.Sprintf("http://%s", dockerRegistry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+
+	var blobs atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			blobs.Add(1)
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://"), &blobs
+}
+
+func TestPullModuleWithCache(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	opts := Options(ctx, "", false)
+
+	modName := rnd("my-module", 5)
+	digestURL, err := PushModule(fmt.Sprintf("oci://%s/%s:1.0.0", dockerRegistry, modName),
+		"testdata/module/", nil, nil, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	digest := digestURL[strings.Index(digestURL, "@"):]
+
+	t.Run("pulls the layers once for the same digest", func(t *testing.T) {
+		g := NewWithT(t)
+		registry, blobs := newCountingRegistry(t)
+
+		cache, err := NewLayerCache("")
+		g.Expect(err).ToNot(HaveOccurred())
+		defer cache.Close()
+
+		// Pull the module of two instances referencing the same digest in parallel.
+		dstPaths := []string{t.TempDir(), t.TempDir()}
+		errs := make([]error, len(dstPaths))
+		var wg sync.WaitGroup
+		for i, dstPath := range dstPaths {
+			wg.Add(1)
+			go func(i int, dstPath string) {
+				defer wg.Done()
+				_, errs[i] = PullModuleWithCache(fmt.Sprintf("oci://%s/%s%s", registry, modName, digest),
+					dstPath, cache, opts)
+			}(i, dstPath)
+		}
+		wg.Wait()
+
+		for i, dstPath := range dstPaths {
+			g.Expect(errs[i]).ToNot(HaveOccurred())
+			g.Expect(filepath.Join(dstPath, "timoni.cue")).To(BeAnExistingFile())
+		}
+
+		// The module has two layers, one for the module and one for the vendored schemas.
+		g.Expect(blobs.Load()).To(BeEquivalentTo(2))
+	})
+
+	t.Run("removes the ephemeral layers on close", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cache, err := NewLayerCache("")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		_, err = PullModuleWithCache(fmt.Sprintf("oci://%s/%s%s", dockerRegistry, modName, digest),
+			t.TempDir(), cache, opts)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cache.dir).To(BeADirectory())
+
+		g.Expect(cache.Close()).To(Succeed())
+		g.Expect(cache.dir).ToNot(BeADirectory())
+	})
+}
@@ -88,3 +88,45 @@ func ListModuleVersions(ociURL string, withDigest bool, opts []crane.Option) ([]
 
 	return list, nil
 }
+
+// ListModuleTags returns the tags of the module repository which are not valid semver
+// versions, e.g. branch names or commit SHAs, ordered descending by name.
+// The latest tag is excluded, as it is returned by ListModuleVersions.
+func ListModuleTags(ociURL string, withDigest bool, opts []crane.Option) ([]apiv1.ModuleReference, error) {
+	var list []apiv1.ModuleReference
+
+	ref, err := parseArtifactRef(ociURL)
+	if err != nil {
+		return nil, err
+	}
+
+	repoURL := ref.Context().Name()
+
+	tags, err := crane.ListTags(repoURL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags failed: %w", err)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(tags)))
+
+	for _, tag := range tags {
+		if _, err := semver.StrictNewVersion(tag); err == nil || tag == name.DefaultTag {
+			continue
+		}
+		digest := ""
+		if withDigest {
+			d, err := crane.Digest(fmt.Sprintf("%s:%s", repoURL, tag), opts...)
+			if err != nil {
+				return nil, fmt.Errorf("faild to get digest for '%s': %w", tag, err)
+			}
+			digest = d
+		}
+		list = append(list, apiv1.ModuleReference{
+			Repository: ociURL,
+			Version:    tag,
+			Digest:     digest,
+		})
+	}
+
+	return list, nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"fmt"
+	"strings"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// Mirror rewrites the artifact URLs starting with the Source registry host
+// or repository prefix, to the Target registry host or repository prefix.
+type Mirror struct {
+	Source string
+	Target string
+}
+
+// ParseMirror parses a mirror in the format '<source>=<target>',
+// e.g. 'ghcr.io=registry.internal/ghcr'. The 'oci://' prefix is optional.
+func ParseMirror(str string) (Mirror, error) {
+	source, target, ok := strings.Cut(str, "=")
+	source = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(source), apiv1.ArtifactPrefix), "/")
+	target = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(target), apiv1.ArtifactPrefix), "/")
+	if !ok || source == "" || target == "" {
+		return Mirror{}, fmt.Errorf("invalid registry mirror '%s', must be in the format '<source>=<target>'", str)
+	}
+	return Mirror{Source: source, Target: target}, nil
+}
+
+// String returns the mirror in the format '<source>=<target>'.
+func (m Mirror) String() string {
+	return fmt.Sprintf("%s=%s", m.Source, m.Target)
+}
+
+// matches returns true if the address starts with the mirror source, followed
+// by the repository path or, if the source is a repository, by the tag or digest.
+func (m Mirror) matches(addr string) bool {
+	if addr == m.Source {
+		return true
+	}
+	if !strings.HasPrefix(addr, m.Source) {
+		return false
+	}
+
+	switch addr[len(m.Source)] {
+	case '/':
+		return true
+	case ':', '@':
+		// A colon after a registry host is the port separator.
+		return strings.Contains(m.Source, "/")
+	default:
+		return false
+	}
+}
+
+// RewriteURL returns the OpenContainers URL with the source prefix of the longest
+// matching mirror replaced by its target, while the repository path, tag and digest
+// are preserved. If no mirror matches, the URL is returned unchanged.
+func RewriteURL(ociURL string, mirrors []Mirror) string {
+	if !strings.HasPrefix(ociURL, apiv1.ArtifactPrefix) {
+		return ociURL
+	}
+
+	addr := strings.TrimPrefix(ociURL, apiv1.ArtifactPrefix)
+	var match *Mirror
+	for i, m := range mirrors {
+		if m.matches(addr) && (match == nil || len(m.Source) > len(match.Source)) {
+			match = &mirrors[i]
+		}
+	}
+	if match == nil {
+		return ociURL
+	}
+
+	return apiv1.ArtifactPrefix + match.Target + strings.TrimPrefix(addr, match.Source)
+}
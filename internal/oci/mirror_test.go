@@ -0,0 +1,95 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRewriteURL(t *testing.T) {
+	var mirrors []Mirror
+	for _, str := range []string{
+		"ghcr.io=registry.internal/ghcr",
+		"oci://ghcr.io/stefanprodan/modules/redis=oci://registry.internal/redis",
+		"localhost=registry.internal/local",
+	} {
+		m, err := ParseMirror(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mirrors = append(mirrors, m)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{
+			url:  "oci://ghcr.io/stefanprodan/modules/podinfo",
+			want: "oci://registry.internal/ghcr/stefanprodan/modules/podinfo",
+		},
+		{
+			url:  "oci://ghcr.io/stefanprodan/modules/podinfo:6.5.0",
+			want: "oci://registry.internal/ghcr/stefanprodan/modules/podinfo:6.5.0",
+		},
+		{
+			url:  "oci://ghcr.io/stefanprodan/modules/podinfo@sha256:a1b2",
+			want: "oci://registry.internal/ghcr/stefanprodan/modules/podinfo@sha256:a1b2",
+		},
+		{
+			url:  "oci://ghcr.io/stefanprodan/modules/redis:7.2.0",
+			want: "oci://registry.internal/redis:7.2.0",
+		},
+		{
+			url:  "oci://ghcr.io/stefanprodan/modules/redis-cluster:7.2.0",
+			want: "oci://registry.internal/ghcr/stefanprodan/modules/redis-cluster:7.2.0",
+		},
+		{
+			url:  "oci://ghcr.iox/org/module",
+			want: "oci://ghcr.iox/org/module",
+		},
+		{
+			url:  "oci://localhost:5000/org/module",
+			want: "oci://localhost:5000/org/module",
+		},
+		{
+			url:  "oci://docker.io/org/module",
+			want: "oci://docker.io/org/module",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(RewriteURL(tt.url, mirrors)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestParseMirror(t *testing.T) {
+	g := NewWithT(t)
+
+	m, err := ParseMirror("oci://ghcr.io/=registry.internal/ghcr/")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(m).To(Equal(Mirror{Source: "ghcr.io", Target: "registry.internal/ghcr"}))
+
+	for _, str := range []string{"ghcr.io", "=registry.internal", "ghcr.io="} {
+		_, err := ParseMirror(str)
+		g.Expect(err).To(HaveOccurred(), str)
+	}
+}
@@ -17,12 +17,15 @@ limitations under the License.
 package oci
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/crane"
 	. "github.com/onsi/gomega"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
@@ -112,3 +115,85 @@ func TestModuleOperations(t *testing.T) {
 	g.Expect(err).ToNot(HaveOccurred())
 	g.Expect(len(cachedLayers)).To(BeEquivalentTo(2))
 }
+
+func TestListModuleVersions(t *testing.T) {
+	g := NewWithT(t)
+	opts := Options(context.Background(), "", false)
+	imgURL := fmt.Sprintf("oci://%s/%s", dockerRegistry, rnd("my-module", 5))
+
+	var digestURL string
+	for _, version := range []string{"1.0.0", "1.10.0", "1.2.0", "2.0.0-rc.1"} {
+		var err error
+		digestURL, err = PushModule(fmt.Sprintf("%s:%s", imgURL, version), "testdata/module/", nil, nil, opts)
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+	for _, tag := range []string{"main", "sha-1a2b3c"} {
+		g.Expect(TagArtifact(digestURL, tag, opts)).To(Succeed())
+	}
+
+	list, err := ListModuleVersions(imgURL, false, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	var versions []string
+	for _, v := range list {
+		versions = append(versions, v.Version)
+	}
+	g.Expect(versions).To(Equal([]string{"2.0.0-rc.1", "1.10.0", "1.2.0", "1.0.0"}))
+
+	tags, err := ListModuleTags(imgURL, true, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tags).To(HaveLen(2))
+	g.Expect(tags[0].Version).To(Equal("sha-1a2b3c"))
+	g.Expect(tags[1].Version).To(Equal("main"))
+	g.Expect(digestURL).To(HaveSuffix(tags[1].Digest))
+}
+
+func TestPullModule_VerifyDigest(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	srcPath := "testdata/module/"
+	imgURL := fmt.Sprintf("oci://%s/%s:1.0.0", dockerRegistry, rnd("my-module", 5))
+	annotations := map[string]string{apiv1.VersionAnnotation: "1.0.0"}
+
+	opts := Options(ctx, "", false)
+	digestURL, err := PushModule(imgURL, srcPath, nil, annotations, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	manifestJSON, err := crane.Manifest(strings.TrimPrefix(digestURL, apiv1.ArtifactPrefix), opts...)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	t.Run("fails for mismatched digest", func(t *testing.T) {
+		g := NewWithT(t)
+		mismatched := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+		err := verifyDigest(digestURL, mismatched, bytes.NewReader(manifestJSON))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("digest mismatch"))
+		g.Expect(err.Error()).To(ContainSubstring(mismatched))
+		g.Expect(err.Error()).To(ContainSubstring(strings.Split(digestURL, "@")[1]))
+	})
+
+	t.Run("fails for tampered cached layer", func(t *testing.T) {
+		g := NewWithT(t)
+		cacheDir := t.TempDir()
+
+		modRef, err := PullModule(digestURL, t.TempDir(), cacheDir, opts)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(digestURL).To(HaveSuffix(modRef.Digest))
+
+		cachedLayers, err := os.ReadDir(cacheDir)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(cachedLayers).ToNot(BeEmpty())
+		tampered := filepath.Join(cacheDir, cachedLayers[0].Name())
+		g.Expect(os.WriteFile(tampered, []byte("tampered"), 0644)).To(Succeed())
+
+		_, err = PullModule(digestURL, t.TempDir(), cacheDir, opts)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("digest mismatch"))
+		g.Expect(tampered).ToNot(BeAnExistingFile())
+
+		// the tampered layer is evicted from cache and pulled again
+		_, err = PullModule(digestURL, t.TempDir(), cacheDir, opts)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+}
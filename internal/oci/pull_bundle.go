@@ -0,0 +1,63 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// PullBundle performs the following operations:
+// - pulls the bundle artifact and extracts all its layers to the destination directory
+// - returns the sorted paths of the bundle files found at the root of the artifact
+//
+// The bundle files are the CUE, YAML and JSON files, the files in subdirectories
+// are extracted too, so that they can be read by the bundle @timoni() attributes.
+func PullBundle(ociURL, dstPath string, opts []crane.Option) ([]string, error) {
+	if err := PullArtifact(ociURL, dstPath, apiv1.AnyContentType, opts); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dstPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle artifact contents failed: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".cue", ".yaml", ".yml", ".json":
+			files = append(files, filepath.Join(dstPath, entry.Name()))
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no bundle files found in artifact '%s'", ociURL)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
@@ -21,10 +21,9 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path"
 
-	"github.com/fluxcd/pkg/tar"
 	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
 	gcrv1 "github.com/google/go-containerregistry/pkg/v1"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
@@ -33,11 +32,35 @@ import (
 // PullModule performs the following operations:
 // - determines the artifact digest corresponding to the module version
 // - fetches the manifest of the remote artifact
+// - verifies that the manifest digest matches the resolved or pinned digest
 // - verifies that artifact config matches Timoni's media type
 // - downloads all the compressed layer matching Timoni's media type (if not cached)
 // - stores the compressed layers in the local cache (if caching is enabled)
+// - verifies that the digest of each layer matches the manifest
 // - extracts the module contents to the destination directory
 func PullModule(ociURL, dstPath, cacheDir string, opts []crane.Option) (*apiv1.ModuleReference, error) {
+	cache, err := NewLayerCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	defer cache.Close()
+
+	return PullModuleWithCache(ociURL, dstPath, cache, opts)
+}
+
+// PullModuleWithCache is like PullModule, but the layers are stored in the given cache,
+// which can be shared between the pulls of multiple modules. If the cache is nil,
+// the layers are downloaded to a temporary dir removed after the pull.
+func PullModuleWithCache(ociURL, dstPath string, cache *LayerCache, opts []crane.Option) (*apiv1.ModuleReference, error) {
+	if cache == nil {
+		var err error
+		cache, err = NewLayerCache("")
+		if err != nil {
+			return nil, err
+		}
+		defer cache.Close()
+	}
+
 	ref, err := parseArtifactRef(ociURL)
 	if err != nil {
 		return nil, err
@@ -55,6 +78,17 @@ func PullModule(ociURL, dstPath, cacheDir string, opts []crane.Option) (*apiv1.M
 		return nil, fmt.Errorf("pulling artifact manifest failed: %w", err)
 	}
 
+	// Verify the manifest content against the digest returned by the registry,
+	// and against the digest specified in the URL if the module is pinned.
+	if err := verifyDigest(ociURL, digest, bytes.NewReader(manifestJSON)); err != nil {
+		return nil, err
+	}
+	if pinned, ok := ref.(name.Digest); ok {
+		if err := verifyDigest(ociURL, pinned.DigestStr(), bytes.NewReader(manifestJSON)); err != nil {
+			return nil, err
+		}
+	}
+
 	manifest, err := gcrv1.ParseManifest(bytes.NewReader(manifestJSON))
 	if err != nil {
 		return nil, fmt.Errorf("parsing artifact manifest failed: %w", err)
@@ -81,16 +115,6 @@ func PullModule(ociURL, dstPath, cacheDir string, opts []crane.Option) (*apiv1.M
 		Annotations: manifest.Annotations,
 	}
 
-	// If caching is disable, download the compressed layers to an ephemeral tmp dir.
-	if cacheDir == "" {
-		tmpDir, err := os.MkdirTemp("", apiv1.FieldManager)
-		if err != nil {
-			return nil, err
-		}
-		defer os.RemoveAll(tmpDir)
-		cacheDir = tmpDir
-	}
-
 	var foundLayer bool
 	for _, layer := range manifest.Layers {
 		if layer.MediaType == apiv1.ContentMediaType {
@@ -98,37 +122,9 @@ func PullModule(ociURL, dstPath, cacheDir string, opts []crane.Option) (*apiv1.M
 			layerDigest := layer.Digest.String()
 			blobURL := fmt.Sprintf("%s@%s", repoURL, layerDigest)
 
-			isCached := false
-			cachedLayer := path.Join(cacheDir, fmt.Sprintf("%s.tgz", layer.Digest.Hex))
-			if _, err := os.Stat(cachedLayer); err == nil {
-				isCached = true
-			}
-
-			// Pull the compressed layer from the registry and persist the gzip tarball
-			// in the cache at '<cache-dir>/<layer-digest-hex>.tgz'.
-			if !isCached {
-				layer, err := crane.PullLayer(blobURL, opts...)
-				if err != nil {
-					return nil, fmt.Errorf("pulling layer %s failed: %w", layerDigest, err)
-				}
-
-				remote, err := layer.Compressed()
-				if err != nil {
-					return nil, fmt.Errorf("pulling layer %s failed: %w", layerDigest, err)
-				}
-
-				local, err := os.Create(cachedLayer)
-				if err != nil {
-					return nil, fmt.Errorf("writing layer to storage failed: %w", err)
-				}
-
-				if _, err := io.Copy(local, remote); err != nil {
-					return nil, fmt.Errorf("writing layer to storage failed: %w", err)
-				}
-
-				if err := local.Close(); err != nil {
-					return nil, fmt.Errorf("writing layer to storage failed: %w", err)
-				}
+			cachedLayer, err := cache.fetch(repoURL, layer.Digest, opts)
+			if err != nil {
+				return nil, err
 			}
 
 			reader, err := os.Open(cachedLayer)
@@ -136,11 +132,23 @@ func PullModule(ociURL, dstPath, cacheDir string, opts []crane.Option) (*apiv1.M
 				return nil, fmt.Errorf("reading layer from storage failed: %w", err)
 			}
 
-			// Extract the contents from the gzip tarball stored in cache.
-			// If extraction fails, the gzip tarball is removed from cache.
-			if err = tar.Untar(reader, dstPath, tar.WithMaxUntarSize(-1)); err != nil {
+			// Verify the layer content against the manifest digest.
+			// If verification fails, the gzip tarball is removed from cache.
+			if err := verifyDigest(blobURL, layerDigest, reader); err != nil {
+				_ = reader.Close()
+				cache.remove(layer.Digest)
+				return nil, err
+			}
+			if _, err := reader.Seek(0, io.SeekStart); err != nil {
 				_ = reader.Close()
-				_ = os.Remove(cachedLayer)
+				return nil, fmt.Errorf("reading layer from storage failed: %w", err)
+			}
+
+			// Extract the contents from the tarball stored in cache.
+			// If extraction fails, the tarball is removed from cache.
+			if err = untarLayer(reader, dstPath); err != nil {
+				_ = reader.Close()
+				cache.remove(layer.Digest)
 				return nil, fmt.Errorf("extracting layer %s failed: %w", layerDigest, err)
 			}
 
@@ -156,3 +164,18 @@ func PullModule(ociURL, dstPath, cacheDir string, opts []crane.Option) (*apiv1.M
 
 	return moduleRef, nil
 }
+
+// verifyDigest computes the SHA256 digest of the content
+// and returns an error if it doesn't match the expected digest.
+func verifyDigest(ociURL, expected string, content io.Reader) error {
+	hash, _, err := gcrv1.SHA256(content)
+	if err != nil {
+		return fmt.Errorf("computing digest of '%s' failed: %w", ociURL, err)
+	}
+
+	if hash.String() != expected {
+		return fmt.Errorf("digest mismatch for '%s': expected %s, computed %s", ociURL, expected, hash.String())
+	}
+
+	return nil
+}
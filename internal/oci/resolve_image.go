@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// ResolveImageDigest returns the digest of the given container image reference.
+// If the reference contains a digest, it is returned without querying the registry,
+// otherwise the digest of the tag is fetched from the remote registry.
+func ResolveImageDigest(imageRef string, opts []crane.Option) (string, error) {
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return "", fmt.Errorf("'%s' invalid image reference: %w", imageRef, err)
+	}
+
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+
+	digest, err := crane.Digest(ref.String(), opts...)
+	if err != nil {
+		return "", fmt.Errorf("resolving digest of '%s' failed: %w", imageRef, err)
+	}
+
+	return digest, nil
+}
+
+// ResolveArtifactDigest returns the digest of the artifact from the given OpenContainers URL.
+// If the URL contains a digest, it is returned without querying the registry,
+// otherwise the digest of the tag is fetched from the remote registry.
+func ResolveArtifactDigest(ociURL string, opts []crane.Option) (string, error) {
+	ref, err := parseArtifactRef(ociURL)
+	if err != nil {
+		return "", err
+	}
+
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+
+	digest, err := crane.Digest(ref.String(), opts...)
+	if err != nil {
+		return "", fmt.Errorf("resolving digest of '%s' failed: %w", ociURL, err)
+	}
+
+	return digest, nil
+}
+
+// CheckArtifact returns an error if the manifest of the artifact
+// from the given OpenContainers URL is not found in the remote registry.
+func CheckArtifact(ociURL string, opts []crane.Option) error {
+	ref, err := parseArtifactRef(ociURL)
+	if err != nil {
+		return err
+	}
+
+	if _, err := crane.Head(ref.String(), opts...); err != nil {
+		return fmt.Errorf("resolving '%s' failed: %w", ociURL, err)
+	}
+
+	return nil
+}
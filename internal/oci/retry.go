@@ -0,0 +1,137 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// RetryOptions holds the settings for retrying registry operations
+// that fail with transient errors.
+type RetryOptions struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+
+	// Delay is the wait time after the first failed attempt,
+	// doubled after each subsequent failure.
+	Delay time.Duration
+}
+
+// DefaultRetryOptions returns the RetryOptions used when none are specified.
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{
+		Attempts: 3,
+		Delay:    time.Second,
+	}
+}
+
+// retryableStatusCodes are the registry HTTP status codes considered transient.
+var retryableStatusCodes = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// IsRetryable returns true if the error is caused by a transient registry
+// failure, like rate limiting or an unavailable service. Errors with
+// permanent status codes, like 401 or 404, are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		return retryableStatusCodes[terr.StatusCode]
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// Retry calls fn until it succeeds, returns a non-retryable error,
+// or the maximum number of attempts is reached. The wait time between
+// attempts grows exponentially starting from the base delay.
+// If fn was called more than once, the returned error
+// reports the number of attempts made.
+func Retry(ctx context.Context, opts RetryOptions, fn func() error) error {
+	attempts := max(opts.Attempts, 1)
+	delay := opts.Delay
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if attempt == attempts || !IsRetryable(err) {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// withoutStatusRetry disables the retries performed by the registry
+// client on HTTP errors, as these are handled by Retry.
+func withoutStatusRetry() crane.Option {
+	return func(o *crane.Options) {
+		o.Remote = append(o.Remote, remote.WithRetryStatusCodes())
+	}
+}
+
+// PullModuleWithRetry is like PullModuleWithCache, but it retries the
+// pull on transient registry errors according to the given options.
+func PullModuleWithRetry(ctx context.Context, ociURL, dstPath string, cache *LayerCache, opts []crane.Option, retry RetryOptions) (*apiv1.ModuleReference, error) {
+	opts = append(opts, withoutStatusRetry())
+
+	var moduleRef *apiv1.ModuleReference
+	err := Retry(ctx, retry, func() (err error) {
+		moduleRef, err = PullModuleWithCache(ociURL, dstPath, cache, opts)
+		return err
+	})
+	return moduleRef, err
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// newFlakyRegistry returns a registry proxy that responds with the given
+// status code to the first failures manifest requests, and counts them.
+func newFlakyRegistry(t *testing.T, failures int32, status int) (string, *atomic.Int32) {
+	upstream, err := url.Parse(fmt.Sprintf("http://%s", dockerRegistry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") && requests.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "http://"), &requests
+}
+
+func TestPullModuleWithRetry(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	opts := Options(ctx, "", false)
+
+	modName := rnd("my-module", 5)
+	_, err := PushModule(fmt.Sprintf("oci://%s/%s:1.0.0", dockerRegistry, modName),
+		"testdata/module/", nil, nil, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	retry := RetryOptions{Attempts: 3, Delay: time.Millisecond}
+
+	t.Run("succeeds after transient errors", func(t *testing.T) {
+		g := NewWithT(t)
+		registry, requests := newFlakyRegistry(t, 2, http.StatusServiceUnavailable)
+		dstPath := t.TempDir()
+
+		mr, err := PullModuleWithRetry(ctx, fmt.Sprintf("oci://%s/%s:1.0.0", registry, modName),
+			dstPath, nil, opts, retry)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(mr.Digest).ToNot(BeEmpty())
+		g.Expect(filepath.Join(dstPath, "timoni.cue")).To(BeAnExistingFile())
+		g.Expect(requests.Load()).To(BeNumerically(">", 2))
+	})
+
+	t.Run("reports the attempts made", func(t *testing.T) {
+		g := NewWithT(t)
+		registry, _ := newFlakyRegistry(t, 100, http.StatusTooManyRequests)
+
+		_, err := PullModuleWithRetry(ctx, fmt.Sprintf("oci://%s/%s:1.0.0", registry, modName),
+			t.TempDir(), nil, opts, retry)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(HavePrefix("failed after 3 attempts"))
+	})
+
+	t.Run("fails fast on permanent errors", func(t *testing.T) {
+		g := NewWithT(t)
+		registry, _ := newFlakyRegistry(t, 100, http.StatusUnauthorized)
+
+		_, err := PullModuleWithRetry(ctx, fmt.Sprintf("oci://%s/%s:1.0.0", registry, modName),
+			t.TempDir(), nil, opts, retry)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("401 Unauthorized"))
+		g.Expect(err.Error()).ToNot(ContainSubstring("attempts"))
+	})
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/fluxcd/pkg/tar"
+)
+
+// gzipMagic is the header of a gzip stream as defined in RFC 1952.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// untarLayer extracts the layer tarball to the destination directory.
+// The compression is detected from the content, regardless of the media type
+// declared in the manifest, plain tarballs are compressed on the fly
+// so that they are extracted with the same safety checks.
+func untarLayer(r io.Reader, dstPath string) error {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if bytes.Equal(header, gzipMagic) {
+		return tar.Untar(br, dstPath, tar.WithMaxUntarSize(-1))
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		gw := gzip.NewWriter(pw)
+		_, err := io.Copy(gw, br)
+		if err == nil {
+			err = gw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+
+	return tar.Untar(pr, dstPath, tar.WithMaxUntarSize(-1))
+}
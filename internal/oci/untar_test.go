@@ -0,0 +1,73 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUntarLayer(t *testing.T) {
+	g := NewWithT(t)
+
+	var plain bytes.Buffer
+	tw := tar.NewWriter(&plain)
+	content := []byte("package main\n")
+	g.Expect(tw.WriteHeader(&tar.Header{
+		Name:     "module/timoni.cue",
+		Mode:     0o600,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	})).To(Succeed())
+	_, err := tw.Write(content)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tw.Close()).To(Succeed())
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err = gw.Write(plain.Bytes())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(gw.Close()).To(Succeed())
+
+	for name, layer := range map[string][]byte{
+		"gzip":  compressed.Bytes(),
+		"plain": plain.Bytes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			g := NewWithT(t)
+			dstPath := t.TempDir()
+
+			g.Expect(untarLayer(bytes.NewReader(layer), dstPath)).To(Succeed())
+
+			data, err := os.ReadFile(filepath.Join(dstPath, "module", "timoni.cue"))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(data).To(Equal(content))
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		g := NewWithT(t)
+		err := untarLayer(bytes.NewReader([]byte("not a tarball")), t.TempDir())
+		g.Expect(err).To(HaveOccurred())
+	})
+}
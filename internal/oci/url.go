@@ -45,6 +45,17 @@ func ParseRepositoryURL(ociURL string) (string, error) {
 	return ref.Context().Name(), nil
 }
 
+// PinDigest returns the OpenContainers URL of the artifact with the given digest
+// from the same repository, in the format 'oci://<domain>/<org>/<repo>@<digest>'.
+func PinDigest(ociURL, digest string) (string, error) {
+	ref, err := parseArtifactRef(ociURL)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%s", apiv1.ArtifactPrefix, ref.Context().Digest(digest).String()), nil
+}
+
 // ParseDigest extracts the digest from the OpenContainers URL.
 func ParseDigest(ociURL string) (name.Digest, error) {
 	ref, err := parseArtifactRef(ociURL)
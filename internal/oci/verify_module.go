@@ -0,0 +1,72 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/crane"
+)
+
+// VerifyOptions holds the trusted signers of the modules.
+type VerifyOptions struct {
+	// Key is the path or the KMS URI of the Cosign public key that signed the modules.
+	Key string
+
+	// Identity is the certificate identity expected in the Cosign keyless signature.
+	Identity string
+
+	// IdentityRegexp is a regular expression alternative to Identity.
+	IdentityRegexp string
+
+	// OIDCIssuer is the OIDC issuer of the certificate identity.
+	OIDCIssuer string
+
+	// OIDCIssuerRegexp is a regular expression alternative to OIDCIssuer.
+	OIDCIssuerRegexp string
+}
+
+// Enabled returns true if a trusted key or identity is set.
+func (o VerifyOptions) Enabled() bool {
+	return o.Key != "" || o.Identity != "" || o.IdentityRegexp != ""
+}
+
+// VerifyModule verifies with the cosign binary that the artifact from the given
+// OpenContainers URL has a valid Cosign signature made with the trusted key or identity.
+// The tag is resolved to a digest before the verification, and the verified digest is
+// returned, so that the module can be pulled by digest, as the tag could be moved to
+// a different artifact after the verification.
+func VerifyModule(log logr.Logger, ociURL string, verify VerifyOptions, opts []crane.Option) (string, error) {
+	ref, err := parseArtifactRef(ociURL)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := crane.Digest(ref.String(), opts...)
+	if err != nil {
+		return "", fmt.Errorf("resolving digest of '%s' failed: %w", ociURL, err)
+	}
+
+	digestRef := ref.Context().Digest(digest).String()
+	if err := VerifyCosign(log, digestRef, verify.Key,
+		verify.Identity, verify.IdentityRegexp, verify.OIDCIssuer, verify.OIDCIssuerRegexp); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
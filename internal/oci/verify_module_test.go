@@ -0,0 +1,124 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/crane"
+	. "github.com/onsi/gomega"
+)
+
+func TestVerifyModule(t *testing.T) {
+	g := NewWithT(t)
+	tmpDir := t.TempDir()
+	opts := Options(context.Background(), "", false)
+
+	// fakeCosign writes a cosign executable to PATH that records its
+	// arguments and fails if the verified reference is not pinned to the digest.
+	argsFile := filepath.Join(tmpDir, "cosign-args")
+	fakeCosign := func(g *WithT, digest string) {
+		binDir := t.TempDir()
+		content := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\ncase \"$*\" in *@%s) exit 0;; *) echo 'no matching signatures' >&2; exit 1;; esac\n",
+			argsFile, digest)
+		g.Expect(os.WriteFile(filepath.Join(binDir, "cosign"), []byte(content), 0755)).To(Succeed())
+		t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+
+	cosignArgs := func(g *WithT) string {
+		data, err := os.ReadFile(argsFile)
+		g.Expect(err).ToNot(HaveOccurred())
+		return string(data)
+	}
+
+	moduleURL := fmt.Sprintf("oci://%s/%s:1.0.0", dockerRegistry, rnd("signed", 5))
+	_, err := PushModule(moduleURL, "testdata/module/", nil, nil, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ref, err := parseArtifactRef(moduleURL)
+	g.Expect(err).ToNot(HaveOccurred())
+	moduleDigest, err := crane.Digest(ref.String(), opts...)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	t.Run("verifies the digest with a key", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeCosign(g, moduleDigest)
+
+		digest, err := VerifyModule(logr.Discard(), moduleURL, VerifyOptions{Key: "cosign.pub"}, opts)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(digest).To(Equal(moduleDigest))
+		g.Expect(cosignArgs(g)).To(Equal(fmt.Sprintf("verify --key cosign.pub %s\n", ref.Context().Digest(moduleDigest))))
+	})
+
+	t.Run("verifies the digest with an identity", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeCosign(g, moduleDigest)
+
+		verify := VerifyOptions{
+			Identity:   "https://github.com/org/repo/.github/workflows/release.yaml@refs/tags/v1.0.0",
+			OIDCIssuer: "https://token.actions.githubusercontent.com",
+		}
+		digest, err := VerifyModule(logr.Discard(), moduleURL, verify, opts)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(digest).To(Equal(moduleDigest))
+		g.Expect(cosignArgs(g)).To(ContainSubstring("--certificate-identity " + verify.Identity))
+		g.Expect(cosignArgs(g)).To(ContainSubstring("--certificate-oidc-issuer " + verify.OIDCIssuer))
+	})
+
+	t.Run("fails for invalid signature", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeCosign(g, "sha256:0000")
+
+		_, err := VerifyModule(logr.Discard(), moduleURL, VerifyOptions{Key: "cosign.pub"}, opts)
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("fails for keyless without issuer", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeCosign(g, moduleDigest)
+
+		_, err := VerifyModule(logr.Discard(), moduleURL, VerifyOptions{Identity: "user@example.com"}, opts)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("--certificate-oidc-issuer"))
+	})
+
+	t.Run("pulls the verified digest after the tag is moved", func(t *testing.T) {
+		g := NewWithT(t)
+		fakeCosign(g, moduleDigest)
+
+		digest, err := VerifyModule(logr.Discard(), moduleURL, VerifyOptions{Key: "cosign.pub"}, opts)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		// Move the tag to an unsigned artifact between the verification and the pull.
+		_, err = PushModule(moduleURL, "testdata/module/", nil, map[string]string{"moved": "true"}, opts)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		pinnedURL, err := PinDigest(moduleURL, digest)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(pinnedURL).To(HaveSuffix("@" + digest))
+
+		mod, err := PullModule(pinnedURL, filepath.Join(tmpDir, "module"), "", opts)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(mod.Digest).To(Equal(digest))
+		g.Expect(mod.Annotations).ToNot(HaveKey("moved"))
+	})
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/fluxcd/pkg/ssa"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// ApplyOrderGroups groups the objects by the value of the apply order annotation,
+// with the groups sorted in ascending order. The objects without the annotation
+// have the order 0, and the objects in a group keep their relative order.
+func ApplyOrderGroups(objects []*unstructured.Unstructured) ([][]*unstructured.Unstructured, error) {
+	byOrder := make(map[int][]*unstructured.Unstructured)
+	for _, object := range objects {
+		order := 0
+		if value, ok := object.GetAnnotations()[apiv1.ApplyOrderAnnotation]; ok {
+			var err error
+			order, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s invalid %s annotation %q: must be an integer",
+					ssa.FmtUnstructured(object), apiv1.ApplyOrderAnnotation, value)
+			}
+		}
+		byOrder[order] = append(byOrder[order], object)
+	}
+
+	orders := make([]int, 0, len(byOrder))
+	for order := range byOrder {
+		orders = append(orders, order)
+	}
+	sort.Ints(orders)
+
+	groups := make([][]*unstructured.Unstructured, 0, len(orders))
+	for _, order := range orders {
+		groups = append(groups, byOrder[order])
+	}
+	return groups, nil
+}
+
+// ApplyAllOrdered applies the objects grouped by their apply order annotation,
+// waiting for a group to be applied before applying the next one.
+// Within a group, the objects are applied in stages based on their kind.
+func ApplyAllOrdered(ctx context.Context, rm *ssa.ResourceManager, objects []*unstructured.Unstructured,
+	opts ssa.ApplyOptions) (*ssa.ChangeSet, error) {
+	groups, err := ApplyOrderGroups(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	changeSet := ssa.NewChangeSet()
+	for _, group := range groups {
+		cs, err := rm.ApplyAllStaged(ctx, group, opts)
+		if err != nil {
+			return nil, err
+		}
+		changeSet.Append(cs.Entries)
+	}
+	return changeSet, nil
+}
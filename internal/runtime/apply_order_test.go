@@ -0,0 +1,86 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+func newOrderedObject(kind, name, order string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind(kind)
+	u.SetName(name)
+	if order != "" {
+		u.SetAnnotations(map[string]string{apiv1.ApplyOrderAnnotation: order})
+	}
+	return u
+}
+
+func TestApplyOrderGroups(t *testing.T) {
+	groupNames := func(groups [][]*unstructured.Unstructured) [][]string {
+		var names [][]string
+		for _, group := range groups {
+			var list []string
+			for _, object := range group {
+				list = append(list, object.GetName())
+			}
+			names = append(names, list)
+		}
+		return names
+	}
+
+	t.Run("sorts objects by annotation", func(t *testing.T) {
+		g := NewWithT(t)
+		groups, err := ApplyOrderGroups([]*unstructured.Unstructured{
+			newOrderedObject("ConfigMap", "second", "10"),
+			newOrderedObject("ConfigMap", "first", "-1"),
+			newOrderedObject("ConfigMap", "default", ""),
+			newOrderedObject("Secret", "also-second", "10"),
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(groupNames(groups)).To(Equal([][]string{
+			{"first"},
+			{"default"},
+			{"second", "also-second"},
+		}))
+	})
+
+	t.Run("keeps a single group without annotations", func(t *testing.T) {
+		g := NewWithT(t)
+		groups, err := ApplyOrderGroups([]*unstructured.Unstructured{
+			newOrderedObject("ConfigMap", "a", ""),
+			newOrderedObject("Namespace", "b", ""),
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(groupNames(groups)).To(Equal([][]string{{"a", "b"}}))
+	})
+
+	t.Run("fails on invalid annotation", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := ApplyOrderGroups([]*unstructured.Unstructured{
+			newOrderedObject("ConfigMap", "a", "first"),
+		})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(`invalid timoni.sh/apply-order annotation "first"`))
+	})
+}
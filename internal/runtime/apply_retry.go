@@ -0,0 +1,118 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ApplyRetryOptions holds the settings for retrying the apply
+// of an instance when the API server returns a transient error.
+type ApplyRetryOptions struct {
+	// Retries is the number of retries after the first failed attempt.
+	Retries int
+
+	// Delay is the wait time after the first failed attempt,
+	// doubled after each subsequent failure.
+	Delay time.Duration
+
+	// OnRetry is called before waiting for the next attempt.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// IsTransientApplyError returns true if the apply error is caused by a condition
+// that may resolve by itself, like an admission webhook that is not ready yet or
+// an API server that is temporarily unavailable. Validation, authorization and
+// field ownership conflict errors are permanent and are not retried.
+func IsTransientApplyError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	switch {
+	case apierrors.IsServiceUnavailable(err),
+		apierrors.IsServerTimeout(err),
+		apierrors.IsTimeout(err),
+		apierrors.IsTooManyRequests(err),
+		apierrors.IsInternalError(err):
+		return true
+	case apierrors.IsInvalid(err),
+		apierrors.IsBadRequest(err),
+		apierrors.IsForbidden(err),
+		apierrors.IsUnauthorized(err),
+		apierrors.IsConflict(err):
+		return false
+	}
+
+	// The admission webhooks that can't be reached are reported
+	// with the InternalError reason, or as plain errors by older servers.
+	if strings.Contains(err.Error(), "failed calling webhook") {
+		return true
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// RetryApply calls fn until it succeeds, returns a permanent error, or the
+// number of retries is exhausted. The wait time between attempts grows
+// exponentially starting from the base delay. If fn was called more than once,
+// the returned error reports the number of attempts made.
+func RetryApply(ctx context.Context, opts ApplyRetryOptions, fn func() error) error {
+	delay := opts.Delay
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if attempt > opts.Retries || !IsTransientApplyError(err) {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("apply failed after %d attempts: %w", attempt, err)
+		}
+
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("apply failed after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestIsTransientApplyError(t *testing.T) {
+	g := NewWithT(t)
+	gr := schema.GroupResource{Resource: "configmaps"}
+
+	g.Expect(IsTransientApplyError(apierrors.NewServiceUnavailable("unavailable"))).To(BeTrue())
+	g.Expect(IsTransientApplyError(apierrors.NewInternalError(errors.New(`failed calling webhook "validate.example.com"`)))).To(BeTrue())
+	g.Expect(IsTransientApplyError(apierrors.NewTooManyRequests("slow down", 1))).To(BeTrue())
+	g.Expect(IsTransientApplyError(errors.New(`failed calling webhook "validate.example.com": connection refused`))).To(BeTrue())
+
+	g.Expect(IsTransientApplyError(nil)).To(BeFalse())
+	g.Expect(IsTransientApplyError(context.DeadlineExceeded)).To(BeFalse())
+	g.Expect(IsTransientApplyError(apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "app", field.ErrorList{}))).To(BeFalse())
+	g.Expect(IsTransientApplyError(apierrors.NewForbidden(gr, "app", errors.New("denied")))).To(BeFalse())
+	g.Expect(IsTransientApplyError(apierrors.NewConflict(gr, "app", errors.New("conflict")))).To(BeFalse())
+}
+
+func TestRetryApply(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+		},
+	}
+
+	// newFailingClient returns a fake client that fails the
+	// first create calls with the given error.
+	newFailingClient := func(failures int, failErr error) (client.Client, *int) {
+		calls := 0
+		c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				calls++
+				if calls <= failures {
+					return failErr
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		}).Build()
+		return c, &calls
+	}
+
+	t.Run("applies after transient failures", func(t *testing.T) {
+		g := NewWithT(t)
+		webhookErr := apierrors.NewInternalError(errors.New(`failed calling webhook "validate.example.com"`))
+		c, calls := newFailingClient(2, webhookErr)
+
+		var retries []int
+		opts := ApplyRetryOptions{
+			Retries: 3,
+			Delay:   time.Millisecond,
+			OnRetry: func(attempt int, _ time.Duration, _ error) {
+				retries = append(retries, attempt)
+			},
+		}
+
+		err := RetryApply(context.Background(), opts, func() error {
+			return c.Create(context.Background(), cm.DeepCopy())
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(*calls).To(Equal(3))
+		g.Expect(retries).To(Equal([]int{1, 2}))
+
+		applied := &corev1.ConfigMap{}
+		g.Expect(c.Get(context.Background(), client.ObjectKeyFromObject(cm), applied)).To(Succeed())
+	})
+
+	t.Run("fails when the retries are exhausted", func(t *testing.T) {
+		g := NewWithT(t)
+		c, calls := newFailingClient(3, apierrors.NewServiceUnavailable("unavailable"))
+
+		err := RetryApply(context.Background(), ApplyRetryOptions{Retries: 1, Delay: time.Millisecond}, func() error {
+			return c.Create(context.Background(), cm.DeepCopy())
+		})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("apply failed after 2 attempts"))
+		g.Expect(*calls).To(Equal(2))
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		g := NewWithT(t)
+		invalidErr := apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "app", field.ErrorList{})
+		c, calls := newFailingClient(1, invalidErr)
+
+		err := RetryApply(context.Background(), ApplyRetryOptions{Retries: 3, Delay: time.Millisecond}, func() error {
+			return c.Create(context.Background(), cm.DeepCopy())
+		})
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		g.Expect(*calls).To(Equal(1))
+	})
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// WaitForDeletion polls the cluster at the given interval, until all the objects
+// are removed or the context is done. When the context expires, the error lists
+// the objects still present in the cluster together with their pending finalizers.
+func WaitForDeletion(ctx context.Context, reader client.Reader, objects []*unstructured.Unstructured,
+	interval time.Duration) error {
+	var stuck []string
+	pollErr := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		stuck = nil
+		for _, object := range objects {
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(object.GroupVersionKind())
+			if err := reader.Get(ctx, client.ObjectKeyFromObject(object), live); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return false, err
+			}
+
+			pending := ssa.FmtUnstructured(object)
+			if finalizers := live.GetFinalizers(); len(finalizers) > 0 {
+				pending += fmt.Sprintf(" (finalizers: %s)", strings.Join(finalizers, ", "))
+			}
+			stuck = append(stuck, pending)
+		}
+		return len(stuck) == 0, nil
+	})
+	if pollErr != nil && len(stuck) > 0 && ctx.Err() != nil {
+		return fmt.Errorf("timeout waiting for deletion: %s", strings.Join(stuck, ", "))
+	}
+	return pollErr
+}
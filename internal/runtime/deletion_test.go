@@ -0,0 +1,98 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestWaitForDeletion(t *testing.T) {
+	finalizer := "example.com/cleanup"
+
+	// deletedObject creates a ConfigMap with a finalizer and deletes it,
+	// leaving the object in the cluster until the finalizer is removed.
+	deletedObject := func(g *WithT, c client.Client) *unstructured.Unstructured {
+		u, err := ToUnstructured(&corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "data",
+				Namespace:  "default",
+				Finalizers: []string{finalizer},
+			},
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(c.Create(context.Background(), u.DeepCopy())).To(Succeed())
+		g.Expect(c.Delete(context.Background(), u.DeepCopy())).To(Succeed())
+		return u
+	}
+
+	t.Run("waits for the finalizers to complete", func(t *testing.T) {
+		g := NewWithT(t)
+
+		// The finalizer is removed when the object is read for the third time,
+		// the object is reported as deleted from the fourth read.
+		gets := 0
+		c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				gets++
+				if err := c.Get(ctx, key, obj, opts...); err != nil {
+					return err
+				}
+				if gets == 3 {
+					obj.SetFinalizers(nil)
+					return c.Update(ctx, obj)
+				}
+				return nil
+			},
+		}).Build()
+		object := deletedObject(g, c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := WaitForDeletion(ctx, c, []*unstructured.Unstructured{object}, 10*time.Millisecond)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(gets).To(Equal(4))
+
+		err = c.Get(context.Background(), client.ObjectKeyFromObject(object), &corev1.ConfigMap{})
+		g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("reports the objects stuck with finalizers", func(t *testing.T) {
+		g := NewWithT(t)
+		c := fake.NewClientBuilder().Build()
+		object := deletedObject(g, c)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := WaitForDeletion(ctx, c, []*unstructured.Unstructured{object}, 10*time.Millisecond)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("timeout waiting for deletion: ConfigMap/default/data (finalizers: example.com/cleanup)"))
+	})
+}
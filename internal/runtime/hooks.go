@@ -0,0 +1,153 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fluxcd/cli-utils/pkg/kstatus/status"
+	"github.com/fluxcd/pkg/ssa"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// Hooks holds the objects of an instance annotated as pre-apply and post-apply hooks.
+type Hooks struct {
+	// PreApply are the objects applied and awaited before the instance objects.
+	PreApply []*unstructured.Unstructured
+
+	// PostApply are the objects applied and awaited after the instance objects.
+	PostApply []*unstructured.Unstructured
+}
+
+// Add appends the given hooks to the existing ones.
+func (h *Hooks) Add(hooks Hooks) {
+	h.PreApply = append(h.PreApply, hooks.PreApply...)
+	h.PostApply = append(h.PostApply, hooks.PostApply...)
+}
+
+// SplitHooks separates the objects annotated as hooks from the other objects,
+// keeping their relative order. An unknown hook annotation value results in an error.
+func SplitHooks(objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, Hooks, error) {
+	var hooks Hooks
+	var rest []*unstructured.Unstructured
+	for _, object := range objects {
+		value, ok := object.GetAnnotations()[apiv1.HookAnnotation]
+		if !ok {
+			rest = append(rest, object)
+			continue
+		}
+		switch value {
+		case apiv1.HookPreApply:
+			hooks.PreApply = append(hooks.PreApply, object)
+		case apiv1.HookPostApply:
+			hooks.PostApply = append(hooks.PostApply, object)
+		default:
+			return nil, hooks, fmt.Errorf("%s invalid %s annotation %q: must be %s or %s",
+				ssa.FmtUnstructured(object), apiv1.HookAnnotation, value, apiv1.HookPreApply, apiv1.HookPostApply)
+		}
+	}
+	return rest, hooks, nil
+}
+
+// ApplyWithHooks applies the pre-apply hooks with applyHooks and waits for them to be ready,
+// then it calls apply, and finally it applies the post-apply hooks and waits for them to be ready.
+// The hooks are awaited with WaitForHooks at the interval and up to the timeout of the wait options,
+// a failed hook aborts the apply.
+func ApplyWithHooks(ctx context.Context, reader client.Reader, hooks Hooks,
+	applyHooks func(ctx context.Context, hook string, objects []*unstructured.Unstructured) error,
+	apply func(ctx context.Context) error,
+	opts ssa.WaitOptions) error {
+	runHooks := func(hook string, objects []*unstructured.Unstructured) error {
+		if len(objects) == 0 {
+			return nil
+		}
+		if err := applyHooks(ctx, hook, objects); err != nil {
+			return fmt.Errorf("%s hooks failed: %w", hook, err)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+		if err := WaitForHooks(waitCtx, reader, objects, opts.Interval); err != nil {
+			return fmt.Errorf("%s hooks failed: %w", hook, err)
+		}
+		return nil
+	}
+
+	if err := runHooks(apiv1.HookPreApply, hooks.PreApply); err != nil {
+		return err
+	}
+	if err := apply(ctx); err != nil {
+		return err
+	}
+	return runHooks(apiv1.HookPostApply, hooks.PostApply)
+}
+
+// WaitForHooks polls the live state of the hooks at the given interval,
+// until all of them are ready or the context is done. The Jobs are ready when
+// they complete, while the readiness of the other objects is computed with kstatus.
+// A hook that fails, such as a Job that exceeds its backoff limit, results in an error.
+func WaitForHooks(ctx context.Context, reader client.Reader, hooks []*unstructured.Unstructured,
+	interval time.Duration) error {
+	var pending []string
+	pollErr := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		pending = nil
+		for _, hook := range hooks {
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(hook.GroupVersionKind())
+			if err := reader.Get(ctx, client.ObjectKeyFromObject(hook), live); err != nil {
+				if apierrors.IsNotFound(err) {
+					pending = append(pending, ssa.FmtUnstructured(hook))
+					continue
+				}
+				return false, err
+			}
+
+			result, err := hookStatus(live)
+			if err != nil {
+				return false, err
+			}
+			switch result.Status {
+			case status.CurrentStatus:
+			case status.FailedStatus:
+				return false, fmt.Errorf("%s failed: %s", ssa.FmtUnstructured(hook), result.Message)
+			default:
+				pending = append(pending, ssa.FmtUnstructured(hook))
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if pollErr != nil && len(pending) > 0 && ctx.Err() != nil {
+		return fmt.Errorf("timeout waiting for hooks: %s", strings.Join(pending, ", "))
+	}
+	return pollErr
+}
+
+// hookStatus computes the status of a live hook object.
+func hookStatus(u *unstructured.Unstructured) (*status.Result, error) {
+	if u.GroupVersionKind().GroupKind().String() == "Job.batch" {
+		return jobConditions(u)
+	}
+	return status.Compute(u)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+func TestSplitHooks(t *testing.T) {
+	g := NewWithT(t)
+
+	objects := []*unstructured.Unstructured{
+		hookObject(g, "migrate", apiv1.HookPreApply),
+		hookObject(g, "app", ""),
+		hookObject(g, "smoke-test", apiv1.HookPostApply),
+	}
+
+	rest, hooks, err := SplitHooks(objects)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rest).To(Equal(objects[1:2]))
+	g.Expect(hooks.PreApply).To(Equal(objects[0:1]))
+	g.Expect(hooks.PostApply).To(Equal(objects[2:]))
+
+	_, _, err = SplitHooks([]*unstructured.Unstructured{hookObject(g, "migrate", "pre-install")})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring(`invalid timoni.sh/hook annotation "pre-install"`))
+}
+
+func TestApplyWithHooks(t *testing.T) {
+	deployment, err := ToUnstructured(&appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitOpts := ssa.WaitOptions{Interval: 10 * time.Millisecond, Timeout: 5 * time.Second}
+
+	// newClient returns a client that reports the Job with the given
+	// condition after the Job was read for the third time.
+	newClient := func(condition batchv1.JobConditionType) (client.Client, *int) {
+		gets := 0
+		return fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if err := c.Get(ctx, key, obj, opts...); err != nil {
+					return err
+				}
+				if u, ok := obj.(*unstructured.Unstructured); ok && u.GetKind() == "Job" {
+					if gets++; gets >= 3 {
+						return unstructured.SetNestedSlice(u.Object, []interface{}{
+							map[string]interface{}{"type": string(condition), "status": "True"},
+						}, "status", "conditions")
+					}
+				}
+				return nil
+			},
+		}).Build(), &gets
+	}
+
+	t.Run("applies and awaits the pre-apply hooks first", func(t *testing.T) {
+		g := NewWithT(t)
+		c, gets := newClient(batchv1.JobComplete)
+		hooks := Hooks{PreApply: []*unstructured.Unstructured{hookObject(g, "migrate", apiv1.HookPreApply)}}
+
+		var events []string
+		applyHooks := func(ctx context.Context, hook string, objects []*unstructured.Unstructured) error {
+			for _, object := range objects {
+				events = append(events, hook+" "+ssa.FmtUnstructured(object))
+				if err := c.Create(ctx, object.DeepCopy()); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		apply := func(ctx context.Context) error {
+			// The Job is reported as completed from the third read.
+			if *gets >= 3 {
+				events = append(events, "completed")
+			}
+			events = append(events, "apply "+ssa.FmtUnstructured(deployment))
+			return nil
+		}
+
+		err := ApplyWithHooks(context.Background(), c, hooks, applyHooks, apply, waitOpts)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(events).To(Equal([]string{
+			"pre-apply Job/default/migrate",
+			"completed",
+			"apply Deployment/default/app",
+		}))
+	})
+
+	t.Run("aborts when a pre-apply hook fails", func(t *testing.T) {
+		g := NewWithT(t)
+		c, _ := newClient(batchv1.JobFailed)
+		hooks := Hooks{PreApply: []*unstructured.Unstructured{hookObject(g, "migrate", apiv1.HookPreApply)}}
+
+		applied := false
+		applyHooks := func(ctx context.Context, hook string, objects []*unstructured.Unstructured) error {
+			return c.Create(ctx, objects[0].DeepCopy())
+		}
+		apply := func(ctx context.Context) error {
+			applied = true
+			return nil
+		}
+
+		err := ApplyWithHooks(context.Background(), c, hooks, applyHooks, apply, waitOpts)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("pre-apply hooks failed: Job/default/migrate failed"))
+		g.Expect(applied).To(BeFalse())
+	})
+
+	t.Run("times out when a hook doesn't complete", func(t *testing.T) {
+		g := NewWithT(t)
+		c := fake.NewClientBuilder().Build()
+		hook := hookObject(g, "smoke-test", apiv1.HookPostApply)
+		g.Expect(c.Create(context.Background(), hook.DeepCopy())).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := WaitForHooks(ctx, c, []*unstructured.Unstructured{hook}, 10*time.Millisecond)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("timeout waiting for hooks: Job/default/smoke-test"))
+	})
+}
+
+// hookObject returns a Job annotated with the given hook, or without annotations if hook is empty.
+func hookObject(g *WithT, name, hook string) *unstructured.Unstructured {
+	job := &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{{Name: "main", Image: "busybox"}},
+				},
+			},
+		},
+	}
+	if hook != "" {
+		job.Annotations = map[string]string{apiv1.HookAnnotation: hook}
+	}
+	u, err := ToUnstructured(job)
+	g.Expect(err).ToNot(HaveOccurred())
+	return u
+}
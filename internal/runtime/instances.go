@@ -17,6 +17,7 @@ limitations under the License.
 package runtime
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"sort"
 
@@ -57,15 +58,11 @@ func (m *InstanceManager) AddObjects(objects []*unstructured.Unstructured) error
 	var entries []apiv1.ResourceRef
 	sort.Sort(ssa.SortableUnstructureds(objects))
 	for _, om := range objects {
-		objMetadata := object.UnstructuredToObjMetadata(om)
-		gv, err := schema.ParseGroupVersion(om.GetAPIVersion())
+		entry, err := resourceRefOf(om)
 		if err != nil {
 			return err
 		}
-		entries = append(entries, apiv1.ResourceRef{
-			ID:      objMetadata.String(),
-			Version: gv.Version,
-		})
+		entries = append(entries, entry)
 	}
 
 	if m.Instance.Inventory == nil {
@@ -77,6 +74,38 @@ func (m *InstanceManager) AddObjects(objects []*unstructured.Unstructured) error
 	return nil
 }
 
+// resourceRefOf returns the inventory entry of the given object.
+func resourceRefOf(om *unstructured.Unstructured) (apiv1.ResourceRef, error) {
+	objMetadata := object.UnstructuredToObjMetadata(om)
+	gv, err := schema.ParseGroupVersion(om.GetAPIVersion())
+	if err != nil {
+		return apiv1.ResourceRef{}, err
+	}
+	return apiv1.ResourceRef{
+		ID:      objMetadata.String(),
+		Version: gv.Version,
+	}, nil
+}
+
+// ObjectsDigest computes the SHA-256 digest of the given objects in the format 'sha256:<hex>'.
+// The objects are sorted in the apply order, so the digest doesn't depend on the rendering order.
+func ObjectsDigest(objects []*unstructured.Unstructured) (string, error) {
+	sorted := append([]*unstructured.Unstructured{}, objects...)
+	sort.Sort(ssa.SortableUnstructureds(sorted))
+
+	h := sha256.New()
+	for _, om := range sorted {
+		data, err := om.MarshalJSON()
+		if err != nil {
+			return "", fmt.Errorf("failed to encode %s: %w", ssa.FmtUnstructured(om), err)
+		}
+		_, _ = fmt.Fprintf(h, "%d\x00", len(data))
+		h.Write(data)
+	}
+
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
 // VersionOf returns the API version of the given object if found in this instance.
 func (m *InstanceManager) VersionOf(objMetadata object.ObjMetadata) string {
 	if inv := m.Instance.Inventory; inv != nil {
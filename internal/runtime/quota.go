@@ -0,0 +1,227 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// QuotaViolation holds a ResourceQuota limit that would be exceeded by the objects of an instance.
+type QuotaViolation struct {
+	// Quota is the name of the ResourceQuota.
+	Quota string
+
+	// Resource is the name of the quota resource, e.g. 'requests.cpu'.
+	Resource corev1.ResourceName
+
+	// Requested is the sum of the resource requested by the objects.
+	Requested resource.Quantity
+
+	// Available is the quota hard limit minus the quota used.
+	Available resource.Quantity
+}
+
+func (v QuotaViolation) String() string {
+	return fmt.Sprintf("%s requested %s exceeds the available %s of ResourceQuota/%s",
+		v.Resource, v.Requested.String(), v.Available.String(), v.Quota)
+}
+
+// CheckResourceQuotas sums the resource requests and limits of the pods created by the
+// objects in the given namespace and compares them with the ResourceQuotas of the namespace.
+// If upgrade is false, the requests are compared with the quota left unused, otherwise
+// with the quota hard limit, as the usage of the current objects is already accounted for.
+func CheckResourceQuotas(ctx context.Context, c client.Client, namespace string,
+	objects []*unstructured.Unstructured, upgrade bool) ([]QuotaViolation, error) {
+	quotas := &corev1.ResourceQuotaList{}
+	if err := c.List(ctx, quotas, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("listing resource quotas in namespace %s failed: %w", namespace, err)
+	}
+	if len(quotas.Items) == 0 {
+		return nil, nil
+	}
+
+	requested, err := ObjectsResourceUsage(objects, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []QuotaViolation
+	for _, quota := range quotas.Items {
+		names := make([]string, 0, len(quota.Spec.Hard))
+		for name := range quota.Spec.Hard {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			resourceName := corev1.ResourceName(name)
+			req, ok := requested[resourceName]
+			if !ok || req.IsZero() {
+				continue
+			}
+
+			available := quota.Spec.Hard[resourceName].DeepCopy()
+			if used, ok := quota.Status.Used[resourceName]; ok && !upgrade {
+				available.Sub(used)
+			}
+			if req.Cmp(available) > 0 {
+				violations = append(violations, QuotaViolation{
+					Quota:     quota.Name,
+					Resource:  resourceName,
+					Requested: req,
+					Available: available,
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// ObjectsResourceUsage returns the compute resources and the number of pods requested by the
+// workloads in the given namespace, or with no namespace set, using the quota resource names, e.g. 'requests.cpu'.
+// The pod resources are multiplied by the number of replicas or the job parallelism.
+func ObjectsResourceUsage(objects []*unstructured.Unstructured, namespace string) (corev1.ResourceList, error) {
+	usage := corev1.ResourceList{}
+	for _, object := range objects {
+		if ns := object.GetNamespace(); ns != "" && ns != namespace {
+			continue
+		}
+
+		spec, replicas, err := podSpecOf(object)
+		if err != nil {
+			return nil, fmt.Errorf("reading the pod spec of %s/%s failed: %w", object.GetKind(), object.GetName(), err)
+		}
+		if spec == nil || replicas == 0 {
+			continue
+		}
+
+		requests, limits := podResources(spec)
+		add := func(name corev1.ResourceName, q resource.Quantity) {
+			total := usage[name]
+			total.Add(*resource.NewMilliQuantity(q.MilliValue()*replicas, q.Format))
+			usage[name] = total
+		}
+		for name, q := range requests {
+			add("requests."+name, q)
+			if name == corev1.ResourceCPU || name == corev1.ResourceMemory {
+				add(name, q)
+			}
+		}
+		for name, q := range limits {
+			add("limits."+name, q)
+		}
+		add(corev1.ResourcePods, *resource.NewQuantity(1, resource.DecimalSI))
+	}
+	return usage, nil
+}
+
+// podSpecOf returns the pod spec of a workload and the number of pods it creates.
+// It returns a nil spec for the objects that don't create pods.
+func podSpecOf(object *unstructured.Unstructured) (*corev1.PodSpec, int64, error) {
+	var path []string
+	replicasPath := []string{"spec", "replicas"}
+	switch object.GroupVersionKind().GroupKind().String() {
+	case "Pod":
+		path = []string{"spec"}
+		replicasPath = nil
+	case "Deployment.apps", "StatefulSet.apps", "ReplicaSet.apps":
+		path = []string{"spec", "template", "spec"}
+	case "DaemonSet.apps":
+		path = []string{"spec", "template", "spec"}
+		replicasPath = nil
+	case "Job.batch":
+		path = []string{"spec", "template", "spec"}
+		replicasPath = []string{"spec", "parallelism"}
+	case "CronJob.batch":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+		replicasPath = []string{"spec", "jobTemplate", "spec", "parallelism"}
+	default:
+		return nil, 0, nil
+	}
+
+	replicas := int64(1)
+	if replicasPath != nil {
+		if r, found, err := unstructured.NestedInt64(object.Object, replicasPath...); err == nil && found {
+			replicas = r
+		}
+	}
+
+	data, found, err := unstructured.NestedMap(object.Object, path...)
+	if err != nil || !found {
+		return nil, 0, err
+	}
+
+	spec := &corev1.PodSpec{}
+	if err := apiruntime.DefaultUnstructuredConverter.FromUnstructured(data, spec); err != nil {
+		return nil, 0, err
+	}
+	return spec, replicas, nil
+}
+
+// podResources returns the effective requests and limits of a pod, which are the highest of
+// the sum of the containers resources and the resources of any init container.
+// The containers with limits and no requests are accounted with requests equal to the limits.
+func podResources(spec *corev1.PodSpec) (corev1.ResourceList, corev1.ResourceList) {
+	requests, limits := corev1.ResourceList{}, corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		for name, q := range containerRequests(container) {
+			total := requests[name]
+			total.Add(q)
+			requests[name] = total
+		}
+		for name, q := range container.Resources.Limits {
+			total := limits[name]
+			total.Add(q)
+			limits[name] = total
+		}
+	}
+
+	for _, container := range spec.InitContainers {
+		for name, q := range containerRequests(container) {
+			if q.Cmp(requests[name]) > 0 {
+				requests[name] = q
+			}
+		}
+		for name, q := range container.Resources.Limits {
+			if q.Cmp(limits[name]) > 0 {
+				limits[name] = q
+			}
+		}
+	}
+	return requests, limits
+}
+
+func containerRequests(container corev1.Container) corev1.ResourceList {
+	requests := container.Resources.Requests.DeepCopy()
+	if requests == nil {
+		requests = corev1.ResourceList{}
+	}
+	for name, q := range container.Resources.Limits {
+		if _, ok := requests[name]; !ok {
+			requests[name] = q
+		}
+	}
+	return requests
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCheckResourceQuotas(t *testing.T) {
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "compute",
+			Namespace: "default",
+		},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:    resource.MustParse("2"),
+				corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+			},
+		},
+		Status: corev1.ResourceQuotaStatus{
+			Used: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:    resource.MustParse("1"),
+				corev1.ResourceRequestsMemory: resource.MustParse("256Mi"),
+			},
+		},
+	}
+
+	replicas := int32(3)
+	deployment := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "app",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("500m"),
+								corev1.ResourceMemory: resource.MustParse("128Mi"),
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+
+	toObjects := func(g *WithT) []*unstructured.Unstructured {
+		u, err := ToUnstructured(deployment)
+		g.Expect(err).ToNot(HaveOccurred())
+		return []*unstructured.Unstructured{u}
+	}
+
+	t.Run("sums the requests of all replicas", func(t *testing.T) {
+		g := NewWithT(t)
+
+		usage, err := ObjectsResourceUsage(toObjects(g), "default")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(usage.Name(corev1.ResourceRequestsCPU, resource.DecimalSI).String()).To(Equal("1500m"))
+		g.Expect(usage.Name(corev1.ResourceRequestsMemory, resource.BinarySI).String()).To(Equal("384Mi"))
+		g.Expect(usage.Pods().String()).To(Equal("3"))
+	})
+
+	t.Run("reports the requests exceeding the unused quota", func(t *testing.T) {
+		g := NewWithT(t)
+		c := fake.NewClientBuilder().WithObjects(quota.DeepCopy()).Build()
+
+		violations, err := CheckResourceQuotas(context.Background(), c, "default", toObjects(g), false)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(violations).To(HaveLen(1))
+		g.Expect(violations[0].Resource).To(Equal(corev1.ResourceRequestsCPU))
+		g.Expect(violations[0].String()).To(
+			Equal("requests.cpu requested 1500m exceeds the available 1 of ResourceQuota/compute"))
+	})
+
+	t.Run("compares the requests with the hard limit on upgrade", func(t *testing.T) {
+		g := NewWithT(t)
+		c := fake.NewClientBuilder().WithObjects(quota.DeepCopy()).Build()
+
+		violations, err := CheckResourceQuotas(context.Background(), c, "default", toObjects(g), true)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(violations).To(BeEmpty())
+	})
+
+	t.Run("ignores the namespaces without quotas", func(t *testing.T) {
+		g := NewWithT(t)
+		c := fake.NewClientBuilder().WithObjects(quota.DeepCopy()).Build()
+
+		violations, err := CheckResourceQuotas(context.Background(), c, "apps", toObjects(g), false)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(violations).To(BeEmpty())
+	})
+}
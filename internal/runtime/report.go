@@ -0,0 +1,61 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"sort"
+
+	"github.com/fluxcd/pkg/ssa"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// NewBuildReport returns an empty build report for the given bundle.
+func NewBuildReport(bundle string) *apiv1.BuildReport {
+	return &apiv1.BuildReport{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       apiv1.BuildReportKind,
+			APIVersion: apiv1.GroupVersion.String(),
+		},
+		Bundle:  bundle,
+		Objects: []apiv1.BuildReportObject{},
+	}
+}
+
+// AddBuildReportObjects appends the objects generated by an instance to the build report.
+// The object IDs are computed in the same way as the entries of the instance inventory.
+func AddBuildReportObjects(report *apiv1.BuildReport, instance, namespace string, objects []*unstructured.Unstructured) error {
+	sort.Sort(ssa.SortableUnstructureds(objects))
+	for _, om := range objects {
+		entry, err := resourceRefOf(om)
+		if err != nil {
+			return err
+		}
+		report.Objects = append(report.Objects, apiv1.BuildReportObject{
+			ID:                entry.ID,
+			APIVersion:        om.GetAPIVersion(),
+			Kind:              om.GetKind(),
+			Name:              om.GetName(),
+			Namespace:         om.GetNamespace(),
+			Instance:          instance,
+			InstanceNamespace: namespace,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+func TestBuildReport(t *testing.T) {
+	g := NewWithT(t)
+
+	newObject := func(apiVersion, kind, name, namespace string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetName(name)
+		u.SetNamespace(namespace)
+		return u
+	}
+
+	report := NewBuildReport("my-bundle")
+	g.Expect(AddBuildReportObjects(report, "frontend", "apps", []*unstructured.Unstructured{
+		newObject("apps/v1", "Deployment", "frontend", "apps"),
+		newObject("v1", "ConfigMap", "frontend", "apps"),
+	})).To(Succeed())
+	g.Expect(AddBuildReportObjects(report, "cluster-addons", "default", []*unstructured.Unstructured{
+		newObject("v1", "Namespace", "apps", ""),
+	})).To(Succeed())
+
+	g.Expect(report.Kind).To(Equal(apiv1.BuildReportKind))
+	g.Expect(report.APIVersion).To(Equal("timoni.sh/v1alpha1"))
+	g.Expect(report.Bundle).To(Equal("my-bundle"))
+	g.Expect(report.Objects).To(Equal([]apiv1.BuildReportObject{
+		{
+			ID:                "apps_frontend__ConfigMap",
+			APIVersion:        "v1",
+			Kind:              "ConfigMap",
+			Name:              "frontend",
+			Namespace:         "apps",
+			Instance:          "frontend",
+			InstanceNamespace: "apps",
+		},
+		{
+			ID:                "apps_frontend_apps_Deployment",
+			APIVersion:        "apps/v1",
+			Kind:              "Deployment",
+			Name:              "frontend",
+			Namespace:         "apps",
+			Instance:          "frontend",
+			InstanceNamespace: "apps",
+		},
+		{
+			ID:                "_apps__Namespace",
+			APIVersion:        "v1",
+			Kind:              "Namespace",
+			Name:              "apps",
+			Instance:          "cluster-addons",
+			InstanceNamespace: "default",
+		},
+	}))
+
+	// The IDs match the entries of the instance inventory used by apply and prune.
+	im := NewInstanceManager("frontend", "apps", "", apiv1.ModuleReference{})
+	g.Expect(im.AddObjects([]*unstructured.Unstructured{
+		newObject("apps/v1", "Deployment", "frontend", "apps"),
+		newObject("v1", "ConfigMap", "frontend", "apps"),
+	})).To(Succeed())
+	for i, entry := range im.Instance.Inventory.Entries {
+		g.Expect(report.Objects[i].ID).To(Equal(entry.ID))
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package runtime
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -33,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 
 	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
 )
@@ -43,8 +45,44 @@ var ownerRef = ssa.Owner{
 	Group: fmt.Sprintf("%s.%s", strings.ToLower(apiv1.InstanceKind), apiv1.GroupVersion.Group),
 }
 
-// NewResourceManager creates a ResourceManager for the given cluster.
+// ManagerOptions holds the server-side apply ownership settings of a ResourceManager.
+type ManagerOptions struct {
+	// FieldManager is the name of the manager recorded in the objects managed fields.
+	FieldManager string
+
+	// ForceConflicts takes the ownership of the fields managed by other field managers.
+	// When disabled, the apply fails if the fields are owned by another manager.
+	ForceConflicts bool
+}
+
+// DefaultManagerOptions returns the options that apply the objects with
+// the Timoni field manager, taking the ownership of the conflicting fields.
+func DefaultManagerOptions() ManagerOptions {
+	return ManagerOptions{
+		FieldManager:   apiv1.FieldManager,
+		ForceConflicts: true,
+	}
+}
+
+// Owner returns the server-side apply owner of the configured field manager,
+// the ownership labels group is not configurable.
+func (o ManagerOptions) Owner() ssa.Owner {
+	owner := ownerRef
+	if o.FieldManager != "" {
+		owner.Field = o.FieldManager
+	}
+	return owner
+}
+
+// NewResourceManager creates a ResourceManager for the given cluster
+// with the default ownership options.
 func NewResourceManager(rcg genericclioptions.RESTClientGetter) (*ssa.ResourceManager, error) {
+	return NewResourceManagerWithOptions(rcg, DefaultManagerOptions())
+}
+
+// NewResourceManagerWithOptions creates a ResourceManager for the given cluster
+// with the specified field manager and conflicts resolution.
+func NewResourceManagerWithOptions(rcg genericclioptions.RESTClientGetter, opts ManagerOptions) (*ssa.ResourceManager, error) {
 	cfg, err := rcg.ToRESTConfig()
 	if err != nil {
 		return nil, fmt.Errorf("loading kubeconfig failed: %w", err)
@@ -59,19 +97,29 @@ func NewResourceManager(rcg genericclioptions.RESTClientGetter) (*ssa.ResourceMa
 		return nil, err
 	}
 
-	kubeClient, err := client.New(cfg, client.Options{Mapper: restMapper, Scheme: defaultScheme()})
+	kubeClient, err := client.NewWithWatch(cfg, client.Options{Mapper: restMapper, Scheme: defaultScheme()})
 	if err != nil {
 		return nil, err
 	}
 
+	// The ssa manager always forces the ownership, the option is removed
+	// from the patch requests to surface the conflicts.
+	if !opts.ForceConflicts {
+		kubeClient = interceptor.NewClient(kubeClient, interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				return c.Patch(ctx, obj, patch, withoutForceOwnership(opts)...)
+			},
+		})
+	}
+
 	kubePoller := polling.NewStatusPoller(kubeClient, restMapper, polling.Options{
 		CustomStatusReaders: []pollingEngine.StatusReader{
-			NewCustomJobStatusReader(restMapper),
+			NewWaitConditionStatusReader(restMapper, NewCustomJobStatusReader(restMapper)),
 		},
 		ClusterReaderFactory: pollingEngine.ClusterReaderFactoryFunc(clusterreader.NewDirectClusterReader),
 	})
 
-	man := ssa.NewResourceManager(kubeClient, kubePoller, ownerRef)
+	man := ssa.NewResourceManager(kubeClient, kubePoller, opts.Owner())
 
 	// bump the server-side apply concurrency
 	man.SetConcurrency(4)
@@ -79,6 +127,18 @@ func NewResourceManager(rcg genericclioptions.RESTClientGetter) (*ssa.ResourceMa
 	return man, nil
 }
 
+// withoutForceOwnership returns the patch options without the force ownership option.
+func withoutForceOwnership(opts []client.PatchOption) []client.PatchOption {
+	result := make([]client.PatchOption, 0, len(opts))
+	for _, opt := range opts {
+		if opt == client.ForceOwnership {
+			continue
+		}
+		result = append(result, opt)
+	}
+	return result
+}
+
 // SelectObjectsFromSet returns a list of Kubernetes objects from the given changeset filtered by action.
 func SelectObjectsFromSet(set *ssa.ChangeSet, action ssa.Action) []*unstructured.Unstructured {
 	var objects []*unstructured.Unstructured
@@ -112,6 +172,22 @@ func ApplyOptions(force bool, wait time.Duration) ssa.ApplyOptions {
 	}
 }
 
+// SetOwnerLabels sets the instance name and namespace labels on the given objects.
+// Unlike the ResourceManager method, it doesn't require a connection to the cluster.
+func SetOwnerLabels(objects []*unstructured.Unstructured, name, namespace string) {
+	for _, object := range objects {
+		labels := object.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+
+		labels[ownerRef.Group+"/name"] = name
+		labels[ownerRef.Group+"/namespace"] = namespace
+
+		object.SetLabels(labels)
+	}
+}
+
 // DeleteOptions returns the default options for delete operations.
 func DeleteOptions(name, namespace string) ssa.DeleteOptions {
 	return ssa.DeleteOptions{
@@ -121,7 +197,8 @@ func DeleteOptions(name, namespace string) ssa.DeleteOptions {
 			ownerRef.Group + "/namespace": namespace,
 		},
 		Exclusions: map[string]string{
-			apiv1.PruneAction: apiv1.DisabledValue,
+			apiv1.PruneAction:     apiv1.DisabledValue,
+			apiv1.PruneAnnotation: apiv1.DisabledValue,
 		},
 	}
 }
@@ -0,0 +1,51 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+func TestManagerOptions_Owner(t *testing.T) {
+	g := NewWithT(t)
+
+	defaults := DefaultManagerOptions()
+	g.Expect(defaults.ForceConflicts).To(BeTrue())
+	g.Expect(defaults.Owner().Field).To(Equal(apiv1.FieldManager))
+	g.Expect(defaults.Owner().Group).To(Equal("instance.timoni.sh"))
+
+	opts := ManagerOptions{FieldManager: "platform-ci"}
+	g.Expect(opts.Owner().Field).To(Equal("platform-ci"))
+	g.Expect(opts.Owner().Group).To(Equal(defaults.Owner().Group))
+
+	g.Expect(ManagerOptions{}.Owner().Field).To(Equal(apiv1.FieldManager))
+}
+
+func TestWithoutForceOwnership(t *testing.T) {
+	g := NewWithT(t)
+
+	opts := withoutForceOwnership([]client.PatchOption{
+		client.ForceOwnership,
+		client.FieldOwner("platform-ci"),
+	})
+	g.Expect(opts).To(Equal([]client.PatchOption{client.FieldOwner("platform-ci")}))
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/fluxcd/pkg/ssa"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+var (
+	revisionPrefix    = fmt.Sprintf("%s-revision.", apiv1.FieldManager)
+	revisionComponent = "revision"
+	revisionDataKey   = "revision"
+)
+
+// revisionMaxSize is the maximum size of the compressed revision data,
+// leaving room for the Secret metadata under the 1 MiB limit enforced by Kubernetes.
+const revisionMaxSize = 1000 * 1024
+
+// InstanceRevision holds the state of a bundle instance recorded by a bundle apply.
+type InstanceRevision struct {
+	// Revision is the bundle revision number, starting at one.
+	Revision int `json:"revision"`
+
+	// Instance is the instance storage record.
+	Instance *apiv1.Instance `json:"instance"`
+
+	// Objects are the Kubernetes objects applied on the cluster, in apply order.
+	Objects []*unstructured.Unstructured `json:"objects"`
+}
+
+// RevisionManager manages the in-cluster storage of the bundle revisions.
+// Each revision is stored as a Secret per instance, in the instance namespace.
+type RevisionManager struct {
+	resManager *ssa.ResourceManager
+}
+
+// NewRevisionManager creates a revision manager for the given cluster.
+func NewRevisionManager(resManager *ssa.ResourceManager) *RevisionManager {
+	return &RevisionManager{
+		resManager: resManager,
+	}
+}
+
+// Apply stores the instance revision of the given bundle.
+// It returns an error if the compressed revision exceeds the size limit of a Secret.
+func (r *RevisionManager) Apply(ctx context.Context, bundle string, rev *InstanceRevision) error {
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(data); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	if buf.Len() > revisionMaxSize {
+		return fmt.Errorf("failed to store revision %d of instance %s: the compressed size of %d bytes exceeds the limit of %d bytes, "+
+			"disable the bundle history with --history-limit=0", rev.Revision, rev.Instance.Name, buf.Len(), revisionMaxSize)
+	}
+
+	secret := r.newSecret(bundle, rev.Instance.Name, rev.Instance.Namespace, rev.Revision)
+	secret.Data = map[string][]byte{
+		revisionDataKey: buf.Bytes(),
+	}
+
+	opts := []client.PatchOption{
+		client.ForceOwnership,
+		client.FieldOwner(ownerRef.Field),
+	}
+	if err := r.resManager.Client().Patch(ctx, secret, client.Apply, opts...); err != nil {
+		return fmt.Errorf("failed to store revision %d of instance %s: %w", rev.Revision, rev.Instance.Name, err)
+	}
+	return nil
+}
+
+// List returns the numbers of the stored bundle revisions in ascending order.
+func (r *RevisionManager) List(ctx context.Context, bundle string) ([]int, error) {
+	secrets, err := r.listSecrets(ctx, bundle, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	var revisions []int
+	for _, secret := range secrets {
+		revision, err := strconv.Atoi(secret.Labels[apiv1.BundleRevisionLabelKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid revision label found in Secret/%s/%s: %w",
+				secret.GetNamespace(), secret.GetName(), err)
+		}
+		if !seen[revision] {
+			seen[revision] = true
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Ints(revisions)
+	return revisions, nil
+}
+
+// Latest returns the number of the last stored bundle revision, or zero if there is none.
+func (r *RevisionManager) Latest(ctx context.Context, bundle string) (int, error) {
+	revisions, err := r.List(ctx, bundle)
+	if err != nil || len(revisions) == 0 {
+		return 0, err
+	}
+	return revisions[len(revisions)-1], nil
+}
+
+// Get returns the instance revisions recorded for the given bundle revision,
+// sorted by namespace and name.
+func (r *RevisionManager) Get(ctx context.Context, bundle string, revision int) ([]*InstanceRevision, error) {
+	secrets, err := r.listSecrets(ctx, bundle, revision)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("revision %d of bundle %s not found", revision, bundle)
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		if secrets[i].Namespace != secrets[j].Namespace {
+			return secrets[i].Namespace < secrets[j].Namespace
+		}
+		return secrets[i].Name < secrets[j].Name
+	})
+
+	var res []*InstanceRevision
+	for _, secret := range secrets {
+		rev, err := r.decodeRevision(secret.Data[revisionDataKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid revision found in Secret/%s/%s: %w",
+				secret.GetNamespace(), secret.GetName(), err)
+		}
+		res = append(res, rev)
+	}
+	return res, nil
+}
+
+// Prune deletes the bundle revisions older than the last keep revisions.
+func (r *RevisionManager) Prune(ctx context.Context, bundle string, keep int) error {
+	revisions, err := r.List(ctx, bundle)
+	if err != nil {
+		return err
+	}
+	if len(revisions) <= keep {
+		return nil
+	}
+
+	for _, revision := range revisions[:len(revisions)-keep] {
+		if err := r.deleteSecrets(ctx, bundle, revision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes all the stored revisions of the given bundle.
+func (r *RevisionManager) Delete(ctx context.Context, bundle string) error {
+	return r.deleteSecrets(ctx, bundle, 0)
+}
+
+func (r *RevisionManager) deleteSecrets(ctx context.Context, bundle string, revision int) error {
+	secrets, err := r.listSecrets(ctx, bundle, revision)
+	if err != nil {
+		return err
+	}
+	for i := range secrets {
+		err := r.resManager.Client().Delete(ctx, &secrets[i])
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete Secret/%s/%s: %w", secrets[i].Namespace, secrets[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// listSecrets returns the revision Secrets of the bundle from all namespaces.
+// If revision is zero, the Secrets of all revisions are returned.
+func (r *RevisionManager) listSecrets(ctx context.Context, bundle string, revision int) ([]corev1.Secret, error) {
+	labels := client.MatchingLabels{
+		componentLabelKey:        revisionComponent,
+		createdByLabelKey:        ownerRef.Field,
+		apiv1.BundleNameLabelKey: bundle,
+	}
+	if revision > 0 {
+		labels[apiv1.BundleRevisionLabelKey] = strconv.Itoa(revision)
+	}
+
+	secretList := &corev1.SecretList{}
+	if err := r.resManager.Client().List(ctx, secretList, labels); err != nil {
+		return nil, fmt.Errorf("failed to list revisions of bundle %s: %w", bundle, err)
+	}
+	return secretList.Items, nil
+}
+
+func (r *RevisionManager) newSecret(bundle, name, namespace string, revision int) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s%s.%d", revisionPrefix, name, revision),
+			Namespace: namespace,
+			Labels: map[string]string{
+				nameLabelKey:                 name,
+				componentLabelKey:            revisionComponent,
+				createdByLabelKey:            ownerRef.Field,
+				apiv1.BundleNameLabelKey:     bundle,
+				apiv1.BundleRevisionLabelKey: strconv.Itoa(revision),
+			},
+		},
+		Type: corev1.SecretType(apiv1.RevisionStorageType),
+	}
+}
+
+func (r *RevisionManager) decodeRevision(data []byte) (*InstanceRevision, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	raw, err := io.ReadAll(gr)
+	if err != nil {
+		return nil, err
+	}
+
+	var rev InstanceRevision
+	if err := json.Unmarshal(raw, &rev); err != nil {
+		return nil, err
+	}
+	if rev.Instance == nil {
+		return nil, fmt.Errorf("instance data not found")
+	}
+	return &rev, nil
+}
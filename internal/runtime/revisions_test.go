@@ -0,0 +1,82 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/fluxcd/pkg/ssa"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+func TestRevisionManager_SizeLimit(t *testing.T) {
+	patched := false
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patched = true
+			return nil
+		},
+	}).Build()
+	revm := NewRevisionManager(ssa.NewResourceManager(c, nil, ownerRef))
+
+	newRevision := func(g *WithT, size int) *InstanceRevision {
+		// random data doesn't compress, the revision size is close to the data size
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		object, err := ToUnstructured(&corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+			Data:       map[string]string{"data": base64.StdEncoding.EncodeToString(data)},
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		return &InstanceRevision{
+			Revision: 1,
+			Instance: &apiv1.Instance{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}},
+			Objects:  []*unstructured.Unstructured{object},
+		}
+	}
+
+	t.Run("stores revisions under the limit", func(t *testing.T) {
+		g := NewWithT(t)
+		patched = false
+		g.Expect(revm.Apply(context.Background(), "bundle", newRevision(g, 1024))).To(Succeed())
+		g.Expect(patched).To(BeTrue())
+	})
+
+	t.Run("fails for revisions over the limit", func(t *testing.T) {
+		g := NewWithT(t)
+		patched = false
+		err := revm.Apply(context.Background(), "bundle", newRevision(g, 2*revisionMaxSize))
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("exceeds the limit"))
+		g.Expect(patched).To(BeFalse())
+	})
+}
@@ -73,8 +73,11 @@ func (s *StorageManager) Apply(ctx context.Context, instance *apiv1.Instance, cr
 		storageDataKey: instanceData,
 	}
 
+	// The instance labels can't override the storage owner labels.
 	for labelKey, labelValue := range instance.Labels {
-		secret.Labels[labelKey] = labelValue
+		if _, ok := secret.Labels[labelKey]; !ok {
+			secret.Labels[labelKey] = labelValue
+		}
 	}
 
 	opts := []client.PatchOption{
@@ -161,6 +164,53 @@ func (s *StorageManager) List(ctx context.Context, namespace, bundle string) ([]
 	return res, nil
 }
 
+// BundleInfo holds the summary of a bundle found in the cluster.
+type BundleInfo struct {
+	// Name is the bundle name.
+	Name string `json:"name"`
+
+	// Instances is the number of instances applied by the bundle.
+	Instances int `json:"instances"`
+
+	// LastApplied is the timestamp (UTC RFC3339) of the last instance change.
+	LastApplied string `json:"lastApplied"`
+}
+
+// ListBundles returns the bundles found in the instances storage from all
+// namespaces, sorted by name. The instances not applied by a bundle are ignored.
+func (s *StorageManager) ListBundles(ctx context.Context) ([]BundleInfo, error) {
+	instances, err := s.List(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]*BundleInfo)
+	var names []string
+	for _, instance := range instances {
+		name := instance.Labels[apiv1.BundleNameLabelKey]
+		if name == "" {
+			continue
+		}
+		info, ok := index[name]
+		if !ok {
+			info = &BundleInfo{Name: name}
+			index[name] = info
+			names = append(names, name)
+		}
+		info.Instances++
+		if instance.LastTransitionTime > info.LastApplied {
+			info.LastApplied = instance.LastTransitionTime
+		}
+	}
+
+	sort.Strings(names)
+	res := make([]BundleInfo, 0, len(names))
+	for _, name := range names {
+		res = append(res, *index[name])
+	}
+	return res, nil
+}
+
 // Delete removes the storage for the given instance name and namespace.
 func (s *StorageManager) Delete(ctx context.Context, name, namespace string) error {
 	secret := s.newSecret(name, namespace)
@@ -231,6 +281,20 @@ func (s *StorageManager) NamespaceExists(ctx context.Context, name string) (bool
 	return true, nil
 }
 
+// InstanceLabels returns the given instance labels without the storage owner labels,
+// which are added to the labels of the instances read from the storage.
+func InstanceLabels(labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels))
+	for k, v := range labels {
+		switch k {
+		case nameLabelKey, componentLabelKey, createdByLabelKey:
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
 // getOwnerLabels returns a label selector matching the storage owner.
 func (s *StorageManager) getOwnerLabels() client.MatchingLabels {
 	return client.MatchingLabels{
@@ -260,32 +324,52 @@ func (s *StorageManager) newSecret(name, namespace string) *corev1.Secret {
 
 // createNamespace creates the inventory namespace if not present.
 func (s *StorageManager) createNamespace(ctx context.Context, name string) error {
+	return s.ApplyNamespace(ctx, name, apiv1.NamespaceMetadata{}, false)
+}
+
+// ApplyNamespace creates the namespace with the given labels and annotations if not present.
+// The metadata of an existing namespace is updated only if update is true.
+func (s *StorageManager) ApplyNamespace(ctx context.Context, name string, metadata apiv1.NamespaceMetadata, update bool) error {
+	existing := &corev1.Namespace{}
+	exists := true
+	if err := s.resManager.Client().Get(ctx, client.ObjectKey{Name: name}, existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		exists = false
+	}
+
+	if exists && !update {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for k, v := range metadata.Labels {
+		labels[k] = v
+	}
+
+	// Namespaces created by other tools are not marked as created by Timoni.
+	if !exists || existing.Labels[createdByLabelKey] == ownerRef.Field {
+		labels[createdByLabelKey] = ownerRef.Field
+	}
+
 	ns := &corev1.Namespace{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
 			Kind:       "Namespace",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
-			Labels: map[string]string{
-				createdByLabelKey: ownerRef.Field,
-			},
+			Name:        name,
+			Labels:      labels,
+			Annotations: metadata.Annotations,
 		},
 	}
 
-	if err := s.resManager.Client().Get(ctx, client.ObjectKeyFromObject(ns), ns); err != nil {
-		if apierrors.IsNotFound(err) {
-			opts := []client.PatchOption{
-				client.ForceOwnership,
-				client.FieldOwner(ownerRef.Field),
-			}
-			return s.resManager.Client().Patch(ctx, ns, client.Apply, opts...)
-		} else {
-			return err
-		}
+	opts := []client.PatchOption{
+		client.ForceOwnership,
+		client.FieldOwner(ownerRef.Field),
 	}
-
-	return nil
+	return s.resManager.Client().Patch(ctx, ns, client.Apply, opts...)
 }
 
 func (s *StorageManager) decodeInstance(data []byte, objMeta metav1.ObjectMeta) (*apiv1.Instance, error) {
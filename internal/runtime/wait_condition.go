@@ -0,0 +1,152 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/fluxcd/cli-utils/pkg/kstatus/polling/engine"
+	"github.com/fluxcd/cli-utils/pkg/kstatus/polling/event"
+	kstatusreaders "github.com/fluxcd/cli-utils/pkg/kstatus/polling/statusreaders"
+	"github.com/fluxcd/cli-utils/pkg/kstatus/status"
+	"github.com/fluxcd/cli-utils/pkg/object"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+type waitConditionStatusReader struct {
+	mapper              meta.RESTMapper
+	genericStatusReader engine.StatusReader
+	defaultStatusReader engine.StatusReader
+}
+
+// NewWaitConditionStatusReader creates a reader that asserts the readiness of the objects
+// annotated with a wait condition. The status of the objects without the annotation
+// is computed by the given custom readers or by the default kstatus readers.
+func NewWaitConditionStatusReader(mapper meta.RESTMapper, statusReaders ...engine.StatusReader) engine.StatusReader {
+	return &waitConditionStatusReader{
+		mapper:              mapper,
+		genericStatusReader: kstatusreaders.NewGenericStatusReader(mapper, waitConditionStatus),
+		defaultStatusReader: kstatusreaders.NewStatusReader(mapper, statusReaders...),
+	}
+}
+
+func (w *waitConditionStatusReader) Supports(schema.GroupKind) bool {
+	return true
+}
+
+func (w *waitConditionStatusReader) ReadStatus(ctx context.Context, reader engine.ClusterReader, resource object.ObjMetadata) (*event.ResourceStatus, error) {
+	mapping, err := w.mapper.RESTMapping(resource.GroupKind)
+	if err != nil {
+		return w.defaultStatusReader.ReadStatus(ctx, reader, resource)
+	}
+
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(mapping.GroupVersionKind)
+	key := client.ObjectKey{Namespace: resource.Namespace, Name: resource.Name}
+	if err := reader.Get(ctx, key, u); err != nil {
+		// Let the default reader report the not found or the cluster errors.
+		return w.defaultStatusReader.ReadStatus(ctx, reader, resource)
+	}
+
+	return w.ReadStatusForObject(ctx, reader, u)
+}
+
+func (w *waitConditionStatusReader) ReadStatusForObject(ctx context.Context, reader engine.ClusterReader, resource *unstructured.Unstructured) (*event.ResourceStatus, error) {
+	if _, ok := resource.GetAnnotations()[apiv1.WaitConditionAnnotation]; ok {
+		return w.genericStatusReader.ReadStatusForObject(ctx, reader, resource)
+	}
+	return w.defaultStatusReader.ReadStatusForObject(ctx, reader, resource)
+}
+
+// waitConditionStatus evaluates the JSONPath expression from the wait condition annotation,
+// the object is considered ready when the expression evaluates to a non-empty value.
+func waitConditionStatus(u *unstructured.Unstructured) (*status.Result, error) {
+	condition := u.GetAnnotations()[apiv1.WaitConditionAnnotation]
+
+	jp := jsonpath.New(apiv1.WaitConditionAnnotation).AllowMissingKeys(true)
+	if err := jp.Parse(waitConditionTemplate(condition)); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation '%s': %w", apiv1.WaitConditionAnnotation, condition, err)
+	}
+
+	results, err := jp.FindResults(u.UnstructuredContent())
+	if err != nil {
+		return nil, fmt.Errorf("evaluating %s annotation '%s' failed: %w", apiv1.WaitConditionAnnotation, condition, err)
+	}
+
+	for _, result := range results {
+		for _, value := range result {
+			if value.IsValid() && !isEmptyValue(value) {
+				return &status.Result{
+					Status:     status.CurrentStatus,
+					Message:    fmt.Sprintf("Wait condition '%s' met", condition),
+					Conditions: []status.Condition{},
+				}, nil
+			}
+		}
+	}
+
+	message := fmt.Sprintf("Waiting for '%s' to be set", condition)
+	return &status.Result{
+		Status:  status.InProgressStatus,
+		Message: message,
+		Conditions: []status.Condition{
+			{
+				Type:    status.ConditionReconciling,
+				Status:  corev1.ConditionTrue,
+				Reason:  "WaitConditionNotMet",
+				Message: message,
+			},
+		},
+	}, nil
+}
+
+// waitConditionTemplate converts a field path in the format 'status.field'
+// to a JSONPath template. Templates enclosed in braces are returned as is.
+func waitConditionTemplate(condition string) string {
+	condition = strings.TrimSpace(condition)
+	if strings.HasPrefix(condition, "{") {
+		return condition
+	}
+	return fmt.Sprintf("{.%s}", strings.TrimPrefix(condition, "."))
+}
+
+// isEmptyValue reports whether the value is zero or an empty string, slice or map,
+// including values wrapped in interfaces.
+func isEmptyValue(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/fluxcd/cli-utils/pkg/kstatus/status"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+func Test_waitConditionStatus(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "lb",
+			Annotations: map[string]string{
+				apiv1.WaitConditionAnnotation: "status.loadBalancer.ingress",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeLoadBalancer,
+		},
+	}
+
+	t.Run("service without ingress returns InProgress status", func(t *testing.T) {
+		g := NewWithT(t)
+		us, err := ToUnstructured(svc)
+		g.Expect(err).ToNot(HaveOccurred())
+		result, err := waitConditionStatus(us)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result.Status).To(Equal(status.InProgressStatus))
+	})
+
+	t.Run("service with ingress returns Current status", func(t *testing.T) {
+		g := NewWithT(t)
+		svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+		us, err := ToUnstructured(svc)
+		g.Expect(err).ToNot(HaveOccurred())
+		result, err := waitConditionStatus(us)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result.Status).To(Equal(status.CurrentStatus))
+	})
+
+	t.Run("supports JSONPath templates", func(t *testing.T) {
+		g := NewWithT(t)
+		svc.Annotations[apiv1.WaitConditionAnnotation] = "{.status.loadBalancer.ingress[0].hostname}"
+		us, err := ToUnstructured(svc)
+		g.Expect(err).ToNot(HaveOccurred())
+		result, err := waitConditionStatus(us)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(result.Status).To(Equal(status.InProgressStatus))
+	})
+
+	t.Run("fails for invalid JSONPath", func(t *testing.T) {
+		g := NewWithT(t)
+		svc.Annotations[apiv1.WaitConditionAnnotation] = "{.status"
+		us, err := ToUnstructured(svc)
+		g.Expect(err).ToNot(HaveOccurred())
+		_, err = waitConditionStatus(us)
+		g.Expect(err).To(HaveOccurred())
+	})
+}
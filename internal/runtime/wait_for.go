@@ -0,0 +1,146 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fluxcd/pkg/ssa"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+// ValidateWaitCondition returns an error if the condition
+// has no kind or if its JSONPath expression can't be parsed.
+func ValidateWaitCondition(condition apiv1.WaitCondition) error {
+	if condition.Kind == "" {
+		return fmt.Errorf("wait condition '%s' has no kind", condition)
+	}
+	if _, err := parseWaitCondition(condition); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MatchWaitConditions returns the objects to which each condition applies,
+// and an error if any of the conditions doesn't match any object.
+func MatchWaitConditions(objects []*unstructured.Unstructured, conditions []apiv1.WaitCondition) ([][]*unstructured.Unstructured, error) {
+	matches := make([][]*unstructured.Unstructured, len(conditions))
+	for i, condition := range conditions {
+		for _, object := range objects {
+			if object.GetKind() != condition.Kind {
+				continue
+			}
+			if condition.Name != "" && object.GetName() != condition.Name {
+				continue
+			}
+			matches[i] = append(matches[i], object)
+		}
+		if len(matches[i]) == 0 {
+			return nil, fmt.Errorf("wait condition '%s' doesn't match any object", condition)
+		}
+	}
+	return matches, nil
+}
+
+// WaitForConditions polls the live state of the objects at the given interval,
+// until all the conditions are met or the context is done. A condition is met
+// when its JSONPath expression evaluated against each matching object returns
+// the expected value, or a non-empty value when no value is expected.
+func WaitForConditions(ctx context.Context, reader client.Reader, objects []*unstructured.Unstructured,
+	conditions []apiv1.WaitCondition, interval time.Duration) error {
+	matches, err := MatchWaitConditions(objects, conditions)
+	if err != nil {
+		return err
+	}
+
+	parsers := make([]*jsonpath.JSONPath, len(conditions))
+	for i, condition := range conditions {
+		if parsers[i], err = parseWaitCondition(condition); err != nil {
+			return err
+		}
+	}
+
+	var pending []string
+	pollErr := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		pending = nil
+		for i, condition := range conditions {
+			for _, object := range matches[i] {
+				met, err := waitConditionMet(ctx, reader, object, condition, parsers[i])
+				if err != nil {
+					return false, err
+				}
+				if !met {
+					pending = append(pending, fmt.Sprintf("%s '%s'",
+						ssa.FmtUnstructured(object), condition.JSONPath))
+				}
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if pollErr != nil && len(pending) > 0 {
+		return fmt.Errorf("timeout waiting for conditions: %s", strings.Join(pending, ", "))
+	}
+	return pollErr
+}
+
+// waitConditionMet fetches the live object and evaluates the condition against it,
+// an object that doesn't exist yet doesn't meet the condition.
+func waitConditionMet(ctx context.Context, reader client.Reader, object *unstructured.Unstructured,
+	condition apiv1.WaitCondition, jp *jsonpath.JSONPath) (bool, error) {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(object.GroupVersionKind())
+	if err := reader.Get(ctx, client.ObjectKeyFromObject(object), live); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	results, err := jp.FindResults(live.UnstructuredContent())
+	if err != nil {
+		return false, fmt.Errorf("evaluating wait condition '%s' failed: %w", condition, err)
+	}
+
+	for _, result := range results {
+		for _, value := range result {
+			if !value.IsValid() || isEmptyValue(value) {
+				continue
+			}
+			if condition.Value == "" || fmt.Sprint(value.Interface()) == condition.Value {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func parseWaitCondition(condition apiv1.WaitCondition) (*jsonpath.JSONPath, error) {
+	jp := jsonpath.New(condition.Kind).AllowMissingKeys(true)
+	if err := jp.Parse(waitConditionTemplate(condition.JSONPath)); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath in wait condition '%s': %w", condition, err)
+	}
+	return jp, nil
+}
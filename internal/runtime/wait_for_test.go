@@ -0,0 +1,116 @@
+/*
+Copyright 2024 Stefan Prodan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1 "github.com/stefanprodan/timoni/api/v1alpha1"
+)
+
+func TestValidateWaitCondition(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ValidateWaitCondition(apiv1.WaitCondition{Kind: "Pod", JSONPath: "status.phase"})).To(Succeed())
+	g.Expect(ValidateWaitCondition(apiv1.WaitCondition{Kind: "Pod", JSONPath: "{.status.phase}"})).To(Succeed())
+
+	err := ValidateWaitCondition(apiv1.WaitCondition{Kind: "Pod", JSONPath: "{.status"})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("invalid JSONPath in wait condition 'Pod:{.status'"))
+
+	g.Expect(ValidateWaitCondition(apiv1.WaitCondition{JSONPath: "status.phase"})).ToNot(Succeed())
+}
+
+func TestWaitForConditions(t *testing.T) {
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodPending},
+	}
+
+	toObjects := func(g *WithT) []*unstructured.Unstructured {
+		u, err := ToUnstructured(pod)
+		g.Expect(err).ToNot(HaveOccurred())
+		return []*unstructured.Unstructured{u}
+	}
+
+	t.Run("returns when the conditions are met", func(t *testing.T) {
+		g := NewWithT(t)
+		running := pod.DeepCopy()
+		running.Status.Phase = corev1.PodRunning
+		reader := fake.NewClientBuilder().WithObjects(running).Build()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := WaitForConditions(ctx, reader, toObjects(g), []apiv1.WaitCondition{
+			{Kind: "Pod", JSONPath: "status.phase", Value: "Running"},
+			{Kind: "Pod", Name: "app", JSONPath: "{.status.phase}"},
+		}, 10*time.Millisecond)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+
+	t.Run("times out when the value doesn't match", func(t *testing.T) {
+		g := NewWithT(t)
+		reader := fake.NewClientBuilder().WithObjects(pod.DeepCopy()).Build()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := WaitForConditions(ctx, reader, toObjects(g), []apiv1.WaitCondition{
+			{Kind: "Pod", JSONPath: "status.phase", Value: "Running"},
+		}, 10*time.Millisecond)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("timeout waiting for conditions: Pod/default/app 'status.phase'"))
+	})
+
+	t.Run("times out when the object doesn't exist", func(t *testing.T) {
+		g := NewWithT(t)
+		reader := fake.NewClientBuilder().Build()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := WaitForConditions(ctx, reader, toObjects(g), []apiv1.WaitCondition{
+			{Kind: "Pod", JSONPath: "status.phase"},
+		}, 10*time.Millisecond)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("timeout waiting for conditions"))
+	})
+
+	t.Run("fails when the condition doesn't match any object", func(t *testing.T) {
+		g := NewWithT(t)
+		reader := fake.NewClientBuilder().Build()
+
+		err := WaitForConditions(context.Background(), reader, toObjects(g), []apiv1.WaitCondition{
+			{Kind: "Pod", Name: "db", JSONPath: "status.phase"},
+		}, 10*time.Millisecond)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("wait condition 'Pod/db:status.phase' doesn't match any object"))
+	})
+}